@@ -2,9 +2,15 @@ package calc
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"math"
+	"math/big"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime/debug"
 	"strconv"
@@ -13,7 +19,6 @@ import (
 
 	"github.com/elk-language/go-prompt"
 	"github.com/ripta/reals/pkg/constructive"
-	"github.com/ripta/reals/pkg/unified"
 
 	"github.com/ripta/rt/pkg/calc/parser"
 )
@@ -37,24 +42,134 @@ const (
 
 type Calculator struct {
 	DecimalPlaces     int
+	Base              int
+	Display           string
+	Notation          string
+	SigFigs           int
+	ComplexForm       string
+	Output            string
+	IntWidth          int
+	IntUnsigned       bool
 	KeepTrailingZeros bool
 	UnderscoreZeros   bool
 	Verbose           bool
 	Trace             bool
+	// Strict stops a script at its first error, rather than reporting it
+	// and continuing with the next statement.
+	Strict bool
+
+	// Limits bounds the work done to evaluate each expression.
+	Limits parser.Limits
 
 	count   int
 	env     *parser.Env
 	history []string
+
+	// last is the most recent result, for .show cf
+	last parser.Value
+	// out, if set, replaces os.Stdout for results and command output
+	out io.Writer
+	// historyPath is the file to which REPL input is appended, if any
+	historyPath string
+	// ctx, if set, is the context in which expressions are evaluated and
+	// their results formatted, which the REPL cancels on Ctrl-C
+	ctx context.Context
+	// sources is the stack of scripts being run, as absolute paths, to
+	// resolve relative .source paths and detect cycles
+	sources []string
+}
+
+func (c *Calculator) Evaluate(expr string) (parser.Value, error) {
+	return c.EvaluateContext(c.context(), expr)
+}
+
+// EvaluateContext is Evaluate, but stops early once ctx is canceled or the
+// calculator's Limits are exceeded.
+func (c *Calculator) EvaluateContext(ctx context.Context, expr string) (parser.Value, error) {
+	c.prepareEnv()
+	return EvaluateContext(ctx, expr, c.env)
+}
+
+// context returns the context in which expressions are evaluated.
+func (c *Calculator) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// bounded returns a context for evaluating an expression and formatting its
+// result, which ends once the calculator's context does or its timeout
+// passes, so that the timeout covers both.
+func (c *Calculator) bounded() (context.Context, context.CancelFunc) {
+	if c.Limits.Timeout > 0 {
+		return context.WithTimeout(c.context(), c.Limits.Timeout)
+	}
+	return context.WithCancel(c.context())
+}
+
+// format runs fn, which formats a result, on a copy of the calculator, and
+// gives up on it once ctx is done. Formatting a real computes its digits,
+// which can take as long as evaluating it did, and cannot be stopped part
+// way, so fn is left to finish in the background; it must not write to
+// anything that outlives it.
+func (c *Calculator) format(ctx context.Context, fn func(*Calculator) error) error {
+	c.prepareEnv()
+	snapshot := *c
+	snapshot.env = c.env.WithContext(ctx)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- fn(&snapshot)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return snapshot.env.Err()
+	}
 }
 
-func (c *Calculator) Evaluate(expr string) (*unified.Real, error) {
+// display displays res, giving up once ctx is done.
+func (c *Calculator) display(ctx context.Context, res parser.Value) error {
+	var buf bytes.Buffer
+	err := c.format(ctx, func(c *Calculator) error {
+		c.out = &buf
+		c.DisplayResult(res)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.stdout().Write(buf.Bytes())
+	return err
+}
+
+// evaluateAndDisplay evaluates expr and displays its result, within the
+// calculator's limits.
+func (c *Calculator) evaluateAndDisplay(expr string) error {
+	ctx, cancel := c.bounded()
+	defer cancel()
+
+	res, err := c.EvaluateContext(ctx, expr)
+	if err != nil {
+		return err
+	}
+	return c.display(ctx, res)
+}
+
+// prepareEnv creates the environment if needed, and applies the current
+// settings to it.
+func (c *Calculator) prepareEnv() {
 	if c.env == nil {
 		c.env = parser.NewEnv()
 	}
 
 	c.env.SetDecimalPlaces(c.DecimalPlaces)
 	c.env.SetTrace(c.Trace)
-	return Evaluate(expr, c.env)
+	c.env.SetIntWidth(c.IntWidth, c.IntUnsigned)
+	c.env.SetLimits(c.Limits)
 }
 
 // processLine processes a single line of input (expression or meta-command).
@@ -68,7 +183,7 @@ func (c *Calculator) processLine(expr string, mode ExecutionMode, lineNum int) e
 	}()
 
 	expr = strings.TrimSpace(expr)
-	if expr == "" {
+	if blank(expr) {
 		return nil
 	}
 
@@ -87,24 +202,39 @@ func (c *Calculator) processLine(expr string, mode ExecutionMode, lineNum int) e
 		c.history = append(c.history, expr)
 	}
 
-	res, err := c.Evaluate(expr)
+	ctx, cancel := c.bounded()
+	defer cancel()
+
+	res, err := c.EvaluateContext(ctx, expr)
 	if err != nil {
 		c.reportError(err, mode, lineNum)
 		return err
 	}
+	if res != nil {
+		c.last = res
+	}
 
-	if mode == ModeREPL {
+	// Function definitions produce no result to remember
+	if mode == ModeREPL && res != nil {
 		c.env.SetConstant(fmt.Sprintf("$%d", c.count), res)
 	}
 
-	// ModeLoad adds to history after successful evaluation
+	// ModeLoad adds to history after successful evaluation, and warns about
+	// checks in the session that no longer hold
 	if mode == ModeLoad {
 		c.history = append(c.history, expr)
+		if res == parser.Bool(false) {
+			fmt.Fprintf(os.Stderr, "Warning: line %d: check failed: %s\n", lineNum, expr)
+		}
 	}
 
-	// Display results (except in Load mode)
+	// Display results (except in Load mode), within the same bounds as
+	// evaluation
 	if mode != ModeLoad {
-		c.DisplayResult(res)
+		if err := c.display(ctx, res); err != nil {
+			c.reportError(err, mode, lineNum)
+			return err
+		}
 	}
 
 	return nil
@@ -121,7 +251,17 @@ func (c *Calculator) reportError(err error, mode ExecutionMode, lineNum int) {
 }
 
 func (c *Calculator) Execute(expr string) {
-	defer fmt.Println()
+	defer fmt.Fprintln(c.stdout())
+	c.appendHistory(expr)
+
+	// Ctrl-C interrupts the evaluation rather than the REPL
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	c.ctx = ctx
+	defer func() {
+		c.ctx = nil
+	}()
 	c.processLine(expr, ModeREPL, 0)
 }
 
@@ -129,32 +269,173 @@ func (c *Calculator) DisplayError(err error) {
 	fmt.Fprintf(os.Stderr, "calc:%03d/ Error: %s\n", c.count, err)
 }
 
-func (c *Calculator) DisplayResult(res *unified.Real) {
-	cons := res.Constructive()
+func (c *Calculator) DisplayResult(res parser.Value) {
+	if b, ok := res.(parser.Bool); ok {
+		fmt.Fprintf(c.stdout(), "%s\n", b)
+		return
+	}
+
+	if z, ok := res.(*parser.Complex); ok {
+		c.displayComplex(z)
+		return
+	}
+
+	if l, ok := res.(*parser.List); ok {
+		c.displayList(l)
+		return
+	}
+
+	if e, ok := res.(*parser.Expr); ok {
+		fmt.Fprintf(c.stdout(), "%s\n", e)
+		return
+	}
+
+	num, ok := res.(*parser.Number)
+	if !ok {
+		return
+	}
 
 	if c.Verbose {
-		fmt.Printf("calc:%03d/ Construction: %s\n", c.count, constructive.AsConstruction(cons))
-	}
-
-	// Format the output to the specified number of decimal places. Insert an
-	// underscore after all zeroes for readability.
-	t := constructive.Text(cons, c.DecimalPlaces, 10)
-	if strings.Contains(t, ".") {
-		if t2 := strings.TrimRight(t, "0"); len(t2) < len(t) {
-			if c.UnderscoreZeros {
-				t = t2 + "_" + strings.Repeat("0", len(t)-len(t2))
-			} else if !c.KeepTrailingZeros {
-				t = strings.TrimRight(t2, ".")
-			}
+		mag, _ := num.Display()
+		fmt.Fprintf(c.stdout(), "calc:%03d/ Construction: %s\n", c.count, constructive.AsConstruction(mag.Constructive()))
+	}
+
+	t, unit := c.formatNumber(num)
+	if unit != "" {
+		t += " " + unit
+	}
+	fmt.Fprintf(c.stdout(), "%s\n", t)
+}
+
+// formatNumber formats the magnitude of num according to the display
+// settings, and returns it along with the name of its display unit.
+func (c *Calculator) formatNumber(num *parser.Number) (string, string) {
+	mag, unit := num.Display()
+
+	base := c.base()
+	t := c.formatExact(num.DisplayExact(), base)
+	if t == "" && base == 10 {
+		t = c.formatNotation(mag, num.DisplayExact())
+	}
+	if t == "" {
+		// Format the output to the specified number of decimal places, or
+		// the equivalent number of digits in the output base.
+		t = constructive.Text(mag.Constructive(), digitsForBase(c.DecimalPlaces, base), base)
+		t = withRadixPrefix(c.trimZeros(t), base)
+	}
+	return t, unit
+}
+
+// stdout returns the writer that results and command output are written to.
+func (c *Calculator) stdout() io.Writer {
+	if c.out == nil {
+		return os.Stdout
+	}
+	return c.out
+}
+
+// trimZeros removes trailing zeros after the decimal point in t, or with
+// UnderscoreZeros, inserts an underscore before them for readability.
+func (c *Calculator) trimZeros(t string) string {
+	if !strings.Contains(t, ".") {
+		return t
+	}
+
+	if t2 := strings.TrimRight(t, "0"); len(t2) < len(t) {
+		if c.UnderscoreZeros {
+			t = t2 + "_" + strings.Repeat("0", len(t)-len(t2))
+		} else if !c.KeepTrailingZeros {
+			t = strings.TrimRight(t2, ".")
+		}
+	}
+	return t
+}
+
+// formatExact formats an exact rational r according to the display mode,
+// returning the empty string if r is nil or the mode is decimal. Integers
+// are left to the decimal formatting.
+func (c *Calculator) formatExact(r *big.Rat, base int) string {
+	if r == nil || r.IsInt() || (c.Display != DisplayRational && c.Display != DisplayMixed) {
+		return ""
+	}
+
+	if c.Display == DisplayMixed {
+		// Truncate toward zero, so that the whole and fractional parts share
+		// the sign of r, as in -1 1/2
+		whole := new(big.Int).Quo(r.Num(), r.Denom())
+		if whole.Sign() != 0 {
+			frac := new(big.Rat).Sub(r, new(big.Rat).SetInt(whole))
+			return formatFraction(new(big.Rat).SetInt(whole), base) + " " + formatFraction(frac.Abs(frac), base)
 		}
 	}
+	return formatFraction(r, base)
+}
+
+// formatFraction formats r as numerator/denominator in base, or just the
+// numerator if r is an integer.
+func formatFraction(r *big.Rat, base int) string {
+	t := withRadixPrefix(r.Num().Text(base), base)
+	if r.IsInt() {
+		return t
+	}
+	return t + "/" + withRadixPrefix(r.Denom().Text(base), base)
+}
+
+// base returns the output radix, treating an unset base as decimal.
+func (c *Calculator) base() int {
+	if c.Base == 0 {
+		return 10
+	}
+	return c.Base
+}
+
+// radixPrefixes are prepended to results in bases that have literal syntax,
+// so that results can be pasted back in as input.
+var radixPrefixes = map[int]string{
+	2:  "0b",
+	8:  "0o",
+	16: "0x",
+}
+
+// withRadixPrefix inserts the literal prefix for base after any sign in t.
+func withRadixPrefix(t string, base int) string {
+	prefix, ok := radixPrefixes[base]
+	if !ok {
+		return t
+	}
 
-	fmt.Printf("%s\n", t)
+	if strings.HasPrefix(t, "-") {
+		return "-" + prefix + t[1:]
+	}
+	return prefix + t
+}
+
+// digitsForBase converts a number of decimal places into the number of
+// digits in base that carry at least the same precision.
+func digitsForBase(decimalPlaces, base int) int {
+	if base == 10 {
+		return decimalPlaces
+	}
+	return int(math.Ceil(float64(decimalPlaces) * math.Log(10) / math.Log(float64(base))))
 }
 
 func (c *Calculator) REPL() error {
+	var history []string
+	if path, err := getHistoryPath(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: history will not be saved: %v\n", err)
+	} else {
+		c.historyPath = path
+		if history, err = loadHistory(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+
 	p := prompt.New(
 		c.Execute,
+		prompt.WithCompleter(c.complete),
+		prompt.WithLexer(prompt.NewEagerLexer(c.highlight)),
+		prompt.WithHistory(history),
+		prompt.WithHistorySize(maxHistory),
 		prompt.WithPrefixCallback(func() string {
 			return fmt.Sprintf("calc:%03d> ", c.count)
 		}),
@@ -172,15 +453,30 @@ func (c *Calculator) REPL() error {
 }
 
 // ProcessSTDIN reads expressions from STDIN and evaluates them line by line.
-// This is used for non-interactive mode (e.g., piped input).
+// This is used for non-interactive mode (e.g., piped input). In JSON output,
+// every line is reported and the first error is returned at the end, as for
+// expression arguments.
 func (c *Calculator) ProcessSTDIN() error {
 	scanner := bufio.NewScanner(os.Stdin)
+	lineNum := 0
+	var firstErr error
 	for scanner.Scan() {
+		lineNum++
+
 		line := scanner.Text()
+		if c.Output == OutputJSON {
+			if err := c.processLineJSON(line, lineNum); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
 		c.processLine(line, ModeSTDIN, 0)
 	}
 
-	return scanner.Err()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return firstErr
 }
 
 type metaCommandFunc func(*Calculator, []string) error
@@ -198,8 +494,7 @@ func init() {
 			return c.handleSet(args)
 		},
 		".show": func(c *Calculator, args []string) error {
-			c.handleShow()
-			return nil
+			return c.handleShow(args)
 		},
 		".toggle": func(c *Calculator, args []string) error {
 			return c.handleToggle(args)
@@ -210,6 +505,9 @@ func init() {
 		".load": func(c *Calculator, args []string) error {
 			return c.handleLoad(args)
 		},
+		".source": func(c *Calculator, args []string) error {
+			return c.handleSource(args)
+		},
 	}
 }
 
@@ -251,7 +549,7 @@ func (c *Calculator) handleSet(args []string) error {
 				settingName, value)
 		}
 		setting.SetBool(c, v)
-		fmt.Printf("%s %s\n", settingName, formatBool(v))
+		fmt.Fprintf(c.stdout(), "%s %s\n", settingName, formatBool(v))
 
 	case SettingTypeInt:
 		v, err := strconv.Atoi(value)
@@ -264,7 +562,14 @@ func (c *Calculator) handleSet(args []string) error {
 			}
 		}
 		setting.SetInt(c, v)
-		fmt.Printf("%s set to %d\n", settingName, v)
+		fmt.Fprintf(c.stdout(), "%s set to %d\n", settingName, v)
+
+	case SettingTypeString:
+		if err := setting.validateChoice(settingName, value); err != nil {
+			return err
+		}
+		setting.SetString(c, value)
+		fmt.Fprintf(c.stdout(), "%s set to %s\n", settingName, value)
 	}
 
 	return nil
@@ -289,7 +594,7 @@ func (c *Calculator) handleToggle(args []string) error {
 	currentValue := setting.GetBool(c)
 	newValue := !currentValue
 	setting.SetBool(c, newValue)
-	fmt.Printf("calc:/ %s set to %s\n", settingName, formatBool(newValue))
+	fmt.Fprintf(c.stdout(), "calc:/ %s set to %s\n", settingName, formatBool(newValue))
 
 	return nil
 }
@@ -364,6 +669,8 @@ func (c *Calculator) handleSave(args []string) error {
 		case SettingTypeInt:
 			value := setting.GetInt(c)
 			fmt.Fprintf(w, ".set %s %d\n", name, value)
+		case SettingTypeString:
+			fmt.Fprintf(w, ".set %s %s\n", name, c.settingString(setting))
 		}
 	}
 
@@ -376,7 +683,7 @@ func (c *Calculator) handleSave(args []string) error {
 		fmt.Fprintln(w, expr)
 	}
 
-	fmt.Printf("Session saved to %s\n", filename)
+	fmt.Fprintf(c.stdout(), "Session saved to %s\n", filename)
 	return nil
 }
 
@@ -420,38 +727,131 @@ func (c *Calculator) handleLoad(args []string) error {
 		return fmt.Errorf("error reading file: %w", err)
 	}
 
-	fmt.Printf("Loaded from %s\n", filename)
+	fmt.Fprintf(c.stdout(), "Loaded from %s\n", filename)
 	return nil
 }
 
-// handleShow displays current settings
-func (c *Calculator) handleShow() {
-	fmt.Println("settings:")
+// handleShow displays current settings and user-defined functions, or with
+// the cf argument, the continued fraction of a value
+func (c *Calculator) handleShow(args []string) error {
+	if len(args) > 0 {
+		if args[0] != "cf" {
+			return fmt.Errorf("usage: .show [cf [expression]]")
+		}
+		return c.showContinuedFraction(strings.Join(args[1:], " "))
+	}
+
+	fmt.Fprintln(c.stdout(), "settings:")
 	for name, setting := range settingsRegistry {
 		switch setting.Type {
 		case SettingTypeBool:
-			fmt.Printf("  %s: %s\n", name, formatBool(setting.GetBool(c)))
+			fmt.Fprintf(c.stdout(), "  %s: %s\n", name, formatBool(setting.GetBool(c)))
 		case SettingTypeInt:
-			fmt.Printf("  %s: %d\n", name, setting.GetInt(c))
+			fmt.Fprintf(c.stdout(), "  %s: %d\n", name, setting.GetInt(c))
+		case SettingTypeString:
+			fmt.Fprintf(c.stdout(), "  %s: %s\n", name, c.settingString(setting))
 		}
 	}
+
+	if c.env == nil {
+		return nil
+	}
+	if defs := c.env.Functions(); len(defs) > 0 {
+		fmt.Fprintln(c.stdout(), "functions:")
+		for _, def := range defs {
+			fmt.Fprintf(c.stdout(), "  %s\n", def)
+		}
+	}
+	return nil
+}
+
+// settingString returns the value of a string setting, treating an unset
+// value as the first choice, which is its default.
+func (c *Calculator) settingString(setting *SettingDescriptor) string {
+	if v := setting.GetString(c); v != "" {
+		return v
+	}
+	return setting.Choices[0]
+}
+
+// maxShownConvergents is the number of convergents .show cf lists.
+const maxShownConvergents = 12
+
+// showContinuedFraction displays the continued fraction of expr, or of the
+// last result if expr is empty, along with its convergents, which are the
+// best rational approximations with denominators up to their own.
+func (c *Calculator) showContinuedFraction(expr string) error {
+	res := c.last
+	if expr != "" {
+		v, err := c.Evaluate(expr)
+		if err != nil {
+			return err
+		}
+		res = v
+	}
+
+	num, ok := res.(*parser.Number)
+	if !ok {
+		return fmt.Errorf("no number to expand; use .show cf <expression>")
+	}
+
+	terms, err := c.env.ContinuedFraction(num, maxShownConvergents+1)
+	if err != nil {
+		return err
+	}
+
+	more := len(terms) > maxShownConvergents
+	if more {
+		terms = terms[:maxShownConvergents]
+	}
+
+	parts := make([]string, len(terms))
+	for i, a := range terms {
+		parts[i] = a.String()
+	}
+	list := parts[0]
+	if len(parts) > 1 {
+		list += "; " + strings.Join(parts[1:], ", ")
+	}
+	if more {
+		list += ", ..."
+	}
+
+	fmt.Fprintf(c.stdout(), "cf: [%s]\n", list)
+	for i, conv := range parser.Convergents(terms) {
+		fmt.Fprintf(c.stdout(), "  %2d: %s\n", i+1, conv.RatString())
+	}
+	return nil
 }
 
 // handleHelp displays available meta-commands
 func (c *Calculator) handleHelp() {
-	fmt.Println("Available commands:")
-	fmt.Println("  .set <setting> <value>  - Change a setting")
-	fmt.Println("  .show                   - Show current settings")
-	fmt.Println("  .toggle <setting>       - Toggle a boolean setting")
-	fmt.Println("  .save [path]            - Save session (default: ~/.local/state/rt/calc/session.txt)")
-	fmt.Println("  .load [path]            - Load session (default: ~/.local/state/rt/calc/session.txt)")
-	fmt.Println("  .help                   - Show this help message")
-	fmt.Println()
-	fmt.Println("Commands accept any unambiguous prefix, e.g., .se for .set, .sh for .show)")
-	fmt.Println()
-	fmt.Println("Available settings:")
+	fmt.Fprintln(c.stdout(), "Available commands:")
+	fmt.Fprintln(c.stdout(), "  .set <setting> <value>  - Change a setting")
+	fmt.Fprintln(c.stdout(), "  .show                   - Show current settings and defined functions")
+	fmt.Fprintln(c.stdout(), "  .show cf [expression]   - Show the continued fraction of an expression or the last result")
+	fmt.Fprintln(c.stdout(), "  .toggle <setting>       - Toggle a boolean setting")
+	fmt.Fprintln(c.stdout(), "  .save [path]            - Save session (default: ~/.local/state/rt/calc/session.txt)")
+	fmt.Fprintln(c.stdout(), "  .load [path]            - Load session (default: ~/.local/state/rt/calc/session.txt)")
+	fmt.Fprintln(c.stdout(), "  .source <path>          - Run a script, relative to the current script")
+	fmt.Fprintln(c.stdout(), "  .help                   - Show this help message")
+	fmt.Fprintln(c.stdout())
+	fmt.Fprintln(c.stdout(), "Commands accept any unambiguous prefix, e.g., .se for .set, .sh for .show)")
+	fmt.Fprintln(c.stdout())
+	fmt.Fprintln(c.stdout(), "Define functions with name(params) = expression, e.g., hyp(a, b) = √(a*a + b*b)")
+	fmt.Fprintln(c.stdout(), "Compare with ==, !=, <, <=, >, >=, combine with &&, || and !, and branch with cond ? a : b")
+	fmt.Fprintln(c.stdout(), "Attach units to numbers and convert between them, e.g., 3 km + 200 m, 72 °F to °C")
+	fmt.Fprintln(c.stdout(), "Write complex numbers with i or j, e.g., (1+2i) * (3-j), √(-4), abs(3+4i)")
+	fmt.Fprintln(c.stdout())
+	fmt.Fprintln(c.stdout(), "Available settings:")
 	for name, setting := range settingsRegistry {
-		fmt.Printf("  %-20s - %s\n", name, setting.Description)
+		fmt.Fprintf(c.stdout(), "  %-20s - %s\n", name, setting.Description)
+	}
+	fmt.Fprintln(c.stdout())
+	fmt.Fprintln(c.stdout(), "Available functions:")
+	for _, name := range parser.FunctionNames() {
+		desc, _ := parser.FunctionDescription(name)
+		fmt.Fprintf(c.stdout(), "  %-20s - %s\n", name, desc)
 	}
 }
 
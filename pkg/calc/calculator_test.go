@@ -1,13 +1,20 @@
 package calc
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"math"
+	"math/big"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ripta/reals/pkg/constructive"
-	"github.com/ripta/reals/pkg/unified"
+
+	"github.com/ripta/rt/pkg/calc/parser"
 )
 
 type handleMetaCommandTest struct {
@@ -349,6 +356,50 @@ func TestREPLCrossReference(t *testing.T) {
 	}
 }
 
+func TestREPLStoresListResults(t *testing.T) {
+	c := &Calculator{DecimalPlaces: 30}
+
+	if err := c.processLine("[[1, 2], [3, 4]]", ModeREPL, 0); err != nil {
+		t.Fatalf("processLine: %v", err)
+	}
+	if err := c.processLine("dot($0, inv($0))", ModeREPL, 0); err != nil {
+		t.Fatalf("processLine(dot): %v", err)
+	}
+
+	res, err := c.Evaluate("$1 == [[1, 0], [0, 1]]")
+	if err != nil {
+		t.Fatalf("Evaluate($1): %v", err)
+	}
+	if res != parser.Bool(true) {
+		t.Fatalf("$1 is not the identity matrix")
+	}
+}
+
+func TestEvaluateLimits(t *testing.T) {
+	c := &Calculator{DecimalPlaces: 30, Limits: parser.Limits{MaxExponent: 100}}
+
+	var lerr *parser.LimitError
+	if _, err := c.Evaluate("2 ** 1000"); !errors.As(err, &lerr) || lerr.Limit != "exponent" {
+		t.Fatalf("Evaluate(2 ** 1000) = %v, want exponent limit error", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.ctx = ctx
+	if err := c.processLine("x = 2 ** 10", ModeREPL, 0); !errors.Is(err, parser.ErrInterrupted) {
+		t.Fatalf("processLine = %v, want ErrInterrupted", err)
+	}
+
+	// The calculator remains usable after an interruption
+	c.ctx = nil
+	if _, err := c.Evaluate("x"); err == nil {
+		t.Fatalf("x was assigned by an interrupted evaluation")
+	}
+	if _, err := c.Evaluate("2 ** 10"); err != nil {
+		t.Fatalf("Evaluate after interruption: %v", err)
+	}
+}
+
 func TestSTDINDoesNotStoreHistory(t *testing.T) {
 	c := &Calculator{DecimalPlaces: 30}
 
@@ -365,6 +416,19 @@ func TestSTDINDoesNotStoreHistory(t *testing.T) {
 	}
 }
 
+func TestProcessLineCommentOnly(t *testing.T) {
+	c := &Calculator{DecimalPlaces: 30}
+
+	for _, mode := range []ExecutionMode{ModeREPL, ModeSTDIN} {
+		if err := c.processLine("  # just a note", mode, 0); err != nil {
+			t.Errorf("processLine in mode %v: %v, want a comment-only line ignored", mode, err)
+		}
+	}
+	if len(c.history) != 0 {
+		t.Errorf("history = %q, want comment-only lines left out", c.history)
+	}
+}
+
 func TestREPLResultHistoryImmutable(t *testing.T) {
 	c := &Calculator{DecimalPlaces: 30}
 
@@ -419,11 +483,359 @@ func TestREPLResultHistorySurvivesErrors(t *testing.T) {
 	}
 }
 
-func approxFloat(t *testing.T, res *unified.Real) float64 {
+func TestFunctionDefinitionSessionRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.txt")
+
+	c := &Calculator{DecimalPlaces: 30}
+	for _, line := range []string{"f(x, y) = x**2 + y", "hyp(a,b) = √(a*a+b*b)", "f(2, 1)"} {
+		if err := c.processLine(line, ModeREPL, 0); err != nil {
+			t.Fatalf("processLine(%q): %v", line, err)
+		}
+	}
+
+	if _, err := c.Evaluate("$0"); err == nil {
+		t.Fatalf("expected no result for a function definition")
+	}
+
+	if err := c.handleSave([]string{path}); err != nil {
+		t.Fatalf("handleSave: %v", err)
+	}
+
+	loaded := &Calculator{DecimalPlaces: 30}
+	if err := loaded.handleLoad([]string{path}); err != nil {
+		t.Fatalf("handleLoad: %v", err)
+	}
+
+	res, err := loaded.Evaluate("f(3, 1) + hyp(3, 4)")
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	if got := approxFloat(t, res); math.Abs(got-15) > 1e-9 {
+		t.Fatalf("f(3, 1) + hyp(3, 4) = %v, want 15", got)
+	}
+
+	want := []string{"f(x, y) = x ** 2 + y", "hyp(a, b) = √(a * a + b * b)"}
+	if got := loaded.env.Functions(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("Functions() = %q, want %q", got, want)
+	}
+}
+
+func TestWithRadixPrefix(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		text string
+		base int
+		want string
+	}{
+		{text: "ff", base: 16, want: "0xff"},
+		{text: "-ff", base: 16, want: "-0xff"},
+		{text: "755", base: 8, want: "0o755"},
+		{text: "0.1", base: 2, want: "0b0.1"},
+		{text: "zz", base: 36, want: "zz"},
+		{text: "12", base: 10, want: "12"},
+	}
+
+	for _, tt := range tests {
+		if got := withRadixPrefix(tt.text, tt.base); got != tt.want {
+			t.Errorf("withRadixPrefix(%q, %d) = %q, want %q", tt.text, tt.base, got, tt.want)
+		}
+	}
+}
+
+func TestDigitsForBase(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		places int
+		base   int
+		want   int
+	}{
+		{places: 30, base: 10, want: 30},
+		{places: 30, base: 2, want: 100},
+		{places: 30, base: 16, want: 25},
+		{places: 0, base: 16, want: 0},
+		{places: 5, base: 36, want: 4},
+	}
+
+	for _, tt := range tests {
+		if got := digitsForBase(tt.places, tt.base); got != tt.want {
+			t.Errorf("digitsForBase(%d, %d) = %d, want %d", tt.places, tt.base, got, tt.want)
+		}
+	}
+}
+
+func TestSetBase(t *testing.T) {
+	c := &Calculator{DecimalPlaces: 30, Base: 10}
+
+	if err := c.handleSet([]string{"base", "16"}); err != nil {
+		t.Fatalf("handleSet(base, 16): %v", err)
+	}
+	if c.Base != 16 {
+		t.Errorf("Base = %d, want 16", c.Base)
+	}
+
+	for _, bad := range []string{"1", "37"} {
+		if err := c.handleSet([]string{"base", bad}); err == nil {
+			t.Errorf("expected error setting base to %s", bad)
+		}
+	}
+	if c.Base != 16 {
+		t.Errorf("Base = %d after invalid sets, want 16", c.Base)
+	}
+}
+
+func approxFloat(t *testing.T, res parser.Value) float64 {
 	t.Helper()
-	cons := res.Constructive()
+	num, ok := res.(*parser.Number)
+	if !ok {
+		t.Fatalf("expected a number, got %T", res)
+	}
+	cons := num.Real.Constructive()
 	text := constructive.Text(cons, 30, 10)
 	var f float64
 	fmt.Sscanf(text, "%f", &f)
 	return f
 }
+
+func TestFormatExact(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		rat     string
+		display string
+		base    int
+		want    string
+	}{
+		{rat: "355/113", display: DisplayRational, base: 10, want: "355/113"},
+		{rat: "355/113", display: DisplayMixed, base: 10, want: "3 16/113"},
+		{rat: "-3/2", display: DisplayRational, base: 10, want: "-3/2"},
+		{rat: "-3/2", display: DisplayMixed, base: 10, want: "-1 1/2"},
+		{rat: "1/2", display: DisplayMixed, base: 10, want: "1/2"},
+		{rat: "-255/16", display: DisplayRational, base: 16, want: "-0xff/0x10"},
+		{rat: "7", display: DisplayRational, base: 10, want: ""},
+		{rat: "1/3", display: DisplayDecimal, base: 10, want: ""},
+		{rat: "1/3", display: "", base: 10, want: ""},
+	}
+
+	for _, tt := range tests {
+		r, _ := new(big.Rat).SetString(tt.rat)
+		c := &Calculator{Display: tt.display}
+		if got := c.formatExact(r, tt.base); got != tt.want {
+			t.Errorf("formatExact(%s) in %s/%d = %q, want %q", tt.rat, tt.display, tt.base, got, tt.want)
+		}
+	}
+}
+
+func TestSetDisplay(t *testing.T) {
+	c := &Calculator{DecimalPlaces: 30}
+
+	if err := c.handleSet([]string{"display", "mixed"}); err != nil {
+		t.Fatalf("handleSet(display, mixed): %v", err)
+	}
+	if c.Display != DisplayMixed {
+		t.Errorf("Display = %q, want %q", c.Display, DisplayMixed)
+	}
+
+	if err := c.handleSet([]string{"display", "fraction"}); err == nil {
+		t.Errorf("expected error setting display to fraction")
+	}
+	if c.Display != DisplayMixed {
+		t.Errorf("Display = %q after invalid set, want %q", c.Display, DisplayMixed)
+	}
+}
+
+func TestShowContinuedFraction(t *testing.T) {
+	c := &Calculator{DecimalPlaces: 30}
+
+	if err := c.handleShow([]string{"cf"}); err == nil {
+		t.Errorf("expected error showing cf without a result")
+	}
+	if err := c.processLine("355/113", ModeSTDIN, 0); err != nil {
+		t.Fatalf("processLine: %v", err)
+	}
+	if err := c.handleShow([]string{"cf"}); err != nil {
+		t.Errorf("handleShow(cf): %v", err)
+	}
+	if err := c.handleShow([]string{"cf", "PI", "+", "1"}); err != nil {
+		t.Errorf("handleShow(cf PI + 1): %v", err)
+	}
+	if err := c.handleShow([]string{"nosuch"}); err == nil {
+		t.Errorf("expected error for unknown .show argument")
+	}
+}
+
+func TestFormatNotation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr     string
+		notation string
+		places   int
+		sigFigs  int
+		want     string
+	}{
+		{expr: "2**4096", notation: NotationSci, places: 5, want: "1.04439e1233"},
+		{expr: "1/3**200", notation: NotationSci, places: 5, want: "3.76486e-96"},
+		{expr: "-123.456", notation: NotationSci, places: 3, want: "-1.235e2"},
+		{expr: "PI * 1e-30", notation: NotationSci, places: 5, want: "3.14159e-30"},
+		{expr: "9.9999", notation: NotationSci, places: 2, want: "1e1"},
+		{expr: "0", notation: NotationSci, places: 5, want: "0"},
+		{expr: "6.022e23", notation: NotationEng, places: 5, want: "602.2e21"},
+		{expr: "1.6e-19", notation: NotationEng, places: 5, want: "160e-21"},
+		{expr: "-0.00123", notation: NotationEng, places: 5, want: "-1.23e-3"},
+		{expr: "2**100", notation: NotationAuto, places: 5, want: "1.26765e30"},
+		{expr: "1e-7", notation: NotationAuto, places: 5, want: "1e-7"},
+		{expr: "12345", notation: NotationAuto, places: 5, want: ""},
+		{expr: "12345", notation: NotationAuto, places: 5, sigFigs: 2, want: "12000"},
+		{expr: "PI", notation: NotationFixed, places: 30, sigFigs: 3, want: "3.14"},
+		{expr: "1/3**10", notation: NotationFixed, places: 30, sigFigs: 3, want: "0.0000169"},
+		{expr: "PI", notation: NotationFixed, places: 30, want: ""},
+		{expr: "PI", notation: "", places: 30, want: ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.notation+"/"+tt.expr, func(t *testing.T) {
+			t.Parallel()
+			c := &Calculator{DecimalPlaces: tt.places, Notation: tt.notation, SigFigs: tt.sigFigs}
+			res, err := c.Evaluate(tt.expr)
+			if err != nil {
+				t.Fatalf("Evaluate: %v", err)
+			}
+
+			num := res.(*parser.Number)
+			if got := c.formatNotation(num.Real, num.DisplayExact()); got != tt.want {
+				t.Errorf("formatNotation = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatMatrix(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{expr: "[1, 2/4, 3 m]", want: "[1, 0.5, 3 m]"},
+		{expr: "[]", want: "[]"},
+		{expr: "[[1, -2], [30, 4]]", want: "[[ 1, -2],\n [30,  4]]"},
+		{expr: "[[1], [2, 3]]", want: "[[1], [2, 3]]"},
+		{expr: "[[1, [2]], [3, 4]]", want: "[[1, [2]], [3, 4]]"},
+		{expr: "[[i, 2]]", want: "[[i, 2]]"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.expr, func(t *testing.T) {
+			t.Parallel()
+			c := &Calculator{DecimalPlaces: 5}
+			res, err := c.Evaluate(tt.expr)
+			if err != nil {
+				t.Fatalf("Evaluate: %v", err)
+			}
+
+			got, err := c.formatMatrix(res.(*parser.List))
+			if err != nil {
+				t.Fatalf("formatMatrix: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("formatMatrix = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisplayLimits(t *testing.T) {
+	// PI evaluates at once, but computing 10000 of its digits to display it
+	// takes far longer than the limit
+	var buf bytes.Buffer
+	c := &Calculator{DecimalPlaces: 10000, Limits: parser.Limits{Timeout: 50 * time.Millisecond}, out: &buf}
+
+	var lerr *parser.LimitError
+	if err := c.processLine("PI", ModeSTDIN, 0); !errors.As(err, &lerr) || lerr.Limit != "time" {
+		t.Errorf("processLine(PI) = %v, want time limit error", err)
+	}
+	if err := c.evaluateAndDisplay("PI"); !errors.As(err, &lerr) || lerr.Limit != "time" {
+		t.Errorf("evaluateAndDisplay(PI) = %v, want time limit error", err)
+	}
+
+	// Ctrl-C in the REPL interrupts the display as it does the evaluation
+	c.Limits = parser.Limits{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(50*time.Millisecond, cancel)
+	c.ctx = ctx
+	if err := c.processLine("PI", ModeREPL, 0); !errors.Is(err, parser.ErrInterrupted) {
+		t.Errorf("processLine(PI) = %v, want ErrInterrupted", err)
+	}
+
+	if buf.Len() > 0 {
+		t.Errorf("abandoned results were displayed:\n%s", buf.String())
+	}
+}
+
+func TestLimitSettings(t *testing.T) {
+	var buf bytes.Buffer
+	c := &Calculator{DecimalPlaces: 30, Limits: defaultLimits, out: &buf}
+
+	var lerr *parser.LimitError
+	if _, err := c.Evaluate("2 ** 2 ** 2 ** 30"); !errors.As(err, &lerr) || lerr.Limit != "exponent" {
+		t.Fatalf("Evaluate(2 ** 2 ** 2 ** 30) = %v, want exponent limit error by default", err)
+	}
+
+	tests := []struct {
+		set       string
+		expr      string
+		wantLimit string
+	}{
+		{set: ".set max_exponent 10", expr: "2 ** 11", wantLimit: "exponent"},
+		{set: ".set max_exponent 0", expr: "2 ** 11"},
+		{set: ".set max_decimal_places 20", expr: "1/3", wantLimit: "precision"},
+		{set: ".set max_decimal_places 0", expr: "1/3"},
+		{set: ".set timeout_ms 1", expr: "2 ** 2 ** 2 ** 30", wantLimit: "time"},
+	}
+	for _, tt := range tests {
+		if err := c.handleMetaCommand(tt.set); err != nil {
+			t.Fatalf("%s: %v", tt.set, err)
+		}
+		_, err := c.Evaluate(tt.expr)
+		if tt.wantLimit == "" {
+			if err != nil {
+				t.Errorf("after %s: Evaluate(%s) = %v, want no error", tt.set, tt.expr, err)
+			}
+			continue
+		}
+		if !errors.As(err, &lerr) || lerr.Limit != tt.wantLimit {
+			t.Errorf("after %s: Evaluate(%s) = %v, want %s limit error", tt.set, tt.expr, err, tt.wantLimit)
+		}
+	}
+
+	for _, set := range []string{".set max_exponent -1", ".set max_decimal_places -1", ".set timeout_ms -1"} {
+		if err := c.handleMetaCommand(set); err == nil || !strings.Contains(err.Error(), "non-negative") {
+			t.Errorf("%s = %v, want non-negative error", set, err)
+		}
+	}
+}
+
+func TestCommandLimitFlags(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr string
+	}{
+		{args: []string{"2 ** 2 ** 2 ** 30"}, wantErr: "exponent limit exceeded"},
+		{args: []string{"--max-exponent", "10", "2 ** 11"}, wantErr: "exponent limit exceeded"},
+		{args: []string{"--max-decimal-places", "10", "1/3"}, wantErr: "precision limit exceeded"},
+		{args: []string{"--timeout", "1ms", "--max-exponent", "0", "2 ** 2 ** 2 ** 30"}, wantErr: "time limit exceeded"},
+		{args: []string{"--max-exponent", "-1", "1"}, wantErr: "limits must be non-negative"},
+	}
+	for _, tt := range tests {
+		cmd := NewCommand()
+		cmd.SetArgs(tt.args)
+		if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("calc %q = %v, want error containing %q", tt.args, err, tt.wantErr)
+		}
+	}
+}
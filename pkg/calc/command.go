@@ -1,6 +1,7 @@
 package calc
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -9,13 +10,20 @@ import (
 
 // NewCommand creates a new calculator command.
 //
-// Expressions can be passed as one or more arguments. If no arguments are
-// provided and STDIN is a TTY, it will start a REPL. Otherwise, the command
-// will return ErrNotTTY.
+// Expressions can be passed as one or more arguments, and scripts with
+// --file, which run before any arguments. If neither are provided and STDIN
+// is a TTY, it will start a REPL. Otherwise, expressions are read from STDIN.
 func NewCommand() *cobra.Command {
+	var files []string
 	c := &Calculator{
 		DecimalPlaces: 30,
+		Base:          10,
+		Display:       DisplayDecimal,
+		Notation:      NotationFixed,
+		ComplexForm:   ComplexRect,
+		Output:        OutputText,
 		Verbose:       false,
+		Limits:        defaultLimits,
 	}
 	cmd := &cobra.Command{
 		Use:           "calc",
@@ -24,18 +32,59 @@ func NewCommand() *cobra.Command {
 		SilenceErrors: true,
 		SilenceUsage:  true,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// mode 1: evaluate each arg
+			if err := validateBase(c.Base); err != nil {
+				return err
+			}
+			if err := validateDisplay(c.Display); err != nil {
+				return err
+			}
+			if err := validateNotation(c.Notation); err != nil {
+				return err
+			}
+			if err := validateComplexForm(c.ComplexForm); err != nil {
+				return err
+			}
+			if err := settingsRegistry["sig_figs"].ValidateInt(c.SigFigs); err != nil {
+				return err
+			}
+			if err := validateOutput(c.Output); err != nil {
+				return err
+			}
+			if err := validateLimits(c.Limits); err != nil {
+				return err
+			}
+
+			if len(files) > 0 && c.Output == OutputJSON {
+				return fmt.Errorf("--file does not support %s output", OutputJSON)
+			}
+			for _, file := range files {
+				if err := c.RunScript(file); err != nil {
+					return err
+				}
+			}
+
+			// mode 1: evaluate each arg, reporting all of them in JSON
+			// output, or stopping at the first error otherwise
+			if len(args) > 0 && c.Output == OutputJSON {
+				var firstErr error
+				for i, arg := range args {
+					if err := c.processLineJSON(arg, i+1); err != nil && firstErr == nil {
+						firstErr = err
+					}
+				}
+				return firstErr
+			}
 			if len(args) > 0 {
 				for _, arg := range args {
-					res, err := c.Evaluate(arg)
-					if err != nil {
+					if err := c.evaluateAndDisplay(arg); err != nil {
 						return err
 					}
-
-					c.DisplayResult(res)
 				}
 				return nil
 			}
+			if len(files) > 0 {
+				return nil
+			}
 
 			// mode 2: start interactive REPL if STDIN is a TTY
 			if term.IsTerminal(int(os.Stdin.Fd())) {
@@ -47,7 +96,18 @@ func NewCommand() *cobra.Command {
 		},
 	}
 
+	cmd.Flags().StringArrayVarP(&files, "file", "f", nil, "Run the script in this file; may be repeated")
+	cmd.Flags().BoolVar(&c.Strict, "strict", c.Strict, "Stop scripts at the first error")
 	cmd.Flags().IntVarP(&c.DecimalPlaces, "decimal-places", "d", c.DecimalPlaces, "Number of decimal places to display")
+	cmd.Flags().IntVarP(&c.Base, "base", "b", c.Base, "Radix in which to display results (2-36)")
+	cmd.Flags().StringVar(&c.Display, "display", c.Display, "Display exact rationals as decimal, rational or mixed")
+	cmd.Flags().StringVar(&c.Notation, "notation", c.Notation, "Display decimals in fixed, sci, eng or auto notation")
+	cmd.Flags().IntVar(&c.SigFigs, "sig-figs", c.SigFigs, "Round results to this many significant figures, 0 to disable")
+	cmd.Flags().StringVar(&c.ComplexForm, "complex", c.ComplexForm, "Display complex numbers in rect, polar or polar_deg form")
+	cmd.Flags().StringVarP(&c.Output, "output", "o", c.Output, "Output format for non-interactive use: text or json")
+	cmd.Flags().IntVar(&c.Limits.MaxDecimalPlaces, "max-decimal-places", c.Limits.MaxDecimalPlaces, "Refuse to compute results to more decimal places than this, 0 for no limit")
+	cmd.Flags().Int64Var(&c.Limits.MaxExponent, "max-exponent", c.Limits.MaxExponent, "Refuse integer exponents larger than this in magnitude, 0 for no limit")
+	cmd.Flags().DurationVar(&c.Limits.Timeout, "timeout", c.Limits.Timeout, "Stop each evaluation after this long, 0 for no limit")
 	cmd.Flags().BoolVarP(&c.KeepTrailingZeros, "keep-trailing-zeros", "k", c.KeepTrailingZeros, "Keep trailing zeros in decimal output")
 	cmd.Flags().BoolVarP(&c.UnderscoreZeros, "underscore-zeros", "u", c.UnderscoreZeros, "Insert underscore before trailing zeros, implies --keep-trailing-zeros")
 	cmd.Flags().BoolVarP(&c.Verbose, "verbose", "v", c.Verbose, "Verbose output")
@@ -0,0 +1,101 @@
+package calc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ripta/reals/pkg/constructive"
+
+	"github.com/ripta/rt/pkg/calc/parser"
+	"github.com/ripta/rt/pkg/calc/units"
+)
+
+// Forms in which complex results are displayed: rectangular (3 + 4i), or
+// polar as a modulus and an angle in radians (5 ∠ 0.9273) or degrees
+// (5 ∠ 53.13°).
+const (
+	ComplexRect     = "rect"
+	ComplexPolar    = "polar"
+	ComplexPolarDeg = "polar_deg"
+)
+
+var complexForms = []string{ComplexRect, ComplexPolar, ComplexPolarDeg}
+
+// displayComplex prints a complex result, along with the construction of
+// each part in verbose mode.
+func (c *Calculator) displayComplex(z *parser.Complex) {
+	if c.Verbose {
+		fmt.Fprintf(c.stdout(), "calc:%03d/ Construction: re=%s im=%s\n", c.count,
+			constructive.AsConstruction(z.Re.Real.Constructive()), constructive.AsConstruction(z.Im.Real.Constructive()))
+	}
+
+	t, err := c.formatComplex(z)
+	if err != nil {
+		c.DisplayError(err)
+		return
+	}
+	fmt.Fprintf(c.stdout(), "%s\n", t)
+}
+
+// formatComplex formats z in the configured form, with each part formatted
+// like any other number.
+func (c *Calculator) formatComplex(z *parser.Complex) (string, error) {
+	if c.ComplexForm == ComplexPolar || c.ComplexForm == ComplexPolarDeg {
+		mod, arg, err := c.env.Polar(z)
+		if err != nil {
+			return "", err
+		}
+
+		angle, _ := c.formatNumber(arg)
+		if c.ComplexForm == ComplexPolarDeg {
+			deg, _ := units.Lookup("deg")
+			angle, _ = c.formatNumber(&parser.Number{Real: arg.Real, Exact: arg.Exact, Dim: deg.Dim, Unit: deg})
+			angle += "°"
+		}
+
+		r, _ := c.formatNumber(mod)
+		return r + " ∠ " + angle, nil
+	}
+
+	// A part that rounds to zero is left out, whether it is exactly zero,
+	// as in (1+i)**2, or only nearly so, as in E**(i*PI)
+	reZero, imZero := c.roundsToZero(z.Re), c.roundsToZero(z.Im)
+	re, _ := c.formatNumber(z.Re)
+	if imZero {
+		if reZero {
+			return "0", nil
+		}
+		return re, nil
+	}
+
+	im, _ := c.formatNumber(z.Im)
+	switch im {
+	case "1":
+		im = ""
+	case "-1":
+		im = "-"
+	}
+	im += "i"
+
+	if reZero {
+		return im, nil
+	}
+	if after, ok := strings.CutPrefix(im, "-"); ok {
+		return re + " - " + after, nil
+	}
+	return re + " + " + im, nil
+}
+
+// roundsToZero reports whether n is zero to the configured decimal places.
+func (c *Calculator) roundsToZero(n *parser.Number) bool {
+	if n.Exact != nil {
+		return n.Exact.Sign() == 0
+	}
+	t := constructive.Text(n.Real.Constructive(), c.DecimalPlaces, 10)
+	return strings.Trim(t, "-0.") == ""
+}
+
+// validateComplexForm checks that v is a complex display form.
+func validateComplexForm(v string) error {
+	return settingsRegistry["complex"].validateChoice("complex", v)
+}
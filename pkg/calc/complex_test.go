@@ -0,0 +1,54 @@
+package calc
+
+import (
+	"testing"
+
+	"github.com/ripta/rt/pkg/calc/parser"
+)
+
+func TestFormatComplex(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr    string
+		form    string
+		display string
+		want    string
+	}{
+		{expr: "3 + 4i", form: ComplexRect, want: "3 + 4i"},
+		{expr: "3 - 4i", form: "", want: "3 - 4i"},
+		{expr: "-2i", form: ComplexRect, want: "-2i"},
+		{expr: "1 + i", form: ComplexRect, want: "1 + i"},
+		{expr: "1 - i", form: ComplexRect, want: "1 - i"},
+		{expr: "-i", form: ComplexRect, want: "-i"},
+		{expr: "1 / (2 + i)", form: ComplexRect, display: DisplayRational, want: "2/5 - 1/5i"},
+		{expr: "(-8)**(1/3)", form: ComplexRect, want: "1 + 1.73205i"},
+		{expr: "(1 + i)**2", form: ComplexRect, want: "2i"},
+		{expr: "E**(i*PI)", form: ComplexRect, want: "-1"},
+		{expr: "E**(i*PI/2)", form: ComplexRect, want: "i"},
+		{expr: "E**(i*PI/2) - i", form: ComplexRect, want: "0"},
+		{expr: "3 + 4i", form: ComplexPolar, want: "5 ∠ 0.9273"},
+		{expr: "-1 - i", form: ComplexPolarDeg, want: "1.41421 ∠ -135°"},
+		{expr: "2i", form: ComplexPolarDeg, want: "2 ∠ 90°"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.form+"/"+tt.expr, func(t *testing.T) {
+			t.Parallel()
+			c := &Calculator{DecimalPlaces: 5, ComplexForm: tt.form, Display: tt.display}
+			res, err := c.Evaluate(tt.expr)
+			if err != nil {
+				t.Fatalf("Evaluate: %v", err)
+			}
+
+			got, err := c.formatComplex(res.(*parser.Complex))
+			if err != nil {
+				t.Fatalf("formatComplex: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("formatComplex = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package calc
 
 import (
+	"context"
 	"errors"
 
 	"github.com/ripta/reals/pkg/unified"
@@ -12,9 +13,16 @@ var ErrEnvironmentMissing = errors.New("environment missing")
 
 // Evaluate parses expr and evaluates it in the given environment.
 // The caller is responsible for trimming whitespace from expr.
-func Evaluate(expr string, env *parser.Env) (*unified.Real, error) {
+func Evaluate(expr string, env *parser.Env) (parser.Value, error) {
+	return EvaluateContext(context.Background(), expr, env)
+}
+
+// EvaluateContext is Evaluate, but stops early with parser.ErrInterrupted
+// once ctx is canceled, or with a *parser.LimitError once evaluation exceeds
+// the limits set on env or ctx's deadline passes.
+func EvaluateContext(ctx context.Context, expr string, env *parser.Env) (parser.Value, error) {
 	if expr == "" {
-		return unified.Zero(), nil
+		return parser.NewNumber(unified.Zero()), nil
 	}
 
 	if env == nil {
@@ -27,7 +35,7 @@ func Evaluate(expr string, env *parser.Env) (*unified.Real, error) {
 		return nil, err
 	}
 
-	val, err := node.Eval(env)
+	val, err := env.EvalContext(ctx, node)
 	if err != nil {
 		return nil, err
 	}
@@ -28,9 +28,23 @@ func lexExpression(l *L) lexingState {
 		return lexRawString
 
 	case r == '=':
+		if l.Peek() == '=' {
+			l.Next()
+			l.Emit(tokens.OP_EQ)
+			return lexExpression
+		}
 		l.Emit(tokens.ASSIGN)
 		return lexExpression
 
+	case r == '!':
+		if l.Peek() == '=' {
+			l.Next()
+			l.Emit(tokens.OP_NE)
+			return lexExpression
+		}
+		l.Emit(tokens.OP_NOT)
+		return lexExpression
+
 	case unicode.IsDigit(r):
 		l.Rewind()
 		return lexNumber
@@ -61,20 +75,56 @@ func lexExpression(l *L) lexingState {
 		return lexExpression
 
 	case r == '<':
-		if l.Peek() == '<' {
+		switch l.Peek() {
+		case '<':
 			l.Next()
 			l.Emit(tokens.OP_SHL)
-			return lexExpression
+		case '=':
+			l.Next()
+			l.Emit(tokens.OP_LE)
+		default:
+			l.Emit(tokens.OP_LT)
 		}
-		return l.Errorf("%w %q in expression, expecting another '<'", ErrUnexpectedToken, string(r))
+		return lexExpression
 
 	case r == '>':
-		if l.Peek() == '>' {
+		switch l.Peek() {
+		case '>':
 			l.Next()
 			l.Emit(tokens.OP_SHR)
+		case '=':
+			l.Next()
+			l.Emit(tokens.OP_GE)
+		default:
+			l.Emit(tokens.OP_GT)
+		}
+		return lexExpression
+
+	case r == '&':
+		if l.Peek() == '&' {
+			l.Next()
+			l.Emit(tokens.OP_AND)
 			return lexExpression
 		}
-		return l.Errorf("%w %q in expression, expecting another '>'", ErrUnexpectedToken, string(r))
+		l.Emit(tokens.OP_BITAND)
+		return lexExpression
+
+	case r == '|':
+		if l.Peek() == '|' {
+			l.Next()
+			l.Emit(tokens.OP_OR)
+			return lexExpression
+		}
+		l.Emit(tokens.OP_BITOR)
+		return lexExpression
+
+	case r == '^':
+		l.Emit(tokens.OP_BITXOR)
+		return lexExpression
+
+	case r == '~':
+		l.Emit(tokens.OP_BITNOT)
+		return lexExpression
 
 	case r == '√':
 		l.Emit(tokens.OP_ROOT)
@@ -88,9 +138,47 @@ func lexExpression(l *L) lexingState {
 		l.Emit(tokens.RPAREN)
 		return lexExpression
 
+	case r == '[':
+		l.Emit(tokens.LBRACKET)
+		return lexExpression
+
+	case r == ']':
+		l.Emit(tokens.RBRACKET)
+		return lexExpression
+
+	case r == ',':
+		l.Emit(tokens.COMMA)
+		return lexExpression
+
+	case r == ';':
+		l.Emit(tokens.SEMICOLON)
+		return lexExpression
+
+	case r == '#':
+		for r := l.Peek(); r != EOF && r != '\n'; r = l.Peek() {
+			l.Next()
+		}
+		l.Emit(tokens.COMMENT)
+		return lexExpression
+
+	case r == '?':
+		l.Emit(tokens.QUESTION)
+		return lexExpression
+
+	case r == ':':
+		l.Emit(tokens.COLON)
+		return lexExpression
+
 	case r == '$':
 		return lexLineIdent
 
+	case r == '°':
+		// A degree sign outside a number starts a unit symbol, e.g. °C
+		if !unicode.IsLetter(l.Peek()) {
+			return l.Errorf("%w %q in expression, expecting a unit such as °C", ErrUnexpectedToken, string(r))
+		}
+		return lexIdent
+
 	case IsAlnum(r):
 		l.Rewind()
 		return lexIdent
@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"strings"
+	"unicode"
 
 	"github.com/ripta/rt/pkg/calc/tokens"
 )
@@ -21,15 +22,35 @@ func lexLineIdent(l *L) lexingState {
 	return lexExpression
 }
 
+// radixPrefixes maps the letter following a leading zero to the base of the
+// integer literal it introduces, e.g. 0x1F.
+var radixPrefixes = map[rune]int{
+	'x': 16, 'X': 16,
+	'o': 8, 'O': 8,
+	'b': 2, 'B': 2,
+}
+
 func lexNumber(l *L) lexingState {
-	if !l.AcceptWhile(IsNumeric) {
+	if l.AcceptOnce(StringPredicate("0")) {
+		if base, ok := radixPrefixes[l.Peek()]; ok {
+			l.Next()
+			return lexRadixNumber(l, base)
+		}
+	}
+
+	l.AcceptWhile(IsNumeric)
+	if l.Current() == "" {
 		return l.Errorf("invalid number: %s", l.Current())
 	}
 
 	num := l.Current()
 	if dec := strings.Count(num, "."); dec > 1 {
 		return l.Errorf("too many decimal points (%d) in number; expected 0 or 1", dec)
-	} else if dec == 1 {
+	} else if exp := acceptExponent(l); acceptDegreeSign(l) {
+		l.Emit(tokens.LIT_DEGREE)
+	} else if acceptImaginarySuffix(l) {
+		l.Emit(tokens.LIT_IMAG)
+	} else if dec == 1 || exp {
 		l.Emit(tokens.LIT_FLOAT)
 	} else {
 		l.Emit(tokens.LIT_INT)
@@ -37,3 +58,69 @@ func lexNumber(l *L) lexingState {
 
 	return lexExpression
 }
+
+// acceptExponent accepts the exponent of a number in scientific notation,
+// as in 6.022e23 or 1.6e-19. The e is only accepted when digits follow it,
+// so that a unit such as eV can still follow a number directly.
+func acceptExponent(l *L) bool {
+	rest := l.src[l.pos:]
+	if len(rest) < 2 || (rest[0] != 'e' && rest[0] != 'E') {
+		return false
+	}
+
+	i := 1
+	if rest[i] == '+' || rest[i] == '-' {
+		i++
+	}
+	if i >= len(rest) || rest[i] < '0' || rest[i] > '9' {
+		return false
+	}
+
+	l.pos += i
+	l.AcceptWhile(IsRadixDigit(10))
+	return true
+}
+
+// acceptDegreeSign accepts a degree sign directly after a number, as in 30°,
+// unless the sign begins a unit symbol such as °C.
+func acceptDegreeSign(l *L) bool {
+	if !l.AcceptOnce(StringPredicate("°")) {
+		return false
+	}
+
+	if unicode.IsLetter(l.Peek()) {
+		l.Rewind()
+		return false
+	}
+	return true
+}
+
+// acceptImaginarySuffix accepts the i or j that makes a number imaginary, as
+// in 2i or 0.5j, unless it begins a unit symbol such as in.
+func acceptImaginarySuffix(l *L) bool {
+	if !l.AcceptOnce(StringPredicate("ij")) {
+		return false
+	}
+
+	if IsAlnum(l.Peek()) {
+		l.Rewind()
+		return false
+	}
+	return true
+}
+
+// lexRadixNumber lexes the digits of an integer literal in the given base,
+// after its 0x, 0o or 0b prefix has been consumed.
+func lexRadixNumber(l *L, base int) lexingState {
+	if !l.AcceptWhile(IsRadixDigit(base)) {
+		return l.Errorf("invalid number: %s, expecting base-%d digits", l.Current(), base)
+	}
+
+	if r := l.Peek(); IsAlnum(r) {
+		l.Next()
+		return l.Errorf("invalid digit %q in base-%d number %s", string(r), base, l.Current())
+	}
+
+	l.Emit(tokens.LIT_INT)
+	return lexExpression
+}
@@ -32,10 +32,16 @@ type L struct {
 }
 
 func New(name, src string) *L {
+	return NewAt(name, src, 1)
+}
+
+// NewAt is New for a source that starts on the given line of the file name,
+// such as a statement in a script.
+func NewAt(name, src string, line int) *L {
 	l := &L{
 		name:   name,
 		src:    src,
-		line:   1,
+		line:   line,
 		tokens: make(chan tokens.Token, 100),
 	}
 
@@ -80,22 +86,24 @@ func (l *L) Emit(t tokens.TokenType) {
 	l.tokens <- tokens.Token{
 		Type:  t,
 		Value: l.src[l.start:l.pos],
-		Pos: tokens.Position{
-			File:   l.name,
-			Line:   l.line,
-			Column: l.start + 1,
-		},
+		Pos:   l.position(),
 	}
 	l.start = l.pos
 }
 
-func (l *L) Errorf(format string, args ...any) lexingState {
-	err := fmt.Errorf(format, args...)
-	pos := tokens.Position{
+// position returns the position of the start of the current token. Columns
+// count bytes from the start of the line.
+func (l *L) position() tokens.Position {
+	return tokens.Position{
 		File:   l.name,
-		Line:   l.line,
-		Column: l.start + 1,
+		Line:   l.line - strings.Count(l.src[l.start:l.pos], "\n"),
+		Column: l.start - strings.LastIndexByte(l.src[:l.start], '\n'),
 	}
+}
+
+func (l *L) Errorf(format string, args ...any) lexingState {
+	err := fmt.Errorf(format, args...)
+	pos := l.position()
 
 	l.err = fmt.Errorf("%s: %w", pos, err)
 	l.tokens <- tokens.Token{
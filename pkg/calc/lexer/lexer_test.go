@@ -152,24 +152,63 @@ var tokenTests = []tokenTest{
 		},
 	},
 	{
-		name:  "single less-than is illegal",
+		name:  "less-than comparison",
 		input: "4 < 2",
 		want: []tokenExpectation{
 			{Type: tokens.LIT_INT, Value: "4", Col: 1},
 			{Type: tokens.WHITESPACE, Value: " ", Col: 2},
-			{Type: tokens.ILLEGAL, Value: "<", Col: 3},
+			{Type: tokens.OP_LT, Value: "<", Col: 3},
+			{Type: tokens.WHITESPACE, Value: " ", Col: 4},
+			{Type: tokens.LIT_INT, Value: "2", Col: 5},
 		},
-		wantErr: "unexpected token",
 	},
 	{
-		name:  "single greater-than is illegal",
+		name:  "greater-than comparison",
 		input: "8 > 2",
 		want: []tokenExpectation{
 			{Type: tokens.LIT_INT, Value: "8", Col: 1},
 			{Type: tokens.WHITESPACE, Value: " ", Col: 2},
-			{Type: tokens.ILLEGAL, Value: ">", Col: 3},
+			{Type: tokens.OP_GT, Value: ">", Col: 3},
+			{Type: tokens.WHITESPACE, Value: " ", Col: 4},
+			{Type: tokens.LIT_INT, Value: "2", Col: 5},
+		},
+	},
+	{
+		name:  "comparison operators",
+		input: "a==b!=c<=d>=e<<f>>g",
+		want: []tokenExpectation{
+			{Type: tokens.IDENT, Value: "a", Col: 1},
+			{Type: tokens.OP_EQ, Value: "==", Col: 2},
+			{Type: tokens.IDENT, Value: "b", Col: 4},
+			{Type: tokens.OP_NE, Value: "!=", Col: 5},
+			{Type: tokens.IDENT, Value: "c", Col: 7},
+			{Type: tokens.OP_LE, Value: "<=", Col: 8},
+			{Type: tokens.IDENT, Value: "d", Col: 10},
+			{Type: tokens.OP_GE, Value: ">=", Col: 11},
+			{Type: tokens.IDENT, Value: "e", Col: 13},
+			{Type: tokens.OP_SHL, Value: "<<", Col: 14},
+			{Type: tokens.IDENT, Value: "f", Col: 16},
+			{Type: tokens.OP_SHR, Value: ">>", Col: 17},
+			{Type: tokens.IDENT, Value: "g", Col: 19},
+		},
+	},
+	{
+		name:  "logical and conditional operators",
+		input: "!a&&b||c&d?e:f",
+		want: []tokenExpectation{
+			{Type: tokens.OP_NOT, Value: "!", Col: 1},
+			{Type: tokens.IDENT, Value: "a", Col: 2},
+			{Type: tokens.OP_AND, Value: "&&", Col: 3},
+			{Type: tokens.IDENT, Value: "b", Col: 5},
+			{Type: tokens.OP_OR, Value: "||", Col: 6},
+			{Type: tokens.IDENT, Value: "c", Col: 8},
+			{Type: tokens.OP_BITAND, Value: "&", Col: 9},
+			{Type: tokens.IDENT, Value: "d", Col: 10},
+			{Type: tokens.QUESTION, Value: "?", Col: 11},
+			{Type: tokens.IDENT, Value: "e", Col: 12},
+			{Type: tokens.COLON, Value: ":", Col: 13},
+			{Type: tokens.IDENT, Value: "f", Col: 14},
 		},
-		wantErr: "unexpected token",
 	},
 	{
 		name:  "exponentiation operator",
@@ -278,6 +317,216 @@ var tokenTests = []tokenTest{
 			{Type: tokens.IDENT, Value: "$1", Col: 6},
 		},
 	},
+	{
+		name:  "function call with arguments",
+		input: "atan2(y, 1)",
+		want: []tokenExpectation{
+			{Type: tokens.IDENT, Value: "atan2", Col: 1},
+			{Type: tokens.LPAREN, Value: "(", Col: 6},
+			{Type: tokens.IDENT, Value: "y", Col: 7},
+			{Type: tokens.COMMA, Value: ",", Col: 8},
+			{Type: tokens.WHITESPACE, Value: " ", Col: 9},
+			{Type: tokens.LIT_INT, Value: "1", Col: 10},
+			{Type: tokens.RPAREN, Value: ")", Col: 11},
+		},
+	},
+	{
+		name:  "list literal",
+		input: "[1,[2]]",
+		want: []tokenExpectation{
+			{Type: tokens.LBRACKET, Value: "[", Col: 1},
+			{Type: tokens.LIT_INT, Value: "1", Col: 2},
+			{Type: tokens.COMMA, Value: ",", Col: 3},
+			{Type: tokens.LBRACKET, Value: "[", Col: 4},
+			{Type: tokens.LIT_INT, Value: "2", Col: 5},
+			{Type: tokens.RBRACKET, Value: "]", Col: 6},
+			{Type: tokens.RBRACKET, Value: "]", Col: 7},
+		},
+	},
+	{
+		name:  "statements and comment",
+		input: "1;2 # two",
+		want: []tokenExpectation{
+			{Type: tokens.LIT_INT, Value: "1", Col: 1},
+			{Type: tokens.SEMICOLON, Value: ";", Col: 2},
+			{Type: tokens.LIT_INT, Value: "2", Col: 3},
+			{Type: tokens.WHITESPACE, Value: " ", Col: 4},
+			{Type: tokens.COMMENT, Value: "# two", Col: 5},
+		},
+	},
+	{
+		name:  "columns restart on each line",
+		input: "1 +\n  2",
+		want: []tokenExpectation{
+			{Type: tokens.LIT_INT, Value: "1", Col: 1},
+			{Type: tokens.WHITESPACE, Value: " ", Col: 2},
+			{Type: tokens.OP_PLUS, Value: "+", Col: 3},
+			{Type: tokens.WHITESPACE, Value: "\n  ", Col: 4},
+			{Type: tokens.LIT_INT, Value: "2", Col: 3},
+		},
+	},
+	{
+		name:  "hexadecimal literal",
+		input: "0xFF+0x1_0",
+		want: []tokenExpectation{
+			{Type: tokens.LIT_INT, Value: "0xFF", Col: 1},
+			{Type: tokens.OP_PLUS, Value: "+", Col: 5},
+			{Type: tokens.LIT_INT, Value: "0x1_0", Col: 6},
+		},
+	},
+	{
+		name:  "octal and binary literals",
+		input: "0o755 0B1011",
+		want: []tokenExpectation{
+			{Type: tokens.LIT_INT, Value: "0o755", Col: 1},
+			{Type: tokens.WHITESPACE, Value: " ", Col: 6},
+			{Type: tokens.LIT_INT, Value: "0B1011", Col: 7},
+		},
+	},
+	{
+		name:  "zero is still decimal",
+		input: "0 0.5",
+		want: []tokenExpectation{
+			{Type: tokens.LIT_INT, Value: "0", Col: 1},
+			{Type: tokens.WHITESPACE, Value: " ", Col: 2},
+			{Type: tokens.LIT_FLOAT, Value: "0.5", Col: 3},
+		},
+	},
+	{
+		name:  "exponent literals",
+		input: "6.022e23 1.6E-19 2e+3",
+		want: []tokenExpectation{
+			{Type: tokens.LIT_FLOAT, Value: "6.022e23", Col: 1},
+			{Type: tokens.WHITESPACE, Value: " ", Col: 9},
+			{Type: tokens.LIT_FLOAT, Value: "1.6E-19", Col: 10},
+			{Type: tokens.WHITESPACE, Value: " ", Col: 17},
+			{Type: tokens.LIT_FLOAT, Value: "2e+3", Col: 18},
+		},
+	},
+	{
+		name:  "e without exponent digits starts a unit",
+		input: "2eV 3e-x",
+		want: []tokenExpectation{
+			{Type: tokens.LIT_INT, Value: "2", Col: 1},
+			{Type: tokens.IDENT, Value: "eV", Col: 2},
+			{Type: tokens.WHITESPACE, Value: " ", Col: 4},
+			{Type: tokens.LIT_INT, Value: "3", Col: 5},
+			{Type: tokens.IDENT, Value: "e", Col: 6},
+			{Type: tokens.OP_MINUS, Value: "-", Col: 7},
+			{Type: tokens.IDENT, Value: "x", Col: 8},
+		},
+	},
+	{
+		name:  "exponent before degree sign",
+		input: "1e1°",
+		want: []tokenExpectation{
+			{Type: tokens.LIT_DEGREE, Value: "1e1°", Col: 1},
+		},
+	},
+	{
+		name:  "radix prefix without digits",
+		input: "0x",
+		want: []tokenExpectation{
+			{Type: tokens.ILLEGAL, Value: "0x", Col: 1},
+		},
+		wantErr: "expecting base-16 digits",
+	},
+	{
+		name:  "digit out of range for base",
+		input: "0b102",
+		want: []tokenExpectation{
+			{Type: tokens.ILLEGAL, Value: "0b102", Col: 1},
+		},
+		wantErr: "invalid digit \"2\" in base-2 number",
+	},
+	{
+		name:  "letter out of range for base",
+		input: "0o7g",
+		want: []tokenExpectation{
+			{Type: tokens.ILLEGAL, Value: "0o7g", Col: 1},
+		},
+		wantErr: "invalid digit \"g\" in base-8 number",
+	},
+	{
+		name:  "bitwise operators",
+		input: "~a&b|c^d",
+		want: []tokenExpectation{
+			{Type: tokens.OP_BITNOT, Value: "~", Col: 1},
+			{Type: tokens.IDENT, Value: "a", Col: 2},
+			{Type: tokens.OP_BITAND, Value: "&", Col: 3},
+			{Type: tokens.IDENT, Value: "b", Col: 4},
+			{Type: tokens.OP_BITOR, Value: "|", Col: 5},
+			{Type: tokens.IDENT, Value: "c", Col: 6},
+			{Type: tokens.OP_BITXOR, Value: "^", Col: 7},
+			{Type: tokens.IDENT, Value: "d", Col: 8},
+		},
+	},
+	{
+		name:  "degree literal",
+		input: "30°",
+		want: []tokenExpectation{
+			{Type: tokens.LIT_DEGREE, Value: "30°", Col: 1},
+		},
+	},
+	{
+		name:  "fractional degree literal",
+		input: "22.5°*2",
+		want: []tokenExpectation{
+			{Type: tokens.LIT_DEGREE, Value: "22.5°", Col: 1},
+			{Type: tokens.OP_STAR, Value: "*", Col: 7},
+			{Type: tokens.LIT_INT, Value: "2", Col: 8},
+		},
+	},
+	{
+		name:  "imaginary literals",
+		input: "3+4i-0.5j*2e3i",
+		want: []tokenExpectation{
+			{Type: tokens.LIT_INT, Value: "3", Col: 1},
+			{Type: tokens.OP_PLUS, Value: "+", Col: 2},
+			{Type: tokens.LIT_IMAG, Value: "4i", Col: 3},
+			{Type: tokens.OP_MINUS, Value: "-", Col: 5},
+			{Type: tokens.LIT_IMAG, Value: "0.5j", Col: 6},
+			{Type: tokens.OP_STAR, Value: "*", Col: 10},
+			{Type: tokens.LIT_IMAG, Value: "2e3i", Col: 11},
+		},
+	},
+	{
+		name:  "unit starting with i after number",
+		input: "12in",
+		want: []tokenExpectation{
+			{Type: tokens.LIT_INT, Value: "12", Col: 1},
+			{Type: tokens.IDENT, Value: "in", Col: 3},
+		},
+	},
+	{
+		name:  "temperature unit after number",
+		input: "72°F",
+		want: []tokenExpectation{
+			{Type: tokens.LIT_INT, Value: "72", Col: 1},
+			{Type: tokens.IDENT, Value: "°F", Col: 3},
+		},
+	},
+	{
+		name:  "units after numbers",
+		input: "3 km to °C",
+		want: []tokenExpectation{
+			{Type: tokens.LIT_INT, Value: "3", Col: 1},
+			{Type: tokens.WHITESPACE, Value: " ", Col: 2},
+			{Type: tokens.IDENT, Value: "km", Col: 3},
+			{Type: tokens.WHITESPACE, Value: " ", Col: 5},
+			{Type: tokens.IDENT, Value: "to", Col: 6},
+			{Type: tokens.WHITESPACE, Value: " ", Col: 8},
+			{Type: tokens.IDENT, Value: "°C", Col: 9},
+		},
+	},
+	{
+		name:  "lone degree sign",
+		input: "° + 1",
+		want: []tokenExpectation{
+			{Type: tokens.ILLEGAL, Value: "°", Col: 1},
+		},
+		wantErr: "expecting a unit such as °C",
+	},
 	{
 		name:  "fraction additions with integer",
 		input: "1/2 + 3",
@@ -23,6 +23,29 @@ func IsNumeric(r rune) bool {
 	return (r >= '0' && r <= '9') || r == '.' || r == '_'
 }
 
+// IsRadixDigit returns a predicate matching the digits of base, which must be
+// between 2 and 36, as well as underscores used as digit separators.
+func IsRadixDigit(base int) func(rune) bool {
+	return func(r rune) bool {
+		if r == '_' {
+			return true
+		}
+
+		var d int
+		switch {
+		case r >= '0' && r <= '9':
+			d = int(r - '0')
+		case r >= 'a' && r <= 'z':
+			d = int(r-'a') + 10
+		case r >= 'A' && r <= 'Z':
+			d = int(r-'A') + 10
+		default:
+			return false
+		}
+		return d < base
+	}
+}
+
 func StringPredicate(valid string) func(rune) bool {
 	return func(r rune) bool {
 		return strings.ContainsRune(valid, r)
@@ -0,0 +1,113 @@
+package calc
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ripta/rt/pkg/calc/parser"
+)
+
+// displayList prints a list result. Matrices are printed a row per line,
+// with their columns aligned.
+func (c *Calculator) displayList(l *parser.List) {
+	t, err := c.formatMatrix(l)
+	if err != nil {
+		c.DisplayError(err)
+		return
+	}
+	fmt.Fprintf(c.stdout(), "%s\n", t)
+}
+
+// formatList formats l on a single line, as in [1, 2, [3, 4]], with each
+// element formatted like a result of its own.
+func (c *Calculator) formatList(l *parser.List) (string, error) {
+	elems, err := c.formatElems(l.Elems)
+	if err != nil {
+		return "", err
+	}
+	return "[" + strings.Join(elems, ", ") + "]", nil
+}
+
+// formatMatrix formats l as a grid if it is a matrix, and otherwise as
+// formatList does.
+func (c *Calculator) formatMatrix(l *parser.List) (string, error) {
+	var rows [][]string
+	for _, elem := range l.Elems {
+		row, ok := elem.(*parser.List)
+		if !ok || len(row.Elems) == 0 || len(rows) > 0 && len(row.Elems) != len(rows[0]) || slices.ContainsFunc(row.Elems, isList) {
+			return c.formatList(l)
+		}
+
+		cells, err := c.formatElems(row.Elems)
+		if err != nil {
+			return "", err
+		}
+		rows = append(rows, cells)
+	}
+	if len(rows) == 0 {
+		return c.formatList(l)
+	}
+
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for j, cell := range row {
+			widths[j] = max(widths[j], utf8.RuneCountInString(cell))
+		}
+	}
+
+	lines := make([]string, len(rows))
+	for i, row := range rows {
+		var sb strings.Builder
+		for j, cell := range row {
+			if j > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(strings.Repeat(" ", widths[j]-utf8.RuneCountInString(cell)))
+			sb.WriteString(cell)
+		}
+		lines[i] = " [" + sb.String() + "]"
+	}
+	lines[0] = "[" + lines[0][1:]
+	return strings.Join(lines, ",\n") + "]", nil
+}
+
+// isList reports whether v is a list.
+func isList(v parser.Value) bool {
+	_, ok := v.(*parser.List)
+	return ok
+}
+
+// formatElems formats each of vals.
+func (c *Calculator) formatElems(vals []parser.Value) ([]string, error) {
+	elems := make([]string, len(vals))
+	for i, v := range vals {
+		switch v := v.(type) {
+		case *parser.Number:
+			t, unit := c.formatNumber(v)
+			if unit != "" {
+				t += " " + unit
+			}
+			elems[i] = t
+
+		case *parser.Complex:
+			t, err := c.formatComplex(v)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = t
+
+		case *parser.List:
+			t, err := c.formatList(v)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = t
+
+		default:
+			elems[i] = fmt.Sprint(v)
+		}
+	}
+	return elems, nil
+}
@@ -0,0 +1,198 @@
+package calc
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ripta/reals/pkg/constructive"
+	"github.com/ripta/reals/pkg/unified"
+)
+
+// Notations in which decimal results are displayed. Fixed-point shows
+// decimal_places digits after the point; the others show a mantissa and a
+// power of ten, which engineering notation keeps to a multiple of three.
+// Auto uses fixed-point for moderate magnitudes and scientific otherwise.
+const (
+	NotationFixed = "fixed"
+	NotationSci   = "sci"
+	NotationEng   = "eng"
+	NotationAuto  = "auto"
+)
+
+var notations = []string{NotationFixed, NotationSci, NotationEng, NotationAuto}
+
+// Auto notation switches to scientific for results of at least 10^21 or
+// below 10^-6, as JavaScript does.
+const (
+	autoMaxExponent = 21
+	autoMinExponent = -6
+)
+
+// maxMagnitudeBits bounds the extra precision spent finding the leading
+// digits of a tiny result. Results smaller than about 2^-maxMagnitudeBits
+// are indistinguishable from zero.
+const maxMagnitudeBits = 4096
+
+// maxSigFigs bounds the sig_figs setting.
+const maxSigFigs = 10000
+
+// significand is a decimal number rounded to a number of significant
+// digits: ±0.digits × 10^(exp+1), i.e. the first digit is in the 10^exp
+// place. Zero has no digits.
+type significand struct {
+	neg    bool
+	digits string
+	exp    int
+}
+
+// roundSignificant rounds x, or exact if it is known, to sig significant
+// digits.
+func roundSignificant(x *unified.Real, exact *big.Rat, sig int) significand {
+	r := exact
+	if r == nil {
+		r = approximateRelative(x, sig)
+	}
+	if r.Sign() == 0 {
+		return significand{}
+	}
+
+	abs := new(big.Rat).Abs(r)
+	exp := decimalExponent(abs)
+
+	// Scale so that the significant digits are in the integer part, then
+	// round half away from zero
+	scaled := new(big.Rat).Mul(abs, pow10Rat(sig-1-exp))
+	scaled.Add(scaled, big.NewRat(1, 2))
+
+	digits := new(big.Int).Quo(scaled.Num(), scaled.Denom()).String()
+	if len(digits) > sig {
+		// Rounding carried into a new digit, as in 9.99 to 10.0
+		digits = digits[:sig]
+		exp++
+	}
+	return significand{neg: r.Sign() < 0, digits: digits, exp: exp}
+}
+
+// approximateRelative approximates x accurately enough to round it to sig
+// significant digits, whatever its magnitude.
+func approximateRelative(x *unified.Real, sig int) *big.Rat {
+	need := int(math.Ceil(float64(sig)*math.Log2(10))) + 8
+
+	prec := -need
+	for {
+		approx := constructive.Approximate(x.Constructive(), prec)
+		if approx == nil {
+			return new(big.Rat)
+		}
+
+		short := need - approx.BitLen()
+		if short <= 0 || -prec >= maxMagnitudeBits+need {
+			return new(big.Rat).SetFrac(approx, new(big.Int).Lsh(big.NewInt(1), uint(-prec)))
+		}
+
+		if approx.Sign() == 0 {
+			// Nothing is known about the magnitude, so zoom in quickly
+			short = -prec
+		}
+		prec = max(prec-short, -(maxMagnitudeBits + need))
+	}
+}
+
+// decimalExponent returns floor(log10(r)) for a positive r.
+func decimalExponent(r *big.Rat) int {
+	exp := len(r.Num().String()) - len(r.Denom().String())
+
+	// The digit counts are off by at most one
+	if r.Cmp(pow10Rat(exp)) < 0 {
+		exp--
+	}
+	return exp
+}
+
+// pow10Rat returns 10^exp.
+func pow10Rat(exp int) *big.Rat {
+	p := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(max(exp, -exp))), nil)
+	if exp < 0 {
+		return new(big.Rat).SetFrac(big.NewInt(1), p)
+	}
+	return new(big.Rat).SetInt(p)
+}
+
+// formatNotation formats a decimal result in the configured notation,
+// returning the empty string if fixed-point formatting should be used
+// instead.
+func (c *Calculator) formatNotation(x *unified.Real, exact *big.Rat) string {
+	notation := c.Notation
+	if notation == "" {
+		notation = NotationFixed
+	}
+	if notation == NotationFixed && c.SigFigs == 0 {
+		return ""
+	}
+
+	sig := c.SigFigs
+	if sig == 0 {
+		sig = c.DecimalPlaces + 1
+	}
+	s := roundSignificant(x, exact, sig)
+
+	if notation == NotationAuto {
+		notation = NotationFixed
+		if s.digits != "" && (s.exp >= autoMaxExponent || s.exp < autoMinExponent) {
+			notation = NotationSci
+		}
+		if notation == NotationFixed && c.SigFigs == 0 {
+			return ""
+		}
+	}
+
+	if s.digits == "" {
+		return "0"
+	}
+
+	var t string
+	switch notation {
+	case NotationSci:
+		t = c.formatMantissa(s, 0) + "e" + strconv.Itoa(s.exp)
+	case NotationEng:
+		shift := s.exp - floorDiv(s.exp, 3)*3
+		t = c.formatMantissa(s, shift) + "e" + strconv.Itoa(s.exp-shift)
+	default:
+		t = c.formatMantissa(s, s.exp)
+	}
+
+	if s.neg {
+		t = "-" + t
+	}
+	return t
+}
+
+// formatMantissa renders the digits of s with the decimal point after the
+// first shift+1 digits, padding with zeros as needed.
+func (c *Calculator) formatMantissa(s significand, shift int) string {
+	digits := s.digits
+	if shift < 0 {
+		digits = strings.Repeat("0", -shift) + digits
+		shift = 0
+	}
+	if len(digits) <= shift {
+		return digits + strings.Repeat("0", shift+1-len(digits))
+	}
+
+	t := digits[:shift+1]
+	if frac := digits[shift+1:]; frac != "" {
+		t = c.trimZeros(t + "." + frac)
+	}
+	return t
+}
+
+// floorDiv divides a by a positive b, rounding toward negative infinity.
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && a < 0 {
+		q--
+	}
+	return q
+}
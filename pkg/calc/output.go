@@ -0,0 +1,180 @@
+package calc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ripta/reals/pkg/constructive"
+
+	"github.com/ripta/rt/pkg/calc/parser"
+	"github.com/ripta/rt/pkg/calc/tokens"
+)
+
+// Output formats for non-interactive use. Text prints bare results and
+// reports errors on stderr; JSON prints one Record per line of input.
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+var outputFormats = []string{OutputText, OutputJSON}
+
+// Record is the outcome of evaluating one line of input, as printed by
+// --output json.
+type Record struct {
+	// Line is the line number of the input on stdin, or the position of the
+	// expression among the command-line arguments, counting from 1.
+	Line       int    `json:"line"`
+	Expression string `json:"expression"`
+
+	// Type is "number", "complex", "bool", "list" or "expression", and is
+	// empty for lines that produce no value, such as function definitions and
+	// meta-commands.
+	Type string `json:"type,omitempty"`
+	// Result is the value formatted by the display settings, without its
+	// unit, which is given separately.
+	Result string `json:"result,omitempty"`
+	Unit   string `json:"unit,omitempty"`
+	// Exact is the value as a fraction in lowest terms, if it is known to
+	// be rational.
+	Exact string `json:"exact,omitempty"`
+	// Construction is the internal construction of the value, as shown in
+	// verbose mode.
+	Construction string `json:"construction,omitempty"`
+
+	// Output is whatever a meta-command printed.
+	Output string `json:"output,omitempty"`
+
+	Error *RecordError `json:"error,omitempty"`
+}
+
+// RecordError describes an error, along with its position in the
+// expression if known.
+type RecordError struct {
+	Message  string           `json:"message"`
+	Position *tokens.Position `json:"position,omitempty"`
+}
+
+// processLineJSON is processLine for JSON output. The outcome of the line,
+// including any error, is printed as a single Record.
+func (c *Calculator) processLineJSON(expr string, lineNum int) error {
+	defer func() {
+		c.count++
+	}()
+
+	expr = strings.TrimSpace(expr)
+	if blank(expr) {
+		return nil
+	}
+
+	rec := &Record{Line: lineNum, Expression: expr}
+
+	var err error
+	if strings.HasPrefix(expr, ".") {
+		// Capture what the meta-command prints, so that it does not break
+		// up the stream of records
+		var buf bytes.Buffer
+		out := c.out
+		c.out = &buf
+		err = c.handleMetaCommand(expr)
+		c.out = out
+		rec.Output = buf.String()
+	} else {
+		c.history = append(c.history, expr)
+
+		ctx, cancel := c.bounded()
+		defer cancel()
+
+		var res parser.Value
+		res, err = c.EvaluateContext(ctx, expr)
+		if err == nil && res != nil {
+			c.last = res
+
+			// The record is filled in on a copy, which is abandoned if
+			// formatting runs out of time
+			filled := *rec
+			err = c.format(ctx, func(c *Calculator) error {
+				return c.fillRecord(&filled, res)
+			})
+			if err == nil {
+				*rec = filled
+			}
+		}
+	}
+
+	if err != nil {
+		rec.Error = newRecordError(err)
+	}
+
+	enc := json.NewEncoder(c.stdout())
+	enc.SetEscapeHTML(false)
+	if encErr := enc.Encode(rec); encErr != nil {
+		return encErr
+	}
+	return err
+}
+
+// fillRecord sets the fields of rec that describe the value res. It returns
+// an error if the value cannot be formatted.
+func (c *Calculator) fillRecord(rec *Record, res parser.Value) error {
+	rec.Type = res.Type()
+
+	switch v := res.(type) {
+	case parser.Bool:
+		rec.Result = v.String()
+
+	case *parser.Complex:
+		t, err := c.formatComplex(v)
+		if err != nil {
+			return err
+		}
+		rec.Result = t
+
+	case *parser.List:
+		t, err := c.formatList(v)
+		if err != nil {
+			return err
+		}
+		rec.Result = t
+
+	case *parser.Expr:
+		rec.Result = v.String()
+
+	case *parser.Number:
+		rec.Result, rec.Unit = c.formatNumber(v)
+		if exact := v.DisplayExact(); exact != nil {
+			rec.Exact = exact.RatString()
+		}
+
+		mag, _ := v.Display()
+		rec.Construction = constructive.AsConstruction(mag.Constructive())
+	}
+	return nil
+}
+
+// newRecordError converts err into a RecordError, separating out the
+// position of the error if it has one.
+func newRecordError(err error) *RecordError {
+	var perr *parser.PositionError
+	if !errors.As(err, &perr) || perr.Pos.IsZero() {
+		return &RecordError{Message: err.Error()}
+	}
+
+	msg := err.Error()
+	if err == error(perr) {
+		msg = perr.Err.Error()
+	}
+	return &RecordError{Message: msg, Position: &perr.Pos}
+}
+
+// validateOutput checks that v is an output format.
+func validateOutput(v string) error {
+	if !slices.Contains(outputFormats, v) {
+		return fmt.Errorf("output must be one of %s", strings.Join(outputFormats, ", "))
+	}
+	return nil
+}
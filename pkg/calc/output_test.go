@@ -0,0 +1,117 @@
+package calc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ripta/rt/pkg/calc/tokens"
+)
+
+func TestProcessLineJSON(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	c := &Calculator{DecimalPlaces: 5, out: &buf}
+
+	lines := []string{
+		"1/3",
+		"",
+		"3 km + 200 m",
+		"2 > 1",
+		"sq(x) = x * x",
+		".set display rational",
+		"sq(1/2)",
+		"PI",
+		"(1 + 2i) / 2",
+		"inv([[2, 0], [0, 4]])",
+		"[1, 2] * 2",
+		"diff(x ** 3, x)",
+		"1 + nosuch",
+		"# only a comment",
+	}
+	for i, line := range lines {
+		c.processLineJSON(line, i+1)
+	}
+
+	var got []Record
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var rec Record
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		got = append(got, rec)
+	}
+
+	want := []Record{
+		{Line: 1, Expression: "1/3", Type: "number", Result: "0.33333", Exact: "1/3"},
+		{Line: 3, Expression: "3 km + 200 m", Type: "number", Result: "3.2", Unit: "km", Exact: "16/5"},
+		{Line: 4, Expression: "2 > 1", Type: "bool", Result: "true"},
+		{Line: 5, Expression: "sq(x) = x * x"},
+		{Line: 6, Expression: ".set display rational", Output: "display set to rational\n"},
+		{Line: 7, Expression: "sq(1/2)", Type: "number", Result: "1/4", Exact: "1/4"},
+		{Line: 8, Expression: "PI", Type: "number", Result: "3.14159"},
+		{Line: 9, Expression: "(1 + 2i) / 2", Type: "complex", Result: "1/2 + i"},
+		{Line: 10, Expression: "inv([[2, 0], [0, 4]])", Type: "list", Result: "[[1/2, 0], [0, 1/4]]"},
+		{Line: 11, Expression: "[1, 2] * 2", Type: "list", Result: "[2, 4]"},
+		{Line: 12, Expression: "diff(x ** 3, x)", Type: "expression", Result: "3 * x ** 2"},
+		{Line: 13, Expression: "1 + nosuch", Error: &RecordError{
+			Message:  `undefined identifier "nosuch"`,
+			Position: &tokens.Position{File: "(eval)", Line: 1, Column: 5},
+		}},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d records, want %d:\n%s", len(got), len(want), buf.String())
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.Type == "number" && g.Construction == "" {
+			t.Errorf("record %d: missing construction", i)
+		}
+		g.Construction = ""
+
+		gj, _ := json.Marshal(g)
+		wj, _ := json.Marshal(w)
+		if !bytes.Equal(gj, wj) {
+			t.Errorf("record %d:\n got %s\nwant %s", i, gj, wj)
+		}
+	}
+}
+
+func TestValidateOutput(t *testing.T) {
+	t.Parallel()
+
+	for _, v := range []string{OutputText, OutputJSON} {
+		if err := validateOutput(v); err != nil {
+			t.Errorf("validateOutput(%q): %v", v, err)
+		}
+	}
+	if err := validateOutput("yaml"); err == nil || !strings.Contains(err.Error(), "text, json") {
+		t.Errorf("validateOutput(yaml) = %v, want error listing formats", err)
+	}
+}
+
+func TestProcessLineJSONFormatError(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	c := &Calculator{DecimalPlaces: 5, out: &buf}
+	c.processLineJSON(".set complex polar", 1)
+	buf.Reset()
+
+	err := c.processLineJSON("(sin(1)**2 + cos(1)**2 - 1) * i", 2)
+	if err == nil {
+		t.Fatalf("processLineJSON: got nil error, want the formatting error:\n%s", buf.String())
+	}
+
+	var rec Record
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if rec.Error == nil || rec.Error.Message != err.Error() {
+		t.Errorf("record error = %+v, want %q", rec.Error, err)
+	}
+}
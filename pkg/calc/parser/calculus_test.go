@@ -0,0 +1,170 @@
+package parser
+
+import (
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{name: "polynomial", expr: "diff(x ** 3 + 2 * x, x)", want: "3 * x ** 2 + 2"},
+		{name: "product", expr: "diff(x * sin(x), x)", want: "sin(x) + x * cos(x)"},
+		{name: "quotient", expr: "diff(ln(x) / x, x)", want: "(1 - ln(x)) / x ** 2"},
+		{name: "chain rule", expr: "diff(E ** (x ** 2), x)", want: "2 * x * E ** x ** 2"},
+		{name: "power of sum", expr: "diff((2 * x + 1) ** 2, x)", want: "4 * (2 * x + 1)"},
+		{name: "variable exponent", expr: "diff(x ** x, x)", want: "x ** x * (ln(x) + 1)"},
+		{name: "second derivative", expr: "diff(diff(x ** 4, x), x)", want: "12 * x ** 2"},
+		{name: "unbound constant", expr: "diff(a * x, x)", want: "a"},
+		{name: "other variable", expr: "diff(x * y, y)", want: "x"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			v, err := parseAndEval(t, tt.expr, NewEnv())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			e, ok := v.(*Expr)
+			if !ok {
+				t.Fatalf("%s = %v (%T), want an expression", tt.expr, v, v)
+			}
+			if got := e.String(); got != tt.want {
+				t.Errorf("%s = %s, want %s", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffValue(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{name: "constant derivative", expr: "diff(3 * x, x) == 3"},
+		{name: "constant", expr: "diff(PI, x) == 0"},
+		{name: "bound variable", expr: "a = 5; g(x) = diff(a * x ** 2, x); g(2) == 20"},
+		{name: "function of derivative", expr: "f(x) = x ** 3; df(x) = diff(f(x), x); df(2) == 12"},
+		{name: "derivative of function", expr: "f(t) = t ** 2 + t; g(x) = diff(f(x), x); g(3) == 7"},
+		{name: "log with base", expr: "g(x) = diff(log(x, 2), x); g(1) == 1 / ln(2)"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			v, err := parseAndEval(t, tt.expr, NewEnv())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if v != Bool(true) {
+				t.Errorf("%s = %v, want true", tt.expr, v)
+			}
+		})
+	}
+}
+
+func TestSolveIntegrate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		expr string
+		want float64
+	}{
+		{name: "newton", expr: "solve(x ** 2 - 2, x, 1)", want: math.Sqrt2},
+		{name: "newton of cubic", expr: "solve(x ** 3 - x - 1, x, 1)", want: 1.324717957244746},
+		{name: "newton of function", expr: "f(t) = t ** 2 - 9; solve(f(x), x, 1)", want: 3},
+		{name: "newton of double root", expr: "solve(x ** 2, x, 1)", want: 0},
+		{name: "newton of triple root", expr: "solve((x - 2) ** 3, x, 3)", want: 2},
+		{name: "bisection", expr: "solve(cos(x) - x, x, 0, 1)", want: 0.7390851332151607},
+		{name: "bisection of step", expr: "solve(floor(x) - 2.5, x, 1, 5)", want: 3},
+		{name: "polynomial", expr: "integrate(x ** 2, x, 0, 1)", want: 1.0 / 3},
+		{name: "trigonometric", expr: "integrate(sin(x), x, 0, PI)", want: 2},
+		{name: "reversed bounds", expr: "integrate(x, x, 1, 0)", want: -0.5},
+		{name: "kink", expr: "integrate(abs(x), x, -1, 2)", want: 2.5},
+		{name: "singular derivative", expr: "integrate(sqrt(x), x, 0, 1)", want: 2.0 / 3},
+		{name: "gaussian", expr: "integrate(exp(-(x ** 2)), x, -10, 10)", want: math.Sqrt(math.Pi)},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			v, err := parseAndEval(t, tt.expr, NewEnv())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := realToFloat(t, v); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("%s = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSolveMultipleRoot(t *testing.T) {
+	t.Parallel()
+
+	// Near a double root, x ** 2 rounds to zero long before x does
+	env := NewEnv()
+	v, err := parseAndEval(t, "solve(x ** 2, x, 1)", env)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := approximateRealForTest(t, v.(*Number).Real, env.precision)
+	tol := new(big.Rat).SetFrac(big.NewInt(1), new(big.Int).Lsh(big.NewInt(1), uint(-env.precision)))
+	if got.Abs(got).Cmp(tol) > 0 {
+		t.Errorf("solve(x ** 2, x, 1) = %s, want 0 to within %s", got.FloatString(40), tol.FloatString(40))
+	}
+}
+
+func TestCalculusErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr string
+	}{
+		{name: "non-variable", expr: "diff(x ** 2, 3)", wantErr: "diff: argument 2 must be a variable name, got 3"},
+		{name: "not differentiable", expr: "diff(floor(x), x)", wantErr: "test:1:1: diff: cannot differentiate floor"},
+		{name: "recursive function", expr: "f(x) = x * f(x - 1); diff(f(x), x)", wantErr: "recursive"},
+		{name: "newton not differentiable", expr: "solve(floor(x) - 2, x, 1)", wantErr: "test:1:1: solve: cannot differentiate floor; give an interval to bisect instead"},
+		{name: "zero derivative", expr: "solve(x ** 2 + 1, x, 0)", wantErr: "solve: derivative is zero at 0"},
+		{name: "same sign", expr: "solve(x ** 2, x, 1, 2)", wantErr: "solve: expression has the same sign at both ends of the interval"},
+		{name: "pole", expr: "integrate(1/x, x, -1, 1)", wantErr: "integrate: did not converge; the expression may not be integrable over the interval"},
+		{name: "off-center pole", expr: "integrate(1/(x - 1/4), x, 0, 1/2)", wantErr: "integrate: did not converge"},
+		{name: "units", expr: "integrate(x m, x, 0, 1)", wantErr: "integrate requires a dimensionless value, got m"},
+		{name: "list", expr: "[diff(x * y, y)]", wantErr: "list elements must be numbers, got expression"},
+		{name: "arity", expr: "integrate(x, x, 0)", wantErr: "integrate"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := parseAndEval(t, tt.expr, NewEnv())
+			if err == nil {
+				t.Fatalf("expected error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error mismatch: got %v want substring %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,432 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ripta/reals/pkg/constructive"
+	"github.com/ripta/reals/pkg/rational"
+	"github.com/ripta/reals/pkg/unified"
+
+	"github.com/ripta/rt/pkg/calc/tokens"
+)
+
+// ErrNonReal is returned by real operations whose result is complex, such as
+// the square root of a negative number, so that they can be retried over
+// the complex numbers.
+var ErrNonReal = errors.New("result is non-real")
+
+// imaginaryUnits name the imaginary unit, unless shadowed by a variable.
+// Mathematicians write i and engineers write j.
+var imaginaryUnits = []string{"i", "j"}
+
+// Complex is a complex number Re + Im·i, whose parts are dimensionless
+// numbers. Results whose imaginary part is known to be zero are returned as
+// a Number instead.
+type Complex struct {
+	Re *Number
+	Im *Number
+}
+
+func (z *Complex) Type() string {
+	return "complex"
+}
+
+// newComplex returns re + im·i, or just re if im is zero.
+func newComplex(re, im *Number) Value {
+	if isZero(im) {
+		return re
+	}
+	return &Complex{Re: re, Im: im}
+}
+
+// imaginaryUnit returns i.
+func imaginaryUnit() *Complex {
+	return &Complex{Re: newExact(new(big.Rat)), Im: newExact(big.NewRat(1, 1))}
+}
+
+// complexOne returns 1 as a complex number.
+func complexOne() *Complex {
+	return &Complex{Re: newExact(big.NewRat(1, 1)), Im: newExact(new(big.Rat))}
+}
+
+// toComplex converts a number or complex value to a complex number, as
+// needed by the operator or function named by tok.
+func toComplex(val Value, tok tokens.Token) (*Complex, error) {
+	if z, ok := val.(*Complex); ok {
+		return z, nil
+	}
+
+	n, err := asNumber(val, tok)
+	if err != nil {
+		return nil, err
+	}
+	if !n.Dim.IsZero() {
+		return nil, errorAt(tok.Pos, "complex numbers must be dimensionless, got %s", n.Dim)
+	}
+	return &Complex{Re: &Number{Real: n.Real, Exact: n.Exact}, Im: newExact(new(big.Rat))}, nil
+}
+
+// isComplex reports whether val is a complex number.
+func isComplex(val Value) bool {
+	_, ok := val.(*Complex)
+	return ok
+}
+
+// isZero reports whether n is known to be zero.
+func isZero(n *Number) bool {
+	if n.Exact != nil {
+		return n.Exact.Sign() == 0
+	}
+	return n.Real.IsZero()
+}
+
+// combine applies an arithmetic operation to two dimensionless numbers,
+// tracking the exact result when both are exact.
+func combine(a, b *Number, op func(x, y *unified.Real) *unified.Real, exactOp func(z, x, y *big.Rat) *big.Rat) *Number {
+	if a.Exact != nil && b.Exact != nil {
+		return newExact(exactOp(new(big.Rat), a.Exact, b.Exact))
+	}
+	return NewNumber(op(a.Real, b.Real))
+}
+
+// addParts, subParts and mulParts short-circuit operands that are known to
+// be zero, so that parts which cancel in exact arithmetic are known to be
+// zero even if the other operand is irrational.
+func addParts(a, b *Number) *Number {
+	switch {
+	case isZero(a):
+		return b
+	case isZero(b):
+		return a
+	}
+	return combine(a, b, (*unified.Real).Add, (*big.Rat).Add)
+}
+
+func subParts(a, b *Number) *Number {
+	switch {
+	case isZero(b):
+		return a
+	case isZero(a):
+		return negPart(b)
+	}
+	return combine(a, b, (*unified.Real).Subtract, (*big.Rat).Sub)
+}
+
+func mulParts(a, b *Number) *Number {
+	if isZero(a) || isZero(b) {
+		return newExact(new(big.Rat))
+	}
+	return combine(a, b, (*unified.Real).Multiply, (*big.Rat).Mul)
+}
+
+// quoParts divides a by b, which must not be zero.
+func quoParts(a, b *Number) *Number {
+	return combine(a, b, (*unified.Real).Divide, (*big.Rat).Quo)
+}
+
+func negPart(a *Number) *Number {
+	if a.Exact != nil {
+		return newExact(new(big.Rat).Neg(a.Exact))
+	}
+	return NewNumber(a.Real.Negate())
+}
+
+// sqrtPart returns the square root of a non-negative number, exactly if it
+// is the square of a rational.
+func sqrtPart(a *Number) *Number {
+	if a.Exact != nil {
+		if r := exactSqrt(a.Exact); r != nil {
+			return newExact(r)
+		}
+	}
+	return NewNumber(unified.New(constructive.Sqrt(a.Real.Constructive()), rational.One()))
+}
+
+// exactSqrt returns the square root of r if it is the square of a rational,
+// or nil otherwise.
+func exactSqrt(r *big.Rat) *big.Rat {
+	if r.Sign() < 0 {
+		return nil
+	}
+
+	num, den := new(big.Int).Sqrt(r.Num()), new(big.Int).Sqrt(r.Denom())
+	if new(big.Int).Mul(num, num).Cmp(r.Num()) != 0 || new(big.Int).Mul(den, den).Cmp(r.Denom()) != 0 {
+		return nil
+	}
+	return new(big.Rat).SetFrac(num, den)
+}
+
+func complexAdd(z, w *Complex) Value {
+	return newComplex(addParts(z.Re, w.Re), addParts(z.Im, w.Im))
+}
+
+func complexSub(z, w *Complex) Value {
+	return newComplex(subParts(z.Re, w.Re), subParts(z.Im, w.Im))
+}
+
+// complexMul computes (a+bi)(c+di) = (ac-bd) + (ad+bc)i.
+func complexMul(z, w *Complex) *Complex {
+	re := subParts(mulParts(z.Re, w.Re), mulParts(z.Im, w.Im))
+	im := addParts(mulParts(z.Re, w.Im), mulParts(z.Im, w.Re))
+	return &Complex{Re: re, Im: im}
+}
+
+// complexQuo computes (a+bi)/(c+di) = ((ac+bd) + (bc-ad)i) / (c²+d²).
+func complexQuo(z, w *Complex) (*Complex, error) {
+	den := addParts(mulParts(w.Re, w.Re), mulParts(w.Im, w.Im))
+	if isZero(den) {
+		return nil, fmt.Errorf("division by zero")
+	}
+
+	re := addParts(mulParts(z.Re, w.Re), mulParts(z.Im, w.Im))
+	im := subParts(mulParts(z.Im, w.Re), mulParts(z.Re, w.Im))
+	return &Complex{Re: quoParts(re, den), Im: quoParts(im, den)}, nil
+}
+
+// modulus returns |z|.
+func modulus(z *Complex) *Number {
+	return sqrtPart(addParts(mulParts(z.Re, z.Re), mulParts(z.Im, z.Im)))
+}
+
+// argument returns the angle of z from the positive real axis, in
+// (-π, π].
+func argument(env *Env, z *Complex) (*Number, error) {
+	if isZero(z.Im) && sign(z.Re.Real, env.precision) >= 0 {
+		return newExact(new(big.Rat)), nil
+	}
+	if isZero(z.Im) {
+		return NewNumber(unified.Pi()), nil
+	}
+
+	a, err := fnAtan2(env, []*unified.Real{z.Im.Real, z.Re.Real})
+	if err != nil {
+		return nil, err
+	}
+	return NewNumber(a), nil
+}
+
+// Polar returns the modulus and argument of z, the argument in radians.
+func (e *Env) Polar(z *Complex) (*Number, *Number, error) {
+	arg, err := argument(e, z)
+	if err != nil {
+		return nil, nil, err
+	}
+	return modulus(z), arg, nil
+}
+
+// complexSqrt returns the principal square root of z, whose real part is
+// non-negative:
+//
+//	√(a+bi) = √((|z|+a)/2) ± √((|z|-a)/2)·i
+//
+// with the sign of the imaginary part following b.
+func complexSqrt(env *Env, z *Complex) Value {
+	r := modulus(z)
+	half := newExact(big.NewRat(1, 2))
+
+	re := sqrtPart(mulParts(addParts(r, z.Re), half))
+	im := sqrtPart(mulParts(subParts(r, z.Re), half))
+	if !isZero(z.Im) && sign(z.Im.Real, env.precision) < 0 {
+		im = negPart(im)
+	}
+	return newComplex(re, im)
+}
+
+// complexExp returns e^(a+bi) = e^a·(cos b + i·sin b).
+func complexExp(z *Complex) Value {
+	scale := NewNumber(unified.New(constructive.Exp(z.Re.Real.Constructive()), rational.One()))
+	if isZero(z.Re) {
+		scale = newExact(big.NewRat(1, 1))
+	}
+	if isZero(z.Im) {
+		return scale
+	}
+
+	b := z.Im.Real.Constructive()
+	cos := NewNumber(unified.New(constructive.Cos(b), rational.One()))
+	sin := NewNumber(unified.New(constructive.Sin(b), rational.One()))
+	return newComplex(mulParts(scale, cos), mulParts(scale, sin))
+}
+
+// complexPower raises z to the power w. Integer powers are computed by
+// repeated multiplication, which keeps exact parts exact; other powers are
+// the principal value e^(w·ln z).
+func complexPower(env *Env, z, w *Complex) (Value, error) {
+	if isZero(w.Im) {
+		if k, ok := smallInteger(w.Re, env.precision); ok {
+			return complexIntPower(z, k)
+		}
+	}
+
+	if isZero(z.Re) && isZero(z.Im) {
+		if isZero(w.Im) && sign(w.Re.Real, env.precision) > 0 {
+			return newExact(new(big.Rat)), nil
+		}
+		return nil, fmt.Errorf("zero to a complex or negative power is undefined")
+	}
+
+	arg, err := argument(env, z)
+	if err != nil {
+		return nil, err
+	}
+	lnMod, err := lnPart(modulus(z), env.precision)
+	if err != nil {
+		return nil, err
+	}
+
+	return complexExp(complexMul(w, &Complex{Re: lnMod, Im: arg})), nil
+}
+
+// lnPart returns the natural logarithm of a positive number, which is
+// exactly zero for exactly one, as for powers of numbers on the unit circle.
+func lnPart(a *Number, precision int) (*Number, error) {
+	if a.Exact != nil && a.Exact.Cmp(big.NewRat(1, 1)) == 0 {
+		return newExact(new(big.Rat)), nil
+	}
+
+	r, err := ln(a.Real, precision)
+	if err != nil {
+		return nil, err
+	}
+	return NewNumber(r), nil
+}
+
+// smallInteger returns n as an int if it is an integer small enough to
+// raise a complex number to.
+func smallInteger(n *Number, precision int) (int64, bool) {
+	i := n.Exact
+	if i == nil {
+		approx, ok := integerValue(n.Real, precision)
+		if !ok {
+			return 0, false
+		}
+		i = new(big.Rat).SetInt(approx)
+	}
+
+	if !i.IsInt() || !i.Num().IsInt64() {
+		return 0, false
+	}
+	k := i.Num().Int64()
+	return k, k >= -maxExactExponent && k <= maxExactExponent
+}
+
+// complexIntPower raises z to the integer power k by repeated squaring.
+func complexIntPower(z *Complex, k int64) (Value, error) {
+	base := z
+	if k < 0 {
+		var err error
+		if base, err = complexQuo(complexOne(), z); err != nil {
+			return nil, fmt.Errorf("zero to negative power is undefined")
+		}
+		k = -k
+	}
+
+	res := complexOne()
+	for ; k > 0; k >>= 1 {
+		if k&1 == 1 {
+			res = complexMul(res, base)
+		}
+		base = complexMul(base, base)
+	}
+	return newComplex(res.Re, res.Im), nil
+}
+
+// applyComplex applies an arithmetic operator to operands of which at least
+// one is complex.
+func (n *BinaryNode) applyComplex(env *Env, lv, rv Value) (Value, error) {
+	l, err := toComplex(lv, n.Op)
+	if err != nil {
+		return nil, err
+	}
+	r, err := toComplex(rv, n.Op)
+	if err != nil {
+		return nil, err
+	}
+
+	var res Value
+	switch n.Op.Type {
+	case tokens.OP_PLUS:
+		res = complexAdd(l, r)
+	case tokens.OP_MINUS:
+		res = complexSub(l, r)
+	case tokens.OP_STAR:
+		m := complexMul(l, r)
+		res = newComplex(m.Re, m.Im)
+	case tokens.OP_SLASH:
+		q, err := complexQuo(l, r)
+		if err != nil {
+			return nil, errorAt(n.Op.Pos, "%w", err)
+		}
+		res = newComplex(q.Re, q.Im)
+	case tokens.OP_POW:
+		res, err = complexPower(env, l, r)
+		if err != nil {
+			return nil, errorAt(n.Op.Pos, "%w", err)
+		}
+	default:
+		return nil, errorAt(n.Op.Pos, "%s is not defined for complex numbers", opSymbol(n.Op))
+	}
+	return res, nil
+}
+
+// compareComplex evaluates == and != where either operand is complex.
+// Complex numbers are equal if both their parts are within the environment's
+// tolerance; they have no ordering.
+func (n *BinaryNode) compareComplex(env *Env, lv, rv Value) (Value, error) {
+	if n.Op.Type != tokens.OP_EQ && n.Op.Type != tokens.OP_NE {
+		return nil, errorAt(n.Op.Pos, "%s is not defined for complex numbers, which have no order", opSymbol(n.Op))
+	}
+
+	l, err := toComplex(lv, n.Op)
+	if err != nil {
+		return nil, err
+	}
+	r, err := toComplex(rv, n.Op)
+	if err != nil {
+		return nil, err
+	}
+
+	eq := true
+	for _, diff := range []*Number{subParts(l.Re, r.Re), subParts(l.Im, r.Im)} {
+		approx, err := approximate(diff.Real, env.precision-comparisonGuardBits)
+		if err != nil {
+			return nil, errorAt(n.Op.Pos, "%w", err)
+		}
+		if new(big.Rat).Abs(approx).Cmp(env.tolerance()) >= 0 {
+			eq = false
+		}
+	}
+	return Bool(eq == (n.Op.Type == tokens.OP_EQ)), nil
+}
+
+// evalComplex evaluates a unary operator on a complex number.
+func (n *UnaryNode) evalComplex(env *Env, z *Complex) (Value, error) {
+	switch n.Op.Type {
+	case tokens.OP_MINUS:
+		return &Complex{Re: negPart(z.Re), Im: negPart(z.Im)}, nil
+	case tokens.OP_ROOT:
+		return complexSqrt(env, z), nil
+	default:
+		return nil, errorAt(n.Op.Pos, "%s is not defined for complex numbers", opSymbol(n.Op))
+	}
+}
+
+// callComplex calls a built-in function on a complex argument.
+func (n *CallNode) callComplex(env *Env, fn *builtinFunc, args []Value) (Value, error) {
+	if fn.Complex == nil || len(args) != 1 {
+		return nil, errorAt(n.Name.Pos, "%s is not defined for complex numbers", n.Name.Value)
+	}
+
+	z, err := toComplex(args[0], n.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := fn.Complex(env, z)
+	if err != nil {
+		return nil, errorAt(n.Name.Pos, "%s: %w", n.Name.Value, err)
+	}
+	return res, nil
+}
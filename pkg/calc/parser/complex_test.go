@@ -0,0 +1,170 @@
+package parser
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// complexParts approximates the real and imaginary parts of v, which may be
+// a real number.
+func complexParts(t *testing.T, v Value) (float64, float64) {
+	t.Helper()
+
+	z, ok := v.(*Complex)
+	if !ok {
+		return realToFloat(t, v), 0
+	}
+	return realToFloat(t, z.Re), realToFloat(t, z.Im)
+}
+
+func TestComplexArithmetic(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		expr     string
+		wantRe   float64
+		wantIm   float64
+		wantReal bool
+	}{
+		{name: "imaginary literal", expr: "4i", wantIm: 4},
+		{name: "engineering literal", expr: "0.5j", wantIm: 0.5},
+		{name: "imaginary unit", expr: "3 + 2*i", wantRe: 3, wantIm: 2},
+		{name: "i squared", expr: "i*i", wantRe: -1, wantReal: true},
+		{name: "j squared", expr: "j**2", wantRe: -1, wantReal: true},
+		{name: "addition", expr: "(1+2i) + (3-5i)", wantRe: 4, wantIm: -3},
+		{name: "cancelling addition", expr: "(1+2i) + (3-2i)", wantRe: 4, wantReal: true},
+		{name: "subtraction", expr: "(1+2i) - (3-5i)", wantRe: -2, wantIm: 7},
+		{name: "multiplication", expr: "(1+2i) * (3-i)", wantRe: 5, wantIm: 5},
+		{name: "conjugate product", expr: "(3+4i) * (3-4i)", wantRe: 25, wantReal: true},
+		{name: "division", expr: "1 / (1+i)", wantRe: 0.5, wantIm: -0.5},
+		{name: "division by real", expr: "(4+2i) / 2", wantRe: 2, wantIm: 1},
+		{name: "negation", expr: "-(1-i)", wantRe: -1, wantIm: 1},
+		{name: "integer power", expr: "(1+i)**8", wantRe: 16, wantReal: true},
+		{name: "negative integer power", expr: "i**-1", wantIm: -1},
+		{name: "zeroth power", expr: "(2+3i)**0", wantRe: 1, wantReal: true},
+		{name: "i to the i", expr: "i**i", wantRe: math.Exp(-math.Pi / 2), wantReal: true},
+		{name: "real to imaginary power", expr: "2**i", wantRe: math.Cos(math.Ln2), wantIm: math.Sin(math.Ln2)},
+		{name: "cube root of negative", expr: "(-8)**(1/3)", wantRe: 1, wantIm: math.Sqrt(3)},
+		{name: "negative base to fractional power", expr: "-4 ** 0.5", wantIm: 2},
+		{name: "negative base to irrational power", expr: "-3 ** √2", wantRe: math.Pow(3, math.Sqrt2) * math.Cos(math.Pi*math.Sqrt2), wantIm: math.Pow(3, math.Sqrt2) * math.Sin(math.Pi*math.Sqrt2)},
+		{name: "root of negative", expr: "√(-4)", wantIm: 2},
+		{name: "root of complex", expr: "√(3+4i)", wantRe: 2, wantIm: 1},
+		{name: "root of lower half plane", expr: "√(-2i)", wantRe: 1, wantIm: -1},
+		{name: "sqrt of negative", expr: "sqrt(-2)", wantIm: math.Sqrt2},
+		{name: "sqrt of complex", expr: "sqrt(-3-4i)", wantRe: 1, wantIm: -2},
+		{name: "abs", expr: "abs(3+4i)", wantRe: 5, wantReal: true},
+		{name: "abs of real", expr: "abs(-3)", wantRe: 3, wantReal: true},
+		{name: "arg", expr: "arg(-1+i)", wantRe: 3 * math.Pi / 4, wantReal: true},
+		{name: "arg of imaginary", expr: "arg(-2i)", wantRe: -math.Pi / 2, wantReal: true},
+		{name: "arg of negative", expr: "arg(-2)", wantRe: math.Pi, wantReal: true},
+		{name: "arg of positive", expr: "arg(2)", wantRe: 0, wantReal: true},
+		{name: "conj", expr: "conj(3+4i)", wantRe: 3, wantIm: -4},
+		{name: "conj of real", expr: "conj(3)", wantRe: 3, wantReal: true},
+		{name: "re", expr: "re(3+4i)", wantRe: 3, wantReal: true},
+		{name: "im", expr: "im(3+4i)", wantRe: 4, wantReal: true},
+		{name: "im of real", expr: "im(3)", wantRe: 0, wantReal: true},
+		{name: "equality", expr: "(1+i)**2 == 2i", wantRe: 1, wantReal: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			v, err := parseAndEval(t, tt.expr, NewEnv())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if b, ok := v.(Bool); ok {
+				if !bool(b) {
+					t.Fatalf("%s = false, want true", tt.expr)
+				}
+				return
+			}
+
+			if _, ok := v.(*Number); ok != tt.wantReal {
+				t.Errorf("%s is a %s, want real result %v", tt.expr, v.Type(), tt.wantReal)
+			}
+
+			re, im := complexParts(t, v)
+			if math.Abs(re-tt.wantRe) > 1e-9 || math.Abs(im-tt.wantIm) > 1e-9 {
+				t.Errorf("%s = %g%+gi, want %g%+gi", tt.expr, re, im, tt.wantRe, tt.wantIm)
+			}
+		})
+	}
+}
+
+func TestComplexExactParts(t *testing.T) {
+	t.Parallel()
+
+	v, err := parseAndEval(t, "(1/2 + 3i) / (1 - i)", NewEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z, ok := v.(*Complex)
+	if !ok {
+		t.Fatalf("got %T, want *Complex", v)
+	}
+	if z.Re.Exact == nil || z.Re.Exact.RatString() != "-5/4" {
+		t.Errorf("real part = %v, want exactly -5/4", z.Re.Exact)
+	}
+	if z.Im.Exact == nil || z.Im.Exact.RatString() != "7/4" {
+		t.Errorf("imaginary part = %v, want exactly 7/4", z.Im.Exact)
+	}
+}
+
+func TestImaginaryUnitShadowing(t *testing.T) {
+	t.Parallel()
+
+	env := NewEnv()
+	if _, err := parseAndEval(t, "i = 5", env); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := parseAndEval(t, "i + 2j", env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if re, im := complexParts(t, v); re != 5 || im != 2 {
+		t.Errorf("i + 2j = %g%+gi, want 5+2i", re, im)
+	}
+}
+
+func TestComplexErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr string
+	}{
+		{name: "ordering", expr: "i < 2", wantErr: "< is not defined for complex numbers"},
+		{name: "modulo", expr: "(1+i) % 2", wantErr: "% is not defined for complex numbers"},
+		{name: "bitwise", expr: "~i", wantErr: "~ is not defined for complex numbers"},
+		{name: "units", expr: "3 m * i", wantErr: "complex numbers must be dimensionless"},
+		{name: "division by zero", expr: "i / 0", wantErr: "division by zero"},
+		{name: "zero to complex power", expr: "0 ** i", wantErr: "zero to a complex or negative power is undefined"},
+		{name: "zero to negative power", expr: "(0*i) ** -1", wantErr: "zero to negative power is undefined"},
+		{name: "real function", expr: "ln(1+i)", wantErr: "ln is not defined for complex numbers"},
+		{name: "complex among arguments", expr: "max(1, i)", wantErr: "max is not defined for complex numbers"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := parseAndEval(t, tt.expr, NewEnv())
+			if err == nil {
+				t.Fatalf("expected error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error mismatch: got %v want substring %q", err, tt.wantErr)
+			}
+		})
+	}
+}
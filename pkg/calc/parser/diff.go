@@ -0,0 +1,619 @@
+package parser
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+
+	"github.com/ripta/rt/pkg/calc/tokens"
+	"github.com/ripta/rt/pkg/calc/units"
+)
+
+// Expr is an unevaluated expression, such as the derivative produced by
+// diff. It is evaluated where its variables are bound: as the body of a
+// function, or as the expression given to solve or integrate.
+type Expr struct {
+	Node Node
+}
+
+func (e *Expr) Type() string {
+	return "expression"
+}
+
+func (e *Expr) String() string {
+	return e.Node.String()
+}
+
+// evalAt evaluates node with the variable name bound to x, in turn
+// evaluating any expression it produces.
+func evalAt(env *Env, node Node, name string, x Value) (Value, error) {
+	scope := env.child()
+	scope.vars[name] = &binding{value: x, mutable: true}
+	return evalExpr(scope, node)
+}
+
+// evalExpr evaluates node, in turn evaluating any expression it produces.
+func evalExpr(env *Env, node Node) (Value, error) {
+	v, err := node.Eval(env)
+	if e, ok := v.(*Expr); ok && err == nil {
+		return e.Node.Eval(env)
+	}
+	return v, err
+}
+
+// children returns the subexpressions of n, in the order rebuild takes
+// them. Function definitions have none, as their bodies have their own
+// variables.
+func children(n Node) []Node {
+	switch n := n.(type) {
+	case *BinaryNode:
+		return []Node{n.Left, n.Right}
+	case *UnaryNode:
+		return []Node{n.Expr}
+	case *CallNode:
+		return n.Args
+	case *CondNode:
+		return []Node{n.Cond, n.Then, n.Else}
+	case *ListNode:
+		return n.Elems
+	case *UnitNode:
+		return []Node{n.Expr}
+	case *ConvertNode:
+		return []Node{n.Expr}
+	case *CommentNode:
+		return []Node{n.Expr}
+	case *FactorialNode:
+		return []Node{n.Expr}
+	case *SeqNode:
+		return n.Stmts
+	case *AssignNode:
+		return []Node{n.Value}
+	}
+	return nil
+}
+
+// rebuild returns a copy of n with its subexpressions replaced by kids.
+func rebuild(n Node, kids []Node) Node {
+	switch n := n.(type) {
+	case *BinaryNode:
+		return &BinaryNode{Op: n.Op, Left: kids[0], Right: kids[1]}
+	case *UnaryNode:
+		return &UnaryNode{Op: n.Op, Expr: kids[0]}
+	case *CallNode:
+		return &CallNode{Name: n.Name, Args: kids}
+	case *CondNode:
+		return &CondNode{Cond: kids[0], Then: kids[1], Else: kids[2], Tok: n.Tok}
+	case *ListNode:
+		return &ListNode{Elems: kids, Tok: n.Tok}
+	case *UnitNode:
+		return &UnitNode{Expr: kids[0], Unit: n.Unit, Tok: n.Tok}
+	case *ConvertNode:
+		return &ConvertNode{Expr: kids[0], Unit: n.Unit, Tok: n.Tok}
+	case *CommentNode:
+		return &CommentNode{Text: n.Text, Tok: n.Tok, Expr: kids[0]}
+	case *FactorialNode:
+		return &FactorialNode{Expr: kids[0], Op: n.Op}
+	case *SeqNode:
+		return &SeqNode{Stmts: kids}
+	case *AssignNode:
+		return &AssignNode{Name: n.Name, Value: kids[0]}
+	}
+	return n
+}
+
+// substitute returns n with the identifiers in vars replaced by their
+// nodes.
+func substitute(n Node, vars map[string]Node) Node {
+	if id, ok := n.(*IdentNode); ok {
+		if v, ok := vars[id.Name.Value]; ok {
+			return v
+		}
+		return n
+	}
+
+	kids := children(n)
+	if len(kids) == 0 {
+		return n
+	}
+	subs := make([]Node, len(kids))
+	for i, kid := range kids {
+		subs[i] = substitute(kid, vars)
+	}
+	return rebuild(n, subs)
+}
+
+// differ differentiates expressions with respect to a variable, simplifying
+// the result as it goes.
+type differ struct {
+	env  *Env
+	name string
+	// call is the diff call, at whose position generated nodes are placed
+	call *CallNode
+	// inlined names the user-defined functions being differentiated, to
+	// refuse recursive ones
+	inlined []string
+}
+
+// newDiffer returns a differ for the variable named by call's second
+// argument.
+func newDiffer(env *Env, call *CallNode) (*differ, error) {
+	name, err := variableArg(call, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &differ{env: env, name: name, call: call}, nil
+}
+
+// variableArg returns the name of the variable given as call's i-th
+// argument.
+func variableArg(call *CallNode, i int) (string, error) {
+	id, ok := call.Args[i].(*IdentNode)
+	if !ok {
+		return "", errorAt(call.Name.Pos, "%s: argument %d must be a variable name, got %s", call.Name.Value, i+1, call.Args[i])
+	}
+	return id.Name.Value, nil
+}
+
+// differentiate returns the derivative of n with respect to the variable.
+func (d *differ) differentiate(n Node) (Node, error) {
+	return d.derive(d.expand(n))
+}
+
+func fnDiff(env *Env, call *CallNode) (Value, error) {
+	d, err := newDiffer(env, call)
+	if err != nil {
+		return nil, err
+	}
+	node, err := d.differentiate(call.Args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// A derivative that does not depend on the variable is evaluated, unless
+	// it refers to names that are not yet defined
+	if !d.dependsOn(node) && d.isBound(node) {
+		return node.Eval(env)
+	}
+	return &Expr{Node: node}, nil
+}
+
+// expand replaces identifiers other than the variable that are bound to
+// expressions with the expressions themselves.
+func (d *differ) expand(n Node) Node {
+	if id, ok := n.(*IdentNode); ok && id.Name.Value != d.name {
+		if v, ok := d.env.Get(id.Name.Value); ok {
+			if e, ok := v.(*Expr); ok {
+				return d.expand(e.Node)
+			}
+		}
+		return n
+	}
+
+	kids := children(n)
+	if len(kids) == 0 {
+		return n
+	}
+	subs := make([]Node, len(kids))
+	for i, kid := range kids {
+		subs[i] = d.expand(kid)
+	}
+	return rebuild(n, subs)
+}
+
+// dependsOn reports whether n refers to the variable.
+func (d *differ) dependsOn(n Node) bool {
+	if id, ok := n.(*IdentNode); ok {
+		return id.Name.Value == d.name
+	}
+	return slices.ContainsFunc(children(n), d.dependsOn)
+}
+
+// isBound reports whether every identifier in n names a variable, constant
+// or unit.
+func (d *differ) isBound(n Node) bool {
+	if id, ok := n.(*IdentNode); ok {
+		name := id.Name.Value
+		if _, ok := d.env.Get(name); ok || slices.Contains(imaginaryUnits, name) {
+			return true
+		}
+		_, ok := units.Lookup(name)
+		return ok
+	}
+	return !slices.ContainsFunc(children(n), func(kid Node) bool {
+		return !d.isBound(kid)
+	})
+}
+
+func (d *differ) derive(n Node) (Node, error) {
+	if !d.dependsOn(n) {
+		return d.num(new(big.Rat)), nil
+	}
+	if err := d.env.check(); err != nil {
+		return nil, err
+	}
+
+	switch n := n.(type) {
+	case *IdentNode:
+		return d.num(big.NewRat(1, 1)), nil
+
+	case *CommentNode:
+		return d.derive(n.Expr)
+
+	case *UnaryNode:
+		du, err := d.derive(n.Expr)
+		if err != nil {
+			return nil, err
+		}
+		switch n.Op.Type {
+		case tokens.OP_MINUS:
+			return d.neg(du), nil
+		case tokens.OP_ROOT:
+			return d.div(du, d.mul(d.int(2), n)), nil
+		}
+
+	case *BinaryNode:
+		return d.deriveBinary(n)
+
+	case *CallNode:
+		return d.deriveCall(n)
+
+	case *CondNode:
+		then, err := d.derive(n.Then)
+		if err != nil {
+			return nil, err
+		}
+		els, err := d.derive(n.Else)
+		if err != nil {
+			return nil, err
+		}
+		return &CondNode{Cond: n.Cond, Then: then, Else: els, Tok: n.Tok}, nil
+
+	case *ListNode:
+		elems := make([]Node, len(n.Elems))
+		for i, elem := range n.Elems {
+			de, err := d.derive(elem)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = de
+		}
+		return &ListNode{Elems: elems, Tok: n.Tok}, nil
+
+	case *UnitNode:
+		du, err := d.derive(n.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return &UnitNode{Expr: du, Unit: n.Unit, Tok: n.Tok}, nil
+	}
+
+	return nil, d.errorf("cannot differentiate %s", n)
+}
+
+func (d *differ) deriveBinary(n *BinaryNode) (Node, error) {
+	a, b := n.Left, n.Right
+	da, err := d.derive(a)
+	if err != nil {
+		return nil, err
+	}
+	db, err := d.derive(b)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.Op.Type {
+	case tokens.OP_PLUS:
+		return d.add(da, db), nil
+
+	case tokens.OP_MINUS:
+		return d.sub(da, db), nil
+
+	case tokens.OP_STAR:
+		return d.add(d.mul(da, b), d.mul(a, db)), nil
+
+	case tokens.OP_SLASH:
+		return d.div(d.sub(d.mul(da, b), d.mul(a, db)), d.pow(b, d.int(2))), nil
+
+	case tokens.OP_POW:
+		switch {
+		case !d.dependsOn(b):
+			return d.mul(da, d.mul(b, d.pow(a, d.sub(b, d.int(1))))), nil
+		case !d.dependsOn(a):
+			return d.mul(db, d.mul(n, d.ln(a))), nil
+		default:
+			return d.mul(n, d.add(d.mul(db, d.ln(a)), d.div(d.mul(b, da), a))), nil
+		}
+	}
+
+	return nil, d.errorf("cannot differentiate %s", opSymbol(n.Op))
+}
+
+// chainRules give the derivative of each built-in function of one argument
+// at u, which the chain rule multiplies by the derivative of u.
+var chainRules = map[string]func(d *differ, u Node) Node{
+	"sin": func(d *differ, u Node) Node { return d.fn("cos", u) },
+	"cos": func(d *differ, u Node) Node { return d.neg(d.fn("sin", u)) },
+	"tan": func(d *differ, u Node) Node { return d.div(d.int(1), d.pow(d.fn("cos", u), d.int(2))) },
+	"asin": func(d *differ, u Node) Node {
+		return d.div(d.int(1), d.fn("sqrt", d.sub(d.int(1), d.pow(u, d.int(2)))))
+	},
+	"acos": func(d *differ, u Node) Node {
+		return d.neg(d.div(d.int(1), d.fn("sqrt", d.sub(d.int(1), d.pow(u, d.int(2))))))
+	},
+	"atan":  func(d *differ, u Node) Node { return d.div(d.int(1), d.add(d.int(1), d.pow(u, d.int(2)))) },
+	"sinh":  func(d *differ, u Node) Node { return d.fn("cosh", u) },
+	"cosh":  func(d *differ, u Node) Node { return d.fn("sinh", u) },
+	"tanh":  func(d *differ, u Node) Node { return d.div(d.int(1), d.pow(d.fn("cosh", u), d.int(2))) },
+	"exp":   func(d *differ, u Node) Node { return d.fn("exp", u) },
+	"ln":    func(d *differ, u Node) Node { return d.div(d.int(1), u) },
+	"log":   func(d *differ, u Node) Node { return d.div(d.int(1), u) },
+	"log2":  func(d *differ, u Node) Node { return d.div(d.int(1), d.mul(u, d.fn("ln", d.int(2)))) },
+	"log10": func(d *differ, u Node) Node { return d.div(d.int(1), d.mul(u, d.fn("ln", d.int(10)))) },
+	"sqrt":  func(d *differ, u Node) Node { return d.div(d.int(1), d.mul(d.int(2), d.fn("sqrt", u))) },
+	"abs":   func(d *differ, u Node) Node { return d.div(u, d.fn("abs", u)) },
+}
+
+func (d *differ) deriveCall(n *CallNode) (Node, error) {
+	name := n.Name.Value
+	if fn, ok := builtinFunctions[name]; ok {
+		if err := fn.checkArity(len(n.Args)); err != nil {
+			return nil, errorAt(n.Name.Pos, "%s: %w", name, err)
+		}
+
+		switch {
+		case name == "diff":
+			inner, err := newDiffer(d.env, n)
+			if err != nil {
+				return nil, err
+			}
+			dn, err := inner.differentiate(n.Args[0])
+			if err != nil {
+				return nil, err
+			}
+			return d.differentiate(dn)
+
+		case name == "log" && len(n.Args) == 2:
+			u, base := n.Args[0], n.Args[1]
+			if d.dependsOn(base) {
+				return nil, d.errorf("cannot differentiate log with a variable base")
+			}
+			du, err := d.derive(u)
+			if err != nil {
+				return nil, err
+			}
+			return d.div(du, d.mul(u, d.fn("ln", base))), nil
+
+		case chainRules[name] != nil:
+			du, err := d.derive(n.Args[0])
+			if err != nil {
+				return nil, err
+			}
+			return d.mul(du, chainRules[name](d, n.Args[0])), nil
+		}
+		return nil, d.errorf("cannot differentiate %s", name)
+	}
+
+	fn, ok := d.env.function(name)
+	if !ok {
+		return nil, errorAt(n.Name.Pos, "%w %q", ErrUndefinedFunction, name)
+	}
+	if len(n.Args) != len(fn.Params) {
+		return nil, errorAt(n.Name.Pos, "%s: %w: expected %d, got %d", name, ErrArgumentCount, len(fn.Params), len(n.Args))
+	}
+	if slices.Contains(d.inlined, name) {
+		return nil, d.errorf("cannot differentiate recursive function %s", name)
+	}
+
+	args := map[string]Node{}
+	for i, param := range fn.Params {
+		args[param] = n.Args[i]
+	}
+
+	d.inlined = append(d.inlined, name)
+	defer func() {
+		d.inlined = d.inlined[:len(d.inlined)-1]
+	}()
+	return d.differentiate(substitute(fn.Body, args))
+}
+
+// errorf returns an error at the diff call.
+func (d *differ) errorf(format string, args ...any) error {
+	return errorAt(d.call.Name.Pos, "%s: %s", d.call.Name.Value, fmt.Sprintf(format, args...))
+}
+
+// constant returns the value of n if it is a plain rational constant.
+func constant(n Node) (*big.Rat, bool) {
+	switch n := n.(type) {
+	case *NumberNode:
+		if n.Exact != nil && n.Unit == nil && !n.Imaginary {
+			return n.Exact, true
+		}
+
+	case *UnaryNode:
+		if c, ok := constant(n.Expr); ok && n.Op.Type == tokens.OP_MINUS {
+			return new(big.Rat).Neg(c), true
+		}
+
+	case *BinaryNode:
+		l, lok := constant(n.Left)
+		r, rok := constant(n.Right)
+		if lok && rok && n.Op.Type == tokens.OP_SLASH && r.Sign() != 0 {
+			return new(big.Rat).Quo(l, r), true
+		}
+	}
+	return nil, false
+}
+
+// isConstant reports whether n is the constant c.
+func isConstant(n Node, c int64) bool {
+	r, ok := constant(n)
+	return ok && r.Cmp(big.NewRat(c, 1)) == 0
+}
+
+// num returns a node for the rational r, written as a fraction of integers
+// if need be.
+func (d *differ) num(r *big.Rat) Node {
+	if r.Sign() < 0 {
+		return d.unary(tokens.OP_MINUS, d.num(new(big.Rat).Neg(r)))
+	}
+	if !r.IsInt() {
+		return d.binary(tokens.OP_SLASH, d.num(new(big.Rat).SetInt(r.Num())), d.num(new(big.Rat).SetInt(r.Denom())))
+	}
+	return &NumberNode{Value: newRational(r), Exact: r, Literal: r.Num().String()}
+}
+
+func (d *differ) int(n int64) Node {
+	return d.num(big.NewRat(n, 1))
+}
+
+func (d *differ) token(tt tokens.TokenType) tokens.Token {
+	return tokens.Token{Type: tt, Pos: d.call.Name.Pos}
+}
+
+func (d *differ) unary(tt tokens.TokenType, n Node) Node {
+	return &UnaryNode{Op: d.token(tt), Expr: n}
+}
+
+func (d *differ) binary(tt tokens.TokenType, l, r Node) Node {
+	return &BinaryNode{Op: d.token(tt), Left: l, Right: r}
+}
+
+// fn returns a call of the built-in function name.
+func (d *differ) fn(name string, args ...Node) Node {
+	return &CallNode{Name: tokens.Token{Type: tokens.IDENT, Value: name, Pos: d.call.Name.Pos}, Args: args}
+}
+
+// ln returns the natural logarithm of n, which is 1 for E.
+func (d *differ) ln(n Node) Node {
+	if id, ok := n.(*IdentNode); ok && id.Name.Value == "E" {
+		return d.int(1)
+	}
+	return d.fn("ln", n)
+}
+
+func (d *differ) neg(n Node) Node {
+	if c, ok := constant(n); ok {
+		return d.num(new(big.Rat).Neg(c))
+	}
+	if u, ok := n.(*UnaryNode); ok && u.Op.Type == tokens.OP_MINUS {
+		return u.Expr
+	}
+	return d.unary(tokens.OP_MINUS, n)
+}
+
+func (d *differ) add(a, b Node) Node {
+	ca, aok := constant(a)
+	cb, bok := constant(b)
+	switch {
+	case aok && bok:
+		return d.num(new(big.Rat).Add(ca, cb))
+	case aok && ca.Sign() == 0:
+		return b
+	case bok && cb.Sign() == 0:
+		return a
+	case bok && cb.Sign() < 0:
+		return d.sub(a, d.num(new(big.Rat).Neg(cb)))
+	case a.String() == b.String():
+		return d.mul(d.int(2), a)
+	}
+	if u, ok := b.(*UnaryNode); ok && u.Op.Type == tokens.OP_MINUS {
+		return d.sub(a, u.Expr)
+	}
+	return d.binary(tokens.OP_PLUS, a, b)
+}
+
+func (d *differ) sub(a, b Node) Node {
+	ca, aok := constant(a)
+	cb, bok := constant(b)
+	switch {
+	case aok && bok:
+		return d.num(new(big.Rat).Sub(ca, cb))
+	case bok && cb.Sign() == 0:
+		return a
+	case aok && ca.Sign() == 0:
+		return d.neg(b)
+	case a.String() == b.String():
+		return d.int(0)
+	}
+	if u, ok := b.(*UnaryNode); ok && u.Op.Type == tokens.OP_MINUS {
+		return d.add(a, u.Expr)
+	}
+	return d.binary(tokens.OP_MINUS, a, b)
+}
+
+func (d *differ) mul(a, b Node) Node {
+	ca, aok := constant(a)
+	cb, bok := constant(b)
+	switch {
+	case aok && bok:
+		return d.num(new(big.Rat).Mul(ca, cb))
+	case aok && ca.Sign() == 0, bok && cb.Sign() == 0:
+		return d.int(0)
+	case isConstant(a, 1):
+		return b
+	case isConstant(b, 1):
+		return a
+	case isConstant(a, -1):
+		return d.neg(b)
+	case isConstant(b, -1):
+		return d.neg(a)
+	case bok:
+		// Constants go first, as in 3 * x
+		return d.mul(b, a)
+	}
+
+	// Fold constants together, as in 2 * (3 * x)
+	if bin, ok := b.(*BinaryNode); ok && aok && bin.Op.Type == tokens.OP_STAR {
+		if c, ok := constant(bin.Left); ok {
+			return d.mul(d.num(new(big.Rat).Mul(ca, c)), bin.Right)
+		}
+	}
+	if u, ok := a.(*UnaryNode); ok && u.Op.Type == tokens.OP_MINUS {
+		return d.neg(d.mul(u.Expr, b))
+	}
+	if u, ok := b.(*UnaryNode); ok && u.Op.Type == tokens.OP_MINUS {
+		return d.neg(d.mul(a, u.Expr))
+	}
+	if a.String() == b.String() {
+		return d.pow(a, d.int(2))
+	}
+
+	// Cancel a divisor, as in 1 / x * x
+	if q, ok := a.(*BinaryNode); ok && q.Op.Type == tokens.OP_SLASH && q.Right.String() == b.String() {
+		return q.Left
+	}
+	return d.binary(tokens.OP_STAR, a, b)
+}
+
+func (d *differ) div(a, b Node) Node {
+	ca, aok := constant(a)
+	cb, bok := constant(b)
+	switch {
+	case aok && bok && cb.Sign() != 0:
+		return d.num(new(big.Rat).Quo(ca, cb))
+	case aok && ca.Sign() == 0:
+		return d.int(0)
+	case isConstant(b, 1):
+		return a
+	case isConstant(b, -1):
+		return d.neg(a)
+	case a.String() == b.String():
+		return d.int(1)
+	}
+	if u, ok := a.(*UnaryNode); ok && u.Op.Type == tokens.OP_MINUS {
+		return d.neg(d.div(u.Expr, b))
+	}
+	return d.binary(tokens.OP_SLASH, a, b)
+}
+
+func (d *differ) pow(a, b Node) Node {
+	switch {
+	case isConstant(b, 0):
+		return d.int(1)
+	case isConstant(b, 1):
+		return a
+	case isConstant(a, 1):
+		return d.int(1)
+	}
+	return d.binary(tokens.OP_POW, a, b)
+}
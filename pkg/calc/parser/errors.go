@@ -0,0 +1,36 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ripta/rt/pkg/calc/tokens"
+)
+
+// PositionError is an error at a position in the source expression.
+type PositionError struct {
+	Pos tokens.Position
+	Err error
+}
+
+func (e *PositionError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Pos, e.Err)
+}
+
+func (e *PositionError) Unwrap() error {
+	return e.Err
+}
+
+// errorAt returns an error at pos, formatted as with fmt.Errorf.
+func errorAt(pos tokens.Position, format string, args ...any) error {
+	return &PositionError{Pos: pos, Err: fmt.Errorf(format, args...)}
+}
+
+// withPosition attributes err to pos, unless it already has a position.
+func withPosition(pos tokens.Position, err error) error {
+	var perr *PositionError
+	if errors.As(err, &perr) {
+		return err
+	}
+	return &PositionError{Pos: pos, Err: err}
+}
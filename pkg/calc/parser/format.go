@@ -0,0 +1,118 @@
+package parser
+
+import "github.com/ripta/rt/pkg/calc/tokens"
+
+// Binding strength of each kind of node when rendered back into source form,
+// from loosest to tightest. These mirror the parser's recursive descent.
+const (
+	precAssign = iota + 1
+	precConvert
+	precTernary
+	precOr
+	precAnd
+	precCompare
+	precBitOr
+	precBitXor
+	precBitAnd
+	precAdditive
+	precMultiplicative
+	precQuantity
+	precExponential
+	precUnary
+	precPrimary
+)
+
+var opSymbols = map[tokens.TokenType]string{
+	tokens.OP_PLUS:    "+",
+	tokens.OP_MINUS:   "-",
+	tokens.OP_STAR:    "*",
+	tokens.OP_SLASH:   "/",
+	tokens.OP_PERCENT: "%",
+	tokens.OP_ROOT:    "√",
+	tokens.OP_SHL:     "<<",
+	tokens.OP_SHR:     ">>",
+	tokens.OP_POW:     "**",
+	tokens.OP_BITAND:  "&",
+	tokens.OP_BITOR:   "|",
+	tokens.OP_BITXOR:  "^",
+	tokens.OP_BITNOT:  "~",
+	tokens.OP_EQ:      "==",
+	tokens.OP_NE:      "!=",
+	tokens.OP_LT:      "<",
+	tokens.OP_LE:      "<=",
+	tokens.OP_GT:      ">",
+	tokens.OP_GE:      ">=",
+	tokens.OP_AND:     "&&",
+	tokens.OP_OR:      "||",
+	tokens.OP_NOT:     "!",
+	tokens.QUESTION:   "?",
+}
+
+// opSymbol returns the source text of an operator token.
+func opSymbol(op tokens.Token) string {
+	if op.Value != "" {
+		return op.Value
+	}
+	return opSymbols[op.Type]
+}
+
+// precedence returns how tightly node binds when rendered.
+func precedence(node Node) int {
+	switch n := node.(type) {
+	case *AssignNode, *FuncDefNode:
+		return precAssign
+
+	case *BinaryNode:
+		switch n.Op.Type {
+		case tokens.OP_PLUS, tokens.OP_MINUS:
+			return precAdditive
+		case tokens.OP_POW:
+			return precExponential
+		case tokens.OP_BITOR:
+			return precBitOr
+		case tokens.OP_BITXOR:
+			return precBitXor
+		case tokens.OP_BITAND:
+			return precBitAnd
+		case tokens.OP_OR:
+			return precOr
+		case tokens.OP_AND:
+			return precAnd
+		case tokens.OP_EQ, tokens.OP_NE, tokens.OP_LT, tokens.OP_LE, tokens.OP_GT, tokens.OP_GE:
+			return precCompare
+		default:
+			return precMultiplicative
+		}
+
+	case *ConvertNode:
+		return precConvert
+
+	case *CondNode:
+		return precTernary
+
+	case *UnitNode:
+		return precQuantity
+
+	case *UnaryNode:
+		return precUnary
+
+	case *NumberNode:
+		if n.Literal == "" && n.Unit != nil {
+			return precQuantity
+		}
+		if n.Literal == "" && sign(n.Value, -100) < 0 {
+			return precUnary
+		}
+	}
+
+	return precPrimary
+}
+
+// parenthesize renders node, wrapping it in parentheses if it binds less
+// tightly than min.
+func parenthesize(node Node, min int) string {
+	if precedence(node) < min {
+		return "(" + node.String() + ")"
+	}
+	return node.String()
+}
@@ -0,0 +1,99 @@
+package parser
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ripta/reals/pkg/unified"
+)
+
+// ContinuedFraction expands the magnitude of n in its display unit as a
+// continued fraction [a0; a1, a2, ...], returning at most limit terms. Exact
+// numbers expand completely. Other numbers are expanded from an approximation
+// at the environment's precision, stopping once the convergents are as
+// accurate as that approximation, beyond which further terms are noise.
+func (e *Env) ContinuedFraction(n *Number, limit int) ([]*big.Int, error) {
+	if x := n.DisplayExact(); x != nil {
+		return continuedFraction(x, nil, limit), nil
+	}
+
+	mag, _ := n.Display()
+	x, err := approximate(mag, e.precision)
+	if err != nil {
+		return nil, err
+	}
+	return continuedFraction(x, e.resolution(), limit), nil
+}
+
+// resolution returns 2^precision, the accuracy of approximations made at the
+// environment's precision.
+func (e *Env) resolution() *big.Rat {
+	return new(big.Rat).SetFrac(big.NewInt(1), new(big.Int).Lsh(big.NewInt(1), uint(-e.precision)))
+}
+
+// continuedFraction returns up to limit terms of the continued fraction of x,
+// stopping early once a convergent is within eps of x. A nil eps expands x
+// exactly.
+func continuedFraction(x, eps *big.Rat, limit int) []*big.Int {
+	var terms []*big.Int
+	r := new(big.Rat).Set(x)
+	for len(terms) < limit {
+		a := floorRat(r)
+		terms = append(terms, a)
+
+		if eps != nil {
+			convs := Convergents(terms)
+			if new(big.Rat).Abs(new(big.Rat).Sub(convs[len(convs)-1], x)).Cmp(eps) <= 0 {
+				break
+			}
+		}
+
+		r.Sub(r, new(big.Rat).SetInt(a))
+		if r.Sign() == 0 {
+			break
+		}
+		r.Inv(r)
+	}
+	return terms
+}
+
+// Convergents returns the successive rational approximations h/k given by
+// the first 1, 2, ... terms of a continued fraction.
+func Convergents(terms []*big.Int) []*big.Rat {
+	convs := make([]*big.Rat, len(terms))
+
+	// h and k hold the numerators and denominators of the previous two
+	// convergents, seeded with 1/0 and 0/1
+	h1, h2 := big.NewInt(1), big.NewInt(0)
+	k1, k2 := big.NewInt(0), big.NewInt(1)
+	for i, a := range terms {
+		h := new(big.Int).Add(new(big.Int).Mul(a, h1), h2)
+		k := new(big.Int).Add(new(big.Int).Mul(a, k1), k2)
+		convs[i] = new(big.Rat).SetFrac(h, k)
+
+		h1, h2 = h, h1
+		k1, k2 = k, k1
+	}
+	return convs
+}
+
+// fnCF returns the convergent of x formed from the first n terms of its
+// continued fraction. If x has fewer terms, the result is x itself.
+func fnCF(env *Env, args []*unified.Real, exact []*big.Rat) (*big.Rat, error) {
+	count, ok := integerValue(args[1], env.precision)
+	if !ok || count.Sign() <= 0 || !count.IsInt64() {
+		return nil, fmt.Errorf("%w: number of terms must be a positive integer", ErrDomain)
+	}
+
+	terms, err := env.ContinuedFraction(&Number{Real: args[0], Exact: exact[0]}, int(min(count.Int64(), maxConvergents)))
+	if err != nil {
+		return nil, err
+	}
+
+	convs := Convergents(terms)
+	return convs[len(convs)-1], nil
+}
+
+// maxConvergents bounds the number of terms cf expands, which is far more
+// than any approximation at a practical precision needs.
+const maxConvergents = 1 << 16
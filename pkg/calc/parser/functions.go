@@ -0,0 +1,569 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ripta/reals/pkg/constructive"
+	"github.com/ripta/reals/pkg/rational"
+	"github.com/ripta/reals/pkg/unified"
+)
+
+var (
+	ErrUndefinedFunction = errors.New("undefined function")
+	ErrArgumentCount     = errors.New("wrong number of arguments")
+	ErrDomain            = errors.New("argument out of domain")
+)
+
+// builtinFunc describes a function callable from an expression. MaxArgs of -1
+// means the function is variadic. Arguments must be dimensionless unless the
+// function is Dimensional, in which case they must share a dimension, which
+// the result takes on along with the display unit of the first argument.
+//
+// Rational, if set, computes an exact rational result. It receives the exact
+// value of each argument, or nil for arguments not known to be rational, and
+// returns nil if it cannot produce an exact result, in which case Call is
+// used. Functions whose result is always rational may leave Call unset.
+//
+// Complex, if set, computes the function of a single complex argument. It is
+// also used when Call reports that a real argument has a non-real result,
+// as with the square root of a negative number.
+//
+// Values, if set, is called in place of the above with the arguments as
+// given, which may include lists. Other functions apply to each element of a
+// list argument if they take one argument, or to the elements of all list
+// arguments together if they are variadic.
+//
+// Form, if set, is called in place of all of the above with the call
+// itself, for functions like diff whose arguments are expressions in a
+// variable rather than values.
+type builtinFunc struct {
+	MinArgs     int
+	MaxArgs     int
+	Description string
+	Dimensional bool
+	Call        func(env *Env, args []*unified.Real) (*unified.Real, error)
+	Rational    func(env *Env, args []*unified.Real, exact []*big.Rat) (*big.Rat, error)
+	Complex     func(env *Env, z *Complex) (Value, error)
+	Values      func(env *Env, args []Value) (Value, error)
+	Form        func(env *Env, call *CallNode) (Value, error)
+}
+
+// call invokes the function, returning its result along with the result as
+// an exact rational, if known.
+func (f *builtinFunc) call(env *Env, args []*unified.Real, exact []*big.Rat) (*unified.Real, *big.Rat, error) {
+	if f.Rational != nil {
+		r, err := f.Rational(env, args, exact)
+		if err != nil {
+			return nil, nil, err
+		}
+		if r != nil {
+			return newRational(r), r, nil
+		}
+	}
+
+	res, err := f.Call(env, args)
+	return res, nil, err
+}
+
+func (f *builtinFunc) checkArity(n int) error {
+	if n < f.MinArgs {
+		return fmt.Errorf("%w: expected at least %d, got %d", ErrArgumentCount, f.MinArgs, n)
+	}
+	if f.MaxArgs >= 0 && n > f.MaxArgs {
+		return fmt.Errorf("%w: expected at most %d, got %d", ErrArgumentCount, f.MaxArgs, n)
+	}
+	return nil
+}
+
+var builtinFunctions map[string]*builtinFunc
+
+func init() {
+	builtinFunctions = map[string]*builtinFunc{
+		"sin": unary("Sine (radians)", func(_ *Env, x *unified.Real) (*unified.Real, error) {
+			return unified.New(constructive.Sin(x.Constructive()), rational.One()), nil
+		}),
+		"cos": unary("Cosine (radians)", func(_ *Env, x *unified.Real) (*unified.Real, error) {
+			return unified.New(constructive.Cos(x.Constructive()), rational.One()), nil
+		}),
+		"tan": unary("Tangent (radians)", fnTan),
+		"asin": unary("Inverse sine, in radians", func(env *Env, x *unified.Real) (*unified.Real, error) {
+			if err := checkUnitInterval(x, env.precision); err != nil {
+				return nil, err
+			}
+			return unified.New(constructive.Asin(x.Constructive()), rational.One()), nil
+		}),
+		"acos": unary("Inverse cosine, in radians", func(env *Env, x *unified.Real) (*unified.Real, error) {
+			if err := checkUnitInterval(x, env.precision); err != nil {
+				return nil, err
+			}
+			return unified.New(constructive.Acos(x.Constructive()), rational.One()), nil
+		}),
+		"atan": unary("Inverse tangent, in radians", func(_ *Env, x *unified.Real) (*unified.Real, error) {
+			return unified.New(constructive.Atan(x.Constructive()), rational.One()), nil
+		}),
+		"atan2": {
+			MinArgs:     2,
+			MaxArgs:     2,
+			Description: "Angle of the point (x, y) from the positive x-axis, called as atan2(y, x)",
+			Call:        fnAtan2,
+		},
+		"sinh": unary("Hyperbolic sine", func(_ *Env, x *unified.Real) (*unified.Real, error) {
+			ep, en := expPair(x)
+			return ep.Subtract(en).ShiftRight(1), nil
+		}),
+		"cosh": unary("Hyperbolic cosine", func(_ *Env, x *unified.Real) (*unified.Real, error) {
+			ep, en := expPair(x)
+			return ep.Add(en).ShiftRight(1), nil
+		}),
+		"tanh": unary("Hyperbolic tangent", func(_ *Env, x *unified.Real) (*unified.Real, error) {
+			ep, en := expPair(x)
+			return ep.Subtract(en).Divide(ep.Add(en)), nil
+		}),
+		"exp": unary("Exponential function, E raised to the argument", func(_ *Env, x *unified.Real) (*unified.Real, error) {
+			return unified.New(constructive.Exp(x.Constructive()), rational.One()), nil
+		}),
+		"ln": unary("Natural logarithm", func(env *Env, x *unified.Real) (*unified.Real, error) {
+			return ln(x, env.precision)
+		}),
+		"log": {
+			MinArgs:     1,
+			MaxArgs:     2,
+			Description: "Logarithm, natural by default, or to the base given as the second argument",
+			Call:        fnLog,
+		},
+		"log2": unary("Base-2 logarithm", func(env *Env, x *unified.Real) (*unified.Real, error) {
+			return logBase(x, newInteger(2), env.precision)
+		}),
+		"log10": unary("Base-10 logarithm", func(env *Env, x *unified.Real) (*unified.Real, error) {
+			return logBase(x, newInteger(10), env.precision)
+		}),
+		"sqrt": withComplex(unary("Square root, principal for negative and complex numbers", func(env *Env, x *unified.Real) (*unified.Real, error) {
+			if sign(x, env.precision) < 0 {
+				return nil, fmt.Errorf("square root of negative number: %w", ErrNonReal)
+			}
+			return unified.New(constructive.Sqrt(x.Constructive()), rational.One()), nil
+		}), func(env *Env, z *Complex) (Value, error) {
+			return complexSqrt(env, z), nil
+		}),
+		"abs": {
+			MinArgs:     1,
+			MaxArgs:     1,
+			Description: "Absolute value, or modulus of a complex number",
+			Dimensional: true,
+			Call: func(env *Env, args []*unified.Real) (*unified.Real, error) {
+				if sign(args[0], env.precision) < 0 {
+					return args[0].Negate(), nil
+				}
+				return args[0], nil
+			},
+			Rational: func(_ *Env, _ []*unified.Real, exact []*big.Rat) (*big.Rat, error) {
+				if exact[0] == nil {
+					return nil, nil
+				}
+				return new(big.Rat).Abs(exact[0]), nil
+			},
+			Complex: func(_ *Env, z *Complex) (Value, error) {
+				return modulus(z), nil
+			},
+		},
+		"arg": {
+			MinArgs:     1,
+			MaxArgs:     1,
+			Description: "Argument of a complex number, its angle from the positive real axis in radians",
+			Call: func(env *Env, args []*unified.Real) (*unified.Real, error) {
+				if sign(args[0], env.precision) < 0 {
+					return unified.Pi(), nil
+				}
+				return unified.Zero(), nil
+			},
+			Complex: func(env *Env, z *Complex) (Value, error) {
+				return argument(env, z)
+			},
+		},
+		"conj": {
+			MinArgs:     1,
+			MaxArgs:     1,
+			Description: "Complex conjugate",
+			Dimensional: true,
+			Call:        identity,
+			Rational:    exactIdentity,
+			Complex: func(_ *Env, z *Complex) (Value, error) {
+				return &Complex{Re: z.Re, Im: negPart(z.Im)}, nil
+			},
+		},
+		"re": {
+			MinArgs:     1,
+			MaxArgs:     1,
+			Description: "Real part of a complex number",
+			Dimensional: true,
+			Call:        identity,
+			Rational:    exactIdentity,
+			Complex: func(_ *Env, z *Complex) (Value, error) {
+				return z.Re, nil
+			},
+		},
+		"im": {
+			MinArgs:     1,
+			MaxArgs:     1,
+			Description: "Imaginary part of a complex number",
+			Dimensional: true,
+			Rational: func(_ *Env, _ []*unified.Real, _ []*big.Rat) (*big.Rat, error) {
+				return new(big.Rat), nil
+			},
+			Complex: func(_ *Env, z *Complex) (Value, error) {
+				return z.Im, nil
+			},
+		},
+		"floor": rounding("Largest integer not greater than the argument", floorRat),
+		"ceil":  rounding("Smallest integer not less than the argument", ceilRat),
+		"round": rounding("Nearest integer, rounding halves away from zero", roundRat),
+		"trunc": rounding("Integer part, rounding toward zero", truncRat),
+		"min": {
+			MinArgs:     1,
+			MaxArgs:     -1,
+			Description: "Smallest of the arguments",
+			Dimensional: true,
+			Call: func(env *Env, args []*unified.Real) (*unified.Real, error) {
+				return extremum(args, env.precision, -1), nil
+			},
+			Rational: func(_ *Env, _ []*unified.Real, exact []*big.Rat) (*big.Rat, error) {
+				return exactExtremum(exact, -1), nil
+			},
+		},
+		"max": {
+			MinArgs:     1,
+			MaxArgs:     -1,
+			Description: "Largest of the arguments",
+			Dimensional: true,
+			Call: func(env *Env, args []*unified.Real) (*unified.Real, error) {
+				return extremum(args, env.precision, 1), nil
+			},
+			Rational: func(_ *Env, _ []*unified.Real, exact []*big.Rat) (*big.Rat, error) {
+				return exactExtremum(exact, 1), nil
+			},
+		},
+		"sum":       aggregate("Sum of the arguments, which may be lists", fnSum),
+		"mean":      aggregate("Arithmetic mean of the arguments, which may be lists", fnMean),
+		"median":    aggregate("Median of the arguments, which may be lists", fnMedian),
+		"stddev":    aggregate("Sample standard deviation of the arguments, which may be lists", fnStddev),
+		"len":       listFunc(1, "Number of elements of a list", fnLen),
+		"dot":       listFunc(2, "Dot product of two vectors, or the product of matrices", fnDot),
+		"cross":     listFunc(2, "Cross product of two vectors of length 3", fnCross),
+		"det":       listFunc(1, "Determinant of a square matrix", fnDet),
+		"inv":       listFunc(1, "Inverse of a square matrix", fnInv),
+		"transpose": listFunc(1, "Transpose of a matrix; a vector becomes a column", fnTranspose),
+		"gcd":       integerFunc(-1, "Greatest common divisor of integers", fnGCD),
+		"lcm":       integerFunc(-1, "Least common multiple of integers", fnLCM),
+		"factorial": integerFunc(1, "Factorial of a non-negative integer, also written n!", fnFactorial),
+		"binom":     integerFunc(2, "Binomial coefficient, the number of ways to choose k of n, called as binom(n, k)", fnBinom),
+		"modpow":    integerFunc(3, "Modular exponentiation, called as modpow(b, e, m) for b**e mod m", fnModpow),
+		"modinv":    integerFunc(2, "Modular multiplicative inverse, called as modinv(a, m)", fnModinv),
+		"isqrt":     integerFunc(1, "Integer square root, rounded down", fnIsqrt),
+		"ilog2":     integerFunc(1, "Integer base-2 logarithm, rounded down", fnIlog2),
+		"isprime":   listFunc(1, "Whether an integer is prime", fnIsPrime),
+		"factor":    listFunc(1, "Prime factors of an integer, as a list repeating each by its multiplicity", fnFactor),
+		"diff": {
+			MinArgs:     2,
+			MaxArgs:     2,
+			Description: "Derivative of an expression with respect to a variable, called as diff(x**2, x)",
+			Form:        fnDiff,
+		},
+		"solve": {
+			MinArgs:     3,
+			MaxArgs:     4,
+			Description: "Root of an expression in x, by Newton's method from a guess as in solve(expr, x, guess), or by bisection as in solve(expr, x, a, b)",
+			Form:        fnSolve,
+		},
+		"integrate": {
+			MinArgs:     4,
+			MaxArgs:     4,
+			Description: "Definite integral of an expression in x from a to b, called as integrate(expr, x, a, b)",
+			Form:        fnIntegrate,
+		},
+		"cf": {
+			MinArgs:     2,
+			MaxArgs:     2,
+			Description: "Best rational approximation of x from the first n terms of its continued fraction, called as cf(x, n)",
+			Rational:    fnCF,
+		},
+	}
+}
+
+// unary wraps a single-argument function as a builtinFunc.
+func unary(desc string, fn func(*Env, *unified.Real) (*unified.Real, error)) *builtinFunc {
+	return &builtinFunc{
+		MinArgs:     1,
+		MaxArgs:     1,
+		Description: desc,
+		Call: func(env *Env, args []*unified.Real) (*unified.Real, error) {
+			return fn(env, args[0])
+		},
+	}
+}
+
+// aggregate wraps a function of any number of values as a builtinFunc.
+func aggregate(desc string, fn func(*Env, []Value) (Value, error)) *builtinFunc {
+	return &builtinFunc{
+		MinArgs:     1,
+		MaxArgs:     -1,
+		Description: desc,
+		Values:      fn,
+	}
+}
+
+// listFunc wraps a function of n lists as a builtinFunc.
+func listFunc(n int, desc string, fn func(*Env, []Value) (Value, error)) *builtinFunc {
+	return &builtinFunc{
+		MinArgs:     n,
+		MaxArgs:     n,
+		Description: desc,
+		Values:      fn,
+	}
+}
+
+// withComplex extends fn to complex arguments.
+func withComplex(fn *builtinFunc, complexFn func(*Env, *Complex) (Value, error)) *builtinFunc {
+	fn.Complex = complexFn
+	return fn
+}
+
+// identity returns its only argument, as a function of real numbers does on
+// the real part of the complex plane.
+func identity(_ *Env, args []*unified.Real) (*unified.Real, error) {
+	return args[0], nil
+}
+
+// exactIdentity is identity for exact arguments.
+func exactIdentity(_ *Env, _ []*unified.Real, exact []*big.Rat) (*big.Rat, error) {
+	return exact[0], nil
+}
+
+// rounding wraps a function that rounds its argument to an integer as a
+// builtinFunc. The result is always an exact integer.
+func rounding(desc string, fn func(*big.Rat) *big.Int) *builtinFunc {
+	return &builtinFunc{
+		MinArgs:     1,
+		MaxArgs:     1,
+		Description: desc,
+		Rational: func(env *Env, args []*unified.Real, exact []*big.Rat) (*big.Rat, error) {
+			x := exact[0]
+			if x == nil {
+				approx, err := approximateNearInteger(env, args[0])
+				if err != nil {
+					return nil, err
+				}
+				x = approx
+			}
+			return new(big.Rat).SetInt(fn(x)), nil
+		},
+	}
+}
+
+// approximateNearInteger approximates r for rounding. An integer such as
+// sqrt(4) is only known approximately and may land either side of itself, so
+// as in compare, an approximation within the tolerance of an integer is taken
+// to be that integer.
+func approximateNearInteger(env *Env, r *unified.Real) (*big.Rat, error) {
+	approx, err := approximate(r, env.precision-comparisonGuardBits)
+	if err != nil {
+		return nil, err
+	}
+
+	nearest := new(big.Rat).SetInt(roundRat(approx))
+	if new(big.Rat).Abs(new(big.Rat).Sub(approx, nearest)).Cmp(env.tolerance()) < 0 {
+		return nearest, nil
+	}
+	return approx, nil
+}
+
+// FunctionNames returns the sorted names of all built-in functions.
+func FunctionNames() []string {
+	names := make([]string, 0, len(builtinFunctions))
+	for name := range builtinFunctions {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// FunctionDescription returns the help text of the built-in function name.
+func FunctionDescription(name string) (string, bool) {
+	fn, ok := builtinFunctions[name]
+	if !ok {
+		return "", false
+	}
+	return fn.Description, true
+}
+
+func fnTan(env *Env, x *unified.Real) (*unified.Real, error) {
+	cos := unified.New(constructive.Cos(x.Constructive()), rational.One())
+	if sign(cos, env.precision) == 0 {
+		return nil, fmt.Errorf("%w: tangent is undefined where cosine is zero", ErrDomain)
+	}
+
+	sin := unified.New(constructive.Sin(x.Constructive()), rational.One())
+	return sin.Divide(cos), nil
+}
+
+func fnAtan2(env *Env, args []*unified.Real) (*unified.Real, error) {
+	y, x := args[0], args[1]
+	ys, xs := sign(y, env.precision), sign(x, env.precision)
+
+	switch {
+	case xs > 0:
+		return unified.New(constructive.Atan(y.Divide(x).Constructive()), rational.One()), nil
+
+	case xs < 0:
+		at := unified.New(constructive.Atan(y.Divide(x).Constructive()), rational.One())
+		if ys < 0 {
+			return at.Subtract(unified.Pi()), nil
+		}
+		return at.Add(unified.Pi()), nil
+
+	case ys > 0:
+		return unified.Pi().ShiftRight(1), nil
+
+	case ys < 0:
+		return unified.Pi().ShiftRight(1).Negate(), nil
+
+	default:
+		return nil, fmt.Errorf("%w: atan2 is undefined at the origin", ErrDomain)
+	}
+}
+
+func fnLog(env *Env, args []*unified.Real) (*unified.Real, error) {
+	if len(args) == 1 {
+		return ln(args[0], env.precision)
+	}
+	return logBase(args[0], args[1], env.precision)
+}
+
+// expPair returns e^x and e^-x.
+func expPair(x *unified.Real) (*unified.Real, *unified.Real) {
+	ep := unified.New(constructive.Exp(x.Constructive()), rational.One())
+	en := unified.New(constructive.Exp(x.Negate().Constructive()), rational.One())
+	return ep, en
+}
+
+// ln computes the natural logarithm of x, which must be positive.
+func ln(x *unified.Real, precision int) (*unified.Real, error) {
+	if sign(x, precision) <= 0 {
+		return nil, fmt.Errorf("%w: logarithm of non-positive number", ErrDomain)
+	}
+	return unified.New(constructive.Ln(x.Constructive()), rational.One()), nil
+}
+
+// logBase computes the logarithm of x to the given base.
+func logBase(x, base *unified.Real, precision int) (*unified.Real, error) {
+	num, err := ln(x, precision)
+	if err != nil {
+		return nil, err
+	}
+
+	den, err := ln(base, precision)
+	if err != nil {
+		return nil, err
+	}
+	if sign(den, precision) == 0 {
+		return nil, fmt.Errorf("%w: logarithm base must not be 1", ErrDomain)
+	}
+
+	return num.Divide(den), nil
+}
+
+// checkUnitInterval returns an error unless -1 <= x <= 1.
+func checkUnitInterval(x *unified.Real, precision int) error {
+	approx, err := approximate(x, precision)
+	if err != nil {
+		return err
+	}
+	if approx.Cmp(big.NewRat(1, 1)) > 0 || approx.Cmp(big.NewRat(-1, 1)) < 0 {
+		return fmt.Errorf("%w: argument must be between -1 and 1", ErrDomain)
+	}
+	return nil
+}
+
+// extremum returns the smallest (dir < 0) or largest (dir > 0) argument.
+func extremum(args []*unified.Real, precision, dir int) *unified.Real {
+	best := args[0]
+	for _, arg := range args[1:] {
+		if sign(arg.Subtract(best), precision)*dir > 0 {
+			best = arg
+		}
+	}
+	return best
+}
+
+// exactExtremum is extremum for exact arguments. It returns nil unless all
+// arguments are exact.
+func exactExtremum(args []*big.Rat, dir int) *big.Rat {
+	best := args[0]
+	for _, arg := range args {
+		if arg == nil {
+			return nil
+		}
+		if arg.Cmp(best)*dir > 0 {
+			best = arg
+		}
+	}
+	return best
+}
+
+func floorRat(r *big.Rat) *big.Int {
+	// Euclidean division floors when the divisor is positive, which a
+	// normalized denominator always is.
+	return new(big.Int).Div(r.Num(), r.Denom())
+}
+
+func ceilRat(r *big.Rat) *big.Int {
+	q := floorRat(r)
+	if !r.IsInt() {
+		q.Add(q, big.NewInt(1))
+	}
+	return q
+}
+
+func truncRat(r *big.Rat) *big.Int {
+	return new(big.Int).Quo(r.Num(), r.Denom())
+}
+
+func roundRat(r *big.Rat) *big.Int {
+	half := big.NewRat(1, 2)
+	if r.Sign() < 0 {
+		return truncRat(new(big.Rat).Sub(r, half))
+	}
+	return truncRat(new(big.Rat).Add(r, half))
+}
+
+// approximate returns a rational approximation of r to within 2^precision.
+func approximate(r *unified.Real, precision int) (*big.Rat, error) {
+	scale := new(big.Int).Exp(big.NewInt(2), big.NewInt(int64(-precision)), nil)
+
+	approx := constructive.Approximate(r.Constructive(), precision)
+	if approx == nil {
+		return nil, fmt.Errorf("failed to approximate value")
+	}
+
+	return new(big.Rat).SetFrac(approx, scale), nil
+}
+
+// sign returns -1, 0 or +1 depending on the sign of r when approximated at
+// the given precision. Values smaller in magnitude than 2^precision are
+// considered zero.
+func sign(r *unified.Real, precision int) int {
+	return constructive.Approximate(r.Constructive(), precision).Sign()
+}
+
+// newRational wraps an exact rational number as a unified.Real.
+func newRational(r *big.Rat) *unified.Real {
+	return unified.New(constructive.One(), rational.FromRational(r))
+}
+
+// newInteger wraps an integer as a unified.Real.
+func newInteger(n int64) *unified.Real {
+	return newRational(new(big.Rat).SetInt64(n))
+}
@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// ErrInterrupted is returned when evaluation is canceled before it
+// completes, as when the user presses Ctrl-C.
+var ErrInterrupted = errors.New("evaluation interrupted")
+
+// Limits bounds the work done to evaluate an expression, so that input from
+// users or other programs cannot run without end. Zero fields are unlimited.
+type Limits struct {
+	// MaxDecimalPlaces bounds the precision to which results are computed.
+	MaxDecimalPlaces int
+	// MaxExponent bounds the magnitude of integer exponents, which are
+	// computed by repeated multiplication.
+	MaxExponent int64
+	// Timeout bounds the time an evaluation may take.
+	Timeout time.Duration
+}
+
+// LimitError is returned when evaluation stops for exceeding one of its
+// Limits.
+type LimitError struct {
+	// Limit names the exceeded limit: "precision", "exponent" or "time".
+	Limit string
+	Err   error
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit exceeded: %v", e.Limit, e.Err)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// SetLimits bounds the work done by subsequent evaluations.
+func (e *Env) SetLimits(limits Limits) {
+	e.limits = limits
+}
+
+// Limits returns the limits set on the environment.
+func (e *Env) Limits() Limits {
+	return e.limits
+}
+
+// EvalContext evaluates node, stopping with ErrInterrupted once ctx is
+// canceled, or with a *LimitError once evaluation exceeds the environment's
+// limits or ctx's deadline passes. Evaluation stops between steps, such as
+// operators and function calls, so a single step that is slow on its own,
+// like approximating a number to many digits, is only bounded by the other
+// limits. Digits of a real are mostly computed once it is formatted, which
+// callers bound in an environment from WithContext.
+//
+// Each evaluation carries its own ctx, so evaluations may run concurrently
+// in the same environment, provided none of them assigns a variable or
+// defines a function.
+func (e *Env) EvalContext(ctx context.Context, node Node) (Value, error) {
+	if max := e.limits.MaxDecimalPlaces; max > 0 && e.precision < convertDecimalPlacesToPrecision(max) {
+		return nil, &LimitError{Limit: "precision", Err: fmt.Errorf("precision exceeds %d decimal places", max)}
+	}
+
+	if e.limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.limits.Timeout)
+		defer cancel()
+	}
+
+	scope := e.WithContext(ctx)
+	if err := scope.check(); err != nil {
+		return nil, err
+	}
+	return node.Eval(scope)
+}
+
+// WithContext returns a copy of e in which evaluation stops once ctx is
+// done. The copy shares the variables and functions of e, so assignments and
+// definitions made in it are made in e.
+func (e *Env) WithContext(ctx context.Context) *Env {
+	scope := *e
+	scope.ctx = ctx
+	return &scope
+}
+
+// Err returns the error with which evaluation in e stops once its context
+// is done, or nil while it is not, so that work done on a result after
+// evaluation, such as formatting it, can stop in the same way.
+func (e *Env) Err() error {
+	return e.check()
+}
+
+// check returns an error once evaluation should stop because its context
+// is done.
+func (e *Env) check() error {
+	if e == nil || e.ctx == nil {
+		return nil
+	}
+
+	err := e.ctx.Err()
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.DeadlineExceeded):
+		if e.limits.Timeout > 0 {
+			return &LimitError{Limit: "time", Err: fmt.Errorf("evaluation took longer than %s", e.limits.Timeout)}
+		}
+		return &LimitError{Limit: "time", Err: err}
+	default:
+		return fmt.Errorf("%w: %w", ErrInterrupted, err)
+	}
+}
+
+// checkExponent returns an error if exp is too large an integer exponent to
+// compute by repeated multiplication.
+func (e *Env) checkExponent(exp *big.Int) error {
+	if max := e.limits.MaxExponent; max > 0 && new(big.Int).Abs(exp).Cmp(big.NewInt(max)) > 0 {
+		return &LimitError{Limit: "exponent", Err: fmt.Errorf("exponent %s exceeds %d", exp, max)}
+	}
+	return nil
+}
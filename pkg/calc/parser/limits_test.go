@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEvalContextLimits(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		expr      string
+		limits    Limits
+		places    int
+		wantLimit string
+	}{
+		{name: "within limits", expr: "2 ** 10", limits: Limits{MaxExponent: 1000, MaxDecimalPlaces: 30, Timeout: time.Minute}},
+		{name: "exponent", expr: "3 ** 5000", limits: Limits{MaxExponent: 1000}, wantLimit: "exponent"},
+		{name: "negative exponent", expr: "(-3) ** -5000", limits: Limits{MaxExponent: 1000}, wantLimit: "exponent"},
+		{name: "exponent in function", expr: "pow(5000)", limits: Limits{MaxExponent: 1000}, wantLimit: "exponent"},
+		{name: "precision", expr: "1/3", places: 50, limits: Limits{MaxDecimalPlaces: 30}, wantLimit: "precision"},
+		{name: "time", expr: "2 ** 2 ** 2 ** 30", limits: Limits{Timeout: 50 * time.Millisecond}, wantLimit: "time"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			env := NewEnv()
+			if _, err := parseAndEval(t, "pow(n) = 3 ** n", env); err != nil {
+				t.Fatal(err)
+			}
+			if tt.places > 0 {
+				env.SetDecimalPlaces(tt.places)
+			}
+			env.SetLimits(tt.limits)
+
+			node, err := New("test", tt.expr).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = env.EvalContext(context.Background(), node)
+			if tt.wantLimit == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var lerr *LimitError
+			if !errors.As(err, &lerr) {
+				t.Fatalf("got error %v, want a LimitError", err)
+			}
+			if lerr.Limit != tt.wantLimit {
+				t.Errorf("exceeded %s limit, want %s", lerr.Limit, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestEvalContextCanceled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	node, err := New("test", "1 + 2").Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewEnv().EvalContext(ctx, node)
+	if !errors.Is(err, ErrInterrupted) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want ErrInterrupted", err)
+	}
+}
+
+func TestEvalContextConcurrent(t *testing.T) {
+	t.Parallel()
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	node, err := New("test", "1 + 2").Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Evaluations sharing an environment must each keep their own context:
+	// one that is canceled must not be unbounded by another finishing
+	env := NewEnv()
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := env.EvalContext(canceled, node); !errors.Is(err, ErrInterrupted) {
+				t.Errorf("canceled evaluation: got error %v, want ErrInterrupted", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := env.EvalContext(context.Background(), node); err != nil {
+				t.Errorf("evaluation: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
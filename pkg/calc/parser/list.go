@@ -0,0 +1,680 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ripta/rt/pkg/calc/tokens"
+)
+
+// ErrSingular is returned when inverting a matrix that has no inverse.
+var ErrSingular = errors.New("matrix is singular")
+
+// List is an ordered sequence of values, written [1, 2, 3]. A matrix is a
+// list of rows of equal length, as in [[1, 2], [3, 4]]. Elements are numbers,
+// complex numbers or lists, and keep their exact values through arithmetic.
+type List struct {
+	Elems []Value
+}
+
+func (l *List) Type() string {
+	return "list"
+}
+
+// isList reports whether val is a list.
+func isList(val Value) bool {
+	_, ok := val.(*List)
+	return ok
+}
+
+// mapElems returns the list of fn applied to each element of l.
+func (l *List) mapElems(fn func(Value) (Value, error)) (Value, error) {
+	elems := make([]Value, len(l.Elems))
+	for i, elem := range l.Elems {
+		v, err := fn(elem)
+		if err != nil {
+			return nil, err
+		}
+		elems[i] = v
+	}
+	return &List{Elems: elems}, nil
+}
+
+// ListNode is a list literal.
+type ListNode struct {
+	Elems []Node
+	Tok   tokens.Token
+}
+
+func (n *ListNode) Eval(env *Env) (Value, error) {
+	elems := make([]Value, len(n.Elems))
+	for i, elem := range n.Elems {
+		v, err := elem.Eval(env)
+		if err != nil {
+			return nil, err
+		}
+		switch v.(type) {
+		case Bool, *Expr:
+			return nil, errorAt(n.Tok.Pos, "list elements must be numbers, got %s", v.Type())
+		}
+		elems[i] = v
+	}
+	return &List{Elems: elems}, nil
+}
+
+func (n *ListNode) String() string {
+	elems := make([]string, len(n.Elems))
+	for i, elem := range n.Elems {
+		elems[i] = elem.String()
+	}
+	return "[" + strings.Join(elems, ", ") + "]"
+}
+
+// applyList applies an operator to operands of which at least one is a
+// list. Arithmetic applies element by element to lists of the same length,
+// and a scalar operand applies to every element of the other. Lists may only
+// be compared for equality.
+func (n *BinaryNode) applyList(env *Env, lv, rv Value) (Value, error) {
+	if slices.Contains(comparisonOps, n.Op.Type) {
+		if n.Op.Type != tokens.OP_EQ && n.Op.Type != tokens.OP_NE {
+			return nil, errorAt(n.Op.Pos, "%s is not defined for lists", opSymbol(n.Op))
+		}
+		eq, err := n.listsEqual(env, lv, rv)
+		if err != nil {
+			return nil, err
+		}
+		return Bool(eq == (n.Op.Type == tokens.OP_EQ)), nil
+	}
+
+	l, lok := lv.(*List)
+	r, rok := rv.(*List)
+	switch {
+	case lok && rok:
+		if len(l.Elems) != len(r.Elems) {
+			return nil, errorAt(n.Op.Pos, "cannot apply %s to lists of length %d and %d", opSymbol(n.Op), len(l.Elems), len(r.Elems))
+		}
+		elems := make([]Value, len(l.Elems))
+		for i := range l.Elems {
+			v, err := n.operate(env, l.Elems[i], r.Elems[i])
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = v
+		}
+		return &List{Elems: elems}, nil
+
+	case lok:
+		return l.mapElems(func(elem Value) (Value, error) {
+			return n.operate(env, elem, rv)
+		})
+
+	default:
+		return r.mapElems(func(elem Value) (Value, error) {
+			return n.operate(env, lv, elem)
+		})
+	}
+}
+
+// listsEqual reports whether lv and rv have the same shape and equal
+// elements.
+func (n *BinaryNode) listsEqual(env *Env, lv, rv Value) (bool, error) {
+	l, lok := lv.(*List)
+	r, rok := rv.(*List)
+	if lok != rok {
+		return false, errorAt(n.Op.Pos, "cannot compare %s and %s", lv.Type(), rv.Type())
+	}
+
+	if !lok {
+		eq := &BinaryNode{Op: tokens.Token{Type: tokens.OP_EQ, Pos: n.Op.Pos}}
+		v, err := eq.operate(env, lv, rv)
+		if err != nil {
+			return false, err
+		}
+		return bool(v.(Bool)), nil
+	}
+
+	if len(l.Elems) != len(r.Elems) {
+		return false, nil
+	}
+	for i := range l.Elems {
+		eq, err := n.listsEqual(env, l.Elems[i], r.Elems[i])
+		if err != nil || !eq {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// callList calls a built-in function of numbers with list arguments.
+// Functions of one argument apply to each element, while variadic functions
+// such as max take the elements as their arguments.
+func (n *CallNode) callList(env *Env, fn *builtinFunc, args []Value) (Value, error) {
+	switch {
+	case fn.MaxArgs == 1:
+		return args[0].(*List).mapElems(func(elem Value) (Value, error) {
+			return n.callBuiltin(env, fn, []Value{elem})
+		})
+
+	case fn.MaxArgs < 0:
+		flat := flatten(args)
+		if err := fn.checkArity(len(flat)); err != nil {
+			return nil, errorAt(n.Name.Pos, "%s: %w", n.Name.Value, err)
+		}
+		return n.callBuiltin(env, fn, flat)
+	}
+
+	return nil, errorAt(n.Name.Pos, "%s requires numbers, got list", n.Name.Value)
+}
+
+// arith applies a binary operator to values outside of any expression, as
+// functions of lists do. Errors are left for the caller to position.
+func arith(env *Env, op tokens.TokenType, l, r Value) (Value, error) {
+	v, err := (&BinaryNode{Op: tokens.Token{Type: op}}).operate(env, l, r)
+	if perr, ok := err.(*PositionError); ok {
+		return nil, perr.Err
+	}
+	return v, err
+}
+
+// flatten returns the numbers in vals, descending into lists.
+func flatten(vals []Value) []Value {
+	var flat []Value
+	for _, v := range vals {
+		if l, ok := v.(*List); ok {
+			flat = append(flat, flatten(l.Elems)...)
+			continue
+		}
+		flat = append(flat, v)
+	}
+	return flat
+}
+
+// valueIsZero reports whether v is zero, or too close to zero to be told
+// apart at the environment's precision.
+func valueIsZero(env *Env, v Value) bool {
+	switch v := v.(type) {
+	case *Number:
+		if v.Exact != nil {
+			return v.Exact.Sign() == 0
+		}
+		return sign(v.Real, env.precision) == 0
+	case *Complex:
+		return valueIsZero(env, v.Re) && valueIsZero(env, v.Im)
+	}
+	return false
+}
+
+// vector asserts that v is a list of scalars.
+func vector(v Value) ([]Value, error) {
+	l, ok := v.(*List)
+	if !ok {
+		return nil, fmt.Errorf("expected a vector, got %s", v.Type())
+	}
+	for _, elem := range l.Elems {
+		if isList(elem) {
+			return nil, fmt.Errorf("expected a vector, got a matrix")
+		}
+	}
+	return l.Elems, nil
+}
+
+// isMatrix reports whether v is a non-empty list of lists.
+func isMatrix(v Value) bool {
+	l, ok := v.(*List)
+	return ok && len(l.Elems) > 0 && isList(l.Elems[0])
+}
+
+// matrix asserts that v is a matrix, and returns its rows.
+func matrix(v Value) ([][]Value, error) {
+	if !isMatrix(v) {
+		return nil, fmt.Errorf("expected a matrix, got %s", v.Type())
+	}
+
+	elems := v.(*List).Elems
+	rows := make([][]Value, len(elems))
+	for i, elem := range elems {
+		row, err := vector(elem)
+		if err != nil {
+			return nil, fmt.Errorf("expected a matrix, got a list of %s", elem.Type())
+		}
+		if len(row) == 0 || i > 0 && len(row) != len(rows[0]) {
+			return nil, fmt.Errorf("rows of a matrix must be non-empty and of the same length")
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+// squareMatrix asserts that v is a square matrix, and returns a copy of its
+// rows that may be modified.
+func squareMatrix(v Value) ([][]Value, error) {
+	rows, err := matrix(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) != len(rows[0]) {
+		return nil, fmt.Errorf("expected a square matrix, got %dx%d", len(rows), len(rows[0]))
+	}
+
+	m := make([][]Value, len(rows))
+	for i, row := range rows {
+		m[i] = append([]Value(nil), row...)
+	}
+	return m, nil
+}
+
+// matrixValue returns rows as a list of lists.
+func matrixValue(rows [][]Value) *List {
+	elems := make([]Value, len(rows))
+	for i, row := range rows {
+		elems[i] = &List{Elems: row}
+	}
+	return &List{Elems: elems}
+}
+
+// fnSum adds its arguments, which may be numbers or lists of numbers.
+func fnSum(env *Env, args []Value) (Value, error) {
+	vals := flatten(args)
+	if len(vals) == 0 {
+		return newExact(new(big.Rat)), nil
+	}
+
+	total := vals[0]
+	for _, v := range vals[1:] {
+		var err error
+		total, err = arith(env, tokens.OP_PLUS, total, v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return total, nil
+}
+
+// fnMean averages its arguments.
+func fnMean(env *Env, args []Value) (Value, error) {
+	vals := flatten(args)
+	if len(vals) == 0 {
+		return nil, fmt.Errorf("%w: mean of no values", ErrDomain)
+	}
+
+	total, err := fnSum(env, vals)
+	if err != nil {
+		return nil, err
+	}
+	return arith(env, tokens.OP_SLASH, total, newExact(big.NewRat(int64(len(vals)), 1)))
+}
+
+// fnMedian returns the middle argument in sorted order, or the mean of the
+// two middle arguments if there is an even number of them.
+func fnMedian(env *Env, args []Value) (Value, error) {
+	vals := flatten(args)
+	if len(vals) == 0 {
+		return nil, fmt.Errorf("%w: median of no values", ErrDomain)
+	}
+
+	var sortErr error
+	sort.SliceStable(vals, func(i, j int) bool {
+		less, err := arith(env, tokens.OP_LT, vals[i], vals[j])
+		if err != nil {
+			if sortErr == nil {
+				sortErr = err
+			}
+			return false
+		}
+		return bool(less.(Bool))
+	})
+	if sortErr != nil {
+		return nil, sortErr
+	}
+
+	mid := len(vals) / 2
+	if len(vals)%2 == 1 {
+		return vals[mid], nil
+	}
+	return fnMean(env, vals[mid-1:mid+1])
+}
+
+// fnStddev returns the sample standard deviation of its arguments.
+func fnStddev(env *Env, args []Value) (Value, error) {
+	vals := flatten(args)
+	if len(vals) < 2 {
+		return nil, fmt.Errorf("%w: standard deviation needs at least 2 values, got %d", ErrDomain, len(vals))
+	}
+
+	mean, err := fnMean(env, vals)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := mean.(*Number)
+	if !ok {
+		return nil, fmt.Errorf("requires numbers, got %s", mean.Type())
+	}
+
+	squares := make([]Value, len(vals))
+	for i, v := range vals {
+		d, err := arith(env, tokens.OP_MINUS, v, m)
+		if err != nil {
+			return nil, err
+		}
+		if squares[i], err = arith(env, tokens.OP_STAR, d, d); err != nil {
+			return nil, err
+		}
+	}
+
+	total, err := fnSum(env, squares)
+	if err != nil {
+		return nil, err
+	}
+	variance, err := arith(env, tokens.OP_SLASH, total, newExact(big.NewRat(int64(len(vals)-1), 1)))
+	if err != nil {
+		return nil, err
+	}
+
+	sd, err := (&UnaryNode{Op: tokens.Token{Type: tokens.OP_ROOT}}).operate(env, variance)
+	if err != nil {
+		return nil, err
+	}
+
+	res := sd.(*Number)
+	res.Unit = m.Unit
+	if v := variance.(*Number); v.Exact != nil {
+		if exact := exactSqrt(v.Exact); exact != nil {
+			res.Real, res.Exact = newRational(exact), exact
+		}
+	}
+	return res, nil
+}
+
+// fnLen returns the number of elements of a list.
+func fnLen(_ *Env, args []Value) (Value, error) {
+	l, ok := args[0].(*List)
+	if !ok {
+		return nil, fmt.Errorf("expected a list, got %s", args[0].Type())
+	}
+	return newExact(big.NewRat(int64(len(l.Elems)), 1)), nil
+}
+
+// fnDot returns the dot product of two vectors, or the matrix product when
+// either argument is a matrix. A vector on the left of a matrix is a row,
+// and on the right a column.
+func fnDot(env *Env, args []Value) (Value, error) {
+	a, b := args[0], args[1]
+	if !isMatrix(a) && !isMatrix(b) {
+		u, err := vector(a)
+		if err != nil {
+			return nil, err
+		}
+		v, err := vector(b)
+		if err != nil {
+			return nil, err
+		}
+		if len(u) != len(v) {
+			return nil, fmt.Errorf("vectors have different lengths %d and %d", len(u), len(v))
+		}
+		return dotProduct(env, u, v)
+	}
+
+	left, leftVector, err := matrixOperand(a, false)
+	if err != nil {
+		return nil, err
+	}
+	right, rightVector, err := matrixOperand(b, true)
+	if err != nil {
+		return nil, err
+	}
+
+	prod, err := matrixProduct(env, left, right)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case leftVector:
+		return &List{Elems: prod[0]}, nil
+	case rightVector:
+		return &List{Elems: transposed(prod)[0]}, nil
+	}
+	return matrixValue(prod), nil
+}
+
+// matrixOperand returns v as a matrix, treating a vector as a row or, if
+// column is set, as a column.
+func matrixOperand(v Value, column bool) ([][]Value, bool, error) {
+	if isMatrix(v) {
+		m, err := matrix(v)
+		return m, false, err
+	}
+
+	u, err := vector(v)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(u) == 0 {
+		return nil, false, fmt.Errorf("expected a non-empty vector")
+	}
+	if column {
+		return transposed([][]Value{u}), true, nil
+	}
+	return [][]Value{u}, true, nil
+}
+
+// dotProduct sums the products of corresponding elements of u and v, which
+// have the same length.
+func dotProduct(env *Env, u, v []Value) (Value, error) {
+	products := make([]Value, len(u))
+	for i := range u {
+		p, err := arith(env, tokens.OP_STAR, u[i], v[i])
+		if err != nil {
+			return nil, err
+		}
+		products[i] = p
+	}
+	return fnSum(env, products)
+}
+
+// matrixProduct multiplies the matrices a and b.
+func matrixProduct(env *Env, a, b [][]Value) ([][]Value, error) {
+	if len(a[0]) != len(b) {
+		return nil, fmt.Errorf("cannot multiply %dx%d and %dx%d matrices", len(a), len(a[0]), len(b), len(b[0]))
+	}
+
+	cols := transposed(b)
+	prod := make([][]Value, len(a))
+	for i, row := range a {
+		prod[i] = make([]Value, len(cols))
+		for j, col := range cols {
+			p, err := dotProduct(env, row, col)
+			if err != nil {
+				return nil, err
+			}
+			prod[i][j] = p
+		}
+	}
+	return prod, nil
+}
+
+// transposed returns the transpose of the rows of a matrix.
+func transposed(rows [][]Value) [][]Value {
+	cols := make([][]Value, len(rows[0]))
+	for j := range cols {
+		cols[j] = make([]Value, len(rows))
+		for i, row := range rows {
+			cols[j][i] = row[j]
+		}
+	}
+	return cols
+}
+
+// fnCross returns the cross product of two vectors of length 3.
+func fnCross(env *Env, args []Value) (Value, error) {
+	u, err := vector(args[0])
+	if err != nil {
+		return nil, err
+	}
+	v, err := vector(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if len(u) != 3 || len(v) != 3 {
+		return nil, fmt.Errorf("cross product needs vectors of length 3, got %d and %d", len(u), len(v))
+	}
+
+	elems := make([]Value, 3)
+	for i := range elems {
+		j, k := (i+1)%3, (i+2)%3
+		a, err := arith(env, tokens.OP_STAR, u[j], v[k])
+		if err != nil {
+			return nil, err
+		}
+		b, err := arith(env, tokens.OP_STAR, u[k], v[j])
+		if err != nil {
+			return nil, err
+		}
+		if elems[i], err = arith(env, tokens.OP_MINUS, a, b); err != nil {
+			return nil, err
+		}
+	}
+	return &List{Elems: elems}, nil
+}
+
+// fnTranspose swaps the rows and columns of a matrix. The transpose of a
+// vector is a column matrix.
+func fnTranspose(_ *Env, args []Value) (Value, error) {
+	if !isMatrix(args[0]) {
+		u, err := vector(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(u) == 0 {
+			return &List{}, nil
+		}
+		return matrixValue(transposed([][]Value{u})), nil
+	}
+
+	rows, err := matrix(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return matrixValue(transposed(rows)), nil
+}
+
+// fnDet returns the determinant of a square matrix by Gaussian elimination,
+// which keeps exact elements exact.
+func fnDet(env *Env, args []Value) (Value, error) {
+	m, err := squareMatrix(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var det Value = newExact(big.NewRat(1, 1))
+	for k := range m {
+		p := pivot(env, m, k)
+		if p < 0 {
+			return newExact(new(big.Rat)), nil
+		}
+		if p != k {
+			m[k], m[p] = m[p], m[k]
+			if det, err = arith(env, tokens.OP_MINUS, newExact(new(big.Rat)), det); err != nil {
+				return nil, err
+			}
+		}
+
+		if det, err = arith(env, tokens.OP_STAR, det, m[k][k]); err != nil {
+			return nil, err
+		}
+		for i := k + 1; i < len(m); i++ {
+			if err := eliminate(env, m, i, k); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return det, nil
+}
+
+// fnInv returns the inverse of a square matrix by Gauss-Jordan elimination.
+func fnInv(env *Env, args []Value) (Value, error) {
+	m, err := squareMatrix(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// Augment the matrix with the identity, which becomes the inverse as the
+	// left half is reduced to the identity
+	n := len(m)
+	for i := range m {
+		for j := 0; j < n; j++ {
+			var one int64
+			if i == j {
+				one = 1
+			}
+			m[i] = append(m[i], newExact(big.NewRat(one, 1)))
+		}
+	}
+
+	for k := range m {
+		p := pivot(env, m, k)
+		if p < 0 {
+			return nil, ErrSingular
+		}
+		m[k], m[p] = m[p], m[k]
+
+		pv := m[k][k]
+		for j := range m[k] {
+			if m[k][j], err = arith(env, tokens.OP_SLASH, m[k][j], pv); err != nil {
+				return nil, err
+			}
+		}
+		for i := range m {
+			if i == k {
+				continue
+			}
+			if err := eliminate(env, m, i, k); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	inv := make([][]Value, n)
+	for i, row := range m {
+		inv[i] = row[n:]
+	}
+	return matrixValue(inv), nil
+}
+
+// pivot returns the first row at or below k with a non-zero element in
+// column k, or -1 if there is none.
+func pivot(env *Env, m [][]Value, k int) int {
+	for i := k; i < len(m); i++ {
+		if !valueIsZero(env, m[i][k]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// eliminate subtracts a multiple of row k from row i so that column k of row
+// i becomes zero.
+func eliminate(env *Env, m [][]Value, i, k int) error {
+	if valueIsZero(env, m[i][k]) {
+		return nil
+	}
+
+	factor, err := arith(env, tokens.OP_SLASH, m[i][k], m[k][k])
+	if err != nil {
+		return err
+	}
+	for j := k; j < len(m[i]); j++ {
+		p, err := arith(env, tokens.OP_STAR, factor, m[k][j])
+		if err != nil {
+			return err
+		}
+		if m[i][j], err = arith(env, tokens.OP_MINUS, m[i][j], p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package parser
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestListEvaluation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{name: "literal", expr: "[1, 2, 3]", want: "[1, 2, 3]"},
+		{name: "elements are expressions", expr: "[1 + 1, 2 * 3]", want: "[2, 6]"},
+		{name: "scalar broadcast", expr: "[1, 2, 3] + 10", want: "[11, 12, 13]"},
+		{name: "scalar broadcast on the left", expr: "2 ** [1, 2, 3]", want: "[2, 4, 8]"},
+		{name: "elementwise product", expr: "[1, 2, 3] * [4, 5, 6]", want: "[4, 10, 18]"},
+		{name: "elementwise matrix", expr: "[[1, 2], [3, 4]] - [[1, 1], [1, 1]]", want: "[[0, 1], [2, 3]]"},
+		{name: "negation", expr: "-[1, [2, 3]]", want: "[-1, [-2, -3]]"},
+		{name: "units", expr: "[1, 2] km to m", want: "[1000 m, 2000 m]"},
+		{name: "complex elements", expr: "[1, i] * i", want: "[i, -1]"},
+		{name: "unary function", expr: "abs([-1, 2, -3])", want: "[1, 2, 3]"},
+		{name: "variadic function", expr: "max([3, 9], 4)", want: "9"},
+		{name: "user function", expr: "sq([1, 2, 3])", want: "[1, 4, 9]"},
+		{name: "inequality", expr: "[1, 2] != [1, 3]", want: "(1 == 1)"},
+		{name: "different shapes", expr: "[1, 2] == [1, 2, 3]", want: "(1 == 0)"},
+		{name: "len", expr: "len([[1, 2], [3, 4], [5, 6]])", want: "3"},
+		{name: "sum", expr: "sum([1, 2, 3], 4)", want: "10"},
+		{name: "sum of matrix", expr: "sum([[1, 2], [3, 4]])", want: "10"},
+		{name: "sum of nothing", expr: "sum([])", want: "0"},
+		{name: "sum of quantities", expr: "sum([1 m, 50 cm])", want: "1.5 m"},
+		{name: "mean", expr: "mean([1, 2, 3, 4])", want: "5/2"},
+		{name: "median", expr: "median([5, 1, 3])", want: "3"},
+		{name: "median of even count", expr: "median([5, 1, 3, 2])", want: "5/2"},
+		{name: "exact stddev", expr: "stddev([1, 3])", want: "sqrt(2)"},
+		{name: "dot", expr: "dot([1, 2, 3], [4, 5, 6])", want: "32"},
+		{name: "matrix product", expr: "dot([[1, 2], [3, 4]], [[5, 6], [7, 8]])", want: "[[19, 22], [43, 50]]"},
+		{name: "matrix times vector", expr: "dot([[1, 2], [3, 4]], [5, 6])", want: "[17, 39]"},
+		{name: "vector times matrix", expr: "dot([5, 6], [[1, 2], [3, 4]])", want: "[23, 34]"},
+		{name: "cross", expr: "cross([1, 0, 0], [0, 1, 0])", want: "[0, 0, 1]"},
+		{name: "cross of general vectors", expr: "cross([1, 2, 3], [4, 5, 6])", want: "[-3, 6, -3]"},
+		{name: "det", expr: "det([[1, 2], [3, 4]])", want: "-2"},
+		{name: "det with pivoting", expr: "det([[0, 1, 2], [1, 0, 3], [4, -3, 8]])", want: "-2"},
+		{name: "det of singular", expr: "det([[1, 2], [2, 4]])", want: "0"},
+		{name: "inv", expr: "inv([[1, 2], [3, 4]])", want: "[[-2, 1], [3/2, -1/2]]"},
+		{name: "inv with pivoting", expr: "inv([[0, 1], [1, 0]])", want: "[[0, 1], [1, 0]]"},
+		{name: "inverse product", expr: "dot([[2, 1], [7, 4]], inv([[2, 1], [7, 4]]))", want: "[[1, 0], [0, 1]]"},
+		{name: "transpose", expr: "transpose([[1, 2, 3], [4, 5, 6]])", want: "[[1, 4], [2, 5], [3, 6]]"},
+		{name: "transpose of vector", expr: "transpose([1, 2])", want: "[[1], [2]]"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			env := NewEnv()
+			if _, err := parseAndEval(t, "sq(x) = x * x", env); err != nil {
+				t.Fatal(err)
+			}
+
+			v, err := parseAndEval(t, "("+tt.expr+") == "+tt.want, env)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if v != Bool(true) {
+				t.Errorf("%s is not %s", tt.expr, tt.want)
+			}
+		})
+	}
+}
+
+func TestListExact(t *testing.T) {
+	t.Parallel()
+
+	v, err := parseAndEval(t, "inv([[1/3, 0], [0, 1/5]])", NewEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := v.(*List).Elems
+	for i, want := range []string{"3", "5"} {
+		n := rows[i].(*List).Elems[i].(*Number)
+		if n.Exact == nil || n.Exact.RatString() != want {
+			t.Errorf("element %d,%d = %v, want exactly %s", i, i, n.Exact, want)
+		}
+	}
+
+	v, err = parseAndEval(t, "stddev([2, 4, 4, 4, 5, 5, 7, 9])", NewEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := realToFloat(t, v); math.Abs(got-math.Sqrt(32.0/7)) > 1e-9 {
+		t.Errorf("stddev = %g, want %g", got, math.Sqrt(32.0/7))
+	}
+}
+
+func TestListString(t *testing.T) {
+	t.Parallel()
+
+	p := New("test", "[1, [2 + 3, x]]")
+	node, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := node.String(); got != "[1, [2 + 3, x]]" {
+		t.Errorf("String() = %q, want %q", got, "[1, [2 + 3, x]]")
+	}
+}
+
+func TestListErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr string
+	}{
+		{name: "unclosed", expr: "[1, 2", wantErr: "unexpected EOF in list"},
+		{name: "missing comma", expr: "[1 2]", wantErr: "in list, expecting COMMA or RBRACKET"},
+		{name: "bool element", expr: "[1 < 2]", wantErr: "list elements must be numbers, got bool"},
+		{name: "length mismatch", expr: "[1, 2] + [1]", wantErr: "cannot apply + to lists of length 2 and 1"},
+		{name: "ordering", expr: "[1] < [2]", wantErr: "< is not defined for lists"},
+		{name: "compare with number", expr: "[1] == 1", wantErr: "cannot compare list and number"},
+		{name: "logical", expr: "[1] && true", wantErr: "&& requires a bool, got list"},
+		{name: "incompatible elements", expr: "sum([1 m, 1 s])", wantErr: "sum: incompatible units"},
+		{name: "mean of nothing", expr: "mean([])", wantErr: "mean of no values"},
+		{name: "median of complex", expr: "median([i, 1])", wantErr: "< is not defined for complex numbers"},
+		{name: "stddev of one", expr: "stddev([1])", wantErr: "needs at least 2 values"},
+		{name: "dot length", expr: "dot([1, 2], [1])", wantErr: "vectors have different lengths 2 and 1"},
+		{name: "matrix product shape", expr: "dot([[1, 2]], [[1, 2]])", wantErr: "cannot multiply 1x2 and 1x2 matrices"},
+		{name: "cross length", expr: "cross([1, 2], [3, 4])", wantErr: "needs vectors of length 3"},
+		{name: "det of non-square", expr: "det([[1, 2]])", wantErr: "expected a square matrix, got 1x2"},
+		{name: "det of vector", expr: "det([1, 2])", wantErr: "expected a matrix, got list"},
+		{name: "ragged matrix", expr: "det([[1, 2], [3]])", wantErr: "rows of a matrix must be non-empty and of the same length"},
+		{name: "singular", expr: "inv([[1, 2], [2, 4]])", wantErr: "inv: matrix is singular"},
+		{name: "len of number", expr: "len(3)", wantErr: "expected a list, got number"},
+		{name: "multi-argument function", expr: "atan2([1], 1)", wantErr: "atan2 requires numbers, got list"},
+		{name: "empty variadic", expr: "max([])", wantErr: "max: wrong number of arguments"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := parseAndEval(t, tt.expr, NewEnv())
+			if err == nil {
+				t.Fatalf("expected error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error mismatch: got %v want substring %q", err, tt.wantErr)
+			}
+		})
+	}
+}
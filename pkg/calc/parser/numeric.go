@@ -0,0 +1,404 @@
+package parser
+
+import (
+	"errors"
+	"math"
+	"math/big"
+)
+
+// maxNewtonSteps bounds the iterations of Newton's method in solve, beyond
+// two for each bit of precision: near a multiple root, the method gains
+// about a bit a step, rather than doubling its bits.
+const maxNewtonSteps = 100
+
+// maxRefinement bounds the precision to which solve evaluates a residual
+// that rounds to zero before taking it as a root, as a multiple of that of
+// the environment.
+const maxRefinement = 4
+
+// maxQuadratureDepth bounds how many times integrate halves an interval.
+const maxQuadratureDepth = 200
+
+// maxQuadratureStalls bounds how many times in a row integrate halves an
+// interval without its estimates of the magnitude of the expression
+// improving.
+const maxQuadratureStalls = 4
+
+// quadratureOrder is the number of points of the Gauss-Legendre rule that
+// integrate applies to each interval.
+const quadratureOrder = 16
+
+// guardBits is the extra precision to which solve and integrate evaluate
+// their expressions, beyond that of the environment.
+const guardBits = 16
+
+// numeric evaluates an expression of one variable at rational points, for
+// solve and integrate.
+type numeric struct {
+	env  *Env
+	call *CallNode
+	node Node
+	name string
+	// precision is the precision to which values are approximated
+	precision int
+}
+
+// newNumeric returns a numeric for the expression given as call's first
+// argument, of the variable named by its second.
+func newNumeric(env *Env, call *CallNode) (*numeric, error) {
+	name, err := variableArg(call, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &numeric{env: env, call: call, node: call.Args[0], name: name, precision: env.precision - guardBits}, nil
+}
+
+// at evaluates node at x.
+func (f *numeric) at(node Node, x *big.Rat) (*big.Rat, error) {
+	if err := f.env.check(); err != nil {
+		return nil, err
+	}
+
+	v, err := evalAt(f.env, node, f.name, &Number{Real: newRational(x), Exact: x})
+	if err != nil {
+		return nil, err
+	}
+	r, err := dimensionless(v, f.call.Name)
+	if err != nil {
+		return nil, err
+	}
+	return approximate(r, f.precision)
+}
+
+// arg evaluates call's i-th argument as a rational.
+func (f *numeric) arg(i int) (*big.Rat, error) {
+	v, err := f.call.Args[i].Eval(f.env)
+	if err != nil {
+		return nil, err
+	}
+	r, err := dimensionless(v, f.call.Name)
+	if err != nil {
+		return nil, err
+	}
+	return approximate(r, f.precision)
+}
+
+// round rounds x to the precision, to keep rationals from growing without
+// bound over many steps.
+func (f *numeric) round(x *big.Rat) *big.Rat {
+	scale := new(big.Int).Lsh(big.NewInt(1), uint(-f.precision))
+	n := roundRat(new(big.Rat).Mul(x, new(big.Rat).SetInt(scale)))
+	return new(big.Rat).SetFrac(n, scale)
+}
+
+// tolerance returns 2 raised to the precision of the environment, the
+// largest error tolerated in a result.
+func (f *numeric) tolerance() *big.Rat {
+	return new(big.Rat).SetFrac(big.NewInt(1), new(big.Int).Lsh(big.NewInt(1), uint(-f.env.precision)))
+}
+
+// result returns x as an approximate number.
+func (f *numeric) result(x *big.Rat) Value {
+	return &Number{Real: newRational(x)}
+}
+
+func (f *numeric) errorf(format string, args ...any) error {
+	return errorAt(f.call.Name.Pos, "%s: "+format, append([]any{f.call.Name.Value}, args...)...)
+}
+
+// fnSolve finds a root of an expression by Newton's method from a guess,
+// or by bisection of an interval whose ends differ in sign.
+func fnSolve(env *Env, call *CallNode) (Value, error) {
+	f, err := newNumeric(env, call)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := f.arg(2)
+	if err != nil {
+		return nil, err
+	}
+	if len(call.Args) == 4 {
+		b, err := f.arg(3)
+		if err != nil {
+			return nil, err
+		}
+		return f.bisect(a, b)
+	}
+	return f.newton(a)
+}
+
+func (f *numeric) newton(x *big.Rat) (Value, error) {
+	d, err := newDiffer(f.env, f.call)
+	if err != nil {
+		return nil, err
+	}
+	deriv, err := d.differentiate(f.node)
+	if perr := (*PositionError)(nil); errors.As(err, &perr) {
+		return nil, errorAt(perr.Pos, "%w; give an interval to bisect instead, as in solve(expr, x, a, b)", perr.Err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Steps shrink only geometrically near a multiple root, where x can be
+	// many steps from the root, so they must shrink to well within the
+	// tolerance
+	tol := new(big.Rat).Quo(f.tolerance(), new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), guardBits)))
+	steps := maxNewtonSteps - 2*f.precision
+	for range steps {
+		fx, err := f.residual(x)
+		if err != nil {
+			return nil, err
+		}
+		if fx.Sign() == 0 {
+			return f.result(x), nil
+		}
+
+		dfx, err := f.at(deriv, x)
+		if err != nil {
+			return nil, err
+		}
+		if dfx.Sign() == 0 {
+			return nil, f.errorf("derivative is zero at %s", x.FloatString(10))
+		}
+
+		step := new(big.Rat).Quo(fx, dfx)
+		x = f.round(new(big.Rat).Sub(x, step))
+		if step.Abs(step).Cmp(tol) <= 0 {
+			return f.result(x), nil
+		}
+	}
+	return nil, f.errorf("did not converge after %d steps", steps)
+}
+
+// residual evaluates the expression at x. A residual that rounds to zero
+// only says that x is near a root, which near a multiple root may be far
+// short of the tolerance, so it is evaluated again to more bits, keeping
+// them for the steps that follow.
+func (f *numeric) residual(x *big.Rat) (*big.Rat, error) {
+	finest := maxRefinement * (f.env.precision - guardBits)
+	fx, err := f.at(f.node, x)
+	for err == nil && fx.Sign() == 0 && f.precision > finest {
+		f.precision = max(2*f.precision, finest)
+		fx, err = f.at(f.node, x)
+	}
+	return fx, err
+}
+
+func (f *numeric) bisect(a, b *big.Rat) (Value, error) {
+	fa, err := f.at(f.node, a)
+	if err != nil {
+		return nil, err
+	}
+	fb, err := f.at(f.node, b)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case fa.Sign() == 0:
+		return f.result(a), nil
+	case fb.Sign() == 0:
+		return f.result(b), nil
+	case fa.Sign() == fb.Sign():
+		return nil, f.errorf("expression has the same sign at both ends of the interval")
+	}
+
+	tol := f.tolerance()
+	for new(big.Rat).Abs(new(big.Rat).Sub(b, a)).Cmp(tol) > 0 {
+		m := new(big.Rat).Quo(new(big.Rat).Add(a, b), big.NewRat(2, 1))
+		fm, err := f.at(f.node, m)
+		if err != nil {
+			return nil, err
+		}
+		if fm.Sign() == 0 {
+			return f.result(m), nil
+		}
+		if fm.Sign() == fa.Sign() {
+			a, fa = m, fm
+		} else {
+			b = m
+		}
+	}
+	return f.result(new(big.Rat).Quo(new(big.Rat).Add(a, b), big.NewRat(2, 1))), nil
+}
+
+// fnIntegrate integrates an expression over an interval by adaptive
+// Gauss-Legendre quadrature, halving intervals until the result is
+// accurate to the environment's precision.
+func fnIntegrate(env *Env, call *CallNode) (Value, error) {
+	f, err := newNumeric(env, call)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := f.arg(2)
+	if err != nil {
+		return nil, err
+	}
+	b, err := f.arg(3)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &quadrature{numeric: f}
+	q.nodes, q.weights = gaussLegendre(quadratureOrder, uint(-f.precision))
+
+	// Intervals are accepted once within a small share of the tolerance,
+	// so that their errors sum to within it
+	q.tol = new(big.Rat).Quo(f.tolerance(), big.NewRat(256, 1))
+
+	whole, err := q.rule(a, b)
+	if err != nil {
+		return nil, err
+	}
+
+	// The estimates of |f| need only settle to a share of the whole, since
+	// they guard against those of f cancelling, as for 1/x about zero, and
+	// a kink where f changes sign would otherwise take many halvings
+	q.magTol = new(big.Rat).Quo(whole.mag, big.NewRat(1<<16, 1))
+	if q.magTol.Cmp(q.tol) < 0 {
+		q.magTol = q.tol
+	}
+
+	res, err := q.adapt(a, b, whole, nil, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	return f.result(f.round(res)), nil
+}
+
+// quadrature integrates by an adaptive Gauss-Legendre rule.
+type quadrature struct {
+	*numeric
+	nodes, weights []*big.Rat
+	tol, magTol    *big.Rat
+}
+
+// estimate is the rule applied to an interval, both to the expression and
+// to its absolute value.
+type estimate struct {
+	value, mag *big.Rat
+}
+
+// rule applies the Gauss-Legendre rule to the interval from a to b.
+func (q *quadrature) rule(a, b *big.Rat) (estimate, error) {
+	half := new(big.Rat).Quo(new(big.Rat).Sub(b, a), big.NewRat(2, 1))
+	mid := new(big.Rat).Quo(new(big.Rat).Add(a, b), big.NewRat(2, 1))
+
+	sum, mag := new(big.Rat), new(big.Rat)
+	for i, node := range q.nodes {
+		x := q.round(new(big.Rat).Add(mid, new(big.Rat).Mul(half, node)))
+		fx, err := q.at(q.node, x)
+		if err != nil {
+			return estimate{}, err
+		}
+		wfx := new(big.Rat).Mul(q.weights[i], fx)
+		sum.Add(sum, wfx)
+		mag.Add(mag, wfx.Abs(wfx))
+	}
+	sum.Mul(sum, half)
+	mag.Mul(mag, half.Abs(half))
+	return estimate{value: q.round(sum), mag: q.round(mag)}, nil
+}
+
+// adapt refines whole, the rule applied to the interval from a to b, by
+// applying it to each half of the interval until the two agree. The halves'
+// estimates of |f| differ from whole's by less at each depth, unless near a
+// singularity that is not integrable, where they stall; spread is by how
+// much they differed at the depth above, and stalls counts the depths in a
+// row at which that shrank by less than an eighth.
+func (q *quadrature) adapt(a, b *big.Rat, whole estimate, spread *big.Rat, stalls, depth int) (*big.Rat, error) {
+	mid := new(big.Rat).Quo(new(big.Rat).Add(a, b), big.NewRat(2, 1))
+	left, err := q.rule(a, mid)
+	if err != nil {
+		return nil, err
+	}
+	right, err := q.rule(mid, b)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := new(big.Rat).Add(left.value, right.value)
+	diff := new(big.Rat).Abs(new(big.Rat).Sub(sum, whole.value))
+	magDiff := new(big.Rat).Sub(new(big.Rat).Add(left.mag, right.mag), whole.mag)
+	magDiff.Abs(magDiff)
+	if diff.Cmp(q.tol) <= 0 && magDiff.Cmp(q.magTol) <= 0 {
+		return sum, nil
+	}
+
+	if spread != nil && new(big.Rat).Mul(magDiff, big.NewRat(8, 1)).Cmp(new(big.Rat).Mul(spread, big.NewRat(7, 1))) > 0 {
+		stalls++
+	} else {
+		stalls = 0
+	}
+	if depth >= maxQuadratureDepth || stalls >= maxQuadratureStalls {
+		return nil, q.errorf("did not converge; the expression may not be integrable over the interval")
+	}
+
+	l, err := q.adapt(a, mid, left, magDiff, stalls, depth+1)
+	if err != nil {
+		return nil, err
+	}
+	r, err := q.adapt(mid, b, right, magDiff, stalls, depth+1)
+	if err != nil {
+		return nil, err
+	}
+	return l.Add(l, r), nil
+}
+
+// gaussLegendre returns the nodes and weights of the n-point Gauss-Legendre
+// rule on the interval from -1 to 1, computed to prec bits by Newton's
+// method on the Legendre polynomial of degree n.
+func gaussLegendre(n int, prec uint) ([]*big.Rat, []*big.Rat) {
+	prec += 32
+	newFloat := func(x float64) *big.Float {
+		return new(big.Float).SetPrec(prec).SetFloat64(x)
+	}
+	one := newFloat(1)
+	eps := new(big.Float).SetMantExp(one, -int(prec)+8)
+
+	nodes := make([]*big.Rat, n)
+	weights := make([]*big.Rat, n)
+	for i := range (n + 1) / 2 {
+		x := newFloat(math.Cos(math.Pi * (float64(i) + 0.75) / (float64(n) + 0.5)))
+
+		var deriv *big.Float
+		for range 100 {
+			// Evaluate the polynomial and its derivative by the recurrence
+			// (k+1) P[k+1] = (2k+1) x P[k] - k P[k-1]
+			p0, p1 := newFloat(1), newFloat(0).Set(x)
+			for k := 1; k < n; k++ {
+				t := newFloat(0).Mul(x, p1)
+				t.Mul(t, newFloat(float64(2*k+1)))
+				t.Sub(t, newFloat(0).Mul(p0, newFloat(float64(k))))
+				t.Quo(t, newFloat(float64(k+1)))
+				p0, p1 = p1, t
+			}
+
+			// P'[n] = n (x P[n] - P[n-1]) / (x**2 - 1)
+			deriv = newFloat(0).Mul(x, p1)
+			deriv.Sub(deriv, p0)
+			deriv.Mul(deriv, newFloat(float64(n)))
+			deriv.Quo(deriv, newFloat(0).Sub(newFloat(0).Mul(x, x), one))
+
+			step := newFloat(0).Quo(p1, deriv)
+			x.Sub(x, step)
+			if step.Abs(step).Cmp(eps) < 0 {
+				break
+			}
+		}
+
+		// w = 2 / ((1 - x**2) P'[n]**2)
+		w := newFloat(0).Sub(one, newFloat(0).Mul(x, x))
+		w.Mul(w, newFloat(0).Mul(deriv, deriv))
+		w.Quo(newFloat(2), w)
+
+		xr, _ := x.Rat(nil)
+		wr, _ := w.Rat(nil)
+		nodes[i], weights[i] = new(big.Rat).Neg(xr), wr
+		nodes[n-1-i], weights[n-1-i] = xr, wr
+	}
+	return nodes, weights
+}
@@ -0,0 +1,310 @@
+package parser
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+
+	"github.com/ripta/reals/pkg/unified"
+
+	"github.com/ripta/rt/pkg/calc/tokens"
+)
+
+// factorialChunk is the number of factors multiplied between checks of
+// whether evaluation should stop.
+const factorialChunk = 4096
+
+// trialDivisionBound is the largest divisor tried before factoring with
+// Pollard's rho.
+const trialDivisionBound = 1000
+
+// integerFunc wraps a function of n integers, or of one or more if n is -1,
+// as a builtinFunc. Its arguments must be integers, and its result is always
+// an exact integer.
+func integerFunc(n int, desc string, fn func(*Env, []*big.Int) (*big.Int, error)) *builtinFunc {
+	return &builtinFunc{
+		MinArgs:     max(n, 1),
+		MaxArgs:     n,
+		Description: desc,
+		Rational: func(env *Env, args []*unified.Real, exact []*big.Rat) (*big.Rat, error) {
+			ints := make([]*big.Int, len(args))
+			for i := range args {
+				x, err := integerArg(env, args[i], exact[i])
+				if err != nil {
+					return nil, err
+				}
+				ints[i] = x
+			}
+
+			res, err := fn(env, ints)
+			if err != nil {
+				return nil, err
+			}
+			return new(big.Rat).SetInt(res), nil
+		},
+	}
+}
+
+// integerArg returns the integer argument x, whose exact value is known if
+// exact is non-nil.
+func integerArg(env *Env, x *unified.Real, exact *big.Rat) (*big.Int, error) {
+	if exact == nil {
+		approx, err := approximate(x, env.precision)
+		if err != nil {
+			return nil, err
+		}
+		exact = approx
+	}
+	if !exact.IsInt() {
+		return nil, fmt.Errorf("%w: expected integer arguments, got non-integer value", ErrDomain)
+	}
+	return new(big.Int).Set(exact.Num()), nil
+}
+
+// integerValueArg returns the integer v, which must be a dimensionless
+// number.
+func integerValueArg(env *Env, v Value) (*big.Int, error) {
+	n, ok := v.(*Number)
+	if !ok {
+		return nil, fmt.Errorf("expected an integer, got %s", v.Type())
+	}
+	if !n.Dim.IsZero() {
+		return nil, fmt.Errorf("expected a dimensionless integer, got %s", n.Dim)
+	}
+	return integerArg(env, n.Real, n.Exact)
+}
+
+func fnGCD(_ *Env, args []*big.Int) (*big.Int, error) {
+	res := new(big.Int)
+	for _, x := range args {
+		res.GCD(nil, nil, res, x)
+	}
+	return res, nil
+}
+
+func fnLCM(_ *Env, args []*big.Int) (*big.Int, error) {
+	res := big.NewInt(1)
+	for _, x := range args {
+		if x.Sign() == 0 {
+			return new(big.Int), nil
+		}
+		gcd := new(big.Int).GCD(nil, nil, res, x)
+		res.Mul(res, new(big.Int).Abs(x))
+		res.Quo(res, gcd)
+	}
+	return res, nil
+}
+
+func fnFactorial(env *Env, args []*big.Int) (*big.Int, error) {
+	n := args[0]
+	if n.Sign() < 0 {
+		return nil, fmt.Errorf("%w: factorial of negative number", ErrDomain)
+	}
+	if !n.IsInt64() {
+		return nil, fmt.Errorf("%w: %s is too large", ErrDomain, n)
+	}
+
+	res := big.NewInt(1)
+	for lo := int64(2); lo <= n.Int64(); lo += factorialChunk {
+		if err := env.check(); err != nil {
+			return nil, err
+		}
+		hi := min(lo+factorialChunk-1, n.Int64())
+		res.Mul(res, new(big.Int).MulRange(lo, hi))
+	}
+	return res, nil
+}
+
+// fnBinom computes the binomial coefficient, extended to negative n by
+// binom(n, k) = (-1)**k * binom(k - n - 1, k).
+func fnBinom(_ *Env, args []*big.Int) (*big.Int, error) {
+	n, k := args[0], args[1]
+	if k.Sign() < 0 {
+		return new(big.Int), nil
+	}
+	if !n.IsInt64() || !k.IsInt64() {
+		return nil, fmt.Errorf("%w: arguments are too large", ErrDomain)
+	}
+
+	if n.Sign() >= 0 {
+		return new(big.Int).Binomial(n.Int64(), k.Int64()), nil
+	}
+	res := new(big.Int).Binomial(k.Int64()-n.Int64()-1, k.Int64())
+	if k.Bit(0) == 1 {
+		res.Neg(res)
+	}
+	return res, nil
+}
+
+func fnModpow(_ *Env, args []*big.Int) (*big.Int, error) {
+	b, e, m := args[0], args[1], args[2]
+	if m.Sign() == 0 {
+		return nil, fmt.Errorf("%w: modulus must be non-zero", ErrDomain)
+	}
+
+	res := new(big.Int).Exp(b, e, m)
+	if res == nil {
+		return nil, fmt.Errorf("%w: %s has no inverse modulo %s", ErrDomain, b, m)
+	}
+	return res, nil
+}
+
+func fnModinv(_ *Env, args []*big.Int) (*big.Int, error) {
+	a, m := args[0], args[1]
+	if m.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: modulus must be positive", ErrDomain)
+	}
+
+	res := new(big.Int).ModInverse(new(big.Int).Mod(a, m), m)
+	if res == nil {
+		return nil, fmt.Errorf("%w: %s has no inverse modulo %s", ErrDomain, a, m)
+	}
+	return res, nil
+}
+
+func fnIsqrt(_ *Env, args []*big.Int) (*big.Int, error) {
+	if args[0].Sign() < 0 {
+		return nil, fmt.Errorf("%w: square root of negative number", ErrDomain)
+	}
+	return new(big.Int).Sqrt(args[0]), nil
+}
+
+func fnIlog2(_ *Env, args []*big.Int) (*big.Int, error) {
+	if args[0].Sign() <= 0 {
+		return nil, fmt.Errorf("%w: logarithm of non-positive number", ErrDomain)
+	}
+	return big.NewInt(int64(args[0].BitLen() - 1)), nil
+}
+
+func fnIsPrime(env *Env, args []Value) (Value, error) {
+	n, err := integerValueArg(env, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return Bool(n.ProbablyPrime(20)), nil
+}
+
+// fnFactor returns the prime factors of an integer in ascending order,
+// repeated by their multiplicity, with -1 first for negative integers.
+func fnFactor(env *Env, args []Value) (Value, error) {
+	n, err := integerValueArg(env, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if n.Sign() == 0 {
+		return nil, fmt.Errorf("%w: cannot factor 0", ErrDomain)
+	}
+
+	var factors []*big.Int
+	if n.Sign() < 0 {
+		factors = append(factors, big.NewInt(-1))
+	}
+	factors, err = factorize(env, new(big.Int).Abs(n), factors)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(factors, (*big.Int).Cmp)
+
+	elems := make([]Value, len(factors))
+	for i, f := range factors {
+		r := new(big.Rat).SetInt(f)
+		elems[i] = &Number{Real: newRational(r), Exact: r}
+	}
+	return &List{Elems: elems}, nil
+}
+
+// factorize appends the prime factors of the positive integer n to factors,
+// by trial division of small factors and Pollard's rho for the rest.
+func factorize(env *Env, n *big.Int, factors []*big.Int) ([]*big.Int, error) {
+	n = new(big.Int).Set(n)
+	rem := new(big.Int)
+	for d := int64(2); d <= trialDivisionBound; d++ {
+		div := big.NewInt(d)
+		if new(big.Int).Mul(div, div).Cmp(n) > 0 {
+			break
+		}
+		for {
+			q, r := new(big.Int).QuoRem(n, div, rem)
+			if r.Sign() != 0 {
+				break
+			}
+			factors = append(factors, div)
+			n = q
+		}
+	}
+	return splitFactors(env, n, factors)
+}
+
+// splitFactors appends the prime factors of n, which has no small factors,
+// to factors.
+func splitFactors(env *Env, n *big.Int, factors []*big.Int) ([]*big.Int, error) {
+	if n.Cmp(big.NewInt(1)) == 0 {
+		return factors, nil
+	}
+	if n.ProbablyPrime(20) {
+		return append(factors, n), nil
+	}
+
+	d, err := pollardRho(env, n)
+	if err != nil {
+		return nil, err
+	}
+	factors, err = splitFactors(env, d, factors)
+	if err != nil {
+		return nil, err
+	}
+	return splitFactors(env, new(big.Int).Quo(n, d), factors)
+}
+
+// pollardRho returns a non-trivial factor of the composite n.
+func pollardRho(env *Env, n *big.Int) (*big.Int, error) {
+	one := big.NewInt(1)
+	for c := int64(1); ; c++ {
+		step := func(x *big.Int) {
+			x.Mul(x, x)
+			x.Add(x, big.NewInt(c))
+			x.Mod(x, n)
+		}
+
+		x, y, d := big.NewInt(2), big.NewInt(2), big.NewInt(1)
+		diff := new(big.Int)
+		for i := 0; d.Cmp(one) == 0; i++ {
+			if i%1024 == 0 {
+				if err := env.check(); err != nil {
+					return nil, err
+				}
+			}
+			step(x)
+			step(y)
+			step(y)
+			d.GCD(nil, nil, diff.Abs(diff.Sub(x, y)), n)
+		}
+		if d.Cmp(n) != 0 {
+			return d, nil
+		}
+	}
+}
+
+// FactorialNode is the postfix factorial, e.g. 5!.
+type FactorialNode struct {
+	Expr Node
+	Op   tokens.Token
+}
+
+func (n *FactorialNode) Eval(env *Env) (Value, error) {
+	if env == nil {
+		env = NewEnv()
+	}
+
+	v, err := n.Expr.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	call := &CallNode{Name: tokens.Token{Type: tokens.IDENT, Value: "factorial", Pos: n.Op.Pos}}
+	return call.callBuiltin(env, builtinFunctions["factorial"], []Value{v})
+}
+
+func (n *FactorialNode) String() string {
+	return parenthesize(n.Expr, precPrimary) + "!"
+}
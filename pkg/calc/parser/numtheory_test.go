@@ -0,0 +1,138 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNumberTheory(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{name: "gcd", expr: "gcd(12, 18, -8)", want: "2"},
+		{name: "gcd of zero", expr: "gcd(0, 0)", want: "0"},
+		{name: "gcd of list", expr: "gcd([12, 18], 8)", want: "2"},
+		{name: "lcm", expr: "lcm(4, 6, 10)", want: "60"},
+		{name: "lcm with zero", expr: "lcm(4, 0)", want: "0"},
+		{name: "factorial", expr: "factorial(20)", want: "2432902008176640000"},
+		{name: "factorial of zero", expr: "factorial(0)", want: "1"},
+		{name: "postfix factorial", expr: "5!", want: "120"},
+		{name: "repeated factorial", expr: "3!!", want: "720"},
+		{name: "factorial binds tighter than minus", expr: "-3!", want: "-6"},
+		{name: "factorial binds tighter than power", expr: "2 ** 3!", want: "64"},
+		{name: "factorial of list", expr: "[3, 4]!", want: "[6, 24]"},
+		{name: "factorial of computed integer", expr: "(2 + 2)!", want: "24"},
+		{name: "binom", expr: "binom(5, 2)", want: "10"},
+		{name: "binom of more than n", expr: "binom(3, 5)", want: "0"},
+		{name: "binom of negative k", expr: "binom(3, -1)", want: "0"},
+		{name: "binom of negative n", expr: "binom(-1, 3)", want: "-1"},
+		{name: "modpow", expr: "modpow(2, 10, 1000)", want: "24"},
+		{name: "modpow of large exponent", expr: "modpow(3, 10 ** 30, 1000000007)", want: "965115194"},
+		{name: "modpow of negative base", expr: "modpow(-2, 3, 5)", want: "2"},
+		{name: "modpow of negative exponent", expr: "modpow(3, -1, 7)", want: "5"},
+		{name: "modinv", expr: "modinv(3, 7)", want: "5"},
+		{name: "modinv of negative", expr: "modinv(-3, 7)", want: "2"},
+		{name: "isqrt", expr: "isqrt(99)", want: "9"},
+		{name: "isqrt of large", expr: "isqrt(10 ** 40 + 1)", want: "10 ** 20"},
+		{name: "ilog2", expr: "ilog2(1024)", want: "10"},
+		{name: "ilog2 rounds down", expr: "ilog2(1023)", want: "9"},
+		{name: "factor", expr: "factor(360)", want: "[2, 2, 2, 3, 3, 5]"},
+		{name: "factor of negative", expr: "factor(-12)", want: "[-1, 2, 2, 3]"},
+		{name: "factor of one", expr: "factor(1)", want: "[]"},
+		{name: "factor of prime", expr: "factor(1000003)", want: "[1000003]"},
+		{name: "factor of semiprime", expr: "factor(1000003 * 1000033)", want: "[1000003, 1000033]"},
+		{name: "factor of Fermat number", expr: "factor(2 ** 64 + 1)", want: "[274177, 67280421310721]"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			v, err := parseAndEval(t, "("+tt.expr+") == "+tt.want, NewEnv())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if v != Bool(true) {
+				got, _ := parseAndEval(t, tt.expr, NewEnv())
+				t.Errorf("%s = %v, want %s", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPrime(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{expr: "isprime(2)", want: true},
+		{expr: "isprime(1)", want: false},
+		{expr: "isprime(0)", want: false},
+		{expr: "isprime(-7)", want: false},
+		{expr: "isprime(91)", want: false},
+		{expr: "isprime(2 ** 61 - 1)", want: true},
+		{expr: "isprime(2 ** 64 + 1)", want: false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.expr, func(t *testing.T) {
+			t.Parallel()
+
+			v, err := parseAndEval(t, tt.expr, NewEnv())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if v != Bool(tt.want) {
+				t.Errorf("%s = %v, want %v", tt.expr, v, tt.want)
+			}
+		})
+	}
+}
+
+func TestNumberTheoryErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr string
+	}{
+		{name: "non-integer", expr: "gcd(1.5, 3)", wantErr: "gcd: argument out of domain: expected integer arguments"},
+		{name: "units", expr: "lcm(2 m, 4)", wantErr: "lcm requires a dimensionless value, got m"},
+		{name: "negative factorial", expr: "(-1)!", wantErr: "test:1:5: factorial: argument out of domain: factorial of negative number"},
+		{name: "non-integer factorial", expr: "1.5!", wantErr: "expected integer arguments"},
+		{name: "no inverse", expr: "modinv(2, 4)", wantErr: "2 has no inverse modulo 4"},
+		{name: "no inverse power", expr: "modpow(2, -1, 4)", wantErr: "2 has no inverse modulo 4"},
+		{name: "zero modulus", expr: "modpow(2, 3, 0)", wantErr: "modulus must be non-zero"},
+		{name: "non-positive modulus", expr: "modinv(2, -5)", wantErr: "modulus must be positive"},
+		{name: "negative isqrt", expr: "isqrt(-1)", wantErr: "square root of negative number"},
+		{name: "zero ilog2", expr: "ilog2(0)", wantErr: "logarithm of non-positive number"},
+		{name: "factor of zero", expr: "factor(0)", wantErr: "cannot factor 0"},
+		{name: "isprime of list", expr: "isprime([7])", wantErr: "isprime: expected an integer, got list"},
+		{name: "isprime of quantity", expr: "isprime(7 m)", wantErr: "isprime: expected a dimensionless integer, got m"},
+		{name: "isprime of non-integer", expr: "isprime(7.5)", wantErr: "expected integer arguments"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := parseAndEval(t, tt.expr, NewEnv())
+			if err == nil {
+				t.Fatalf("expected error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error mismatch: got %v want substring %q", err, tt.wantErr)
+			}
+		})
+	}
+}
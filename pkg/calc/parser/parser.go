@@ -4,14 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"slices"
+	"strconv"
 	"strings"
 
-	"github.com/ripta/reals/pkg/constructive"
-	"github.com/ripta/reals/pkg/rational"
-	"github.com/ripta/reals/pkg/unified"
-
 	"github.com/ripta/rt/pkg/calc/lexer"
 	"github.com/ripta/rt/pkg/calc/tokens"
+	"github.com/ripta/rt/pkg/calc/units"
 )
 
 var ErrUnexpectedToken = errors.New("unexpected token")
@@ -27,8 +26,14 @@ type P struct {
 }
 
 func New(name, src string) *P {
+	return NewAt(name, src, 1)
+}
+
+// NewAt is New for a source that starts on the given line of the file name,
+// so that errors are reported at their position in the file.
+func NewAt(name, src string, line int) *P {
 	return &P{
-		lex: lexer.New(name, src),
+		lex: lexer.NewAt(name, src, line),
 		fn:  parseInit,
 	}
 }
@@ -55,28 +60,101 @@ func parseExpr(p *P) parsingState {
 		return nil
 	}
 
+	var stmts []Node
+	for {
+		// Skip empty statements, as after a trailing semicolon
+		tok := p.peek()
+		if tok.Type == tokens.SEMICOLON {
+			p.next()
+			continue
+		}
+		if tok.Type == tokens.EOF && len(stmts) > 0 {
+			break
+		}
+
+		node, err := p.parseStatement()
+		if err != nil {
+			p.err = err
+			return nil
+		}
+		stmts = append(stmts, node)
+
+		tok = p.next()
+		if p.err != nil {
+			return nil
+		}
+		if tok.Type == tokens.EOF {
+			break
+		}
+		if tok.Type != tokens.SEMICOLON {
+			p.err = p.errorf(tok, "%s %s, expecting SEMICOLON or EOF", ErrUnexpectedToken, tok.Type)
+			return nil
+		}
+	}
+
+	if len(stmts) == 1 {
+		p.root = stmts[0]
+	} else {
+		p.root = &SeqNode{Stmts: stmts}
+	}
+	return nil
+}
+
+func parseInit(p *P) parsingState {
+	return parseExpr
+}
+
+// parseStatement parses a top-level expression, which may additionally be a
+// function definition of the form name(param, ...) = body.
+func (p *P) parseStatement() (Node, error) {
 	node, err := p.parseAssignment()
 	if err != nil {
-		p.err = err
-		return nil
+		return nil, err
 	}
 
-	tok := p.next()
+	call, ok := node.(*CallNode)
+	if !ok {
+		return node, nil
+	}
+
+	tok := p.peek()
 	if p.err != nil {
-		return nil
+		return nil, p.err
+	}
+	if tok.Type != tokens.ASSIGN {
+		return node, nil
 	}
+	p.next() // consume =
 
-	if tok.Type != tokens.EOF {
-		p.err = p.errorf(tok, "%s %s, expecting EOF", ErrUnexpectedToken, tok.Type)
-		return nil
+	def := &FuncDefNode{
+		Name: call.Name,
 	}
 
-	p.root = node
-	return nil
-}
+	seen := map[string]bool{}
+	for _, arg := range call.Args {
+		ident, ok := arg.(*IdentNode)
+		if !ok {
+			return nil, p.errorf(call.Name, "parameters of %s must be identifiers, got %s", call.Name.Value, arg)
+		}
 
-func parseInit(p *P) parsingState {
-	return parseExpr
+		name := ident.Name.Value
+		if strings.HasPrefix(name, "$") {
+			return nil, p.errorf(ident.Name, "cannot use result history variable %s as a parameter", name)
+		}
+		if seen[name] {
+			return nil, p.errorf(ident.Name, "duplicate parameter %s in definition of %s", name, call.Name.Value)
+		}
+
+		seen[name] = true
+		def.Params = append(def.Params, ident.Name)
+	}
+
+	def.Body, err = p.parseAssignment()
+	if err != nil {
+		return nil, err
+	}
+
+	return def, nil
 }
 
 func (p *P) parseAssignment() (Node, error) {
@@ -84,7 +162,7 @@ func (p *P) parseAssignment() (Node, error) {
 		return nil, p.err
 	}
 
-	left, err := p.parseAdditive()
+	left, err := p.parseConversion()
 	if err != nil {
 		return nil, err
 	}
@@ -155,6 +233,257 @@ func (p *P) parseComment() (Node, error) {
 	}, nil
 }
 
+// ConvertKeyword introduces the target unit of a conversion.
+const ConvertKeyword = "to"
+
+// parseConversion parses an expression optionally converted to another unit,
+// e.g. 72 °F to °C.
+func (p *P) parseConversion() (Node, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	node, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok := p.peek()
+		if p.err != nil {
+			return nil, p.err
+		}
+		if tok.Type != tokens.IDENT || tok.Value != ConvertKeyword {
+			break
+		}
+		p.next()
+
+		unit, err := p.parseUnitExpr()
+		if err != nil {
+			return nil, err
+		}
+		node = &ConvertNode{
+			Expr: node,
+			Unit: unit,
+			Tok:  tok,
+		}
+	}
+
+	return node, nil
+}
+
+// parseUnitExpr parses a product or quotient of units, e.g. km/h or N*m.
+func (p *P) parseUnitExpr() (*units.Unit, error) {
+	tok, err := p.expect(tokens.IDENT)
+	if err != nil {
+		return nil, err
+	}
+	unit, err := p.parseUnitTerm(tok)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op := p.peek()
+		if p.err != nil {
+			return nil, p.err
+		}
+		if op.Type != tokens.OP_STAR && op.Type != tokens.OP_SLASH {
+			return unit, nil
+		}
+		p.next()
+
+		tok, err := p.expect(tokens.IDENT)
+		if err != nil {
+			return nil, err
+		}
+		next, err := p.parseUnitTerm(tok)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Type == tokens.OP_STAR {
+			unit, err = unit.Mul(next)
+		} else {
+			unit, err = unit.Div(next)
+		}
+		if err != nil {
+			return nil, p.errorf(op, "%s", err)
+		}
+	}
+}
+
+// parseUnitTerm parses a unit symbol, which has already been consumed as
+// tok, with an optional integer power, e.g. m**2 or s**-1.
+func (p *P) parseUnitTerm(tok tokens.Token) (*units.Unit, error) {
+	unit, ok := units.Lookup(tok.Value)
+	if !ok {
+		return nil, p.errorf(tok, "unknown unit %q", tok.Value)
+	}
+
+	if p.peek().Type != tokens.OP_POW {
+		return unit, nil
+	}
+	p.next()
+
+	neg := p.peek().Type == tokens.OP_MINUS
+	if neg {
+		p.next()
+	}
+
+	exp, err := p.expect(tokens.LIT_INT)
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.ReplaceAll(exp.Value, "_", ""))
+	if err != nil {
+		return nil, p.errorf(exp, "invalid power %s of unit %s", exp.Value, tok.Value)
+	}
+	if neg {
+		n = -n
+	}
+
+	unit, err = unit.Pow(n)
+	if err != nil {
+		return nil, p.errorf(tok, "%s", err)
+	}
+	return unit, nil
+}
+
+// parseBinaryLevel parses a left-associative chain of binary operators of the
+// same precedence, with operands parsed by operand.
+func (p *P) parseBinaryLevel(operand func() (Node, error), ops ...tokens.TokenType) (Node, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	node, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok := p.peek()
+		if p.err != nil {
+			return nil, p.err
+		}
+		if !slices.Contains(ops, tok.Type) {
+			break
+		}
+		p.next()
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		node = &BinaryNode{
+			Op:    tok,
+			Left:  node,
+			Right: right,
+		}
+	}
+
+	return node, nil
+}
+
+// parseTernary parses a conditional expression, cond ? a : b, which is
+// right-associative.
+func (p *P) parseTernary() (Node, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	if p.err != nil {
+		return nil, p.err
+	}
+	if tok.Type != tokens.QUESTION {
+		return cond, nil
+	}
+	p.next()
+
+	then, err := p.parseConversion()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokens.COLON); err != nil {
+		return nil, err
+	}
+	els, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+
+	return &CondNode{
+		Cond: cond,
+		Then: then,
+		Else: els,
+		Tok:  tok,
+	}, nil
+}
+
+func (p *P) parseOr() (Node, error) {
+	return p.parseBinaryLevel(p.parseAnd, tokens.OP_OR)
+}
+
+func (p *P) parseAnd() (Node, error) {
+	return p.parseBinaryLevel(p.parseComparison, tokens.OP_AND)
+}
+
+// comparisonOps are the operators that compare two values.
+var comparisonOps = []tokens.TokenType{
+	tokens.OP_EQ, tokens.OP_NE, tokens.OP_LT, tokens.OP_LE, tokens.OP_GT, tokens.OP_GE,
+}
+
+// parseComparison parses an optional comparison of two operands. Comparisons
+// do not chain: 1 < x < 3 must be written as 1 < x && x < 3.
+func (p *P) parseComparison() (Node, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	node, err := p.parseBitOr()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	if p.err != nil {
+		return nil, p.err
+	}
+	if !slices.Contains(comparisonOps, tok.Type) {
+		return node, nil
+	}
+	p.next()
+
+	right, err := p.parseBitOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if next := p.peek(); slices.Contains(comparisonOps, next.Type) {
+		return nil, p.errorf(next, "comparisons cannot be chained; combine them with &&")
+	}
+
+	return &BinaryNode{
+		Op:    tok,
+		Left:  node,
+		Right: right,
+	}, nil
+}
+
+func (p *P) parseBitOr() (Node, error) {
+	return p.parseBinaryLevel(p.parseBitXor, tokens.OP_BITOR)
+}
+
+func (p *P) parseBitXor() (Node, error) {
+	return p.parseBinaryLevel(p.parseBitAnd, tokens.OP_BITXOR)
+}
+
+func (p *P) parseBitAnd() (Node, error) {
+	return p.parseBinaryLevel(p.parseAdditive, tokens.OP_BITAND)
+}
+
 func (p *P) parseAdditive() (Node, error) {
 	if p.err != nil {
 		return nil, p.err
@@ -191,11 +520,16 @@ func (p *P) parseMultiplicative() (Node, error) {
 	if p.err != nil {
 		return nil, p.err
 	}
-	node, err := p.parseExponential()
+	node, err := p.parseQuantity()
 	if err != nil {
 		return nil, err
 	}
 
+	// Operands of * and / in a chain with a quantity, such as the h in
+	// 60 mi/h, are in unit position and may name units
+	unitOperands := []Node{node}
+	quantity := isQuantity(node)
+
 	for {
 		tok := p.peek()
 		if p.err != nil {
@@ -205,7 +539,7 @@ func (p *P) parseMultiplicative() (Node, error) {
 			break
 		}
 		p.next()
-		right, err := p.parseExponential()
+		right, err := p.parseQuantity()
 		if err != nil {
 			return nil, err
 		}
@@ -214,11 +548,80 @@ func (p *P) parseMultiplicative() (Node, error) {
 			Left:  node,
 			Right: right,
 		}
+
+		if tok.Type != tokens.OP_STAR && tok.Type != tokens.OP_SLASH {
+			unitOperands = unitOperands[:0]
+			quantity = false
+		}
+		unitOperands = append(unitOperands, right)
+		quantity = quantity || isQuantity(right)
 	}
 
+	if quantity {
+		for _, operand := range unitOperands {
+			markUnitPosition(operand)
+		}
+	}
 	return node, nil
 }
 
+// isQuantity reports whether node is a number given a unit, such as 3 km or
+// 30°.
+func isQuantity(node Node) bool {
+	switch n := node.(type) {
+	case *UnitNode:
+		return true
+	case *NumberNode:
+		return n.Unit != nil
+	default:
+		return false
+	}
+}
+
+// markUnitPosition lets an identifier operand, or the base of a power such as
+// the s in s**2, resolve to a unit when it is not a variable.
+func markUnitPosition(node Node) {
+	switch n := node.(type) {
+	case *IdentNode:
+		n.UnitPosition = true
+	case *BinaryNode:
+		if n.Op.Type == tokens.OP_POW {
+			markUnitPosition(n.Left)
+		}
+	}
+}
+
+// parseQuantity parses an expression followed by an optional unit, e.g.
+// 3 km or 9.8 m/s**2, where the unit binds tighter than the division.
+func (p *P) parseQuantity() (Node, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	node, err := p.parseExponential()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	if p.err != nil {
+		return nil, p.err
+	}
+	if tok.Type != tokens.IDENT || tok.Value == ConvertKeyword {
+		return node, nil
+	}
+	p.next()
+
+	unit, err := p.parseUnitTerm(tok)
+	if err != nil {
+		return nil, err
+	}
+	return &UnitNode{
+		Expr: node,
+		Unit: unit,
+		Tok:  tok,
+	}, nil
+}
+
 func (p *P) parseExponential() (Node, error) {
 	if p.err != nil {
 		return nil, p.err
@@ -259,7 +662,7 @@ func (p *P) parseUnary() (Node, error) {
 		return nil, p.err
 	}
 
-	if tok.Type == tokens.OP_MINUS || tok.Type == tokens.OP_ROOT {
+	if tok.Type == tokens.OP_MINUS || tok.Type == tokens.OP_ROOT || tok.Type == tokens.OP_BITNOT || tok.Type == tokens.OP_NOT {
 		p.next()
 		expr, err := p.parseUnary()
 		if err != nil {
@@ -296,10 +699,33 @@ func (p *P) parsePrimary() (Node, error) {
 		if err != nil {
 			return nil, err
 		}
-		node = &NumberNode{Value: val}
+		node = &NumberNode{Value: newRational(val), Exact: val, Literal: tok.Value}
+
+	case tokens.LIT_IMAG:
+		val, err := p.parseNumber(tok)
+		if err != nil {
+			return nil, err
+		}
+		node = &NumberNode{Value: newRational(val), Exact: val, Literal: tok.Value, Imaginary: true}
+
+	case tokens.LIT_DEGREE:
+		val, err := p.parseNumber(tok)
+		if err != nil {
+			return nil, err
+		}
+		deg, _ := units.Lookup("deg")
+		node = &NumberNode{Value: newRational(val), Exact: val, Literal: tok.Value, Unit: deg}
 
 	case tokens.IDENT:
-		node = &IdentNode{Name: tok}
+		if p.peek().Type == tokens.LPAREN {
+			var err error
+			node, err = p.parseCall(tok)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			node = &IdentNode{Name: tok}
+		}
 
 	case tokens.LPAREN:
 		var err error
@@ -311,6 +737,13 @@ func (p *P) parsePrimary() (Node, error) {
 			return nil, err
 		}
 
+	case tokens.LBRACKET:
+		var err error
+		node, err = p.parseList(tok)
+		if err != nil {
+			return nil, err
+		}
+
 	case tokens.EOF:
 		return nil, p.errorf(tok, "unexpected EOF")
 
@@ -318,6 +751,11 @@ func (p *P) parsePrimary() (Node, error) {
 		return nil, p.errorf(tok, "unexpected token %s", tok.Type)
 	}
 
+	// A trailing ! is a factorial, which may be repeated as in 3!!
+	for p.peek().Type == tokens.OP_NOT {
+		node = &FactorialNode{Expr: node, Op: p.next()}
+	}
+
 	// Check for trailing comment
 	if p.peek().Type == tokens.LIT_STRING {
 		commentTok := p.next()
@@ -331,27 +769,106 @@ func (p *P) parsePrimary() (Node, error) {
 	return node, nil
 }
 
-func (p *P) parseNumber(tok tokens.Token) (*unified.Real, error) {
+// parseCall parses the parenthesized, comma-separated argument list of a
+// function call. The function name has already been consumed.
+func (p *P) parseCall(name tokens.Token) (Node, error) {
+	if _, err := p.expect(tokens.LPAREN); err != nil {
+		return nil, err
+	}
+
+	call := &CallNode{Name: name}
+	if p.peek().Type == tokens.RPAREN {
+		p.next()
+		return call, nil
+	}
+
+	for {
+		arg, err := p.parseAssignment()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+
+		tok := p.next()
+		if p.err != nil {
+			return nil, p.err
+		}
+
+		switch tok.Type {
+		case tokens.COMMA:
+			continue
+		case tokens.RPAREN:
+			return call, nil
+		case tokens.EOF:
+			return nil, p.errorf(tok, "unexpected EOF in arguments to %s", name.Value)
+		default:
+			return nil, p.errorf(tok, "%s %s in arguments to %s, expecting COMMA or RPAREN", ErrUnexpectedToken, tok.Type, name.Value)
+		}
+	}
+}
+
+// parseList parses the comma-separated elements of a list literal, whose
+// opening bracket has already been consumed. A matrix is a list of rows, as
+// in [[1, 2], [3, 4]].
+func (p *P) parseList(open tokens.Token) (Node, error) {
+	list := &ListNode{Tok: open}
+	if p.peek().Type == tokens.RBRACKET {
+		p.next()
+		return list, nil
+	}
+
+	for {
+		elem, err := p.parseAssignment()
+		if err != nil {
+			return nil, err
+		}
+		list.Elems = append(list.Elems, elem)
+
+		tok := p.next()
+		if p.err != nil {
+			return nil, p.err
+		}
+
+		switch tok.Type {
+		case tokens.COMMA:
+			continue
+		case tokens.RBRACKET:
+			return list, nil
+		case tokens.EOF:
+			return nil, p.errorf(tok, "unexpected EOF in list")
+		default:
+			return nil, p.errorf(tok, "%s %s in list, expecting COMMA or RBRACKET", ErrUnexpectedToken, tok.Type)
+		}
+	}
+}
+
+func (p *P) parseNumber(tok tokens.Token) (*big.Rat, error) {
 	cleaned := strings.ReplaceAll(tok.Value, "_", "")
+	switch tok.Type {
+	case tokens.LIT_DEGREE:
+		cleaned = strings.TrimSuffix(cleaned, "°")
+	case tokens.LIT_IMAG:
+		cleaned = cleaned[:len(cleaned)-1]
+	}
 	rat := new(big.Rat)
 	if _, ok := rat.SetString(cleaned); !ok {
-		return nil, fmt.Errorf("%s: invalid number %q", tok.Pos, tok.Value)
+		return nil, errorAt(tok.Pos, "invalid number %q", tok.Value)
 	}
 
-	return unified.New(constructive.One(), rational.FromRational(rat)), nil
+	return rat, nil
 }
 
 func (p *P) next() tokens.Token {
 	tok := p.nextRaw()
-	for tok.Type == tokens.WHITESPACE {
+	for tok.Type == tokens.WHITESPACE || tok.Type == tokens.COMMENT {
 		tok = p.nextRaw()
 	}
 
 	if tok.Type == tokens.ILLEGAL && p.err == nil {
 		if tok.Err != nil {
-			p.err = fmt.Errorf("%s: %w", tok.Pos, tok.Err)
+			p.err = &PositionError{Pos: tok.Pos, Err: tok.Err}
 		} else {
-			p.err = fmt.Errorf("%s: illegal token %q", tok.Pos, tok.Value)
+			p.err = errorAt(tok.Pos, "illegal token %q", tok.Value)
 		}
 	}
 
@@ -396,10 +913,9 @@ func (p *P) expect(tt tokens.TokenType) (tokens.Token, error) {
 }
 
 func (p *P) errorf(tok tokens.Token, format string, args ...any) error {
-	msg := fmt.Sprintf(format, args...)
 	if !tok.Pos.IsZero() {
-		return fmt.Errorf("%s: %s", tok.Pos, msg)
+		return errorAt(tok.Pos, format, args...)
 	}
 
-	return fmt.Errorf("%s", msg)
+	return fmt.Errorf(format, args...)
 }
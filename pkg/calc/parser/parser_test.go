@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"fmt"
 	"math"
 	"math/big"
 	"strings"
@@ -34,6 +35,11 @@ func TestParserExpressions(t *testing.T) {
 			exprs: []string{"-4 + 2"},
 			want:  -2,
 		},
+		{
+			name:  "statements",
+			exprs: []string{"a = 2; b = a + 1; # product\n a * b;"},
+			want:  6,
+		},
 		{
 			name:  "assignment and reference",
 			exprs: []string{"foo = 2", "foo * 5"},
@@ -329,6 +335,71 @@ func TestParserExpressions(t *testing.T) {
 			exprs: []string{"-2 ** -2"},
 			want:  0.25,
 		},
+		{
+			name:  "hexadecimal literal",
+			exprs: []string{"0xFF"},
+			want:  255,
+		},
+		{
+			name:  "octal literal",
+			exprs: []string{"0o755"},
+			want:  493,
+		},
+		{
+			name:  "binary literal with separators",
+			exprs: []string{"0b1010_1010"},
+			want:  170,
+		},
+		{
+			name:  "radix literals in expression",
+			exprs: []string{"0x10 + 0o10 + 0b10 + 10"},
+			want:  36,
+		},
+		{
+			name:  "radix literal shifted",
+			exprs: []string{"0b1011 << 4"},
+			want:  176,
+		},
+		{
+			name:  "bitwise and",
+			exprs: []string{"0b1100 & 0b1010"},
+			want:  8,
+		},
+		{
+			name:  "bitwise or",
+			exprs: []string{"0b1100 | 0b1010"},
+			want:  14,
+		},
+		{
+			name:  "bitwise xor",
+			exprs: []string{"0b1100 ^ 0b1010"},
+			want:  6,
+		},
+		{
+			name:  "bitwise complement",
+			exprs: []string{"~5"},
+			want:  -6,
+		},
+		{
+			name:  "bitwise and of negative",
+			exprs: []string{"-1 & 0xFF"},
+			want:  255,
+		},
+		{
+			name:  "bitwise precedence below additive",
+			exprs: []string{"1 + 2 & 3"},
+			want:  3,
+		},
+		{
+			name:  "bitwise precedence and before xor before or",
+			exprs: []string{"1 | 6 ^ 3 & 5"},
+			want:  7,
+		},
+		{
+			name:  "mask and shift",
+			exprs: []string{"(0xABCD & 0xFF00) >> 8"},
+			want:  0xAB,
+		},
 		{
 			name:  "leading comment",
 			exprs: []string{`"note" 3 + 4`},
@@ -366,7 +437,7 @@ func TestParserExpressions(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 			env := NewEnv()
-			var result *unified.Real
+			var result Value
 			var err error
 			for _, expr := range tt.exprs {
 				result, err = parseAndEval(t, expr, env)
@@ -406,6 +477,16 @@ func TestParserErrors(t *testing.T) {
 			expr:    "$",
 			wantErr: "expected digits after '$'",
 		},
+		{
+			name:    "missing separator",
+			expr:    "1 2",
+			wantErr: "expecting SEMICOLON or EOF",
+		},
+		{
+			name:    "position on a later line",
+			expr:    "1 +\n  * 2",
+			wantErr: "test:2:3: unexpected token OP_STAR",
+		},
 	}
 
 	for _, tt := range tests {
@@ -539,29 +620,215 @@ func TestExponentiationErrors(t *testing.T) {
 			wantErr: "zero to negative power is undefined",
 		},
 		{
-			name:    "negative base to fractional power",
-			expr:    "-4 ** 0.5",
-			wantErr: "negative base to non-integer power is non-real",
+			name:    "negative quantity to fractional power",
+			expr:    "(-8 m**3) ** (1/3)",
+			wantErr: "negative base to non-integer power: result is non-real",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			env := NewEnv()
+			_, err := parseAndEval(t, tt.expr, env)
+			if err == nil {
+				t.Fatalf("expected error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error mismatch: got %v want substring %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParserFunctions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		exprs []string
+		want  float64
+	}{
+		{name: "sin", exprs: []string{"sin(PI/6)"}, want: 0.5},
+		{name: "cos", exprs: []string{"cos(0)"}, want: 1},
+		{name: "tan", exprs: []string{"tan(PI/4)"}, want: 1},
+		{name: "asin", exprs: []string{"asin(1)"}, want: math.Pi / 2},
+		{name: "acos", exprs: []string{"acos(0)"}, want: math.Pi / 2},
+		{name: "atan", exprs: []string{"atan(1)"}, want: math.Pi / 4},
+		{name: "atan2 first quadrant", exprs: []string{"atan2(1, 1)"}, want: math.Pi / 4},
+		{name: "atan2 second quadrant", exprs: []string{"atan2(1, -1)"}, want: 3 * math.Pi / 4},
+		{name: "atan2 third quadrant", exprs: []string{"atan2(-1, -1)"}, want: -3 * math.Pi / 4},
+		{name: "atan2 positive y-axis", exprs: []string{"atan2(2, 0)"}, want: math.Pi / 2},
+		{name: "sinh", exprs: []string{"sinh(1)"}, want: math.Sinh(1)},
+		{name: "cosh", exprs: []string{"cosh(1)"}, want: math.Cosh(1)},
+		{name: "tanh", exprs: []string{"tanh(1)"}, want: math.Tanh(1)},
+		{name: "exp", exprs: []string{"exp(1)"}, want: math.E},
+		{name: "ln", exprs: []string{"ln(2)"}, want: math.Ln2},
+		{name: "ln of E", exprs: []string{"ln(E)"}, want: 1},
+		{name: "log natural", exprs: []string{"log(E)"}, want: 1},
+		{name: "log with base", exprs: []string{"log(81, 3)"}, want: 4},
+		{name: "log2", exprs: []string{"log2(1024)"}, want: 10},
+		{name: "log10", exprs: []string{"log10(1000)"}, want: 3},
+		{name: "sqrt", exprs: []string{"sqrt(16)"}, want: 4},
+		{name: "abs negative", exprs: []string{"abs(-3.5)"}, want: 3.5},
+		{name: "abs positive", exprs: []string{"abs(2)"}, want: 2},
+		{name: "floor", exprs: []string{"floor(2.7)"}, want: 2},
+		{name: "floor negative", exprs: []string{"floor(-2.2)"}, want: -3},
+		{name: "floor integer", exprs: []string{"floor(5)"}, want: 5},
+		{name: "ceil", exprs: []string{"ceil(2.2)"}, want: 3},
+		{name: "ceil negative", exprs: []string{"ceil(-2.7)"}, want: -2},
+		{name: "round half up", exprs: []string{"round(2.5)"}, want: 3},
+		{name: "round half away from zero", exprs: []string{"round(-2.5)"}, want: -3},
+		{name: "trunc", exprs: []string{"trunc(-2.7)"}, want: -2},
+		{name: "ceil of inexact integer", exprs: []string{"ceil(sqrt(4))"}, want: 2},
+		{name: "floor of inexact integer", exprs: []string{"floor(ln(E))"}, want: 1},
+		{name: "floor of inexact negative integer", exprs: []string{"floor(-sqrt(9))"}, want: -3},
+		{name: "ceil just above an integer", exprs: []string{"ceil(sqrt(4) + 0.001)"}, want: 3},
+		{name: "min", exprs: []string{"min(3, 1, 2)"}, want: 1},
+		{name: "max", exprs: []string{"max(3, PI, 2)"}, want: math.Pi},
+		{name: "single-argument max", exprs: []string{"max(7)"}, want: 7},
+		{name: "nested calls", exprs: []string{"sqrt(abs(-16)) + exp(ln(3))"}, want: 7},
+		{name: "call in expression", exprs: []string{"2 * sin(PI/2) ** 2 + 1"}, want: 3},
+		{name: "call with variables", exprs: []string{"x = 3", "y = 4", "sqrt(x*x + y*y)"}, want: 5},
+		{name: "whitespace before parenthesis", exprs: []string{"floor (9.9)"}, want: 9},
+		{name: "comment in argument", exprs: []string{`sqrt("nine" 9)`}, want: 3},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			env := NewEnv()
+			var result Value
+			var err error
+			for _, expr := range tt.exprs {
+				result, err = parseAndEval(t, expr, env)
+				if err != nil {
+					t.Fatalf("parse/eval %q: %v", expr, err)
+				}
+			}
+
+			got := realToFloat(t, result)
+			if diff := math.Abs(got - tt.want); diff > 1e-9 {
+				t.Fatalf("result mismatch: got %v, want %v (diff=%v)", got, tt.want, diff)
+			}
+		})
+	}
+}
+
+func TestFunctionErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr string
+	}{
+		{name: "undefined function", expr: "nope(1)", wantErr: "undefined function \"nope\""},
+		{name: "too few arguments", expr: "atan2(1)", wantErr: "wrong number of arguments"},
+		{name: "too many arguments", expr: "sin(1, 2)", wantErr: "wrong number of arguments"},
+		{name: "no arguments", expr: "max()", wantErr: "wrong number of arguments"},
+		{name: "ln of zero", expr: "ln(0)", wantErr: "logarithm of non-positive number"},
+		{name: "ln of negative", expr: "ln(-1)", wantErr: "logarithm of non-positive number"},
+		{name: "log base one", expr: "log(8, 1)", wantErr: "logarithm base must not be 1"},
+		{name: "complex argument to real function", expr: "sin(2i)", wantErr: "sin is not defined for complex numbers"},
+		{name: "asin out of range", expr: "asin(1.5)", wantErr: "between -1 and 1"},
+		{name: "atan2 at origin", expr: "atan2(0, 0)", wantErr: "undefined at the origin"},
+		{name: "tan at pole", expr: "tan(PI/2)", wantErr: "tangent is undefined"},
+		{name: "unterminated call", expr: "sin(1", wantErr: "unexpected EOF in arguments to sin"},
+		{name: "missing comma", expr: "max(1 2)", wantErr: "expecting COMMA or RPAREN"},
+		{name: "trailing comma", expr: "max(1,)", wantErr: "unexpected token RPAREN"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			env := NewEnv()
+			_, err := parseAndEval(t, tt.expr, env)
+			if err == nil {
+				t.Fatalf("expected error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error mismatch: got %v want substring %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUserFunctions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		exprs []string
+		want  float64
+	}{
+		{
+			name:  "single parameter",
+			exprs: []string{"sq(x) = x * x", "sq(7)"},
+			want:  49,
 		},
 		{
-			name:    "negative base to decimal power",
-			expr:    "-2 ** 2.5",
-			wantErr: "negative base to non-integer power is non-real",
+			name:  "multiple parameters",
+			exprs: []string{"f(x, y) = x**2 + y", "f(3, 1)"},
+			want:  10,
+		},
+		{
+			name:  "square root body",
+			exprs: []string{"hyp(a, b) = √(a*a + b*b)", "hyp(3, 4)"},
+			want:  5,
 		},
 		{
-			name:    "negative base to irrational power",
-			expr:    "-3 ** √2",
-			wantErr: "negative base to non-integer power is non-real",
+			name:  "no parameters",
+			exprs: []string{"two() = 2", "two() * 3"},
+			want:  6,
+		},
+		{
+			name:  "calls another user function",
+			exprs: []string{"sq(x) = x * x", "sumsq(a, b) = sq(a) + sq(b)", "sumsq(1, 2)"},
+			want:  5,
+		},
+		{
+			name:  "calls built-in function",
+			exprs: []string{"deg(x) = x * PI / 180", "sin(deg(30))"},
+			want:  0.5,
 		},
 		{
-			name:    "negative base to transcendental power",
-			expr:    "-2 ** PI",
-			wantErr: "negative base to non-integer power is non-real",
+			name:  "reads global at call time",
+			exprs: []string{"k = 2", "scale(x) = k * x", "k = 10", "scale(3)"},
+			want:  30,
+		},
+		{
+			name:  "parameter shadows global",
+			exprs: []string{"x = 100", "inc(x) = x + 1", "inc(1)"},
+			want:  2,
+		},
+		{
+			name:  "parameter does not leak",
+			exprs: []string{"x = 100", "inc(x) = x + 1", "inc(1)", "x"},
+			want:  100,
+		},
+		{
+			name:  "assignment in body is local",
+			exprs: []string{"y = 1", "f(x) = (y = x) * 2", "f(5)", "y"},
+			want:  1,
+		},
+		{
+			name:  "redefinition replaces",
+			exprs: []string{"f(x) = x", "f(x) = x * 3", "f(2)"},
+			want:  6,
+		},
+		{
+			name:  "variable and function share a name",
+			exprs: []string{"f = 4", "f(x) = x + f", "f(1)"},
+			want:  5,
 		},
 		{
-			name:    "negative base via unary minus to fractional power",
-			expr:    "-2 ** 0.5",
-			wantErr: "negative base to non-integer power is non-real",
+			name:  "comment before definition body",
+			exprs: []string{`half(x) = "halve" x / 2`, "half(9)"},
+			want:  4.5,
 		},
 	}
 
@@ -570,7 +837,90 @@ func TestExponentiationErrors(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 			env := NewEnv()
-			_, err := parseAndEval(t, tt.expr, env)
+			var result Value
+			var err error
+			for _, expr := range tt.exprs {
+				result, err = parseAndEval(t, expr, env)
+				if err != nil {
+					t.Fatalf("parse/eval %q: %v", expr, err)
+				}
+			}
+
+			got := realToFloat(t, result)
+			if diff := math.Abs(got - tt.want); diff > 1e-9 {
+				t.Fatalf("result mismatch: got %v, want %v (diff=%v)", got, tt.want, diff)
+			}
+		})
+	}
+}
+
+func TestUserFunctionErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		exprs   []string
+		wantErr string
+	}{
+		{
+			name:    "undefined function",
+			exprs:   []string{"g(1)"},
+			wantErr: "undefined function",
+		},
+		{
+			name:    "wrong number of arguments",
+			exprs:   []string{"f(x, y) = x + y", "f(1)"},
+			wantErr: "wrong number of arguments",
+		},
+		{
+			name:    "redefine built-in",
+			exprs:   []string{"sin(x) = x"},
+			wantErr: "cannot redefine built-in function",
+		},
+		{
+			name:    "non-identifier parameter",
+			exprs:   []string{"f(1) = 2"},
+			wantErr: "parameters of f must be identifiers",
+		},
+		{
+			name:    "duplicate parameter",
+			exprs:   []string{"f(x, x) = x"},
+			wantErr: "duplicate parameter x",
+		},
+		{
+			name:    "history variable parameter",
+			exprs:   []string{"f($1) = 2"},
+			wantErr: "cannot use result history variable",
+		},
+		{
+			name:    "definition nested in expression",
+			exprs:   []string{"(f(x) = x)"},
+			wantErr: "expected RPAREN, got ASSIGN",
+		},
+		{
+			name:    "unbounded recursion",
+			exprs:   []string{"f(x) = f(x + 1)", "f(0)"},
+			wantErr: "maximum call depth",
+		},
+		{
+			name:    "undefined name in body",
+			exprs:   []string{"f(x) = x + z", "f(1)"},
+			wantErr: "undefined identifier \"z\"",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			env := NewEnv()
+			var err error
+			for _, expr := range tt.exprs {
+				if _, err = parseAndEval(t, expr, env); err != nil {
+					break
+				}
+			}
+
 			if err == nil {
 				t.Fatalf("expected error containing %q", tt.wantErr)
 			}
@@ -581,7 +931,589 @@ func TestExponentiationErrors(t *testing.T) {
 	}
 }
 
-func parseAndEval(t *testing.T, expr string, env *Env) (*unified.Real, error) {
+func TestNodeString(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{expr: "1+2*3", want: "1 + 2 * 3"},
+		{expr: "(1+2)*3", want: "(1 + 2) * 3"},
+		{expr: "1-(2-3)", want: "1 - (2 - 3)"},
+		{expr: "(1-2)-3", want: "1 - 2 - 3"},
+		{expr: "2**3**2", want: "2 ** 3 ** 2"},
+		{expr: "(2**3)**2", want: "(2 ** 3) ** 2"},
+		{expr: "-2**2", want: "-2 ** 2"},
+		{expr: "-(2**2)", want: "-(2 ** 2)"},
+		{expr: "√(a*a+b*b)", want: "√(a * a + b * b)"},
+		{expr: "a = b = 3", want: "a = b = 3"},
+		{expr: "atan2(y,x)+1", want: "atan2(y, x) + 1"},
+		{expr: "f(x,y)=x**2+y", want: "f(x, y) = x ** 2 + y"},
+		{expr: `"note" 3 + 4`, want: `"note" 3 + 4`},
+		{expr: "1_000.50 << 2", want: "1_000.50 << 2"},
+		{expr: "~a&(b|c)^d", want: "~a & (b | c) ^ d"},
+		{expr: "(a^b)&c", want: "(a ^ b) & c"},
+		{expr: "3 km+200 m", want: "3 km + 200 m"},
+		{expr: "5 GiB/(3 s)", want: "5 GiB / 3 s"},
+		{expr: "(2 m)**2", want: "(2 m) ** 2"},
+		{expr: "-40 °C to °F", want: "-40 °C to °F"},
+		{expr: "x=9.8 m/s**2 to km/h**2", want: "x = 9.8 m / s ** 2 to km/h**2"},
+		{expr: "sin(30°)", want: "sin(30°)"},
+		{expr: "(a<b)==(c>=d)", want: "(a < b) == (c >= d)"},
+		{expr: "!a||b&&c", want: "!a || b && c"},
+		{expr: "(a||b)&&!(c==d)", want: "(a || b) && !(c == d)"},
+		{expr: "a?b:c?d:e", want: "a ? b : c ? d : e"},
+		{expr: "(a?b:c)?d:e", want: "(a ? b : c) ? d : e"},
+		{expr: "f(n)=n<=1?1:n*f(n-1)", want: "f(n) = n <= 1 ? 1 : n * f(n - 1)"},
+		{expr: "a=1;;b=2 # two", want: "a = 1; b = 2"},
+		{expr: "-n!+(n+1)!!", want: "-n! + (n + 1)!!"},
+		{expr: "2**f(n)!", want: "2 ** f(n)!"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.expr, func(t *testing.T) {
+			t.Parallel()
+			node, err := Parse("test", tt.expr)
+			if err != nil {
+				t.Fatalf("parse %q: %v", tt.expr, err)
+			}
+
+			if got := node.String(); got != tt.want {
+				t.Fatalf("String() = %q, want %q", got, tt.want)
+			}
+
+			// The rendered form must parse back to the same rendering
+			again, err := Parse("test", node.String())
+			if err != nil {
+				t.Fatalf("reparse %q: %v", node.String(), err)
+			}
+			if got := again.String(); got != tt.want {
+				t.Fatalf("reparsed String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvFunctions(t *testing.T) {
+	t.Parallel()
+
+	env := NewEnv()
+	for _, expr := range []string{"hyp(a,b) = √(a*a+b*b)", "f(x, y) = x**2 + y"} {
+		if _, err := parseAndEval(t, expr, env); err != nil {
+			t.Fatalf("parse/eval %q: %v", expr, err)
+		}
+	}
+
+	got := env.Functions()
+	want := []string{"f(x, y) = x ** 2 + y", "hyp(a, b) = √(a * a + b * b)"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("Functions() = %q, want %q", got, want)
+	}
+}
+
+func TestIntWidth(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		width    int
+		unsigned bool
+		expr     string
+		want     float64
+	}{
+		{name: "uint8 overflow", width: 8, unsigned: true, expr: "200 + 100", want: 44},
+		{name: "uint8 underflow", width: 8, unsigned: true, expr: "3 - 5", want: 254},
+		{name: "uint8 complement", width: 8, unsigned: true, expr: "~0", want: 255},
+		{name: "uint8 negation", width: 8, unsigned: true, expr: "-1", want: 255},
+		{name: "uint8 literal", width: 8, unsigned: true, expr: "0x1FF", want: 255},
+		{name: "int8 overflow", width: 8, expr: "127 + 1", want: -128},
+		{name: "int8 complement", width: 8, expr: "~0", want: -1},
+		{name: "int32 multiplication", width: 32, expr: "65536 * 65536 + 7", want: 7},
+		{name: "uint32 shift", width: 32, unsigned: true, expr: "1 << 32", want: 0},
+		{name: "int16 arithmetic shift right", width: 16, expr: "-7 >> 1", want: -4},
+		{name: "uint64 max", width: 64, unsigned: true, expr: "-1", want: 18446744073709551615},
+		{name: "non-integer untouched", width: 8, expr: "300.5 + 0", want: 300.5},
+		{name: "division is exact", width: 8, expr: "7 / 2", want: 3.5},
+		{name: "disabled", width: 0, expr: "200 + 100", want: 300},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			env := NewEnv()
+			env.SetIntWidth(tt.width, tt.unsigned)
+
+			result, err := parseAndEval(t, tt.expr, env)
+			if err != nil {
+				t.Fatalf("parse/eval %q: %v", tt.expr, err)
+			}
+
+			got := realToFloat(t, result)
+			if diff := math.Abs(got - tt.want); diff > 1e-9 {
+				t.Fatalf("result mismatch: got %v, want %v (diff=%v)", got, tt.want, diff)
+			}
+		})
+	}
+}
+
+func TestBitwiseErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr string
+	}{
+		{name: "and with fraction", expr: "2.5 & 1", wantErr: "bitwise & requires integer operands"},
+		{name: "or with irrational", expr: "1 | PI", wantErr: "bitwise | requires integer operands"},
+		{name: "xor with quotient", expr: "(1/3) ^ 1", wantErr: "bitwise ^ requires integer operands"},
+		{name: "complement of fraction", expr: "~0.5", wantErr: "bitwise ~ requires integer operands"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := parseAndEval(t, tt.expr, NewEnv())
+			if err == nil {
+				t.Fatalf("expected error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error mismatch: got %v want substring %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUnits(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr string
+		want float64
+		unit string
+	}{
+		{expr: "3 km + 200 m", want: 3.2, unit: "km"},
+		{expr: "200 m + 3 km", want: 3200, unit: "m"},
+		{expr: "5 GiB / 4 s", want: 1.25, unit: "GiB/s"},
+		{expr: "72 °F to °C", want: 22.2222222222, unit: "°C"},
+		{expr: "-40 °C to °F", want: -40, unit: "°F"},
+		{expr: "0 degC to K", want: 273.15, unit: "K"},
+		{expr: "60 mi/h to km/h", want: 96.56064, unit: "km/h"},
+		{expr: "9.8 m/s**2 * 10 kg to N", want: 98, unit: "N"},
+		{expr: "2 km * 3", want: 6, unit: "km"},
+		{expr: "2 * 3 km", want: 6, unit: "km"},
+		{expr: "1 km / 1 m", want: 1000, unit: ""},
+		{expr: "2 / 4 s", want: 0.5, unit: "s**-1"},
+		{expr: "3 m ** 2", want: 3, unit: "m**2"},
+		{expr: "(3 m) ** 2", want: 9, unit: "m**2"},
+		{expr: "(4 m**2) ** 0.5", want: 2, unit: "m"},
+		{expr: "√(9 m**2)", want: 3, unit: "m"},
+		{expr: "1 kWh to J", want: 3.6e6, unit: "J"},
+		{expr: "1 L to m**3", want: 0.001, unit: "m**3"},
+		{expr: "10 N * 2 m", want: 20, unit: "N*m"},
+		{expr: "7 m % 2 m", want: 1, unit: "m"},
+		{expr: "1 m << 3", want: 8, unit: "m"},
+		{expr: "abs(-3 km)", want: 3, unit: "km"},
+		{expr: "max(1 km, 2000 m)", want: 2, unit: "km"},
+		{expr: "30°", want: 30, unit: "deg"},
+		{expr: "sin(30°)", want: 0.5, unit: ""},
+		{expr: "cos(100 grad)", want: 0, unit: ""},
+		{expr: "PI rad to deg", want: 180, unit: "deg"},
+		{expr: "90° to rad", want: math.Pi / 2, unit: "rad"},
+		{expr: "1 N * m", want: 1, unit: "N*m"},
+		{expr: "2 * 3 km / h", want: 6, unit: "km/h"},
+		{expr: "3 km * 2 km", want: 6, unit: "km**2"},
+		{expr: "100 km/h * 2 h", want: 200, unit: "km"},
+		{expr: "6 m**2 / 2 m", want: 3, unit: "m"},
+		{expr: "5 GiB / 3 s * 3 s", want: 5, unit: "GiB"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.expr, func(t *testing.T) {
+			t.Parallel()
+			result, err := parseAndEval(t, tt.expr, NewEnv())
+			if err != nil {
+				t.Fatalf("parse/eval %q: %v", tt.expr, err)
+			}
+
+			num, ok := result.(*Number)
+			if !ok {
+				t.Fatalf("expected a number, got %T", result)
+			}
+
+			mag, unit := num.Display()
+			if unit != tt.unit {
+				t.Errorf("unit mismatch: got %q, want %q", unit, tt.unit)
+			}
+			if got := realToFloat(t, NewNumber(mag)); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("result mismatch: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnitVariables(t *testing.T) {
+	t.Parallel()
+
+	env := NewEnv()
+	for _, expr := range []string{"d = 42.195 km", "speed(t) = d / t"} {
+		if _, err := parseAndEval(t, expr, env); err != nil {
+			t.Fatalf("parse/eval %q: %v", expr, err)
+		}
+	}
+
+	result, err := parseAndEval(t, "speed(3 h) to km/h", env)
+	if err != nil {
+		t.Fatalf("eval: %v", err)
+	}
+
+	mag, unit := result.(*Number).Display()
+	if unit != "km/h" {
+		t.Errorf("unit = %q, want km/h", unit)
+	}
+	if got := realToFloat(t, NewNumber(mag)); math.Abs(got-14.065) > 1e-9 {
+		t.Errorf("result = %v, want 14.065", got)
+	}
+
+	// Variables take precedence over units of the same name
+	if _, err := parseAndEval(t, "m = 5", env); err != nil {
+		t.Fatalf("assign m: %v", err)
+	}
+	result, err = parseAndEval(t, "m * 2", env)
+	if err != nil {
+		t.Fatalf("eval: %v", err)
+	}
+	if got := realToFloat(t, result); got != 10 {
+		t.Errorf("m * 2 = %v, want 10", got)
+	}
+}
+
+func TestUnitErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr string
+	}{
+		{name: "adding length and time", expr: "3 m + 2 s", wantErr: "incompatible units: cannot apply + to m and s"},
+		{name: "converting to another dimension", expr: "3 m to kg", wantErr: "incompatible units: cannot convert m to kg"},
+		{name: "unknown unit", expr: "3 furlongs", wantErr: `unknown unit "furlongs"`},
+		{name: "unknown conversion target", expr: "3 m to parsecs", wantErr: `unknown unit "parsecs"`},
+		{name: "arithmetic on offset scale", expr: "20 °C * 2", wantErr: "whose zero is offset"},
+		{name: "offset unit without magnitude", expr: "°C", wantErr: "needs a magnitude"},
+		{name: "unit without magnitude", expr: "km", wantErr: `undefined identifier "km"`},
+		{name: "undefined single-letter name", expr: "2*h", wantErr: `undefined identifier "h"`},
+		{name: "unit name before a number", expr: "m*5", wantErr: `undefined identifier "m"`},
+		{name: "unit name after a modulo", expr: "3 km % h", wantErr: `undefined identifier "h"`},
+		{name: "offset unit in compound", expr: "1 to °C/s", wantErr: "cannot be combined"},
+		{name: "unit on a quantity", expr: "(3 m) s", wantErr: "applies only to plain numbers"},
+		{name: "function of a length", expr: "sin(1 m)", wantErr: "sin requires a dimensionless value, got m"},
+		{name: "bitwise on a length", expr: "3 m & 1", wantErr: "& requires a dimensionless value"},
+		{name: "exponent with units", expr: "2 ** (3 m)", wantErr: "exponent must be dimensionless"},
+		{name: "irrational power", expr: "(2 m) ** PI", wantErr: "non-rational power"},
+		{name: "fractional dimension", expr: "√(2 m)", wantErr: "cannot take the square root of m"},
+		{name: "mixed extremum", expr: "min(1 m, 1 s)", wantErr: "incompatible units"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := parseAndEval(t, tt.expr, NewEnv())
+			if err == nil {
+				t.Fatalf("expected error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error mismatch: got %v want substring %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestComparisons(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{expr: "1 < 2", want: true},
+		{expr: "2 <= 2", want: true},
+		{expr: "3 > 4", want: false},
+		{expr: "-1 >= -1", want: true},
+		{expr: "1 + 1 == 2", want: true},
+		{expr: "1 != 1", want: false},
+		{expr: "0.1 + 0.2 == 0.3", want: true},
+		{expr: "√2 * √2 == 2", want: true},
+		{expr: "sin(PI) == 0", want: true},
+		{expr: "PI == 3.14159", want: false},
+		{expr: "1/3 == 0.333333", want: false},
+		{expr: "3 km > 200 m", want: true},
+		{expr: "1000 m == 1 km", want: true},
+		{expr: "0 °C == 32 °F", want: true},
+		{expr: "180° == PI rad", want: true},
+		{expr: "(1 < 2) == (2 < 3)", want: true},
+		{expr: "1 | 2 == 3", want: true},
+		{expr: "!(1 < 2)", want: false},
+		{expr: "!!(1 < 2)", want: true},
+		{expr: "1 < 2 && 2 < 3", want: true},
+		{expr: "1 < 2 && 3 < 2", want: false},
+		{expr: "1 > 2 || 2 > 1", want: true},
+		{expr: "1 > 2 || 1 > 2 && 1 < 2", want: false},
+		{expr: "1 > 2 && nosuch", want: false},
+		{expr: "1 < 2 || nosuch", want: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.expr, func(t *testing.T) {
+			t.Parallel()
+			result, err := parseAndEval(t, tt.expr, NewEnv())
+			if err != nil {
+				t.Fatalf("parse/eval %q: %v", tt.expr, err)
+			}
+			if result != Bool(tt.want) {
+				t.Fatalf("result mismatch: got %v, want %v", result, tt.want)
+			}
+		})
+	}
+}
+
+func TestComparisonTolerance(t *testing.T) {
+	t.Parallel()
+
+	env := NewEnv()
+	env.SetDecimalPlaces(3)
+
+	for expr, want := range map[string]bool{
+		"2/3 == 0.667":  true,
+		"1/3 == 0.3333": true,
+		"1/3 == 0.332":  false,
+		"1/3 < 0.3334":  false,
+		"1/3 < 0.335":   true,
+	} {
+		result, err := parseAndEval(t, expr, env)
+		if err != nil {
+			t.Fatalf("parse/eval %q: %v", expr, err)
+		}
+		if result != Bool(want) {
+			t.Errorf("%s at 3 decimal places = %v, want %v", expr, result, want)
+		}
+	}
+}
+
+func TestConditional(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		exprs []string
+		want  float64
+	}{
+		{name: "true branch", exprs: []string{"1 < 2 ? 10 : 20"}, want: 10},
+		{name: "false branch", exprs: []string{"1 > 2 ? 10 : 20"}, want: 20},
+		{name: "right associative", exprs: []string{"x = 5", "x < 0 ? -1 : x == 0 ? 0 : 1"}, want: 1},
+		{name: "untaken branch is not evaluated", exprs: []string{"1 < 2 ? 3 : nosuch"}, want: 3},
+		{name: "assignment of conditional", exprs: []string{"y = 2 > 1 ? 7 : 8", "y"}, want: 7},
+		{name: "conversion in branch", exprs: []string{"1 < 2 ? 1 km to m : 5 m"}, want: 1000},
+		{name: "recursion", exprs: []string{"fact(n) = n <= 1 ? 1 : n * fact(n - 1)", "fact(10)"}, want: 3628800},
+		{name: "absolute value", exprs: []string{"a(x) = x < 0 ? -x : x", "a(-3) + a(4)"}, want: 7},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			env := NewEnv()
+			var result Value
+			var err error
+			for _, expr := range tt.exprs {
+				result, err = parseAndEval(t, expr, env)
+				if err != nil {
+					t.Fatalf("parse/eval %q: %v", expr, err)
+				}
+			}
+
+			if got := realToFloat(t, result); math.Abs(got-tt.want) > 1e-9 {
+				t.Fatalf("result mismatch: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComparisonErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr string
+	}{
+		{name: "chained comparison", expr: "1 < 2 < 3", wantErr: "comparisons cannot be chained"},
+		{name: "incompatible units", expr: "1 m < 1 s", wantErr: "incompatible units: cannot compare m and s"},
+		{name: "ordering bools", expr: "(1 < 2) < (2 < 3)", wantErr: "< requires numbers, got bool"},
+		{name: "bool and number", expr: "(1 < 2) == 1", wantErr: "cannot compare bool and number"},
+		{name: "arithmetic on bool", expr: "(1 < 2) + 1", wantErr: "+ requires a number, got bool"},
+		{name: "and of numbers", expr: "1 && 2", wantErr: "&& requires a bool, got number"},
+		{name: "not of number", expr: "!1", wantErr: "! requires a bool, got number"},
+		{name: "numeric condition", expr: "1 ? 2 : 3", wantErr: "? requires a bool, got number"},
+		{name: "missing colon", expr: "1 < 2 ? 3", wantErr: "expected COLON, got EOF"},
+		{name: "function of bool", expr: "sin(1 < 2)", wantErr: "sin requires a number, got bool"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := parseAndEval(t, tt.expr, NewEnv())
+			if err == nil {
+				t.Fatalf("expected error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error mismatch: got %v want substring %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExactRationals(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr string
+		want string // empty if the result should not be exact
+	}{
+		{expr: "355/113", want: "355/113"},
+		{expr: "0.1 + 0.2", want: "3/10"},
+		{expr: "6.022e23", want: "602200000000000000000000"},
+		{expr: "1.6e-19", want: "1/6250000000000000000"},
+		{expr: "2.5E+2 g", want: "1/4"},
+		{expr: "1/3 - 1/2", want: "-1/6"},
+		{expr: "(2/3) ** 3", want: "8/27"},
+		{expr: "2 ** -3", want: "1/8"},
+		{expr: "7 % (3/2)", want: "1"},
+		{expr: "1 >> 3", want: "1/8"},
+		{expr: "-(5/4)", want: "-5/4"},
+		{expr: "0xff & 0x0f", want: "15"},
+		{expr: "floor(PI)", want: "3"},
+		{expr: "min(1/3, 1/4)", want: "1/4"},
+		{expr: "(3/2) km", want: "1500"},
+		{expr: "1.5 h to min", want: "5400"},
+		{expr: "PI", want: ""},
+		{expr: "1/3 + PI", want: ""},
+		{expr: "sqrt(4)", want: ""},
+		{expr: "2 ** 0.5", want: ""},
+		{expr: "30°", want: ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.expr, func(t *testing.T) {
+			t.Parallel()
+			res, err := parseAndEval(t, tt.expr, NewEnv())
+			if err != nil {
+				t.Fatalf("parse/eval: %v", err)
+			}
+
+			got := res.(*Number).Exact
+			switch {
+			case tt.want == "" && got != nil:
+				t.Fatalf("expected an inexact result, got %s", got.RatString())
+			case tt.want != "" && got == nil:
+				t.Fatalf("expected exact result %s, got an inexact one", tt.want)
+			case tt.want != "" && got.RatString() != tt.want:
+				t.Fatalf("exact result mismatch: got %s, want %s", got.RatString(), tt.want)
+			}
+		})
+	}
+}
+
+func TestContinuedFractions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr  string
+		terms string
+	}{
+		{expr: "415/93", terms: "[4 2 6 7]"},
+		{expr: "-7/2", terms: "[-4 2]"},
+		{expr: "3", terms: "[3]"},
+		{expr: "PI", terms: "[3 7 15 1 292 1 1 1]"},
+		{expr: "SQRT2", terms: "[1 2 2 2 2 2 2 2]"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.expr, func(t *testing.T) {
+			t.Parallel()
+			env := NewEnv()
+			res, err := parseAndEval(t, tt.expr, env)
+			if err != nil {
+				t.Fatalf("parse/eval: %v", err)
+			}
+
+			terms, err := env.ContinuedFraction(res.(*Number), 8)
+			if err != nil {
+				t.Fatalf("ContinuedFraction: %v", err)
+			}
+			if got := fmt.Sprint(terms); got != tt.terms {
+				t.Fatalf("terms mismatch: got %s, want %s", got, tt.terms)
+			}
+		})
+	}
+
+	convs := Convergents([]*big.Int{big.NewInt(3), big.NewInt(7), big.NewInt(15), big.NewInt(1)})
+	if got := fmt.Sprint(convs); got != "[3/1 22/7 333/106 355/113]" {
+		t.Errorf("Convergents = %s", got)
+	}
+}
+
+func TestContinuedFractionFunction(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr    string
+		want    string
+		wantErr string
+	}{
+		{expr: "cf(PI, 1)", want: "3"},
+		{expr: "cf(PI, 2)", want: "22/7"},
+		{expr: "cf(PI, 4)", want: "355/113"},
+		{expr: "cf(0.75, 100)", want: "3/4"},
+		{expr: "cf(E, 5)", want: "19/7"},
+		{expr: "cf(PI, 0)", wantErr: "number of terms must be a positive integer"},
+		{expr: "cf(PI, 1.5)", wantErr: "number of terms must be a positive integer"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.expr, func(t *testing.T) {
+			t.Parallel()
+			res, err := parseAndEval(t, tt.expr, NewEnv())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error mismatch: got %v want substring %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse/eval: %v", err)
+			}
+
+			if got := res.(*Number).Exact; got == nil || got.RatString() != tt.want {
+				t.Fatalf("result mismatch: got %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func parseAndEval(t *testing.T, expr string, env *Env) (Value, error) {
 	t.Helper()
 	p := New("test", expr)
 	node, err := p.Parse()
@@ -593,9 +1525,13 @@ func parseAndEval(t *testing.T, expr string, env *Env) (*unified.Real, error) {
 
 const testPrecision = -100
 
-func realToFloat(t *testing.T, r *unified.Real) float64 {
+func realToFloat(t *testing.T, v Value) float64 {
 	t.Helper()
-	rat := approximateRealForTest(t, r, testPrecision)
+	n, ok := v.(*Number)
+	if !ok {
+		t.Fatalf("expected a number, got %T", v)
+	}
+	rat := approximateRealForTest(t, n.Real, testPrecision)
 	f, _ := rat.Float64()
 	return f
 }
@@ -618,9 +1554,9 @@ func approximateRealForTest(t *testing.T, r *unified.Real, precision int) *big.R
 	return new(big.Rat).SetFrac(approx, denom)
 }
 
-func makeReal(n int64) *unified.Real {
+func makeReal(n int64) *Number {
 	rat := new(big.Rat).SetInt64(n)
-	return unified.New(constructive.One(), rational.FromRational(rat))
+	return NewNumber(unified.New(constructive.One(), rational.FromRational(rat)))
 }
 
 func TestResultHistoryVariable(t *testing.T) {
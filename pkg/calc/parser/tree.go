@@ -1,10 +1,15 @@
 package parser
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"math/big"
 	"os"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/ripta/reals/pkg/constructive"
@@ -12,22 +17,54 @@ import (
 	"github.com/ripta/reals/pkg/unified"
 
 	"github.com/ripta/rt/pkg/calc/tokens"
+	"github.com/ripta/rt/pkg/calc/units"
 )
 
+// Node is an expression in the syntax tree. Eval returns a nil value without
+// an error for statements, such as function definitions, that produce no
+// value. String renders the node back into source form.
 type Node interface {
-	Eval(*Env) (*unified.Real, error)
+	Eval(*Env) (Value, error)
+	String() string
 }
 
 type binding struct {
-	value   *unified.Real
+	value   Value
 	mutable bool
 }
 
+// userFunc is a function defined in an expression, e.g. f(x, y) = x + y.
+type userFunc struct {
+	Params []string
+	Body   Node
+}
+
+// maxCallDepth bounds the nesting of user-defined function calls, which
+// would otherwise recurse without end.
+const maxCallDepth = 1000
+
 type Env struct {
 	precision int
 	vars      map[string]*binding
+	funcs     map[string]*userFunc
 	trace     bool
 	traceOut  io.Writer
+
+	// intWidth, when non-zero, is the width in bits to which integer results
+	// are wrapped, as two's complement unless intUnsigned is set.
+	intWidth    int
+	intUnsigned bool
+
+	// limits bounds the work done by evaluation, and ctx, if set, stops
+	// evaluation once it is done. ctx is only set on the copy of the
+	// environment made for each evaluation by EvalContext.
+	limits Limits
+	ctx    context.Context
+
+	// parent is the enclosing environment of a function call, or nil for
+	// the top-level environment. depth is the number of enclosing calls.
+	parent *Env
+	depth  int
 }
 
 // NewEnv creates a new environment with default precision (-100).
@@ -35,10 +72,28 @@ func NewEnv() *Env {
 	return &Env{
 		precision: -100,
 		vars:      seedConstants(),
+		funcs:     map[string]*userFunc{},
 		traceOut:  os.Stdout,
 	}
 }
 
+// child creates the environment in which a user-defined function body is
+// evaluated. Lookups that miss in the child fall through to e.
+func (e *Env) child() *Env {
+	return &Env{
+		precision:   e.precision,
+		vars:        map[string]*binding{},
+		trace:       e.trace,
+		traceOut:    e.traceOut,
+		intWidth:    e.intWidth,
+		intUnsigned: e.intUnsigned,
+		limits:      e.limits,
+		ctx:         e.ctx,
+		parent:      e,
+		depth:       e.depth + 1,
+	}
+}
+
 // convertDecimalPlacesToPrecision computes the binary precision needed to
 // represent the specified number of decimal places.
 func convertDecimalPlacesToPrecision(decimalPlaces int) int {
@@ -62,7 +117,7 @@ func seedConstants() map[string]*binding {
 	vars := map[string]*binding{}
 	for name, supplier := range transcendentalConstants {
 		vars[name] = &binding{
-			value:   supplier(),
+			value:   NewNumber(supplier()),
 			mutable: false,
 		}
 	}
@@ -70,15 +125,24 @@ func seedConstants() map[string]*binding {
 	return vars
 }
 
-func (e *Env) Get(name string) (*unified.Real, bool) {
-	if binding, ok := e.vars[name]; ok {
+func (e *Env) lookup(name string) (*binding, bool) {
+	for env := e; env != nil; env = env.parent {
+		if binding, ok := env.vars[name]; ok {
+			return binding, true
+		}
+	}
+	return nil, false
+}
+
+func (e *Env) Get(name string) (Value, bool) {
+	if binding, ok := e.lookup(name); ok {
 		return binding.value, true
 	}
 	return nil, false
 }
 
-func (e *Env) Set(name string, val *unified.Real) error {
-	if binding, ok := e.vars[name]; ok && !binding.mutable {
+func (e *Env) Set(name string, val Value) error {
+	if binding, ok := e.lookup(name); ok && !binding.mutable {
 		return fmt.Errorf("cannot assign to constant %q", name)
 	}
 
@@ -89,13 +153,70 @@ func (e *Env) Set(name string, val *unified.Real) error {
 	return nil
 }
 
-func (e *Env) SetConstant(name string, val *unified.Real) {
+func (e *Env) SetConstant(name string, val Value) {
 	e.vars[name] = &binding{
 		value:   val,
 		mutable: false,
 	}
 }
 
+// DefineFunction binds name to a user-defined function, replacing any
+// previous definition. Built-in functions cannot be redefined.
+func (e *Env) DefineFunction(name string, params []string, body Node) error {
+	if _, ok := builtinFunctions[name]; ok {
+		return fmt.Errorf("cannot redefine built-in function %q", name)
+	}
+
+	for env := e; env != nil; env = env.parent {
+		if env.funcs != nil {
+			env.funcs[name] = &userFunc{
+				Params: params,
+				Body:   body,
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot define function %q here", name)
+}
+
+func (e *Env) function(name string) (*userFunc, bool) {
+	for env := e; env != nil; env = env.parent {
+		if fn, ok := env.funcs[name]; ok {
+			return fn, true
+		}
+	}
+	return nil, false
+}
+
+// Functions returns the definitions of all user-defined functions in source
+// form, sorted by name.
+func (e *Env) Functions() []string {
+	names := make([]string, 0, len(e.funcs))
+	for name := range e.funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	defs := make([]string, 0, len(names))
+	for _, name := range names {
+		fn := e.funcs[name]
+		defs = append(defs, fmt.Sprintf("%s(%s) = %s", name, strings.Join(fn.Params, ", "), fn.Body))
+	}
+	return defs
+}
+
+// Names returns the names of all variables and constants, including the
+// built-in constants, sorted.
+func (e *Env) Names() []string {
+	names := make([]string, 0, len(e.vars))
+	for name := range e.vars {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
 func (e *Env) SetDecimalPlaces(decimalPlaces int) {
 	e.precision = convertDecimalPlacesToPrecision(decimalPlaces)
 }
@@ -104,6 +225,25 @@ func (e *Env) SetPrecision(precision int) {
 	e.precision = precision
 }
 
+// comparisonGuardBits is the extra precision at which differences are
+// approximated, so that they can be reliably compared to the tolerance.
+const comparisonGuardBits = 8
+
+// tolerance returns the difference below which two numbers compare equal,
+// which is one unit in the last decimal place at the environment's
+// precision.
+func (e *Env) tolerance() *big.Rat {
+	places := max(int(float64(-e.precision)*math.Log10(2)), 0)
+	return new(big.Rat).SetFrac(big.NewInt(1), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(places)), nil))
+}
+
+// SetIntWidth makes integer results wrap around to the given number of bits,
+// emulating fixed-width integer types. A width of 0 disables wrapping.
+func (e *Env) SetIntWidth(width int, unsigned bool) {
+	e.intWidth = width
+	e.intUnsigned = unsigned
+}
+
 func (e *Env) SetTrace(enabled bool) {
 	e.trace = enabled
 }
@@ -126,10 +266,43 @@ func extractCommentText(tok tokens.Token) string {
 
 type NumberNode struct {
 	Value *unified.Real
+	// Exact is Value as an exact rational, if known.
+	Exact *big.Rat
+	// Literal is the source text of the number, if it was parsed from one.
+	Literal string
+	// Unit, if set, is the unit the number is measured in, as in 30°.
+	Unit *units.Unit
+	// Imaginary is set for imaginary literals such as 2i, whose value is
+	// Value times the imaginary unit.
+	Imaginary bool
 }
 
-func (n *NumberNode) Eval(_ *Env) (*unified.Real, error) {
-	return n.Value, nil
+func (n *NumberNode) Eval(env *Env) (Value, error) {
+	if n.Imaginary {
+		return newComplex(newExact(new(big.Rat)), &Number{Real: n.Value, Exact: n.Exact}), nil
+	}
+	if n.Unit != nil {
+		return &Number{Real: n.Unit.ToBase(n.Value), Exact: n.Unit.ToBaseRat(n.Exact), Dim: n.Unit.Dim, Unit: n.Unit}, nil
+	}
+	return env.wrapInteger(&Number{Real: n.Value, Exact: n.Exact}), nil
+}
+
+func (n *NumberNode) String() string {
+	if n.Literal != "" {
+		return n.Literal
+	}
+
+	t := constructive.Text(n.Value.Constructive(), 30, 10)
+	if strings.Contains(t, ".") {
+		t = strings.TrimRight(strings.TrimRight(t, "0"), ".")
+	}
+	if n.Imaginary {
+		t += "i"
+	}
+	if n.Unit != nil {
+		t += " " + n.Unit.Name
+	}
+	return t
 }
 
 type BinaryNode struct {
@@ -138,17 +311,248 @@ type BinaryNode struct {
 	Right Node
 }
 
-func (n *BinaryNode) Eval(env *Env) (*unified.Real, error) {
-	l, err := n.Left.Eval(env)
+func (n *BinaryNode) Eval(env *Env) (Value, error) {
+	if n.Op.Type == tokens.OP_AND || n.Op.Type == tokens.OP_OR {
+		return n.evalLogical(env)
+	}
+
+	lv, err := n.Left.Eval(env)
 	if err != nil {
 		return nil, err
 	}
 
-	r, err := n.Right.Eval(env)
+	rv, err := n.Right.Eval(env)
 	if err != nil {
 		return nil, err
 	}
 
+	return n.operate(env, lv, rv)
+}
+
+// operate applies the operator to its evaluated operands.
+func (n *BinaryNode) operate(env *Env, lv, rv Value) (Value, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
+	if isList(lv) || isList(rv) {
+		return n.applyList(env, lv, rv)
+	}
+	if slices.Contains(comparisonOps, n.Op.Type) {
+		if isComplex(lv) || isComplex(rv) {
+			return n.compareComplex(env, lv, rv)
+		}
+		return n.compare(env, lv, rv)
+	}
+	if isComplex(lv) || isComplex(rv) {
+		return n.applyComplex(env, lv, rv)
+	}
+
+	l, err := asNumber(lv, n.Op)
+	if err != nil {
+		return nil, err
+	}
+	r, err := asNumber(rv, n.Op)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOffsetUnits(n.Op, l, r); err != nil {
+		return nil, err
+	}
+
+	res, err := n.apply(env, l, r)
+	if errors.Is(err, ErrNonReal) && l.IsPlain() && r.IsPlain() {
+		return n.applyComplex(env, l, r)
+	}
+	if err != nil {
+		return nil, withPosition(n.Op.Pos, err)
+	}
+	return env.wrapInteger(res), nil
+}
+
+func (n *BinaryNode) apply(env *Env, l, r *Number) (*Number, error) {
+	switch n.Op.Type {
+	case tokens.OP_PLUS, tokens.OP_MINUS, tokens.OP_PERCENT:
+		if l.Dim != r.Dim {
+			return nil, errorAt(n.Op.Pos, "%w: cannot apply %s to %s and %s", ErrIncompatibleUnits, opSymbol(n.Op), describeDim(l.Dim), describeDim(r.Dim))
+		}
+
+		res, err := n.applyReal(env, l.Real, r.Real)
+		if err != nil {
+			return nil, err
+		}
+
+		// The result is shown in the unit of the left operand, if any
+		unit := l.Unit
+		if unit == nil {
+			unit = r.Unit
+		}
+		return &Number{Real: res, Exact: n.applyExact(env, l.Exact, r.Exact), Dim: l.Dim, Unit: unit}, nil
+
+	case tokens.OP_STAR, tokens.OP_SLASH:
+		res, err := n.applyReal(env, l.Real, r.Real)
+		if err != nil {
+			return nil, err
+		}
+
+		dim := l.Dim.Mul(r.Dim)
+		if n.Op.Type == tokens.OP_SLASH {
+			dim = l.Dim.Div(r.Dim)
+		}
+		return &Number{Real: res, Exact: n.applyExact(env, l.Exact, r.Exact), Dim: dim, Unit: productUnit(n.Op, l, r, dim)}, nil
+
+	case tokens.OP_POW:
+		if !r.Dim.IsZero() {
+			return nil, errorAt(n.Op.Pos, "exponent must be dimensionless, got %s", r.Dim)
+		}
+
+		res, err := power(env, l.Real, r.Real)
+		if err != nil {
+			return nil, err
+		}
+		// power approximates its base, so prefer the exact result if known
+		exact := exactPower(l.Exact, r.Exact)
+		if exact != nil {
+			res = newRational(exact)
+		}
+		if l.IsPlain() {
+			return &Number{Real: res, Exact: exact}, nil
+		}
+
+		num, den, ok := rationalExponent(r.Real, env.precision)
+		if !ok {
+			return nil, errorAt(n.Op.Pos, "cannot raise %s to a non-rational power", describeDim(l.Dim))
+		}
+		dim, ok := l.Dim.Pow(num, den)
+		if !ok {
+			return nil, errorAt(n.Op.Pos, "cannot raise %s to the power %d/%d", describeDim(l.Dim), num, den)
+		}
+
+		var unit *units.Unit
+		if l.Unit != nil && den == 1 {
+			unit, _ = l.Unit.Pow(num)
+		}
+		return &Number{Real: res, Exact: exact, Dim: dim, Unit: unit}, nil
+
+	case tokens.OP_SHL, tokens.OP_SHR:
+		count, err := dimensionless(r, n.Op)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := n.applyReal(env, l.Real, count)
+		if err != nil {
+			return nil, err
+		}
+		return l.withExact(res, n.applyExact(env, l.Exact, r.Exact)), nil
+
+	case tokens.OP_BITAND, tokens.OP_BITOR, tokens.OP_BITXOR:
+		lr, err := dimensionless(l, n.Op)
+		if err != nil {
+			return nil, err
+		}
+		rr, err := dimensionless(r, n.Op)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := n.applyReal(env, lr, rr)
+		if err != nil {
+			return nil, err
+		}
+		return &Number{Real: res, Exact: n.applyExact(env, l.Exact, r.Exact)}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown operator")
+	}
+}
+
+// evalLogical evaluates && and ||, which only evaluate their right operand if
+// the left operand does not decide the result.
+func (n *BinaryNode) evalLogical(env *Env) (Value, error) {
+	lv, err := n.Left.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+	l, err := asBool(lv, n.Op)
+	if err != nil {
+		return nil, err
+	}
+
+	if l == (n.Op.Type == tokens.OP_OR) {
+		return Bool(l), nil
+	}
+
+	rv, err := n.Right.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+	r, err := asBool(rv, n.Op)
+	if err != nil {
+		return nil, err
+	}
+	return Bool(r), nil
+}
+
+// compare evaluates a comparison operator. Exact comparison of real numbers
+// is undecidable, so numbers that differ by less than the environment's
+// tolerance are considered equal. Bools may only be compared for equality.
+func (n *BinaryNode) compare(env *Env, lv, rv Value) (Value, error) {
+	if lb, ok := lv.(Bool); ok {
+		rb, ok := rv.(Bool)
+		if !ok {
+			return nil, errorAt(n.Op.Pos, "cannot compare bool and %s", rv.Type())
+		}
+
+		switch n.Op.Type {
+		case tokens.OP_EQ:
+			return Bool(lb == rb), nil
+		case tokens.OP_NE:
+			return Bool(lb != rb), nil
+		default:
+			return nil, errorAt(n.Op.Pos, "%s requires numbers, got bool", opSymbol(n.Op))
+		}
+	}
+
+	l, err := asNumber(lv, n.Op)
+	if err != nil {
+		return nil, err
+	}
+	r, err := asNumber(rv, n.Op)
+	if err != nil {
+		return nil, err
+	}
+	if l.Dim != r.Dim {
+		return nil, errorAt(n.Op.Pos, "%w: cannot compare %s and %s", ErrIncompatibleUnits, describeDim(l.Dim), describeDim(r.Dim))
+	}
+
+	diff, err := approximate(l.Real.Subtract(r.Real), env.precision-comparisonGuardBits)
+	if err != nil {
+		return nil, errorAt(n.Op.Pos, "%w", err)
+	}
+
+	cmp := diff.Sign()
+	if new(big.Rat).Abs(diff).Cmp(env.tolerance()) < 0 {
+		cmp = 0
+	}
+
+	switch n.Op.Type {
+	case tokens.OP_EQ:
+		return Bool(cmp == 0), nil
+	case tokens.OP_NE:
+		return Bool(cmp != 0), nil
+	case tokens.OP_LT:
+		return Bool(cmp < 0), nil
+	case tokens.OP_LE:
+		return Bool(cmp <= 0), nil
+	case tokens.OP_GT:
+		return Bool(cmp > 0), nil
+	default:
+		return Bool(cmp >= 0), nil
+	}
+}
+
+// applyReal applies the operator to the magnitudes of its operands.
+func (n *BinaryNode) applyReal(env *Env, l, r *unified.Real) (*unified.Real, error) {
 	switch n.Op.Type {
 	case tokens.OP_PLUS:
 		return l.Add(r), nil
@@ -165,9 +569,6 @@ func (n *BinaryNode) Eval(env *Env) (*unified.Real, error) {
 		}
 		return l.Divide(r), nil
 
-	case tokens.OP_POW:
-		return power(l, r, env.precision)
-
 	case tokens.OP_PERCENT:
 		if r.IsZero() {
 			return nil, fmt.Errorf("modulo by zero")
@@ -186,44 +587,257 @@ func (n *BinaryNode) Eval(env *Env) (*unified.Real, error) {
 		if err != nil {
 			return nil, err
 		}
+
+		// In fixed-width mode, shifting an integer right discards the
+		// low bits as it would in hardware
+		if env.intWidth > 0 {
+			if li, ok := integerValue(l, env.precision); ok {
+				return newRational(new(big.Rat).SetInt(li.Rsh(li, uint(max(shiftCount, 0))))), nil
+			}
+		}
 		return l.ShiftRight(shiftCount), nil
 
+	case tokens.OP_BITAND, tokens.OP_BITOR, tokens.OP_BITXOR:
+		li, err := bitwiseOperand(l, n.Op, env.precision)
+		if err != nil {
+			return nil, err
+		}
+		ri, err := bitwiseOperand(r, n.Op, env.precision)
+		if err != nil {
+			return nil, err
+		}
+
+		switch n.Op.Type {
+		case tokens.OP_BITAND:
+			li.And(li, ri)
+		case tokens.OP_BITOR:
+			li.Or(li, ri)
+		default:
+			li.Xor(li, ri)
+		}
+		return newRational(new(big.Rat).SetInt(li)), nil
+
 	default:
 		return nil, fmt.Errorf("unknown operator")
 	}
 }
 
+// applyExact applies the operator to exact rational operands. It returns nil
+// if either operand is not known to be rational, or if the operator is not
+// defined for them, in which case applyReal reports the error.
+func (n *BinaryNode) applyExact(env *Env, l, r *big.Rat) *big.Rat {
+	if l == nil || r == nil {
+		return nil
+	}
+
+	switch n.Op.Type {
+	case tokens.OP_PLUS:
+		return new(big.Rat).Add(l, r)
+
+	case tokens.OP_MINUS:
+		return new(big.Rat).Sub(l, r)
+
+	case tokens.OP_STAR:
+		return new(big.Rat).Mul(l, r)
+
+	case tokens.OP_SLASH:
+		if r.Sign() == 0 {
+			return nil
+		}
+		return new(big.Rat).Quo(l, r)
+
+	case tokens.OP_PERCENT:
+		if r.Sign() == 0 {
+			return nil
+		}
+		q := new(big.Rat).SetInt(floorRat(new(big.Rat).Quo(l, r)))
+		return q.Sub(l, q.Mul(q, r))
+
+	case tokens.OP_SHL, tokens.OP_SHR:
+		if !r.IsInt() || !r.Num().IsInt64() {
+			return nil
+		}
+
+		count := r.Num().Int64()
+		if n.Op.Type == tokens.OP_SHR {
+			if env.intWidth > 0 && l.IsInt() {
+				return new(big.Rat).SetInt(new(big.Int).Rsh(l.Num(), uint(max(count, 0))))
+			}
+			count = -count
+		}
+		if count < -maxExactShift || count > maxExactShift {
+			return nil
+		}
+
+		if count < 0 {
+			scale := new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), uint(-count)))
+			return scale.Quo(l, scale)
+		}
+		scale := new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), uint(count)))
+		return scale.Mul(l, scale)
+
+	case tokens.OP_BITAND, tokens.OP_BITOR, tokens.OP_BITXOR:
+		if !l.IsInt() || !r.IsInt() {
+			return nil
+		}
+
+		res := new(big.Int)
+		switch n.Op.Type {
+		case tokens.OP_BITAND:
+			res.And(l.Num(), r.Num())
+		case tokens.OP_BITOR:
+			res.Or(l.Num(), r.Num())
+		default:
+			res.Xor(l.Num(), r.Num())
+		}
+		return new(big.Rat).SetInt(res)
+
+	default:
+		return nil
+	}
+}
+
+// maxExactShift and maxExactExponent bound the size of the exact rationals
+// that shifts and powers produce. Larger results are left to the constructive
+// reals, which are evaluated lazily.
+const (
+	maxExactShift    = 1 << 16
+	maxExactExponent = 1 << 12
+)
+
+// exactPower raises an exact rational base to an integer exponent. It returns
+// nil if either operand is not known to be rational, if the exponent is not
+// an integer or is too large, or if the result is undefined.
+func exactPower(base, exp *big.Rat) *big.Rat {
+	if base == nil || exp == nil || !exp.IsInt() || !exp.Num().IsInt64() {
+		return nil
+	}
+
+	e := exp.Num().Int64()
+	if e < -maxExactExponent || e > maxExactExponent || (e < 0 && base.Sign() == 0) {
+		return nil
+	}
+
+	ee := new(big.Int).Abs(big.NewInt(e))
+	num := new(big.Int).Exp(base.Num(), ee, nil)
+	den := new(big.Int).Exp(base.Denom(), ee, nil)
+	if e < 0 {
+		num, den = den, num
+	}
+	return new(big.Rat).SetFrac(num, den)
+}
+
+func (n *BinaryNode) String() string {
+	prec := precedence(n)
+
+	// Exponentiation is right-associative and comparisons do not associate;
+	// all other operators are left-associative.
+	left, right := prec, prec+1
+	if n.Op.Type == tokens.OP_POW {
+		left, right = prec+1, prec
+	} else if slices.Contains(comparisonOps, n.Op.Type) {
+		left = prec + 1
+	}
+
+	return fmt.Sprintf("%s %s %s", parenthesize(n.Left, left), opSymbol(n.Op), parenthesize(n.Right, right))
+}
+
 type UnaryNode struct {
 	Op   tokens.Token
 	Expr Node
 }
 
-func (n *UnaryNode) Eval(env *Env) (*unified.Real, error) {
-	val, err := n.Expr.Eval(env)
+func (n *UnaryNode) Eval(env *Env) (Value, error) {
+	v, err := n.Expr.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	return n.operate(env, v)
+}
+
+// operate applies the operator to its evaluated operand. Operators other
+// than ! apply to each element of a list.
+func (n *UnaryNode) operate(env *Env, v Value) (Value, error) {
+	if err := env.check(); err != nil {
+		return nil, err
+	}
+	if l, ok := v.(*List); ok && n.Op.Type != tokens.OP_NOT {
+		return l.mapElems(func(elem Value) (Value, error) {
+			return n.operate(env, elem)
+		})
+	}
+	if n.Op.Type == tokens.OP_NOT {
+		b, err := asBool(v, n.Op)
+		if err != nil {
+			return nil, err
+		}
+		return Bool(!b), nil
+	}
+	if z, ok := v.(*Complex); ok {
+		return n.evalComplex(env, z)
+	}
+
+	val, err := asNumber(v, n.Op)
 	if err != nil {
 		return nil, err
 	}
+	if err := checkOffsetUnits(n.Op, val); err != nil {
+		return nil, err
+	}
 
 	switch n.Op.Type {
 	case tokens.OP_MINUS:
-		return val.Negate(), nil
+		var exact *big.Rat
+		if val.Exact != nil {
+			exact = new(big.Rat).Neg(val.Exact)
+		}
+		return env.wrapInteger(val.withExact(val.Real.Negate(), exact)), nil
 
 	case tokens.OP_ROOT:
-		cr := constructive.Sqrt(val.Constructive())
-		return unified.New(cr, rational.One()), nil
+		if val.IsPlain() && sign(val.Real, env.precision) < 0 {
+			z, _ := toComplex(val, n.Op)
+			return complexSqrt(env, z), nil
+		}
+
+		dim, ok := val.Dim.Pow(1, 2)
+		if !ok {
+			return nil, errorAt(n.Op.Pos, "cannot take the square root of %s", describeDim(val.Dim))
+		}
+
+		cr := constructive.Sqrt(val.Real.Constructive())
+		return &Number{Real: unified.New(cr, rational.One()), Dim: dim}, nil
+
+	case tokens.OP_BITNOT:
+		r, err := dimensionless(val, n.Op)
+		if err != nil {
+			return nil, err
+		}
+		vi, err := bitwiseOperand(r, n.Op, env.precision)
+		if err != nil {
+			return nil, err
+		}
+		return env.wrapInteger(newExact(new(big.Rat).SetInt(vi.Not(vi)))), nil
 
 	default:
 		return nil, fmt.Errorf("unknown unary operator")
 	}
 }
 
+func (n *UnaryNode) String() string {
+	return opSymbol(n.Op) + parenthesize(n.Expr, precedence(n))
+}
+
 type IdentNode struct {
 	Name tokens.Token
+	// UnitPosition is set on operands of a product or quotient with a
+	// quantity, such as the h in 60 mi/h, which may name a unit.
+	UnitPosition bool
 }
 
-func (n *IdentNode) Eval(env *Env) (*unified.Real, error) {
+func (n *IdentNode) Eval(env *Env) (Value, error) {
 	if env == nil {
-		return nil, fmt.Errorf("%s: undefined identifier %q", n.Name.Pos, n.Name.Value)
+		return nil, errorAt(n.Name.Pos, "undefined identifier %q", n.Name.Value)
 	}
 
 	if val, ok := env.Get(n.Name.Value); ok {
@@ -231,10 +845,31 @@ func (n *IdentNode) Eval(env *Env) (*unified.Real, error) {
 	}
 
 	if strings.HasPrefix(n.Name.Value, "$") {
-		return nil, fmt.Errorf("%s: no result for line %s", n.Name.Pos, n.Name.Value[1:])
+		return nil, errorAt(n.Name.Pos, "no result for line %s", n.Name.Value[1:])
+	}
+
+	if slices.Contains(imaginaryUnits, n.Name.Value) {
+		return imaginaryUnit(), nil
+	}
+
+	// Identifiers in unit position that are not variables may name a unit,
+	// e.g. the h in 60 mi/h; elsewhere, a unit name is more likely a typo or
+	// an unset variable than a quantity of one
+	if unit, ok := units.Lookup(n.Name.Value); ok {
+		if unit.Offset != nil {
+			return nil, errorAt(n.Name.Pos, "unit %s needs a magnitude, as in 20 %s", unit.Name, unit.Name)
+		}
+		if !n.UnitPosition {
+			return nil, errorAt(n.Name.Pos, "undefined identifier %q; for the unit %s, give a magnitude, as in 1 %s", n.Name.Value, unit.Name, unit.Name)
+		}
+		return &Number{Real: unit.Scale, Exact: unit.Rat, Dim: unit.Dim, Unit: unit}, nil
 	}
 
-	return nil, fmt.Errorf("%s: undefined identifier %q", n.Name.Pos, n.Name.Value)
+	return nil, errorAt(n.Name.Pos, "undefined identifier %q", n.Name.Value)
+}
+
+func (n *IdentNode) String() string {
+	return n.Name.Value
 }
 
 type AssignNode struct {
@@ -242,7 +877,7 @@ type AssignNode struct {
 	Value Node
 }
 
-func (n *AssignNode) Eval(env *Env) (*unified.Real, error) {
+func (n *AssignNode) Eval(env *Env) (Value, error) {
 	if env == nil {
 		env = NewEnv()
 	}
@@ -253,24 +888,36 @@ func (n *AssignNode) Eval(env *Env) (*unified.Real, error) {
 	}
 
 	if err := env.Set(n.Name.Value, val); err != nil {
-		return nil, fmt.Errorf("%s: %w", n.Name.Pos, err)
+		return nil, errorAt(n.Name.Pos, "%w", err)
 	}
 	return val, nil
 }
 
+func (n *AssignNode) String() string {
+	return fmt.Sprintf("%s = %s", n.Name.Value, n.Value)
+}
+
 type CommentNode struct {
 	Text string
 	Tok  tokens.Token
 	Expr Node
 }
 
-func (n *CommentNode) Eval(env *Env) (*unified.Real, error) {
+func (n *CommentNode) Eval(env *Env) (Value, error) {
 	if env.trace && env.traceOut != nil {
 		fmt.Fprintf(env.traceOut, "# %s\n", n.Text)
 	}
 	return n.Expr.Eval(env)
 }
 
+func (n *CommentNode) String() string {
+	quote := `"`
+	if strings.Contains(n.Text, `"`) && !strings.Contains(n.Text, "`") {
+		quote = "`"
+	}
+	return fmt.Sprintf("%s%s%s %s", quote, n.Text, quote, parenthesize(n.Expr, precPrimary))
+}
+
 // modulo computes a % b = a - b * floor(a/b) for real numbers
 func modulo(a, b *unified.Real, precision int) (*unified.Real, error) {
 	// scale = 2^(-precision)
@@ -319,25 +966,79 @@ func extractInteger(r *unified.Real, op tokens.Token, precision int) (int, error
 	// Approximate r
 	approxInt := constructive.Approximate(r.Constructive(), precision)
 	if approxInt == nil {
-		return 0, fmt.Errorf("%s: failed to approximate shift count", op.Pos)
+		return 0, errorAt(op.Pos, "failed to approximate shift count")
 	}
 
 	// Check if denominator is 1 (i.e., it's an integer)
 	approxRat := new(big.Rat).SetFrac(approxInt, scale)
 	if approxRat.Denom().Cmp(big.NewInt(1)) != 0 {
-		return 0, fmt.Errorf("%s: shift count must be an integer, got non-integer value", op.Pos)
+		return 0, errorAt(op.Pos, "shift count must be an integer, got non-integer value")
 	}
 
 	// Convert to int, checking for overflow
 	num := approxRat.Num()
 	if !num.IsInt64() {
-		return 0, fmt.Errorf("%s: shift count out of range", op.Pos)
+		return 0, errorAt(op.Pos, "shift count out of range")
 	}
 
 	return int(num.Int64()), nil
 }
 
-func power(l, r *unified.Real, precision int) (*unified.Real, error) {
+// integerValue returns r as an integer if its approximation at the given
+// precision is one.
+func integerValue(r *unified.Real, precision int) (*big.Int, bool) {
+	approx, err := approximate(r, precision)
+	if err != nil || !approx.IsInt() {
+		return nil, false
+	}
+	return new(big.Int).Set(approx.Num()), true
+}
+
+// bitwiseOperand extracts the integer operand of a bitwise operator, which
+// is an error for non-integer values.
+func bitwiseOperand(r *unified.Real, op tokens.Token, precision int) (*big.Int, error) {
+	i, ok := integerValue(r, precision)
+	if !ok {
+		return nil, errorAt(op.Pos, "bitwise %s requires integer operands, got non-integer value", opSymbol(op))
+	}
+	return i, nil
+}
+
+// wrapInteger reduces an integer val to the environment's fixed integer
+// width, if any. Non-integer values and quantities with units are returned
+// unchanged.
+func (e *Env) wrapInteger(val *Number) *Number {
+	if e == nil || e.intWidth <= 0 || !val.IsPlain() {
+		return val
+	}
+
+	i, ok := integerValue(val.Real, e.precision)
+	if !ok {
+		return val
+	}
+
+	wrapped := wrapBits(i, e.intWidth, e.intUnsigned)
+	if wrapped.Cmp(i) == 0 {
+		return val
+	}
+	return newExact(new(big.Rat).SetInt(wrapped))
+}
+
+// wrapBits reduces i modulo 2^width into the unsigned range [0, 2^width) or,
+// for signed integers, the two's complement range [-2^(width-1), 2^(width-1)).
+func wrapBits(i *big.Int, width int, unsigned bool) *big.Int {
+	modulus := new(big.Int).Lsh(big.NewInt(1), uint(width))
+	wrapped := new(big.Int).Mod(i, modulus)
+
+	if !unsigned && wrapped.Bit(width-1) == 1 {
+		wrapped.Sub(wrapped, modulus)
+	}
+	return wrapped
+}
+
+func power(env *Env, l, r *unified.Real) (*unified.Real, error) {
+	precision := env.precision
+
 	// Approximate both operands to check for special cases
 	scale := new(big.Int).Exp(big.NewInt(2), big.NewInt(int64(-precision)), nil)
 
@@ -371,7 +1072,7 @@ func power(l, r *unified.Real, precision int) (*unified.Real, error) {
 	if lRat.Sign() < 0 {
 		// Base is negative, check if exponent is an integer
 		if rRat.Denom().Cmp(big.NewInt(1)) != 0 {
-			return nil, fmt.Errorf("negative base to non-integer power is non-real")
+			return nil, fmt.Errorf("negative base to non-integer power: %w", ErrNonReal)
 		}
 
 		// For integer exponents, compute using big.Rat since we know n is an integer
@@ -386,7 +1087,13 @@ func power(l, r *unified.Real, precision int) (*unified.Real, error) {
 		}
 
 		// Compute base^exp using repeated multiplication
+		if err := env.checkExponent(exp); err != nil {
+			return nil, err
+		}
 		for i := new(big.Int).Set(exp); i.Sign() > 0; i.Sub(i, big.NewInt(1)) {
+			if err := env.check(); err != nil {
+				return nil, err
+			}
 			result.Mul(result, base)
 		}
 
@@ -404,7 +1111,13 @@ func power(l, r *unified.Real, precision int) (*unified.Real, error) {
 		exp := rRat.Num()
 
 		// Compute base^exp using repeated multiplication
+		if err := env.checkExponent(exp); err != nil {
+			return nil, err
+		}
 		for i := new(big.Int).Set(exp); i.Sign() > 0; i.Sub(i, big.NewInt(1)) {
+			if err := env.check(); err != nil {
+				return nil, err
+			}
 			result.Mul(result, base)
 		}
 
@@ -416,3 +1129,307 @@ func power(l, r *unified.Real, precision int) (*unified.Real, error) {
 	cr := constructive.Pow(l.Constructive(), r.Constructive())
 	return unified.New(cr, rational.One()), nil
 }
+
+type CallNode struct {
+	Name tokens.Token
+	Args []Node
+}
+
+func (n *CallNode) Eval(env *Env) (Value, error) {
+	if env == nil {
+		env = NewEnv()
+	}
+	if err := env.check(); err != nil {
+		return nil, err
+	}
+
+	if fn, ok := builtinFunctions[n.Name.Value]; ok {
+		if err := fn.checkArity(len(n.Args)); err != nil {
+			return nil, errorAt(n.Name.Pos, "%s: %w", n.Name.Value, err)
+		}
+		if fn.Form != nil {
+			return fn.Form(env, n)
+		}
+
+		args, err := n.evalArgs(env)
+		if err != nil {
+			return nil, err
+		}
+
+		return n.callBuiltin(env, fn, args)
+	}
+
+	fn, ok := env.function(n.Name.Value)
+	if !ok {
+		return nil, errorAt(n.Name.Pos, "%w %q", ErrUndefinedFunction, n.Name.Value)
+	}
+
+	if len(n.Args) != len(fn.Params) {
+		return nil, errorAt(n.Name.Pos, "%s: %w: expected %d, got %d", n.Name.Value, ErrArgumentCount, len(fn.Params), len(n.Args))
+	}
+	if env.depth >= maxCallDepth {
+		return nil, errorAt(n.Name.Pos, "%s: maximum call depth of %d exceeded", n.Name.Value, maxCallDepth)
+	}
+
+	args, err := n.evalArgs(env)
+	if err != nil {
+		return nil, err
+	}
+
+	scope := env.child()
+	for i, param := range fn.Params {
+		scope.vars[param] = &binding{
+			value:   args[i],
+			mutable: true,
+		}
+	}
+
+	// A body that produces an expression, as from diff, is evaluated with
+	// the parameters bound
+	return evalExpr(scope, fn.Body)
+}
+
+// callBuiltin calls a built-in function on the magnitudes of its arguments.
+// Dimensional functions carry the dimension and unit of their first argument
+// through to the result.
+func (n *CallNode) callBuiltin(env *Env, fn *builtinFunc, args []Value) (Value, error) {
+	if fn.Values != nil {
+		res, err := fn.Values(env, args)
+		if err != nil {
+			return nil, errorAt(n.Name.Pos, "%s: %w", n.Name.Value, err)
+		}
+		return res, nil
+	}
+	if slices.ContainsFunc(args, isList) {
+		return n.callList(env, fn, args)
+	}
+	if slices.ContainsFunc(args, isComplex) {
+		return n.callComplex(env, fn, args)
+	}
+
+	reals := make([]*unified.Real, len(args))
+	exact := make([]*big.Rat, len(args))
+	var first *Number
+	for i, arg := range args {
+		if !fn.Dimensional {
+			r, err := dimensionless(arg, n.Name)
+			if err != nil {
+				return nil, err
+			}
+			reals[i] = r
+			exact[i] = arg.(*Number).Exact
+			continue
+		}
+
+		num, err := asNumber(arg, n.Name)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkOffsetUnits(n.Name, num); err != nil {
+			return nil, err
+		}
+		if first == nil {
+			first = num
+		} else if num.Dim != first.Dim {
+			return nil, errorAt(n.Name.Pos, "%s: %w: %s and %s", n.Name.Value, ErrIncompatibleUnits, describeDim(first.Dim), describeDim(num.Dim))
+		}
+		reals[i] = num.Real
+		exact[i] = num.Exact
+	}
+
+	res, ratRes, err := fn.call(env, reals, exact)
+	if errors.Is(err, ErrNonReal) && first == nil {
+		return n.callComplex(env, fn, args)
+	}
+	if err != nil {
+		return nil, errorAt(n.Name.Pos, "%s: %w", n.Name.Value, err)
+	}
+
+	if first != nil {
+		return first.withExact(res, ratRes), nil
+	}
+	return &Number{Real: res, Exact: ratRes}, nil
+}
+
+func (n *CallNode) evalArgs(env *Env) ([]Value, error) {
+	args := make([]Value, len(n.Args))
+	for i, arg := range n.Args {
+		val, err := arg.Eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = val
+	}
+	return args, nil
+}
+
+func (n *CallNode) String() string {
+	args := make([]string, len(n.Args))
+	for i, arg := range n.Args {
+		args[i] = arg.String()
+	}
+	return fmt.Sprintf("%s(%s)", n.Name.Value, strings.Join(args, ", "))
+}
+
+// FuncDefNode defines a function, e.g. f(x, y) = x**2 + y. The body is not
+// evaluated until the function is called.
+type FuncDefNode struct {
+	Name   tokens.Token
+	Params []tokens.Token
+	Body   Node
+}
+
+func (n *FuncDefNode) Eval(env *Env) (Value, error) {
+	if env == nil {
+		return nil, errorAt(n.Name.Pos, "cannot define function %q without an environment", n.Name.Value)
+	}
+
+	params := make([]string, len(n.Params))
+	for i, param := range n.Params {
+		params[i] = param.Value
+	}
+
+	if err := env.DefineFunction(n.Name.Value, params, n.Body); err != nil {
+		return nil, errorAt(n.Name.Pos, "%w", err)
+	}
+	return nil, nil
+}
+
+func (n *FuncDefNode) String() string {
+	params := make([]string, len(n.Params))
+	for i, param := range n.Params {
+		params[i] = param.Value
+	}
+	return fmt.Sprintf("%s(%s) = %s", n.Name.Value, strings.Join(params, ", "), n.Body)
+}
+
+// UnitNode attaches a unit to a plain number, e.g. 3 km.
+type UnitNode struct {
+	Expr Node
+	Unit *units.Unit
+	Tok  tokens.Token
+}
+
+func (n *UnitNode) Eval(env *Env) (Value, error) {
+	v, err := n.Expr.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	return n.attach(v)
+}
+
+// attach gives v the unit, element by element if v is a list.
+func (n *UnitNode) attach(v Value) (Value, error) {
+	if l, ok := v.(*List); ok {
+		return l.mapElems(n.attach)
+	}
+
+	val, err := asNumber(v, n.Tok)
+	if err != nil {
+		return nil, err
+	}
+	if !val.IsPlain() {
+		return nil, errorAt(n.Tok.Pos, "unit %s applies only to plain numbers, got a quantity in %s", n.Unit.Name, displayUnit(val))
+	}
+
+	return &Number{Real: n.Unit.ToBase(val.Real), Exact: n.Unit.ToBaseRat(val.Exact), Dim: n.Unit.Dim, Unit: n.Unit}, nil
+}
+
+func (n *UnitNode) String() string {
+	return parenthesize(n.Expr, precQuantity+1) + " " + n.Unit.Name
+}
+
+// ConvertNode converts a quantity to another unit of the same dimension,
+// e.g. 72 °F to °C.
+type ConvertNode struct {
+	Expr Node
+	Unit *units.Unit
+	Tok  tokens.Token
+}
+
+func (n *ConvertNode) Eval(env *Env) (Value, error) {
+	v, err := n.Expr.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	return n.convert(v)
+}
+
+// convert displays v in the unit, element by element if v is a list.
+func (n *ConvertNode) convert(v Value) (Value, error) {
+	if l, ok := v.(*List); ok {
+		return l.mapElems(n.convert)
+	}
+
+	val, err := asNumber(v, n.Tok)
+	if err != nil {
+		return nil, err
+	}
+	if val.Dim != n.Unit.Dim {
+		return nil, errorAt(n.Tok.Pos, "%w: cannot convert %s to %s", ErrIncompatibleUnits, describeDim(val.Dim), n.Unit.Name)
+	}
+
+	return &Number{Real: val.Real, Exact: val.Exact, Dim: val.Dim, Unit: n.Unit}, nil
+}
+
+func (n *ConvertNode) String() string {
+	return fmt.Sprintf("%s to %s", parenthesize(n.Expr, precConvert), n.Unit.Name)
+}
+
+// SeqNode is a sequence of statements separated by semicolons, as in
+// x = 2; x ** 2. Its value is that of the last statement.
+type SeqNode struct {
+	Stmts []Node
+}
+
+func (n *SeqNode) Eval(env *Env) (Value, error) {
+	var res Value
+	for _, stmt := range n.Stmts {
+		v, err := stmt.Eval(env)
+		if err != nil {
+			return nil, err
+		}
+		res = v
+	}
+	return res, nil
+}
+
+func (n *SeqNode) String() string {
+	stmts := make([]string, len(n.Stmts))
+	for i, stmt := range n.Stmts {
+		stmts[i] = stmt.String()
+	}
+	return strings.Join(stmts, "; ")
+}
+
+// CondNode is a conditional expression, cond ? a : b. Only the chosen branch
+// is evaluated.
+type CondNode struct {
+	Cond Node
+	Then Node
+	Else Node
+	Tok  tokens.Token
+}
+
+func (n *CondNode) Eval(env *Env) (Value, error) {
+	v, err := n.Cond.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	cond, err := asBool(v, n.Tok)
+	if err != nil {
+		return nil, err
+	}
+
+	if cond {
+		return n.Then.Eval(env)
+	}
+	return n.Else.Eval(env)
+}
+
+func (n *CondNode) String() string {
+	return fmt.Sprintf("%s ? %s : %s", parenthesize(n.Cond, precOr), parenthesize(n.Then, precConvert), parenthesize(n.Else, precTernary))
+}
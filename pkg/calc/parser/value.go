@@ -0,0 +1,211 @@
+package parser
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ripta/reals/pkg/unified"
+
+	"github.com/ripta/rt/pkg/calc/tokens"
+	"github.com/ripta/rt/pkg/calc/units"
+)
+
+var ErrIncompatibleUnits = errors.New("incompatible units")
+
+// Value is the result of evaluating an expression.
+type Value interface {
+	// Type names the kind of value, for use in error messages.
+	Type() string
+}
+
+// Number is a real number, which may be a physical quantity. Real holds the
+// magnitude in SI base units of dimension Dim; Unit, if set, is the unit in
+// which the number is displayed. Exact, if set, is the same magnitude as an
+// exact rational, which is tracked through arithmetic so that results can be
+// displayed as fractions.
+type Number struct {
+	Real  *unified.Real
+	Exact *big.Rat
+	Dim   units.Dimension
+	Unit  *units.Unit
+}
+
+// NewNumber returns a dimensionless number.
+func NewNumber(r *unified.Real) *Number {
+	return &Number{Real: r}
+}
+
+func (n *Number) Type() string {
+	return "number"
+}
+
+// newExact returns a dimensionless number with the exact rational value r.
+func newExact(r *big.Rat) *Number {
+	return &Number{Real: newRational(r), Exact: r}
+}
+
+// IsPlain reports whether n is a dimensionless number without a display
+// unit.
+func (n *Number) IsPlain() bool {
+	return n.Dim.IsZero() && n.Unit == nil
+}
+
+// Display returns the magnitude of n in its display unit, along with the
+// name of that unit. Quantities without a display unit are shown in SI base
+// units, and plain numbers have an empty unit name.
+func (n *Number) Display() (*unified.Real, string) {
+	if n.Unit != nil {
+		return n.Unit.FromBase(n.Real), n.Unit.Name
+	}
+	return n.Real, n.Dim.String()
+}
+
+// DisplayExact is Display for exact numbers. It returns nil if n is not
+// known to be rational in its display unit.
+func (n *Number) DisplayExact() *big.Rat {
+	if n.Unit != nil {
+		return n.Unit.FromBaseRat(n.Exact)
+	}
+	return n.Exact
+}
+
+// withReal returns a number with the same dimension and display unit as n,
+// but magnitude r in base units.
+func (n *Number) withReal(r *unified.Real) *Number {
+	return &Number{Real: r, Dim: n.Dim, Unit: n.Unit}
+}
+
+// withExact is withReal for a magnitude that is also known as the exact
+// rational r, which may be nil.
+func (n *Number) withExact(r *unified.Real, exact *big.Rat) *Number {
+	return &Number{Real: r, Exact: exact, Dim: n.Dim, Unit: n.Unit}
+}
+
+// Bool is the result of a comparison or logical operator.
+type Bool bool
+
+func (b Bool) Type() string {
+	return "bool"
+}
+
+func (b Bool) String() string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+// asBool asserts that val is a bool, as needed by the operator named by tok.
+func asBool(val Value, tok tokens.Token) (bool, error) {
+	b, ok := val.(Bool)
+	if !ok {
+		return false, errorAt(tok.Pos, "%s requires a bool, got %s", tokenSymbol(tok), val.Type())
+	}
+	return bool(b), nil
+}
+
+// asNumber asserts that val is a number, as needed by the operator or
+// function named by tok.
+func asNumber(val Value, tok tokens.Token) (*Number, error) {
+	n, ok := val.(*Number)
+	if !ok {
+		return nil, errorAt(tok.Pos, "%s requires a number, got %s", tokenSymbol(tok), val.Type())
+	}
+	return n, nil
+}
+
+// dimensionless asserts that val is a number without a dimension, and
+// returns its magnitude. Angles are dimensionless and are returned in
+// radians.
+func dimensionless(val Value, tok tokens.Token) (*unified.Real, error) {
+	n, err := asNumber(val, tok)
+	if err != nil {
+		return nil, err
+	}
+
+	if !n.Dim.IsZero() {
+		return nil, errorAt(tok.Pos, "%s requires a dimensionless value, got %s", tokenSymbol(tok), n.Dim)
+	}
+	return n.Real, nil
+}
+
+// tokenSymbol returns the source text of an operator or function name.
+func tokenSymbol(tok tokens.Token) string {
+	if tok.Type == tokens.IDENT {
+		return tok.Value
+	}
+	return opSymbol(tok)
+}
+
+// describeDim renders a dimension for use in error messages.
+func describeDim(d units.Dimension) string {
+	if d.IsZero() {
+		return "dimensionless value"
+	}
+	return d.String()
+}
+
+// displayUnit returns the name of the unit n is displayed in.
+func displayUnit(n *Number) string {
+	_, unit := n.Display()
+	return unit
+}
+
+// checkOffsetUnits rejects operands measured on a scale with an offset zero,
+// such as °C, on which arithmetic is ambiguous. Such quantities must first
+// be converted to an absolute unit like K.
+func checkOffsetUnits(tok tokens.Token, operands ...*Number) error {
+	for _, n := range operands {
+		if n.Unit != nil && n.Unit.Offset != nil {
+			return errorAt(tok.Pos, "cannot apply %s to a quantity in %s, whose zero is offset; convert it to K first", tokenSymbol(tok), n.Unit.Name)
+		}
+	}
+	return nil
+}
+
+// productUnit picks the display unit of the product or quotient of l and r,
+// which has dimension dim. Scaling a quantity by a plain number keeps its
+// unit, while two quantities combine their units, e.g. km/h.
+func productUnit(op tokens.Token, l, r *Number, dim units.Dimension) *units.Unit {
+	if dim.IsZero() && (!l.Dim.IsZero() || !r.Dim.IsZero()) {
+		return nil
+	}
+
+	switch {
+	case r.IsPlain():
+		return l.Unit
+
+	case l.IsPlain() && op.Type == tokens.OP_STAR:
+		return r.Unit
+
+	case l.IsPlain() && r.Unit != nil:
+		u, _ := r.Unit.Pow(-1)
+		return u
+
+	case l.Unit != nil && r.Unit != nil:
+		var u *units.Unit
+		if op.Type == tokens.OP_STAR {
+			u, _ = l.Unit.Mul(r.Unit)
+		} else {
+			u, _ = l.Unit.Div(r.Unit)
+		}
+		return u
+	}
+
+	return nil
+}
+
+// maxExponentDenominator bounds the search for a rational exponent of a
+// quantity, e.g. the 1/2 in (4 m**2) ** 0.5.
+const maxExponentDenominator = 12
+
+// rationalExponent finds num/den equal to r with a small denominator.
+func rationalExponent(r *unified.Real, precision int) (num, den int, ok bool) {
+	for den = 1; den <= maxExponentDenominator; den++ {
+		i, ok := integerValue(r.Multiply(newInteger(int64(den))), precision)
+		if ok && i.IsInt64() {
+			return int(i.Int64()), den, true
+		}
+	}
+	return 0, 0, false
+}
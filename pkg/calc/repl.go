@@ -0,0 +1,323 @@
+package calc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/elk-language/go-prompt"
+	istrings "github.com/elk-language/go-prompt/strings"
+
+	"github.com/ripta/rt/pkg/calc/lexer"
+	"github.com/ripta/rt/pkg/calc/parser"
+	"github.com/ripta/rt/pkg/calc/tokens"
+	"github.com/ripta/rt/pkg/calc/units"
+)
+
+// maxHistory is the number of lines of REPL history kept between sessions.
+const maxHistory = 1000
+
+const historyFilename = "history"
+
+// getHistoryPath returns the path of the REPL history file, creating its
+// directory if needed.
+// Default: ~/.config/rt/calc/history
+func getHistoryPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config directory: %w", err)
+	}
+
+	dir := filepath.Join(configDir, "rt", "calc")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	return filepath.Join(dir, historyFilename), nil
+}
+
+// loadHistory reads the last maxHistory lines of the history file at path.
+// A missing file is an empty history.
+func loadHistory(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	if len(lines) > maxHistory {
+		lines = lines[len(lines)-maxHistory:]
+	}
+	return lines, nil
+}
+
+// appendHistory adds line to the history file, if there is one. Failures
+// are reported once and then history is no longer saved, so that a
+// read-only config directory does not interrupt every line.
+func (c *Calculator) appendHistory(line string) {
+	line = strings.TrimSpace(line)
+	if c.historyPath == "" || line == "" {
+		return
+	}
+
+	f, err := os.OpenFile(c.historyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err == nil {
+		_, err = fmt.Fprintln(f, line)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: history will not be saved: %v\n", err)
+		c.historyPath = ""
+	}
+}
+
+// complete suggests completions for the word before the cursor.
+func (c *Calculator) complete(d prompt.Document) ([]prompt.Suggest, istrings.RuneNumber, istrings.RuneNumber) {
+	suggestions, word := c.suggest(d.TextBeforeCursor())
+
+	end := d.CurrentRuneIndex()
+	start := end - istrings.RuneNumber(utf8.RuneCountInString(word))
+	return suggestions, start, end
+}
+
+// suggest returns the completions of the last word of text, along with that
+// word. On a line starting with ".", these are the names of meta-commands
+// and their arguments; otherwise they are the names of functions,
+// variables, constants and units.
+func (c *Calculator) suggest(text string) ([]prompt.Suggest, string) {
+	var word string
+	var suggestions []prompt.Suggest
+	if strings.HasPrefix(strings.TrimLeftFunc(text, unicode.IsSpace), ".") {
+		args := strings.Fields(text)
+		if unicode.IsSpace(rune(text[len(text)-1])) {
+			args = append(args, "")
+		}
+
+		word = args[len(args)-1]
+		suggestions = completeMetaCommand(args)
+	} else {
+		i := strings.LastIndexFunc(text, func(r rune) bool {
+			return !isWordRune(r)
+		})
+		word = text
+		if i >= 0 {
+			// The delimiter may be a multibyte operator, such as √ or ×
+			_, size := utf8.DecodeRuneInString(text[i:])
+			word = text[i+size:]
+			if text[i] == '$' {
+				word = text[i:]
+			}
+		}
+		if word == "" {
+			return nil, ""
+		}
+		suggestions = c.completeIdent()
+	}
+
+	return prompt.FilterHasPrefix(suggestions, word, true), word
+}
+
+// isWordRune reports whether r may appear in an identifier being completed.
+func isWordRune(r rune) bool {
+	return lexer.IsAlnum(r) || r == '°'
+}
+
+// completeMetaCommand suggests completions for the last of args, which are
+// the words of a meta-command line so far.
+func completeMetaCommand(args []string) []prompt.Suggest {
+	if len(args) == 1 {
+		return suggestNames(metaCommands, func(string) string { return "" })
+	}
+
+	cmd, ok := uniquePrefix(args[0], metaCommands)
+	if !ok {
+		return nil
+	}
+
+	switch {
+	case cmd == ".set" && len(args) == 2:
+		return suggestSettings(func(*SettingDescriptor) bool { return true })
+
+	case cmd == ".set" && len(args) == 3:
+		setting, err := findByPrefix(args[1], settingsRegistry)
+		if err != nil {
+			return nil
+		}
+		switch setting.Type {
+		case SettingTypeBool:
+			return []prompt.Suggest{{Text: "on"}, {Text: "off"}}
+		case SettingTypeString:
+			suggestions := make([]prompt.Suggest, 0, len(setting.Choices))
+			for _, choice := range setting.Choices {
+				suggestions = append(suggestions, prompt.Suggest{Text: choice})
+			}
+			return suggestions
+		}
+
+	case cmd == ".toggle" && len(args) == 2:
+		return suggestSettings(func(s *SettingDescriptor) bool { return s.Type == SettingTypeBool })
+
+	case cmd == ".show" && len(args) == 2:
+		return []prompt.Suggest{{Text: "cf", Description: "continued fraction"}}
+	}
+	return nil
+}
+
+// suggestSettings suggests the names of the settings that match keep.
+func suggestSettings(keep func(*SettingDescriptor) bool) []prompt.Suggest {
+	settings := map[string]*SettingDescriptor{}
+	for name, setting := range settingsRegistry {
+		if keep(setting) {
+			settings[name] = setting
+		}
+	}
+	return suggestNames(settings, func(name string) string {
+		return settings[name].Description
+	})
+}
+
+// suggestNames suggests the keys of items in sorted order.
+func suggestNames[T any](items map[string]T, describe func(string) string) []prompt.Suggest {
+	names := make([]string, 0, len(items))
+	for name := range items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	suggestions := make([]prompt.Suggest, 0, len(names))
+	for _, name := range names {
+		suggestions = append(suggestions, prompt.Suggest{Text: name, Description: describe(name)})
+	}
+	return suggestions
+}
+
+// uniquePrefix returns the only name in items that prefix abbreviates, as
+// findByPrefix would resolve it.
+func uniquePrefix[T any](prefix string, items map[string]T) (string, bool) {
+	var match string
+	for name := range items {
+		if strings.HasPrefix(strings.ToLower(name), strings.ToLower(prefix)) {
+			if match != "" {
+				return "", false
+			}
+			match = name
+		}
+	}
+	return match, match != ""
+}
+
+// completeIdent suggests every name an identifier can refer to.
+func (c *Calculator) completeIdent() []prompt.Suggest {
+	var suggestions []prompt.Suggest
+	for _, name := range parser.FunctionNames() {
+		desc, _ := parser.FunctionDescription(name)
+		suggestions = append(suggestions, prompt.Suggest{Text: name, Description: desc})
+	}
+
+	if c.env == nil {
+		c.env = parser.NewEnv()
+	}
+	for _, def := range c.env.Functions() {
+		name, _, _ := strings.Cut(def, "(")
+		suggestions = append(suggestions, prompt.Suggest{Text: name, Description: def})
+	}
+	for _, name := range c.env.Names() {
+		suggestions = append(suggestions, prompt.Suggest{Text: name, Description: "variable"})
+	}
+
+	for _, name := range units.Names() {
+		suggestions = append(suggestions, prompt.Suggest{Text: name, Description: "unit"})
+	}
+	suggestions = append(suggestions, prompt.Suggest{Text: parser.ConvertKeyword, Description: "convert to a unit"})
+	return suggestions
+}
+
+// Colors used to highlight REPL input.
+const (
+	colorMeta     = prompt.Purple
+	colorNumber   = prompt.Turquoise
+	colorString   = prompt.Brown
+	colorFunction = prompt.Green
+	colorKeyword  = prompt.Purple
+	colorIllegal  = prompt.Red
+)
+
+// highlight splits line into colored tokens for the REPL. Meta-commands have
+// only their name highlighted. Expressions are colored by the tokens the
+// lexer finds, and anything from the first illegal token onwards is marked
+// as an error.
+func (c *Calculator) highlight(line string) []prompt.Token {
+	if trimmed := strings.TrimLeftFunc(line, unicode.IsSpace); strings.HasPrefix(trimmed, ".") {
+		first := len(line) - len(trimmed)
+		last := first + strings.IndexFunc(trimmed+" ", unicode.IsSpace) - 1
+		return []prompt.Token{newToken(first, last, colorMeta)}
+	}
+
+	var toks []prompt.Token
+	l := lexer.New("(input)", line)
+	for tok := range l.Tokens() {
+		first := tok.Pos.Column - 1
+		last := first + len(tok.Value) - 1
+
+		switch tok.Type {
+		case tokens.ILLEGAL:
+			if first < len(line) {
+				toks = append(toks, newToken(first, len(line)-1, colorIllegal))
+			}
+		case tokens.LIT_INT, tokens.LIT_FLOAT, tokens.LIT_DEGREE, tokens.LIT_IMAG:
+			toks = append(toks, newToken(first, last, colorNumber))
+		case tokens.LIT_STRING, tokens.COMMENT:
+			toks = append(toks, newToken(first, last, colorString))
+		case tokens.IDENT:
+			if color, ok := c.identColor(tok.Value); ok {
+				toks = append(toks, newToken(first, last, color))
+			}
+		}
+	}
+	return toks
+}
+
+// identColor returns the color of an identifier, if it has one.
+func (c *Calculator) identColor(name string) (prompt.Color, bool) {
+	if name == parser.ConvertKeyword {
+		return colorKeyword, true
+	}
+	if _, ok := parser.FunctionDescription(name); ok {
+		return colorFunction, true
+	}
+	if c.env != nil {
+		for _, def := range c.env.Functions() {
+			if strings.HasPrefix(def, name+"(") {
+				return colorFunction, true
+			}
+		}
+	}
+	return prompt.DefaultColor, false
+}
+
+func newToken(first, last int, color prompt.Color) prompt.Token {
+	return prompt.NewSimpleToken(istrings.ByteNumber(first), istrings.ByteNumber(last), prompt.SimpleTokenWithColor(color))
+}
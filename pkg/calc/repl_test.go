@@ -0,0 +1,178 @@
+package calc
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/elk-language/go-prompt"
+	istrings "github.com/elk-language/go-prompt/strings"
+)
+
+func TestSuggest(t *testing.T) {
+	t.Parallel()
+
+	c := &Calculator{}
+	if _, err := c.Evaluate("speed = 3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Evaluate("sq(x) = x * x"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		text     string
+		wantWord string
+		want     []string
+	}{
+		{".", ".", []string{".help", ".load", ".save", ".set", ".show", ".source", ".toggle"}},
+		{".s", ".s", []string{".save", ".set", ".show", ".source"}},
+		{".set d", "d", []string{"decimal_places", "display"}},
+		{".se n", "n", []string{"notation"}},
+		{".set notation ", "", []string{"fixed", "sci", "eng", "auto"}},
+		{".set verbose o", "o", []string{"on", "off"}},
+		{".toggle ", "", []string{"int_unsigned", "keep_trailing_zeros", "strict", "trace", "underscore_zeros", "verbose"}},
+		{".show ", "", []string{"cf"}},
+		{".help ", "", nil},
+		{"1 + ", "", nil},
+		{"1 + sp", "sp", []string{"speed"}},
+		{"sq", "sq", []string{"SQRT2", "sq", "sqrt"}},
+		{"2 * P", "P", []string{"PHI", "PI", "Pa", "psi"}},
+		{"72 °F to °", "°", []string{"°C", "°F"}},
+		{"1 + $", "$", nil},
+		{"√sq", "sq", []string{"SQRT2", "sq", "sqrt"}},
+		{"2×sq", "sq", []string{"SQRT2", "sq", "sqrt"}},
+		{"2 ÷ sp", "sp", []string{"speed"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.text, func(t *testing.T) {
+			t.Parallel()
+
+			suggestions, word := c.suggest(tt.text)
+			if word != tt.wantWord {
+				t.Errorf("word = %q, want %q", word, tt.wantWord)
+			}
+
+			var got []string
+			for _, s := range suggestions {
+				got = append(got, s.Text)
+			}
+			slices.Sort(got)
+			want := slices.Clone(tt.want)
+			slices.Sort(want)
+			if !slices.Equal(got, want) {
+				t.Errorf("suggest(%q) = %v, want %v", tt.text, got, want)
+			}
+		})
+	}
+}
+
+func TestCompleteRange(t *testing.T) {
+	t.Parallel()
+
+	c := &Calculator{}
+	for _, text := range []string{"sq", "√sq", "2×sq", "1 + sq"} {
+		b := prompt.NewBuffer()
+		b.InsertTextMoveCursor(text, 80, 24, false)
+
+		_, start, end := c.complete(*b.Document())
+		if n := utf8.RuneCountInString(text); end != istrings.RuneNumber(n) || start != istrings.RuneNumber(n-2) {
+			t.Errorf("complete(%q) replaces runes [%d, %d), want [%d, %d)", text, start, end, n-2, n)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	t.Parallel()
+
+	c := &Calculator{}
+	if _, err := c.Evaluate("sq(x) = x * x"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"1 + 2.5e3", "1:Turquoise 2.5e3:Turquoise"},
+		{"3 - 4i", "3:Turquoise 4i:Turquoise"},
+		{"sqrt(x) + y", "sqrt:Green"},
+		{"sqrt(x) + sq(y)", "sqrt:Green sq:Green"},
+		{"72 °F to °C", "72:Turquoise to:Purple"},
+		{"1 + @ 2", "1:Turquoise @ 2:Red"},
+		{"1 # one", "1:Turquoise # one:Brown"},
+		{`"hi"`, `"hi":Brown`},
+		{"  .set base 16", ".set:Purple"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.line, func(t *testing.T) {
+			t.Parallel()
+
+			var got []string
+			for _, tok := range c.highlight(tt.line) {
+				text := tt.line[tok.FirstByteIndex() : tok.LastByteIndex()+1]
+				got = append(got, text+":"+colorName(tok.Color()))
+			}
+			if s := strings.Join(got, " "); s != tt.want {
+				t.Errorf("highlight(%q) = %s, want %s", tt.line, s, tt.want)
+			}
+		})
+	}
+}
+
+func colorName(color prompt.Color) string {
+	switch color {
+	case prompt.Turquoise:
+		return "Turquoise"
+	case prompt.Green:
+		return "Green"
+	case prompt.Purple:
+		return "Purple"
+	case prompt.Brown:
+		return "Brown"
+	case prompt.Red:
+		return "Red"
+	}
+	return strconv.Itoa(int(color))
+}
+
+func TestHistoryRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "history")
+
+	got, err := loadHistory(path)
+	if err != nil || got != nil {
+		t.Fatalf("loadHistory(missing) = %v, %v, want empty history", got, err)
+	}
+
+	c := &Calculator{historyPath: path}
+	for i := range maxHistory + 2 {
+		c.appendHistory(strconv.Itoa(i))
+	}
+	c.appendHistory("   ")
+
+	got, err = loadHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != maxHistory || got[0] != "2" || got[len(got)-1] != strconv.Itoa(maxHistory+1) {
+		t.Errorf("loadHistory kept %d lines from %q to %q, want the last %d", len(got), got[0], got[len(got)-1], maxHistory)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("history file mode = %v, want 0600", perm)
+	}
+}
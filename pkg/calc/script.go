@@ -0,0 +1,205 @@
+package calc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ripta/rt/pkg/calc/lexer"
+	"github.com/ripta/rt/pkg/calc/parser"
+	"github.com/ripta/rt/pkg/calc/tokens"
+)
+
+// ErrSourceCycle is returned when a script sources itself, directly or
+// through other scripts.
+var ErrSourceCycle = errors.New("source cycle")
+
+// RunScript runs the script at path, displaying the result of each
+// statement in it.
+//
+// Statements are separated by newlines or semicolons. A statement continues
+// onto the next line while it has unclosed parentheses or brackets, or ends
+// with an operator or comma. Text from # to the end of a line is a comment,
+// and lines starting with . are meta-commands, where .source runs another
+// script relative to the directory of the current one.
+//
+// Errors are reported with the file, line and column at which they occur.
+// In Strict mode, the first error stops the script and is returned;
+// otherwise the script continues with the next statement.
+func (c *Calculator) RunScript(path string) error {
+	if len(c.sources) > 0 && !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(c.sources[len(c.sources)-1]), path)
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if i := slices.Index(c.sources, abs); i >= 0 {
+		cycle := append(slices.Clone(c.sources[i:]), abs)
+		return fmt.Errorf("%w: %s", ErrSourceCycle, strings.Join(cycle, " -> "))
+	}
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read script: %w", err)
+	}
+
+	c.sources = append(c.sources, abs)
+	defer func() {
+		c.sources = c.sources[:len(c.sources)-1]
+	}()
+	return c.runScript(path, string(src))
+}
+
+// handleSource runs the script named by args
+func (c *Calculator) handleSource(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: usage: .source <path>", ErrInvalidMetaCommand)
+	}
+	return c.RunScript(strings.Join(args, " "))
+}
+
+// runScript runs the statements in src, which was read from the script
+// name.
+func (c *Calculator) runScript(name, src string) error {
+	lines := strings.Split(src, "\n")
+
+	var stmt strings.Builder
+	start := 0
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+
+		if stmt.Len() == 0 {
+			trimmed := strings.TrimSpace(line)
+			if blank(trimmed) {
+				continue
+			}
+			if strings.HasPrefix(trimmed, ".") {
+				if err := c.scriptError(name, i+1, c.handleMetaCommand(trimmed)); err != nil {
+					return err
+				}
+				continue
+			}
+			start = i + 1
+		} else {
+			stmt.WriteString("\n")
+		}
+
+		stmt.WriteString(line)
+		if i < len(lines)-1 && incomplete(stmt.String()) {
+			continue
+		}
+
+		err := c.runStatement(name, start, stmt.String())
+		stmt.Reset()
+		if err := c.scriptError(name, start, err); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runStatement evaluates src, which starts on the given line of the script
+// name, and displays its result.
+func (c *Calculator) runStatement(name string, line int, src string) error {
+	defer func() {
+		c.count++
+	}()
+
+	ctx, cancel := c.bounded()
+	defer cancel()
+
+	node, err := parser.NewAt(name, src, line).Parse()
+	if err != nil {
+		return err
+	}
+
+	c.prepareEnv()
+	res, err := c.env.EvalContext(ctx, node)
+	if err != nil {
+		return err
+	}
+	if res != nil {
+		c.last = res
+	}
+
+	return c.display(ctx, res)
+}
+
+// scriptError reports err, which occurred at the given line of the script
+// name, and returns it if the script should stop.
+func (c *Calculator) scriptError(name string, line int, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var perr *parser.PositionError
+	if !errors.As(err, &perr) {
+		err = fmt.Errorf("%s:%d: %w", name, line, err)
+	}
+	if c.Strict {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	return nil
+}
+
+// blank reports whether src holds no statement, only whitespace, comments
+// and semicolons.
+func blank(src string) bool {
+	for tok := range lexer.New("", src).Tokens() {
+		switch tok.Type {
+		case tokens.WHITESPACE, tokens.COMMENT, tokens.SEMICOLON, tokens.EOF:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// continuedTypes are the tokens that cannot end a statement, so that a line
+// ending in one continues onto the next.
+var continuedTypes = []tokens.TokenType{
+	tokens.ASSIGN,
+	tokens.COMMA,
+	tokens.QUESTION,
+	tokens.COLON,
+	tokens.LPAREN,
+	tokens.LBRACKET,
+}
+
+// incomplete reports whether src is a statement that continues onto the
+// next line, because it has unclosed parentheses or brackets, or ends with
+// an operator.
+func incomplete(src string) bool {
+	depth := 0
+	illegal := false
+	var last tokens.Token
+	for tok := range lexer.New("", src).Tokens() {
+		switch tok.Type {
+		case tokens.WHITESPACE, tokens.COMMENT, tokens.EOF:
+			continue
+		case tokens.ILLEGAL:
+			illegal = true
+		case tokens.LPAREN, tokens.LBRACKET:
+			depth++
+		case tokens.RPAREN, tokens.RBRACKET:
+			depth--
+		}
+		last = tok
+	}
+
+	if illegal {
+		return false
+	}
+	// A trailing ! is a factorial rather than a logical not awaiting its
+	// operand
+	isOperator := last.Type >= tokens.OP_PLUS && last.Type < tokens.OP_NOT
+	return depth > 0 || isOperator || slices.Contains(continuedTypes, last.Type)
+}
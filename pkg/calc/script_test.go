@@ -0,0 +1,247 @@
+package calc
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeScripts writes each of files into a new directory, returning the
+// directory.
+func writeScripts(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRunScript(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name: "statements",
+			files: map[string]string{
+				"main.calc": "# setup\n\na = 2; b = 3\na * b # product\n",
+			},
+			want: "3\n6\n",
+		},
+		{
+			name: "multi-line statements",
+			files: map[string]string{
+				"main.calc": "hyp(a, b) =\n  √(a*a +\n    b*b)\nhyp(\n  3,\n  4\n)\n[1,\n 2] *\n 2\n",
+			},
+			want: "5\n[2, 4]\n",
+		},
+		{
+			name: "meta-commands",
+			files: map[string]string{
+				"main.calc": ".set display rational\n1/4\n",
+			},
+			want: "display set to rational\n1/4\n",
+		},
+		{
+			name: "source relative to the script",
+			files: map[string]string{
+				"main.calc":     ".source lib/defs.calc\nsq(x0)\n",
+				"lib/defs.calc": "sq(x) = x * x\n.source more.calc\n",
+				"lib/more.calc": "x0 = 7\n",
+			},
+			want: "7\n49\n",
+		},
+		{
+			name: "errors do not stop the script",
+			files: map[string]string{
+				"main.calc": "1 +\n  nosuch\n2\n",
+			},
+			want: "2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := writeScripts(t, tt.files)
+
+			var buf bytes.Buffer
+			c := &Calculator{DecimalPlaces: 5, out: &buf}
+			if err := c.RunScript(filepath.Join(dir, "main.calc")); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunScriptStrict(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name: "position of a later line",
+			files: map[string]string{
+				"main.calc": "1\n\nx = 1 +\n  nosuch\n2\n",
+			},
+			wantErr: "main.calc:4:3: undefined identifier",
+		},
+		{
+			name: "position after a separator",
+			files: map[string]string{
+				"main.calc": "1; 1 / 0\n",
+			},
+			wantErr: "main.calc:1:6: division by zero",
+		},
+		{
+			name: "position in a sourced script",
+			files: map[string]string{
+				"main.calc": "# lib\n.source lib.calc\n",
+				"lib.calc":  "\n\n)\n",
+			},
+			wantErr: "lib.calc:3:1: unexpected token RPAREN",
+		},
+		{
+			name: "meta-command",
+			files: map[string]string{
+				"main.calc": "1\n.set nosuch 1\n",
+			},
+			wantErr: "main.calc:2: prefix not found",
+		},
+		{
+			name: "missing source",
+			files: map[string]string{
+				"main.calc": ".source nosuch.calc\n",
+			},
+			wantErr: "main.calc:1: failed to read script",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := writeScripts(t, tt.files)
+
+			var buf bytes.Buffer
+			c := &Calculator{DecimalPlaces: 5, Strict: true, out: &buf}
+			err := c.RunScript(filepath.Join(dir, "main.calc"))
+			if err == nil {
+				t.Fatalf("expected error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error mismatch: got %v want substring %q", err, tt.wantErr)
+			}
+			if strings.Contains(buf.String(), "2\n") {
+				t.Errorf("script continued after the error: %q", buf.String())
+			}
+		})
+	}
+}
+
+func TestRunScriptSourceCycle(t *testing.T) {
+	t.Parallel()
+
+	dir := writeScripts(t, map[string]string{
+		"a.calc": ".source b.calc\n",
+		"b.calc": "1\n.source a.calc\n",
+	})
+
+	var buf bytes.Buffer
+	c := &Calculator{DecimalPlaces: 5, Strict: true, out: &buf}
+	err := c.RunScript(filepath.Join(dir, "a.calc"))
+	if !errors.Is(err, ErrSourceCycle) {
+		t.Fatalf("got error %v, want ErrSourceCycle", err)
+	}
+	if !strings.Contains(err.Error(), "a.calc -> "+filepath.Join(dir, "b.calc")+" -> "+filepath.Join(dir, "a.calc")) {
+		t.Errorf("error %q does not show the cycle", err)
+	}
+	if len(c.sources) != 0 {
+		t.Errorf("sources = %v after the script, want none", c.sources)
+	}
+
+	// Sourcing the same script twice in a row is not a cycle
+	dir = writeScripts(t, map[string]string{
+		"a.calc": ".source b.calc\n.source b.calc\n",
+		"b.calc": "1\n",
+	})
+	if err := c.RunScript(filepath.Join(dir, "a.calc")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestBlank(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{src: "", want: true},
+		{src: "   ", want: true},
+		{src: "# comment", want: true},
+		{src: "; # comment", want: true},
+		{src: "1 # comment", want: false},
+		{src: ".help", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := blank(tt.src); got != tt.want {
+			t.Errorf("blank(%q) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestIncomplete(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{src: "1 + 2", want: false},
+		{src: "1 +", want: true},
+		{src: "x =", want: true},
+		{src: "f(1,", want: true},
+		{src: "[[1, 2],", want: true},
+		{src: "a ? b :", want: true},
+		{src: "(1 + 2) # comment", want: false},
+		{src: "1 + # comment", want: true},
+		{src: "1;", want: false},
+		{src: "5!", want: false},
+		{src: "(1 @", want: false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.src, func(t *testing.T) {
+			t.Parallel()
+			if got := incomplete(tt.src); got != tt.want {
+				t.Errorf("incomplete(%q) = %v, want %v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,11 @@ package calc
 
 import (
 	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ripta/rt/pkg/calc/parser"
 )
 
 // SettingType represents the data type of a setting
@@ -10,21 +15,58 @@ type SettingType int
 const (
 	SettingTypeBool SettingType = iota
 	SettingTypeInt
+	SettingTypeString
 )
 
 // SettingDescriptor contains all metadata for a setting
 type SettingDescriptor struct {
-	Type        SettingType // bool or int
+	Type        SettingType // bool, int or string
 	Description string      // Help text
 
 	// Type-safe accessors using closures
-	GetBool func(*Calculator) bool
-	SetBool func(*Calculator, bool)
-	GetInt  func(*Calculator) int
-	SetInt  func(*Calculator, int)
+	GetBool   func(*Calculator) bool
+	SetBool   func(*Calculator, bool)
+	GetInt    func(*Calculator) int
+	SetInt    func(*Calculator, int)
+	GetString func(*Calculator) string
+	SetString func(*Calculator, string)
 
 	// Optional validation for int types
 	ValidateInt func(int) error
+
+	// Choices lists the values a string setting accepts
+	Choices []string
+}
+
+// validateChoice checks that v is one of the values string setting name
+// accepts.
+func (s *SettingDescriptor) validateChoice(name, v string) error {
+	if !slices.Contains(s.Choices, v) {
+		return fmt.Errorf("%s must be one of %s", name, strings.Join(s.Choices, ", "))
+	}
+	return nil
+}
+
+// Display modes for numbers that are known to be exactly rational. Other
+// numbers are always displayed in decimal.
+const (
+	DisplayDecimal  = "decimal"
+	DisplayRational = "rational"
+	DisplayMixed    = "mixed"
+)
+
+var displayModes = []string{DisplayDecimal, DisplayRational, DisplayMixed}
+
+// maxIntWidth is the widest fixed integer width that can be emulated.
+const maxIntWidth = 4096
+
+// defaultLimits bound the work done for each expression, so that a stray
+// input such as 2**2**2**30 is refused, and one such as factorial(10**7)
+// stopped, rather than run without end.
+var defaultLimits = parser.Limits{
+	MaxDecimalPlaces: 10000,
+	MaxExponent:      100000,
+	Timeout:          10 * time.Second,
 }
 
 // settingsRegistry is the single source of truth for all settings
@@ -47,6 +89,64 @@ var settingsRegistry = map[string]*SettingDescriptor{
 			return nil
 		},
 	},
+	"base": {
+		Type:        SettingTypeInt,
+		Description: "Radix in which results are displayed (integer, 2-36)",
+		GetInt:      func(c *Calculator) int { return c.Base },
+		SetInt:      func(c *Calculator, v int) { c.Base = v },
+		ValidateInt: validateBase,
+	},
+	"display": {
+		Type:        SettingTypeString,
+		Description: "Display exact rationals as decimal, rational (355/113) or mixed (3 16/113)",
+		GetString:   func(c *Calculator) string { return c.Display },
+		SetString:   func(c *Calculator, v string) { c.Display = v },
+		Choices:     displayModes,
+	},
+	"notation": {
+		Type:        SettingTypeString,
+		Description: "Display decimals in fixed, sci (6.022e23), eng (602.2e21) or auto notation",
+		GetString:   func(c *Calculator) string { return c.Notation },
+		SetString:   func(c *Calculator, v string) { c.Notation = v },
+		Choices:     notations,
+	},
+	"sig_figs": {
+		Type:        SettingTypeInt,
+		Description: "Round results to this many significant figures, 0 to disable (integer)",
+		GetInt:      func(c *Calculator) int { return c.SigFigs },
+		SetInt:      func(c *Calculator, v int) { c.SigFigs = v },
+		ValidateInt: func(v int) error {
+			if v < 0 || v > maxSigFigs {
+				return fmt.Errorf("sig_figs must be between 0 and %d", maxSigFigs)
+			}
+			return nil
+		},
+	},
+	"complex": {
+		Type:        SettingTypeString,
+		Description: "Display complex numbers in rect (3 + 4i), polar (5 ∠ 0.9273) or polar_deg (5 ∠ 53.13°) form",
+		GetString:   func(c *Calculator) string { return c.ComplexForm },
+		SetString:   func(c *Calculator, v string) { c.ComplexForm = v },
+		Choices:     complexForms,
+	},
+	"int_width": {
+		Type:        SettingTypeInt,
+		Description: "Wrap integer results to this many bits, 0 to disable (integer)",
+		GetInt:      func(c *Calculator) int { return c.IntWidth },
+		SetInt:      func(c *Calculator, v int) { c.IntWidth = v },
+		ValidateInt: func(v int) error {
+			if v < 0 || v > maxIntWidth {
+				return fmt.Errorf("int_width must be between 0 and %d", maxIntWidth)
+			}
+			return nil
+		},
+	},
+	"int_unsigned": {
+		Type:        SettingTypeBool,
+		Description: "Wrap integer results as unsigned rather than two's complement (on/off)",
+		GetBool:     func(c *Calculator) bool { return c.IntUnsigned },
+		SetBool:     func(c *Calculator, v bool) { c.IntUnsigned = v },
+	},
 	"keep_trailing_zeros": {
 		Type:        SettingTypeBool,
 		Description: "Keep trailing zeros in output (on/off)",
@@ -59,6 +159,48 @@ var settingsRegistry = map[string]*SettingDescriptor{
 		GetBool:     func(c *Calculator) bool { return c.UnderscoreZeros },
 		SetBool:     func(c *Calculator, v bool) { c.UnderscoreZeros = v },
 	},
+	"max_decimal_places": {
+		Type:        SettingTypeInt,
+		Description: "Refuse to compute results to more decimal places than this, 0 for no limit (integer)",
+		GetInt:      func(c *Calculator) int { return c.Limits.MaxDecimalPlaces },
+		SetInt:      func(c *Calculator, v int) { c.Limits.MaxDecimalPlaces = v },
+		ValidateInt: func(v int) error {
+			if v < 0 {
+				return fmt.Errorf("max_decimal_places must be non-negative")
+			}
+			return nil
+		},
+	},
+	"max_exponent": {
+		Type:        SettingTypeInt,
+		Description: "Refuse integer exponents larger than this in magnitude, 0 for no limit (integer)",
+		GetInt:      func(c *Calculator) int { return int(c.Limits.MaxExponent) },
+		SetInt:      func(c *Calculator, v int) { c.Limits.MaxExponent = int64(v) },
+		ValidateInt: func(v int) error {
+			if v < 0 {
+				return fmt.Errorf("max_exponent must be non-negative")
+			}
+			return nil
+		},
+	},
+	"timeout_ms": {
+		Type:        SettingTypeInt,
+		Description: "Stop each evaluation after this many milliseconds, 0 for no limit (integer)",
+		GetInt:      func(c *Calculator) int { return int(c.Limits.Timeout / time.Millisecond) },
+		SetInt:      func(c *Calculator, v int) { c.Limits.Timeout = time.Duration(v) * time.Millisecond },
+		ValidateInt: func(v int) error {
+			if v < 0 {
+				return fmt.Errorf("timeout_ms must be non-negative")
+			}
+			return nil
+		},
+	},
+	"strict": {
+		Type:        SettingTypeBool,
+		Description: "Stop scripts at the first error (on/off)",
+		GetBool:     func(c *Calculator) bool { return c.Strict },
+		SetBool:     func(c *Calculator, v bool) { c.Strict = v },
+	},
 	"verbose": {
 		Type:        SettingTypeBool,
 		Description: "Enable verbose output (on/off)",
@@ -66,3 +208,29 @@ var settingsRegistry = map[string]*SettingDescriptor{
 		SetBool:     func(c *Calculator, v bool) { c.Verbose = v },
 	},
 }
+
+// validateDisplay checks that v is a display mode.
+func validateDisplay(v string) error {
+	return settingsRegistry["display"].validateChoice("display", v)
+}
+
+// validateNotation checks that v is a notation.
+func validateNotation(v string) error {
+	return settingsRegistry["notation"].validateChoice("notation", v)
+}
+
+// validateBase checks that v is a radix that results can be displayed in.
+func validateBase(v int) error {
+	if v < 2 || v > 36 {
+		return fmt.Errorf("base must be between 2 and 36")
+	}
+	return nil
+}
+
+// validateLimits checks that none of the limits is negative.
+func validateLimits(l parser.Limits) error {
+	if l.MaxDecimalPlaces < 0 || l.MaxExponent < 0 || l.Timeout < 0 {
+		return fmt.Errorf("limits must be non-negative")
+	}
+	return nil
+}
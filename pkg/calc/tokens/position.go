@@ -3,9 +3,9 @@ package tokens
 import "fmt"
 
 type Position struct {
-	File   string
-	Line   int
-	Column int
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
 }
 
 func (p Position) IsZero() bool {
@@ -38,6 +38,7 @@ const (
 	LIT_INT    // Integer literal
 	LIT_FLOAT  // Float literal
 	LIT_DEGREE // Degree literal
+	LIT_IMAG   // Imaginary literal
 	LIT_STRING // String literal
 
 	OP_PLUS    // Infix addition (+)
@@ -49,9 +50,30 @@ const (
 	OP_SHL     // Left shift (<<)
 	OP_SHR     // Right shift (>>)
 	OP_POW     // Exponentiation (**)
+	OP_BITAND  // Bitwise and (&)
+	OP_BITOR   // Bitwise or (|)
+	OP_BITXOR  // Bitwise exclusive or (^)
+	OP_BITNOT  // Bitwise complement (~)
+	OP_EQ      // Equal to (==)
+	OP_NE      // Not equal to (!=)
+	OP_LT      // Less than (<)
+	OP_LE      // Less than or equal to (<=)
+	OP_GT      // Greater than (>)
+	OP_GE      // Greater than or equal to (>=)
+	OP_AND     // Logical and (&&)
+	OP_OR      // Logical or (||)
+	OP_NOT     // Logical not (!)
 
-	LPAREN // (
-	RPAREN // )
+	LPAREN    // (
+	RPAREN    // )
+	LBRACKET  // [
+	RBRACKET  // ]
+	COMMA     // ,
+	SEMICOLON // ;
+	QUESTION  // ?
+	COLON     // :
+
+	COMMENT // # to the end of the line
 )
 
 var tokenNames = map[TokenType]string{
@@ -65,6 +87,7 @@ var tokenNames = map[TokenType]string{
 	LIT_INT:    "LIT_INT",
 	LIT_FLOAT:  "LIT_FLOAT",
 	LIT_DEGREE: "LIT_DEGREE",
+	LIT_IMAG:   "LIT_IMAG",
 	LIT_STRING: "LIT_STRING",
 
 	OP_PLUS:    "OP_PLUS",
@@ -76,9 +99,30 @@ var tokenNames = map[TokenType]string{
 	OP_SHL:     "OP_SHL",
 	OP_SHR:     "OP_SHR",
 	OP_POW:     "OP_POW",
+	OP_BITAND:  "OP_BITAND",
+	OP_BITOR:   "OP_BITOR",
+	OP_BITXOR:  "OP_BITXOR",
+	OP_BITNOT:  "OP_BITNOT",
+	OP_EQ:      "OP_EQ",
+	OP_NE:      "OP_NE",
+	OP_LT:      "OP_LT",
+	OP_LE:      "OP_LE",
+	OP_GT:      "OP_GT",
+	OP_GE:      "OP_GE",
+	OP_AND:     "OP_AND",
+	OP_OR:      "OP_OR",
+	OP_NOT:     "OP_NOT",
+
+	LPAREN:    "LPAREN",
+	RPAREN:    "RPAREN",
+	LBRACKET:  "LBRACKET",
+	RBRACKET:  "RBRACKET",
+	COMMA:     "COMMA",
+	SEMICOLON: "SEMICOLON",
+	QUESTION:  "QUESTION",
+	COLON:     "COLON",
 
-	LPAREN: "LPAREN",
-	RPAREN: "RPAREN",
+	COMMENT: "COMMENT",
 }
 
 func (t TokenType) String() string {
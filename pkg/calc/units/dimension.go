@@ -0,0 +1,113 @@
+package units
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Base is one of the base dimensions that every unit is expressed in.
+type Base int
+
+const (
+	Mass Base = iota
+	Length
+	Time
+	Current
+	Temperature
+	Amount
+	Luminosity
+	Information
+
+	numBases
+)
+
+// baseSymbols are the symbols of the base unit of each dimension, in the
+// order they are rendered.
+var baseSymbols = [numBases]string{
+	Mass:        "kg",
+	Length:      "m",
+	Time:        "s",
+	Current:     "A",
+	Temperature: "K",
+	Amount:      "mol",
+	Luminosity:  "cd",
+	Information: "B",
+}
+
+// Dimension is the exponent of each base dimension in a quantity, e.g.
+// velocity is Length¹Time⁻¹. The zero value is dimensionless.
+type Dimension [numBases]int
+
+// Of returns the dimension consisting of a single base dimension.
+func Of(b Base) Dimension {
+	var d Dimension
+	d[b] = 1
+	return d
+}
+
+// IsZero reports whether d is dimensionless.
+func (d Dimension) IsZero() bool {
+	return d == Dimension{}
+}
+
+// Mul returns the dimension of the product of quantities of dimension d and o.
+func (d Dimension) Mul(o Dimension) Dimension {
+	for i := range d {
+		d[i] += o[i]
+	}
+	return d
+}
+
+// Div returns the dimension of the quotient of quantities of dimension d and o.
+func (d Dimension) Div(o Dimension) Dimension {
+	for i := range d {
+		d[i] -= o[i]
+	}
+	return d
+}
+
+// Pow returns the dimension of a quantity of dimension d raised to num/den.
+// It returns false if any exponent would become fractional.
+func (d Dimension) Pow(num, den int) (Dimension, bool) {
+	if den == 0 {
+		return d, false
+	}
+
+	for i := range d {
+		e := d[i] * num
+		if e%den != 0 {
+			return d, false
+		}
+		d[i] = e / den
+	}
+	return d, true
+}
+
+// String renders d in base units, e.g. "kg*m/s**2". Dimensionless renders as
+// the empty string.
+func (d Dimension) String() string {
+	var num, den []string
+	for i, sym := range baseSymbols {
+		switch e := d[i]; {
+		case e == 1:
+			num = append(num, sym)
+		case e > 1:
+			num = append(num, fmt.Sprintf("%s**%d", sym, e))
+		case e == -1:
+			den = append(den, sym)
+		case e < -1:
+			den = append(den, fmt.Sprintf("%s**%d", sym, -e))
+		}
+	}
+
+	switch {
+	case len(num) == 0 && len(den) == 0:
+		return ""
+	case len(den) == 0:
+		return strings.Join(num, "*")
+	case len(num) == 0:
+		num = []string{"1"}
+	}
+
+	return strings.Join(num, "*") + "/" + strings.Join(den, "/")
+}
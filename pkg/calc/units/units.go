@@ -0,0 +1,421 @@
+// Package units defines physical units and the dimensions they measure, for
+// unit-aware arithmetic in calc. Quantities are kept in SI base units; a Unit
+// converts between its own magnitudes and base units.
+package units
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ripta/reals/pkg/constructive"
+	"github.com/ripta/reals/pkg/rational"
+	"github.com/ripta/reals/pkg/unified"
+)
+
+var ErrOffsetUnit = errors.New("unit with an offset cannot be combined")
+
+// Unit is a named unit of measure. A magnitude v in the unit corresponds to
+// (v + Offset) * Scale in base units of dimension Dim.
+type Unit struct {
+	Name  string
+	Dim   Dimension
+	Scale *unified.Real
+	// Rat is Scale as an exact rational, or nil if the scale is irrational,
+	// as it is for degrees.
+	Rat    *big.Rat
+	Offset *big.Rat // nil unless the unit has a shifted zero, e.g. °C
+
+	// factors are the named units that u is a product of, each with its
+	// exponent, in the order they first appeared. Name is rendered from
+	// them once they are combined.
+	factors []factor
+}
+
+// factor is a named unit raised to a non-zero integer power.
+type factor struct {
+	symbol string
+	exp    int
+}
+
+// ToBase converts a magnitude in u into base units.
+func (u *Unit) ToBase(v *unified.Real) *unified.Real {
+	if u.Offset != nil {
+		v = v.Add(newRat(u.Offset))
+	}
+	return v.Multiply(u.Scale)
+}
+
+// FromBase converts a magnitude in base units into u.
+func (u *Unit) FromBase(v *unified.Real) *unified.Real {
+	v = v.Divide(u.Scale)
+	if u.Offset != nil {
+		v = v.Subtract(newRat(u.Offset))
+	}
+	return v
+}
+
+// ToBaseRat is ToBase for exact rational magnitudes. It returns nil if v is
+// nil or the conversion is not rational.
+func (u *Unit) ToBaseRat(v *big.Rat) *big.Rat {
+	if v == nil || u.Rat == nil {
+		return nil
+	}
+
+	r := new(big.Rat).Set(v)
+	if u.Offset != nil {
+		r.Add(r, u.Offset)
+	}
+	return r.Mul(r, u.Rat)
+}
+
+// FromBaseRat is FromBase for exact rational magnitudes. It returns nil if v
+// is nil or the conversion is not rational.
+func (u *Unit) FromBaseRat(v *big.Rat) *big.Rat {
+	if v == nil || u.Rat == nil {
+		return nil
+	}
+
+	r := new(big.Rat).Quo(v, u.Rat)
+	if u.Offset != nil {
+		r.Sub(r, u.Offset)
+	}
+	return r
+}
+
+// Mul returns the product of units u and o, e.g. N*m. Like factors
+// combine, so that km*km is km**2.
+func (u *Unit) Mul(o *Unit) (*Unit, error) {
+	if u.Offset != nil || o.Offset != nil {
+		return nil, fmt.Errorf("%w: %s*%s", ErrOffsetUnit, u.Name, o.Name)
+	}
+
+	return combined(combine(u.terms(), o.terms(), 1), u.Dim.Mul(o.Dim), u.Scale.Multiply(o.Scale), ratOp((*big.Rat).Mul, u.Rat, o.Rat)), nil
+}
+
+// Div returns the quotient of units u and o, e.g. km/h. Like factors cancel,
+// so that km/h*h is km.
+func (u *Unit) Div(o *Unit) (*Unit, error) {
+	if u.Offset != nil || o.Offset != nil {
+		return nil, fmt.Errorf("%w: %s/%s", ErrOffsetUnit, u.Name, o.Name)
+	}
+
+	return combined(combine(u.terms(), o.terms(), -1), u.Dim.Div(o.Dim), u.Scale.Divide(o.Scale), ratOp((*big.Rat).Quo, u.Rat, o.Rat)), nil
+}
+
+// Pow returns u raised to the integer power n, e.g. m**2.
+func (u *Unit) Pow(n int) (*Unit, error) {
+	if u.Offset != nil {
+		return nil, fmt.Errorf("%w: %s**%d", ErrOffsetUnit, u.Name, n)
+	}
+
+	dim, _ := u.Dim.Pow(n, 1)
+	scale := newInt(1)
+	rat := big.NewRat(1, 1)
+	for i := 0; i < abs(n); i++ {
+		scale = scale.Multiply(u.Scale)
+		rat = ratOp((*big.Rat).Mul, rat, u.Rat)
+	}
+	if n < 0 {
+		scale = newInt(1).Divide(scale)
+		rat = ratOp((*big.Rat).Quo, big.NewRat(1, 1), rat)
+	}
+
+	var fs []factor
+	if n != 0 {
+		for _, f := range u.terms() {
+			fs = append(fs, factor{symbol: f.symbol, exp: f.exp * n})
+		}
+	}
+	return combined(fs, dim, scale, rat), nil
+}
+
+// terms returns the factors of u, which is a factor of its own when it was
+// not built from others.
+func (u *Unit) terms() []factor {
+	if u.factors == nil {
+		return []factor{{symbol: u.Name, exp: 1}}
+	}
+	return u.factors
+}
+
+// combine returns the factors of a multiplied by those of b, each raised to
+// the power sign, dropping any that cancel out.
+func combine(a, b []factor, sign int) []factor {
+	fs := slices.Clone(a)
+	for _, f := range b {
+		if i := slices.IndexFunc(fs, func(g factor) bool { return g.symbol == f.symbol }); i >= 0 {
+			fs[i].exp += sign * f.exp
+		} else {
+			fs = append(fs, factor{symbol: f.symbol, exp: sign * f.exp})
+		}
+	}
+	return slices.DeleteFunc(fs, func(f factor) bool { return f.exp == 0 })
+}
+
+// combined returns the unit made of factors fs, with its name rendered from
+// them.
+func combined(fs []factor, dim Dimension, scale *unified.Real, rat *big.Rat) *Unit {
+	if fs == nil {
+		fs = []factor{}
+	}
+	return &Unit{
+		Name:    render(fs),
+		Dim:     dim,
+		Scale:   scale,
+		Rat:     rat,
+		factors: fs,
+	}
+}
+
+// render names the product of fs, e.g. kg*m/s**2 or s/(N*m). A product of
+// inverses alone is written with negative exponents, as in s**-1.
+func render(fs []factor) string {
+	var num, den []string
+	for _, f := range fs {
+		if f.exp > 0 {
+			num = append(num, power(f.symbol, f.exp))
+		} else {
+			den = append(den, power(f.symbol, -f.exp))
+		}
+	}
+
+	switch {
+	case len(den) == 0:
+		return strings.Join(num, "*")
+	case len(num) == 0:
+		inv := make([]string, 0, len(fs))
+		for _, f := range fs {
+			inv = append(inv, power(f.symbol, f.exp))
+		}
+		return strings.Join(inv, "*")
+	}
+	return strings.Join(num, "*") + "/" + group(strings.Join(den, "*"), len(den) > 1)
+}
+
+// power writes symbol raised to exp, leaving out an exponent of 1.
+func power(symbol string, exp int) string {
+	if exp == 1 {
+		return symbol
+	}
+	return fmt.Sprintf("%s**%d", symbol, exp)
+}
+
+// ratOp applies op to exact scales a and b, either of which may be nil to
+// indicate an irrational scale.
+func ratOp(op func(z, x, y *big.Rat) *big.Rat, a, b *big.Rat) *big.Rat {
+	if a == nil || b == nil {
+		return nil
+	}
+	return op(new(big.Rat), a, b)
+}
+
+// group parenthesizes name if needed.
+func group(name string, needed bool) string {
+	if needed {
+		return "(" + name + ")"
+	}
+	return name
+}
+
+type prefixSet int
+
+const (
+	noPrefixes prefixSet = iota
+	siPrefixes
+	allPrefixes // SI and binary prefixes, for units of information
+)
+
+// definition describes a unit in the registry. scale and offset are exact
+// decimals or fractions; scaleFunc takes precedence for irrational scales.
+type definition struct {
+	dim       Dimension
+	scale     string
+	scaleFunc func() *unified.Real
+	offset    string
+	prefixes  prefixSet
+}
+
+var (
+	dimForce      = Dimension{Mass: 1, Length: 1, Time: -2}
+	dimEnergy     = Dimension{Mass: 1, Length: 2, Time: -2}
+	dimPower      = Dimension{Mass: 1, Length: 2, Time: -3}
+	dimPressure   = Dimension{Mass: 1, Length: -1, Time: -2}
+	dimCharge     = Dimension{Current: 1, Time: 1}
+	dimVoltage    = Dimension{Mass: 1, Length: 2, Time: -3, Current: -1}
+	dimResistance = Dimension{Mass: 1, Length: 2, Time: -3, Current: -2}
+	dimVolume     = Dimension{Length: 3}
+	dimFrequency  = Dimension{Time: -1}
+)
+
+// definitions is the registry of known units by symbol. Angles are
+// dimensionless, with the radian as their base unit.
+var definitions = map[string]definition{
+	// Length
+	"m":  {dim: Of(Length), scale: "1", prefixes: siPrefixes},
+	"in": {dim: Of(Length), scale: "0.0254"},
+	"ft": {dim: Of(Length), scale: "0.3048"},
+	"yd": {dim: Of(Length), scale: "0.9144"},
+	"mi": {dim: Of(Length), scale: "1609.344"},
+	"au": {dim: Of(Length), scale: "149597870700"},
+	"ly": {dim: Of(Length), scale: "9460730472580800"},
+
+	// Mass
+	"g":  {dim: Of(Mass), scale: "1/1000", prefixes: siPrefixes},
+	"lb": {dim: Of(Mass), scale: "0.45359237"},
+	"oz": {dim: Of(Mass), scale: "0.028349523125"},
+
+	// Time
+	"s":    {dim: Of(Time), scale: "1", prefixes: siPrefixes},
+	"min":  {dim: Of(Time), scale: "60"},
+	"h":    {dim: Of(Time), scale: "3600"},
+	"day":  {dim: Of(Time), scale: "86400"},
+	"week": {dim: Of(Time), scale: "604800"},
+	"yr":   {dim: Of(Time), scale: "31557600"},
+
+	// Other SI base units
+	"A":   {dim: Of(Current), scale: "1", prefixes: siPrefixes},
+	"K":   {dim: Of(Temperature), scale: "1", prefixes: siPrefixes},
+	"mol": {dim: Of(Amount), scale: "1", prefixes: siPrefixes},
+	"cd":  {dim: Of(Luminosity), scale: "1", prefixes: siPrefixes},
+
+	// Temperature scales with shifted zeros
+	"°C":   {dim: Of(Temperature), scale: "1", offset: "273.15"},
+	"degC": {dim: Of(Temperature), scale: "1", offset: "273.15"},
+	"°F":   {dim: Of(Temperature), scale: "5/9", offset: "459.67"},
+	"degF": {dim: Of(Temperature), scale: "5/9", offset: "459.67"},
+
+	// Information
+	"B":    {dim: Of(Information), scale: "1", prefixes: allPrefixes},
+	"byte": {dim: Of(Information), scale: "1"},
+	"bit":  {dim: Of(Information), scale: "1/8", prefixes: allPrefixes},
+
+	// Derived units
+	"Hz":  {dim: dimFrequency, scale: "1", prefixes: siPrefixes},
+	"N":   {dim: dimForce, scale: "1", prefixes: siPrefixes},
+	"Pa":  {dim: dimPressure, scale: "1", prefixes: siPrefixes},
+	"bar": {dim: dimPressure, scale: "100000", prefixes: siPrefixes},
+	"atm": {dim: dimPressure, scale: "101325"},
+	"psi": {dim: dimPressure, scale: "44482216152605/6451600000"},
+	"J":   {dim: dimEnergy, scale: "1", prefixes: siPrefixes},
+	"cal": {dim: dimEnergy, scale: "4.184", prefixes: siPrefixes},
+	"Wh":  {dim: dimEnergy, scale: "3600", prefixes: siPrefixes},
+	"eV":  {dim: dimEnergy, scale: "1.602176634e-19", prefixes: siPrefixes},
+	"W":   {dim: dimPower, scale: "1", prefixes: siPrefixes},
+	"C":   {dim: dimCharge, scale: "1", prefixes: siPrefixes},
+	"V":   {dim: dimVoltage, scale: "1", prefixes: siPrefixes},
+	"Ω":   {dim: dimResistance, scale: "1", prefixes: siPrefixes},
+	"ohm": {dim: dimResistance, scale: "1", prefixes: siPrefixes},
+	"L":   {dim: dimVolume, scale: "1/1000", prefixes: siPrefixes},
+	"gal": {dim: dimVolume, scale: "0.003785411784"},
+
+	// Angles
+	"rad":  {scale: "1", prefixes: siPrefixes},
+	"deg":  {scaleFunc: func() *unified.Real { return unified.Pi().Divide(newInt(180)) }},
+	"grad": {scaleFunc: func() *unified.Real { return unified.Pi().Divide(newInt(200)) }},
+	"turn": {scaleFunc: func() *unified.Real { return unified.Pi().ShiftLeft(1) }},
+}
+
+// siPrefixScales maps SI prefixes to powers of ten.
+var siPrefixScales = map[string]int{
+	"Y": 24, "Z": 21, "E": 18, "P": 15, "T": 12, "G": 9, "M": 6, "k": 3, "h": 2, "da": 1,
+	"d": -1, "c": -2, "m": -3, "µ": -6, "u": -6, "n": -9, "p": -12, "f": -15, "a": -18, "z": -21, "y": -24,
+}
+
+// binaryPrefixScales maps IEC binary prefixes to powers of two.
+var binaryPrefixScales = map[string]int{
+	"Ki": 10, "Mi": 20, "Gi": 30, "Ti": 40, "Pi": 50, "Ei": 60,
+}
+
+// Lookup returns the unit named by symbol, which may carry an SI prefix
+// (e.g. km, µs) or, for units of information, a binary prefix (e.g. GiB).
+func Lookup(symbol string) (*Unit, bool) {
+	if def, ok := definitions[symbol]; ok {
+		return def.unit(symbol), true
+	}
+
+	for prefix, exp := range binaryPrefixScales {
+		if def, ok := definitions[strings.TrimPrefix(symbol, prefix)]; ok && strings.HasPrefix(symbol, prefix) && def.prefixes == allPrefixes {
+			return def.unit(symbol).scaled(new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), uint(exp)))), true
+		}
+	}
+
+	for prefix, exp := range siPrefixScales {
+		if def, ok := definitions[strings.TrimPrefix(symbol, prefix)]; ok && strings.HasPrefix(symbol, prefix) && def.prefixes != noPrefixes {
+			return def.unit(symbol).scaled(pow10(exp)), true
+		}
+	}
+
+	return nil, false
+}
+
+// Names returns the sorted symbols of all units, without prefixes.
+func Names() []string {
+	names := make([]string, 0, len(definitions))
+	for name := range definitions {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func (def definition) unit(name string) *Unit {
+	u := &Unit{
+		Name: name,
+		Dim:  def.dim,
+	}
+
+	if def.scaleFunc != nil {
+		u.Scale = def.scaleFunc()
+	} else {
+		u.Rat = mustRat(def.scale)
+		u.Scale = newRat(u.Rat)
+	}
+	if def.offset != "" {
+		u.Offset = mustRat(def.offset)
+	}
+
+	return u
+}
+
+// scaled multiplies the scale of u by a prefix factor.
+func (u *Unit) scaled(factor *big.Rat) *Unit {
+	u.Scale = u.Scale.Multiply(newRat(factor))
+	u.Rat = ratOp((*big.Rat).Mul, u.Rat, factor)
+	return u
+}
+
+func mustRat(s string) *big.Rat {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		panic(fmt.Sprintf("units: invalid number %q in unit definitions", s))
+	}
+	return r
+}
+
+func pow10(exp int) *big.Rat {
+	p := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(exp))), nil)
+	if exp < 0 {
+		return new(big.Rat).SetFrac(big.NewInt(1), p)
+	}
+	return new(big.Rat).SetInt(p)
+}
+
+func newRat(r *big.Rat) *unified.Real {
+	return unified.New(constructive.One(), rational.FromRational(r))
+}
+
+func newInt(n int64) *unified.Real {
+	return newRat(new(big.Rat).SetInt64(n))
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,260 @@
+package units
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"strconv"
+	"testing"
+
+	"github.com/ripta/reals/pkg/constructive"
+	"github.com/ripta/reals/pkg/unified"
+)
+
+func TestLookup(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		symbol string
+		scale  float64
+		dim    Dimension
+	}{
+		{symbol: "m", scale: 1, dim: Of(Length)},
+		{symbol: "km", scale: 1000, dim: Of(Length)},
+		{symbol: "mm", scale: 0.001, dim: Of(Length)},
+		{symbol: "µs", scale: 1e-6, dim: Of(Time)},
+		{symbol: "us", scale: 1e-6, dim: Of(Time)},
+		{symbol: "kg", scale: 1, dim: Of(Mass)},
+		{symbol: "min", scale: 60, dim: Of(Time)},
+		{symbol: "mi", scale: 1609.344, dim: Of(Length)},
+		{symbol: "dam", scale: 10, dim: Of(Length)},
+		{symbol: "hPa", scale: 100, dim: dimPressure},
+		{symbol: "kWh", scale: 3.6e6, dim: dimEnergy},
+		{symbol: "GB", scale: 1e9, dim: Of(Information)},
+		{symbol: "GiB", scale: 1 << 30, dim: Of(Information)},
+		{symbol: "Kibit", scale: 128, dim: Of(Information)},
+		{symbol: "deg", scale: math.Pi / 180},
+		{symbol: "mL", scale: 1e-6, dim: dimVolume},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.symbol, func(t *testing.T) {
+			t.Parallel()
+
+			u, ok := Lookup(tt.symbol)
+			if !ok {
+				t.Fatalf("Lookup(%q) failed", tt.symbol)
+			}
+			if u.Name != tt.symbol {
+				t.Errorf("Name = %q, want %q", u.Name, tt.symbol)
+			}
+			if u.Dim != tt.dim {
+				t.Errorf("Dim = %s, want %s", u.Dim, tt.dim)
+			}
+			if got := toFloat(t, u.Scale); math.Abs(got-tt.scale) > tt.scale*1e-12 {
+				t.Errorf("Scale = %v, want %v", got, tt.scale)
+			}
+		})
+	}
+}
+
+func TestLookupUnknown(t *testing.T) {
+	t.Parallel()
+
+	for _, symbol := range []string{"", "x", "kmin", "Kim", "GiPa", "°K", "kk"} {
+		if u, ok := Lookup(symbol); ok {
+			t.Errorf("Lookup(%q) = %s, want no unit", symbol, u.Name)
+		}
+	}
+}
+
+func TestTemperatureConversion(t *testing.T) {
+	t.Parallel()
+
+	f, _ := Lookup("°F")
+	c, _ := Lookup("degC")
+
+	k := f.ToBase(newInt(212))
+	if got := toFloat(t, k); math.Abs(got-373.15) > 1e-9 {
+		t.Errorf("212 °F = %v K, want 373.15", got)
+	}
+	if got := toFloat(t, c.FromBase(k)); math.Abs(got-100) > 1e-9 {
+		t.Errorf("212 °F = %v °C, want 100", got)
+	}
+	if got := toFloat(t, f.FromBase(c.ToBase(newInt(-40)))); math.Abs(got+40) > 1e-9 {
+		t.Errorf("-40 °C = %v °F, want -40", got)
+	}
+
+	if got := c.FromBaseRat(f.ToBaseRat(big.NewRat(72, 1))); got.RatString() != "200/9" {
+		t.Errorf("72 °F = %s °C exactly, want 200/9", got.RatString())
+	}
+	if deg, _ := Lookup("deg"); deg.ToBaseRat(big.NewRat(30, 1)) != nil {
+		t.Errorf("degrees should not convert to radians exactly")
+	}
+}
+
+func TestCompoundUnits(t *testing.T) {
+	t.Parallel()
+
+	km, _ := Lookup("km")
+	h, _ := Lookup("h")
+	s, _ := Lookup("s")
+	n, _ := Lookup("N")
+	m, _ := Lookup("m")
+
+	kmh, err := km.Div(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kmh.Name != "km/h" || kmh.Dim != (Dimension{Length: 1, Time: -1}) {
+		t.Errorf("km/h = %s [%s]", kmh.Name, kmh.Dim)
+	}
+	if got := toFloat(t, kmh.Scale); math.Abs(got-1/3.6) > 1e-12 {
+		t.Errorf("km/h scale = %v, want %v", got, 1/3.6)
+	}
+
+	s2, err := s.Pow(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accel, err := m.Div(s2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accel.Name != "m/s**2" {
+		t.Errorf("Name = %q, want %q", accel.Name, "m/s**2")
+	}
+
+	nm, err := n.Mul(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	perNM, err := s.Div(nm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perNM.Name != "s/(N*m)" {
+		t.Errorf("Name = %q, want %q", perNM.Name, "s/(N*m)")
+	}
+	if perNM.Dim.String() != "s**3/kg/m**2" {
+		t.Errorf("Dim = %q, want %q", perNM.Dim, "s**3/kg/m**2")
+	}
+}
+
+func TestCompoundUnitNames(t *testing.T) {
+	t.Parallel()
+
+	lookup := func(symbol string) *Unit {
+		u, ok := Lookup(symbol)
+		if !ok {
+			t.Fatalf("Lookup(%q) failed", symbol)
+		}
+		return u
+	}
+	mul := func(a, b *Unit) *Unit {
+		u, err := a.Mul(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	div := func(a, b *Unit) *Unit {
+		u, err := a.Div(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	pow := func(a *Unit, n int) *Unit {
+		u, err := a.Pow(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	km, h, m, s, n, gib := lookup("km"), lookup("h"), lookup("m"), lookup("s"), lookup("N"), lookup("GiB")
+
+	tests := []struct {
+		unit *Unit
+		want string
+	}{
+		{unit: mul(km, km), want: "km**2"},
+		{unit: mul(div(km, h), h), want: "km"},
+		{unit: div(pow(m, 2), m), want: "m"},
+		{unit: mul(div(gib, s), s), want: "GiB"},
+		{unit: div(km, pow(h, 2)), want: "km/h**2"},
+		{unit: pow(div(km, h), 2), want: "km**2/h**2"},
+		{unit: div(mul(n, m), mul(s, s)), want: "N*m/s**2"},
+		{unit: div(s, mul(n, m)), want: "s/(N*m)"},
+		{unit: pow(s, -1), want: "s**-1"},
+		{unit: div(div(m, m), s), want: "s**-1"},
+		{unit: mul(km, m), want: "km*m"},
+	}
+	for _, tt := range tests {
+		if tt.unit.Name != tt.want {
+			t.Errorf("Name = %q, want %q", tt.unit.Name, tt.want)
+		}
+	}
+
+	if got := toFloat(t, mul(div(km, h), h).Scale); got != 1000 {
+		t.Errorf("km/h*h scale = %v, want 1000", got)
+	}
+}
+
+func TestOffsetUnitsDoNotCombine(t *testing.T) {
+	t.Parallel()
+
+	c, _ := Lookup("°C")
+	m, _ := Lookup("m")
+
+	if _, err := c.Mul(m); !errors.Is(err, ErrOffsetUnit) {
+		t.Errorf("°C*m: got %v, want %v", err, ErrOffsetUnit)
+	}
+	if _, err := m.Div(c); !errors.Is(err, ErrOffsetUnit) {
+		t.Errorf("m/°C: got %v, want %v", err, ErrOffsetUnit)
+	}
+	if _, err := c.Pow(2); !errors.Is(err, ErrOffsetUnit) {
+		t.Errorf("°C**2: got %v, want %v", err, ErrOffsetUnit)
+	}
+}
+
+func TestDimension(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		dim  Dimension
+		want string
+	}{
+		{dim: Dimension{}, want: ""},
+		{dim: Of(Length), want: "m"},
+		{dim: dimForce, want: "kg*m/s**2"},
+		{dim: dimFrequency, want: "1/s"},
+		{dim: Dimension{Information: 1, Time: -1}, want: "B/s"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.dim.String(); got != tt.want {
+			t.Errorf("String(%v) = %q, want %q", [numBases]int(tt.dim), got, tt.want)
+		}
+	}
+
+	if d, ok := dimVolume.Pow(1, 3); !ok || d != Of(Length) {
+		t.Errorf("cube root of volume = %s, %v; want m", d, ok)
+	}
+	if _, ok := dimVolume.Pow(1, 2); ok {
+		t.Errorf("square root of volume should not have an integral dimension")
+	}
+	if !dimEnergy.Div(dimForce).Div(Of(Length)).IsZero() {
+		t.Errorf("energy / force / length should be dimensionless")
+	}
+}
+
+func toFloat(t *testing.T, r *unified.Real) float64 {
+	t.Helper()
+	f, err := strconv.ParseFloat(constructive.Text(r.Constructive(), 30, 10), 64)
+	if err != nil {
+		t.Fatalf("parse float: %v", err)
+	}
+	return f
+}
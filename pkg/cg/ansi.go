@@ -0,0 +1,172 @@
+package cg
+
+import (
+	"io"
+	"unicode/utf8"
+)
+
+// StripANSI renders terminal output as the plain text it would leave on
+// screen, line by line. Escape sequences, such as colours and cursor
+// movement, are dropped along with other control characters except tab and
+// newline. A carriage return or backspace moves back along the line, so that
+// later text overwrites earlier text as on a terminal; a progress counter
+// redrawn in place leaves only its final state.
+func StripANSI(b []byte) []byte {
+	s := &ansiStripper{out: make([]byte, 0, len(b))}
+	s.strip(b, true)
+	s.flush()
+	return s.out
+}
+
+// NewANSIStripper returns a writer that strips what is written to it as
+// StripANSI does, writing the plain text to w as each line is completed. It
+// holds back no more than the line being drawn and any escape sequence or
+// character split across writes. Close writes out what remains.
+func NewANSIStripper(w io.Writer) io.WriteCloser {
+	return &ansiStripper{w: w}
+}
+
+// ansiStripper is the state of StripANSI carried between writes: the line
+// being drawn, the cursor's column in it, and input that could not yet be
+// decoded.
+type ansiStripper struct {
+	w       io.Writer
+	out     []byte
+	line    []rune
+	col     int
+	pending []byte
+}
+
+func (s *ansiStripper) Write(p []byte) (int, error) {
+	b := p
+	if len(s.pending) > 0 {
+		b = append(s.pending, p...)
+	}
+	n := s.strip(b, false)
+	s.pending = append(s.pending[:0], b[n:]...)
+	if err := s.emit(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *ansiStripper) Close() error {
+	s.strip(s.pending, true)
+	s.pending = nil
+	s.flush()
+	return s.emit()
+}
+
+// emit writes the stripped text so far to s.w.
+func (s *ansiStripper) emit() error {
+	if len(s.out) == 0 {
+		return nil
+	}
+	_, err := s.w.Write(s.out)
+	s.out = s.out[:0]
+	return err
+}
+
+// flush ends the line being drawn.
+func (s *ansiStripper) flush() {
+	s.out = append(s.out, string(s.line)...)
+	s.line, s.col = s.line[:0], 0
+}
+
+func (s *ansiStripper) put(r rune) {
+	if s.col < len(s.line) {
+		s.line[s.col] = r
+	} else {
+		s.line = append(s.line, r)
+	}
+	s.col++
+}
+
+// strip draws b, returning how much of it was consumed. Unless final, an
+// escape sequence or character cut off by the end of b is left unconsumed,
+// to be completed by the next write; when final, it is treated as StripANSI
+// treats the end of its input.
+func (s *ansiStripper) strip(b []byte, final bool) int {
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c == 0x1b:
+			j, ok := skipEscape(b, i)
+			if !ok && !final {
+				return i
+			}
+			i = j
+			continue
+		case c == '\n':
+			s.flush()
+			s.out = append(s.out, '\n')
+		case c == '\r':
+			s.col = 0
+		case c == '\b':
+			if s.col > 0 {
+				s.col--
+			}
+		case c == '\t':
+			s.put('\t')
+		case c < 0x20 || c == 0x7f:
+			// Other control characters leave nothing on screen
+		default:
+			if !final && !utf8.FullRune(b[i:]) {
+				return i
+			}
+			r, size := utf8.DecodeRune(b[i:])
+			if r == utf8.RuneError && size == 1 {
+				// Keep invalid bytes as they were, for the caller to encode
+				s.flush()
+				s.out = append(s.out, c)
+				i++
+				continue
+			}
+			s.put(r)
+			i += size
+			continue
+		}
+		i++
+	}
+	return len(b)
+}
+
+// skipEscape returns the index just past the escape sequence that starts at
+// b[i], which holds ESC, and whether the sequence was terminated. An
+// unterminated sequence runs to the end of b.
+func skipEscape(b []byte, i int) (int, bool) {
+	i++
+	if i >= len(b) {
+		return i, false
+	}
+
+	switch b[i] {
+	case '[':
+		// CSI: parameter and intermediate bytes, then one final byte
+		for i++; i < len(b); i++ {
+			if b[i] >= 0x40 && b[i] <= 0x7e {
+				return i + 1, true
+			}
+		}
+		return i, false
+	case ']', 'P', 'X', '^', '_':
+		// OSC, DCS, SOS, PM and APC strings end with BEL or ESC \
+		for i++; i < len(b); i++ {
+			if b[i] == 0x07 {
+				return i + 1, true
+			}
+			if b[i] == 0x1b && i+1 < len(b) && b[i+1] == '\\' {
+				return i + 2, true
+			}
+		}
+		return i, false
+	default:
+		// Two-byte and character set sequences: intermediates, then a final
+		for ; i < len(b); i++ {
+			if b[i] >= 0x30 && b[i] <= 0x7e {
+				return i + 1, true
+			}
+		}
+		return i, false
+	}
+}
@@ -0,0 +1,58 @@
+package cg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStripANSI(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "hello\nworld\n", "hello\nworld\n"},
+		{"sgr colour", "\x1b[01;34mbin\x1b[0m  \x1b[32mok\x1b[m\n", "bin  ok\n"},
+		{"cursor movement", "a\x1b[2Kb\x1b[1;1Hc\n", "abc\n"},
+		{"osc title bel", "\x1b]0;title\x07text\n", "text\n"},
+		{"osc hyperlink st", "\x1b]8;;http://x\x1b\\link\x1b]8;;\x1b\\\n", "link\n"},
+		{"charset", "\x1b(Bplain\n", "plain\n"},
+		{"keypad", "\x1b=x\x1b>\n", "x\n"},
+		{"crlf", "one\r\ntwo\r\n", "one\ntwo\n"},
+		{"progress redraw", "50%\r100%\ndone\n", "100%\ndone\n"},
+		{"overwrite shorter", "abcdef\rXY\n", "XYcdef\n"},
+		{"backspace", "ab\bc\n", "ac\n"},
+		{"bell and nul dropped", "a\x07b\x00c\n", "abc\n"},
+		{"tab kept", "a\tb\n", "a\tb\n"},
+		{"multibyte overwrite", "héllo\rH\n", "Héllo\n"},
+		{"no trailing newline", "\x1b[1mbold", "bold"},
+		{"unterminated csi", "text\x1b[1", "text"},
+		{"invalid utf8 kept", "a\xffb\n", "a\xffb\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := string(StripANSI([]byte(tt.in))); got != tt.want {
+				t.Errorf("StripANSI(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+
+			// Written a byte at a time, every sequence and character is
+			// split across writes
+			var buf bytes.Buffer
+			w := NewANSIStripper(&buf)
+			for i := range len(tt.in) {
+				if _, err := w.Write([]byte{tt.in[i]}); err != nil {
+					t.Fatalf("Write: %v", err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("NewANSIStripper(%q) wrote %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
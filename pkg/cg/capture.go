@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // CaptureDirName is the subdirectory under $TMPDIR that holds per-run capture
@@ -16,17 +17,18 @@ func CaptureRoot() string {
 	return filepath.Join(os.TempDir(), CaptureDirName)
 }
 
-// Capture holds the open stdout and stderr files for a single capture run,
-// along with the run's identifier and directory.
+// Capture holds the open stdout, stderr and combined log files for a single
+// capture run, along with the run's identifier and directory.
 type Capture struct {
-	ID     string
-	Dir    string
-	Stdout *os.File
-	Stderr *os.File
+	ID       string
+	Dir      string
+	Stdout   *os.File
+	Stderr   *os.File
+	Combined *os.File
 }
 
 // NewCapture allocates a fresh run ID, creates $TMPDIR/cg/<ID>/, and opens
-// stdout and stderr inside it.
+// stdout, stderr and combined.jsonl inside it.
 func NewCapture() (*Capture, error) {
 	if err := os.MkdirAll(CaptureRoot(), 0o755); err != nil {
 		return nil, fmt.Errorf("creating capture root: %w", err)
@@ -46,16 +48,32 @@ func NewCapture() (*Capture, error) {
 		stdout.Close()
 		return nil, fmt.Errorf("creating stderr capture file: %w", err)
 	}
+	combined, err := os.Create(filepath.Join(dir, CombinedFilename))
+	if err != nil {
+		stdout.Close()
+		stderr.Close()
+		return nil, fmt.Errorf("creating combined log: %w", err)
+	}
+
+	return &Capture{ID: id, Dir: dir, Stdout: stdout, Stderr: stderr, Combined: combined}, nil
+}
 
-	return &Capture{ID: id, Dir: dir, Stdout: stdout, Stderr: stderr}, nil
+// Writers returns writers for the child's stdout and stderr that write to the
+// capture files and record each line in combined.jsonl, with elapsed times
+// measured from start. Both must be flushed once the child has exited.
+func (c *Capture) Writers(start time.Time) (stdout, stderr *CombinedWriter) {
+	log := NewCombinedLog(c.Combined, start)
+	return log.Writer(IndicatorOut, c.Stdout), log.Writer(IndicatorErr, c.Stderr)
 }
 
-// Close closes the captured stdout and stderr files. The first error
-// encountered is returned.
+// Close closes the captured stdout, stderr and combined log files. The first
+// error encountered is returned.
 func (c *Capture) Close() error {
 	first := c.Stdout.Close()
-	if err := c.Stderr.Close(); err != nil && first == nil {
-		first = err
+	for _, f := range []*os.File{c.Stderr, c.Combined} {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
 	}
 	return first
 }
@@ -2,6 +2,8 @@ package cg
 
 import (
 	"fmt"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -14,6 +16,23 @@ type Options struct {
 	Verbose  bool
 	Capture  bool
 	Buffered bool
+	// Labels, as key=value, and Note are recorded in meta.json
+	Labels []string
+	Note   string
+	// StdinFile is fed to the child as stdin; "-" passes cg's own stdin through
+	StdinFile string
+	Pty       bool
+	PtySize   string
+
+	Timeout       time.Duration
+	KillAfter     time.Duration
+	TimeoutSignal string
+
+	Repeat            int
+	RetryUntilSuccess int
+	RetryOnExit       []int
+	Backoff           time.Duration
+	BackoffMax        time.Duration
 
 	LogParse  string
 	LogMsgKey string
@@ -40,6 +59,19 @@ func NewCommand() *cobra.Command {
 	c.Flags().BoolVarP(&opts.Verbose, "verbose", "v", false, "restore the rich preamble and per-line timestamp prefix")
 	c.Flags().BoolVarP(&opts.Capture, "capture", "c", false, "capture child output to temporary files")
 	c.Flags().BoolVar(&opts.Buffered, "buffered", false, "defer child output until command finishes, grouped by stream")
+	c.Flags().StringArrayVar(&opts.Labels, "label", nil, "label the captured run with key=value, to find it again with cg ls --label; repeatable")
+	c.Flags().StringVar(&opts.Note, "note", "", "attach a free-form note to the captured run")
+	c.Flags().BoolVar(&opts.Pty, "pty", false, "run the child under a pseudo-terminal, capturing its combined terminal stream as stdout")
+	c.Flags().StringVar(&opts.PtySize, "pty-size", DefaultPtySize, "pseudo-terminal window size as COLSxROWS; requires --pty")
+	c.Flags().DurationVar(&opts.Timeout, "timeout", 0, "signal the child's process group once it has run this long, and exit 124")
+	c.Flags().DurationVar(&opts.KillAfter, "kill-after", 0, "send SIGKILL if the child is still running this long after the timeout signal; requires --timeout")
+	c.Flags().StringVar(&opts.TimeoutSignal, "timeout-signal", "SIGTERM", "signal to send on timeout: SIGTERM, SIGINT, SIGKILL, or a number; requires --timeout")
+	c.Flags().IntVar(&opts.Repeat, "repeat", 0, "run the command this many times, capturing each attempt as its own run, and summarise them")
+	c.Flags().IntVar(&opts.RetryUntilSuccess, "retry-until-success", 0, "run the command up to this many times, capturing each attempt as its own run, until one exits 0")
+	c.Flags().IntSliceVar(&opts.RetryOnExit, "retry-on-exit", nil, "only retry attempts that exit with one of these comma-separated codes; requires --retry-until-success")
+	c.Flags().DurationVar(&opts.Backoff, "backoff", 0, "wait this long after a failed attempt, doubling with each further failure in a row; requires --repeat or --retry-until-success")
+	c.Flags().DurationVar(&opts.BackoffMax, "backoff-max", 0, "longest wait between attempts; requires --backoff")
+	c.Flags().StringVar(&opts.StdinFile, "stdin-file", "", "feed the child this file on stdin (\"-\" for cg's own stdin); recorded in meta.json with --capture")
 	c.Flags().StringVar(&opts.LogParse, "log-parse", "", "log line parser (\"json\", \"logfmt\")")
 	c.Flags().StringVar(&opts.LogMsgKey, "log-message-key", "message", "JSON key for the log message")
 	c.Flags().StringVar(&opts.LogTSKey, "log-timestamp-key", "timestamp", "JSON key for the timestamp (empty to disable)")
@@ -51,6 +83,8 @@ func NewCommand() *cobra.Command {
 	c.AddCommand(NewPathsCommand())
 	c.AddCommand(NewLsCommand())
 	c.AddCommand(NewPruneCommand())
+	c.AddCommand(NewFollowCommand())
+	c.AddCommand(NewServeCommand())
 
 	return c
 }
@@ -64,6 +98,49 @@ var logDependentFlags = []string{
 }
 
 func (opts *Options) validateFlags(cmd *cobra.Command) error {
+	if opts.Timeout < 0 {
+		return fmt.Errorf("--timeout must not be negative")
+	}
+	if opts.Timeout == 0 {
+		for _, name := range []string{"kill-after", "timeout-signal"} {
+			if cmd.Flags().Changed(name) {
+				return fmt.Errorf("--%s requires --timeout", name)
+			}
+		}
+	}
+	if opts.KillAfter < 0 {
+		return fmt.Errorf("--kill-after must not be negative")
+	}
+	if _, err := ParseSignal(opts.TimeoutSignal, syscall.SIGTERM); err != nil {
+		return fmt.Errorf("--timeout-signal: %w", err)
+	}
+
+	if err := opts.validateRepeatFlags(cmd); err != nil {
+		return err
+	}
+
+	if _, err := ParseLabels(opts.Labels); err != nil {
+		return fmt.Errorf("--label: %w", err)
+	}
+	if !opts.Capture && !opts.repeating() {
+		for _, name := range []string{"label", "note"} {
+			if cmd.Flags().Changed(name) {
+				return fmt.Errorf("--%s requires --capture", name)
+			}
+		}
+	}
+
+	if opts.Pty {
+		if opts.StdinFile != "" {
+			return fmt.Errorf("--stdin-file cannot be combined with --pty")
+		}
+		if _, err := ParsePtySize(opts.PtySize); err != nil {
+			return fmt.Errorf("--pty-size: %w", err)
+		}
+	} else if cmd.Flags().Changed("pty-size") {
+		return fmt.Errorf("--pty-size requires --pty")
+	}
+
 	if opts.LogParse == "" {
 		for _, name := range logDependentFlags {
 			if cmd.Flags().Changed(name) {
@@ -87,3 +164,63 @@ func (opts *Options) validateFlags(cmd *cobra.Command) error {
 
 	return nil
 }
+
+func (opts *Options) validateRepeatFlags(cmd *cobra.Command) error {
+	if opts.Repeat < 0 || opts.RetryUntilSuccess < 0 {
+		return fmt.Errorf("--repeat and --retry-until-success must not be negative")
+	}
+	if opts.Repeat > 0 && opts.RetryUntilSuccess > 0 {
+		return fmt.Errorf("--repeat cannot be combined with --retry-until-success")
+	}
+	if opts.RetryUntilSuccess == 0 && cmd.Flags().Changed("retry-on-exit") {
+		return fmt.Errorf("--retry-on-exit requires --retry-until-success")
+	}
+	if opts.Backoff < 0 || opts.BackoffMax < 0 {
+		return fmt.Errorf("--backoff and --backoff-max must not be negative")
+	}
+	if opts.Backoff == 0 && cmd.Flags().Changed("backoff-max") {
+		return fmt.Errorf("--backoff-max requires --backoff")
+	}
+
+	if !opts.repeating() {
+		if cmd.Flags().Changed("backoff") {
+			return fmt.Errorf("--backoff requires --repeat or --retry-until-success")
+		}
+		return nil
+	}
+	if opts.Buffered {
+		return fmt.Errorf("--buffered cannot be combined with --repeat or --retry-until-success")
+	}
+	if opts.StdinFile == "-" {
+		return fmt.Errorf("--stdin-file - cannot be fed to repeated attempts; name a file instead")
+	}
+	return nil
+}
+
+// repeating reports whether the command is to be run as a series of
+// attempts.
+func (opts *Options) repeating() bool {
+	return opts.Repeat > 0 || opts.RetryUntilSuccess > 0
+}
+
+// repeat returns the series of attempts the flags describe. The flags must
+// have been validated, and must describe a series.
+func (opts *Options) repeat() Repeat {
+	r := Repeat{Attempts: opts.Repeat, Backoff: opts.Backoff, MaxBackoff: opts.BackoffMax}
+	if opts.RetryUntilSuccess > 0 {
+		r.Attempts = opts.RetryUntilSuccess
+		r.UntilSuccess = true
+		r.RetryOn = opts.RetryOnExit
+	}
+	return r
+}
+
+// timeout returns the run's timeout, or nil when it has none. The flags must
+// have been validated.
+func (opts *Options) timeout() *Timeout {
+	if opts.Timeout == 0 {
+		return nil
+	}
+	sig, _ := ParseSignal(opts.TimeoutSignal, syscall.SIGTERM)
+	return &Timeout{After: opts.Timeout, Signal: sig, KillAfter: opts.KillAfter}
+}
@@ -0,0 +1,207 @@
+package cg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CombinedFilename is the file name within a run directory that records, one
+// JSON object per line, every line the child wrote to either stream in the
+// order cg received them.
+const CombinedFilename = "combined.jsonl"
+
+// ErrNoCombined is returned by ReplayCombined for a run without a
+// combined.jsonl, such as one captured by an older cg.
+var ErrNoCombined = errors.New("run has no combined log")
+
+// CombinedRecord locates one line of a run's output. The line's bytes stay in
+// the per-stream file; the record holds only where to find them.
+type CombinedRecord struct {
+	// Stream is "O" for stdout or "E" for stderr.
+	Stream string `json:"stream"`
+	// ElapsedUs is the monotonic time from the start of the run to when cg
+	// received the line, in microseconds.
+	ElapsedUs int64 `json:"elapsed_us"`
+	// Time is the wall-clock time at which cg received the line.
+	Time time.Time `json:"time"`
+	// Offset and Length are the line's byte range in the stream's file,
+	// including its trailing newline.
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+	// Partial is set on a stream's final line when it has no trailing
+	// newline.
+	Partial bool `json:"partial,omitempty"`
+}
+
+// CombinedLog writes combined.jsonl for a run. Its writers may be used from
+// separate goroutines.
+type CombinedLog struct {
+	mu    sync.Mutex
+	w     io.Writer
+	start time.Time
+}
+
+// NewCombinedLog returns a CombinedLog that writes records to w, measuring
+// elapsed times from start.
+func NewCombinedLog(w io.Writer, start time.Time) *CombinedLog {
+	return &CombinedLog{w: w, start: start}
+}
+
+// Writer returns a writer for one stream, which passes everything through to
+// w and records each line once it has been written there.
+func (l *CombinedLog) Writer(ind Indicator, w io.Writer) *CombinedWriter {
+	return &CombinedWriter{log: l, ind: ind, w: w}
+}
+
+// record appends a record to the log. Recording is best-effort: a failure to
+// write the log never interrupts the capture of the output itself.
+func (l *CombinedLog) record(rec CombinedRecord) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(append(data, '\n'))
+}
+
+// CombinedWriter is an io.Writer for one stream of a run, recording its lines
+// in a CombinedLog.
+type CombinedWriter struct {
+	log *CombinedLog
+	ind Indicator
+	w   io.Writer
+
+	// off is the number of bytes written, and lineStart the offset of the
+	// line not yet recorded
+	off       int64
+	lineStart int64
+	// last is when bytes were last written
+	last time.Time
+}
+
+func (cw *CombinedWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	now := time.Now()
+	for i, b := range p[:n] {
+		if b == '\n' {
+			end := cw.off + int64(i) + 1
+			cw.log.record(cw.newRecord(now, end, false))
+			cw.lineStart = end
+		}
+	}
+	cw.off += int64(n)
+	cw.last = now
+	return n, err
+}
+
+// Flush records the stream's unterminated final line, if any, as received
+// when its last bytes were. It is called once the child has exited.
+func (cw *CombinedWriter) Flush() {
+	if cw.off > cw.lineStart {
+		cw.log.record(cw.newRecord(cw.last, cw.off, true))
+		cw.lineStart = cw.off
+	}
+}
+
+func (cw *CombinedWriter) newRecord(now time.Time, end int64, partial bool) CombinedRecord {
+	return CombinedRecord{
+		Stream:    string(rune(cw.ind)),
+		ElapsedUs: now.Sub(cw.log.start).Microseconds(),
+		Time:      now.UTC(),
+		Offset:    cw.lineStart,
+		Length:    end - cw.lineStart,
+		Partial:   partial,
+	}
+}
+
+// CombinedLine is one line of a run's output, replayed from its combined log.
+type CombinedLine struct {
+	CombinedRecord
+	// Number is the line's 1-based position within its stream.
+	Number int64
+	// Text is the line without its trailing newline.
+	Text []byte
+}
+
+// ReplayCombined calls fn for each line of the run in dir, interleaving the
+// streams in the order cg received their lines. It works on in-flight runs,
+// replaying the lines recorded so far. A run without combined.jsonl yields
+// ErrNoCombined.
+func ReplayCombined(dir string, fn func(CombinedLine) error) error {
+	log, err := os.Open(filepath.Join(dir, CombinedFilename))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNoCombined
+	}
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", CombinedFilename, err)
+	}
+	defer log.Close()
+
+	files := map[string]*os.File{}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for ind, name := range map[Indicator]string{IndicatorOut: "stdout", IndicatorErr: "stderr"} {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("opening %s: %w", name, err)
+		}
+		files[string(rune(ind))] = f
+	}
+
+	numbers := map[string]int64{}
+	br := bufio.NewReader(log)
+	for {
+		data, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// A record without its newline is still being written
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", CombinedFilename, err)
+		}
+
+		var rec CombinedRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return fmt.Errorf("parsing %s: %w", CombinedFilename, err)
+		}
+		f, ok := files[rec.Stream]
+		if !ok || rec.Offset < 0 || rec.Length < 0 {
+			return fmt.Errorf("parsing %s: invalid record %s", CombinedFilename, bytes.TrimSpace(data))
+		}
+
+		text := make([]byte, rec.Length)
+		if _, err := f.ReadAt(text, rec.Offset); err != nil {
+			return fmt.Errorf("reading line at offset %d: %w", rec.Offset, err)
+		}
+		numbers[rec.Stream]++
+		line := CombinedLine{CombinedRecord: rec, Number: numbers[rec.Stream], Text: bytes.TrimSuffix(text, []byte("\n"))}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+}
+
+// RenderCombined writes the interleaved lines of the run in dir to w, each
+// annotated with its stream indicator as by the live runner. Every line is
+// terminated, so that a partial line cannot run into one from the other
+// stream.
+func RenderCombined(dir string, w io.Writer) error {
+	aw := NewAnnotatedWriter(w, nil, true)
+	return ReplayCombined(dir, func(l CombinedLine) error {
+		return aw.WriteLine(Indicator(l.Stream[0]), string(l.Text))
+	})
+}
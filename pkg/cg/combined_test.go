@@ -0,0 +1,132 @@
+package cg
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCombinedLog(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	cap, err := NewCapture()
+	if err != nil {
+		t.Fatalf("NewCapture: %v", err)
+	}
+
+	start := time.Now()
+	out, errW := cap.Writers(start)
+	for _, w := range []struct {
+		w    *CombinedWriter
+		data string
+	}{
+		{out, "one\ntw"},
+		{errW, "oops\n"},
+		{out, "o\nthree"},
+		{errW, "fatal"},
+	} {
+		if _, err := w.w.Write([]byte(w.data)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	out.Flush()
+	errW.Flush()
+	if err := cap.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	var got []CombinedLine
+	err = ReplayCombined(cap.Dir, func(l CombinedLine) error {
+		got = append(got, l)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReplayCombined: %v", err)
+	}
+
+	want := []struct {
+		stream  string
+		number  int64
+		text    string
+		offset  int64
+		partial bool
+	}{
+		{stream: "O", number: 1, text: "one", offset: 0},
+		{stream: "E", number: 1, text: "oops", offset: 0},
+		{stream: "O", number: 2, text: "two", offset: 4},
+		{stream: "O", number: 3, text: "three", offset: 8, partial: true},
+		{stream: "E", number: 2, text: "fatal", offset: 5, partial: true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Stream != w.stream || g.Number != w.number || string(g.Text) != w.text || g.Offset != w.offset || g.Partial != w.partial {
+			t.Errorf("line %d = %+v (%q), want %+v", i, g, g.Text, w)
+		}
+		if g.ElapsedUs < 0 || g.Time.Before(start.Add(-time.Second)) {
+			t.Errorf("line %d has elapsed %dus at %v, want times from %v", i, g.ElapsedUs, g.Time, start)
+		}
+		if i > 0 && g.ElapsedUs < got[i-1].ElapsedUs {
+			t.Errorf("line %d elapsed %dus is before line %d", i, g.ElapsedUs, i-1)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := RenderCombined(cap.Dir, &buf); err != nil {
+		t.Fatalf("RenderCombined: %v", err)
+	}
+	if want := "O: one\nE: oops\nO: two\nO: three\nE: fatal\n"; buf.String() != want {
+		t.Errorf("RenderCombined = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestReplayCombinedInFlight(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	dir := seedRunDir(t, "AAAAAA", nil)
+	appendFile(t, dir, "stdout", "one\n")
+	appendFile(t, dir, CombinedFilename, `{"stream":"O","elapsed_us":5,"time":"2026-06-06T19:25:06Z","offset":0,"length":4}`+"\n"+`{"stream":"O","elap`)
+
+	var n int
+	if err := ReplayCombined(dir, func(CombinedLine) error { n++; return nil }); err != nil {
+		t.Fatalf("ReplayCombined: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("replayed %d lines, want 1, skipping the record still being written", n)
+	}
+}
+
+func TestReplayCombinedMissing(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	dir := seedRunDir(t, "AAAAAA", &Meta{ID: "AAAAAA"})
+
+	err := ReplayCombined(dir, func(CombinedLine) error { return nil })
+	if !errors.Is(err, ErrNoCombined) {
+		t.Fatalf("ReplayCombined = %v, want ErrNoCombined", err)
+	}
+
+	_, stderr, err := runCgSplit("out", "--combined", "AAAAAA")
+	assertExitCode1(t, err)
+	if stderr != "no combined log: AAAAAA (missing combined.jsonl)\n" {
+		t.Errorf("stderr = %q", stderr)
+	}
+}
+
+func TestOutCombined(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	args := []string{"sh", "-c", "echo one; sleep 0.05; echo two >&2; sleep 0.05; echo three"}
+	run, err := RunCapture(args, nil, "", nil, CaptureOptions{})
+	if err != nil {
+		t.Fatalf("RunCapture: %v", err)
+	}
+	<-run.Done
+
+	stdout, _, err := runCgSplit("out", "--combined", run.ID)
+	if err != nil {
+		t.Fatalf("cg out --combined: %v", err)
+	}
+	if want := "O: one\nE: two\nO: three\n"; stdout != want {
+		t.Errorf("stdout = %q, want %q", stdout, want)
+	}
+}
@@ -20,6 +20,9 @@ type StartDebug struct {
 	Cwd           string   `json:"cwd,omitempty"`
 	Path          string   `json:"path,omitempty"`
 	StartError    string   `json:"start_error"`
+	// Labels and Note are those the run was given.
+	Labels map[string]string `json:"labels,omitempty"`
+	Note   string            `json:"note,omitempty"`
 }
 
 // WriteStartDebug serialises d and writes it to dir/debug.json.
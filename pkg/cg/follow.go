@@ -0,0 +1,108 @@
+package cg
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// followOptions holds flags for the `cg follow` subcommand.
+type followOptions struct {
+	Format  string
+	Verbose bool
+}
+
+// NewFollowCommand returns the `cg follow <ID>` subcommand. It reattaches to a
+// capture run, whether in flight or finished, printing its stdout and stderr
+// with the same annotation as the live runner until the run finishes, then
+// the Finished summary. It exits with the child's exit code.
+func NewFollowCommand() *cobra.Command {
+	opts := &followOptions{}
+	c := &cobra.Command{
+		Use:           "follow <ID>",
+		Aliases:       []string{"tail"},
+		Short:         "Follow a captured run's output until it finishes",
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE:          opts.run,
+	}
+	c.Flags().StringVar(&opts.Format, "format", DefaultFormat, "time prefix format (Go time.Format layout); only applies in --verbose mode")
+	c.Flags().BoolVarP(&opts.Verbose, "verbose", "v", false, "prefix each line with the time it was read")
+	return c
+}
+
+func (opts *followOptions) run(cmd *cobra.Command, args []string) error {
+	id := args[0]
+	dir, err := LookupRunDir(id)
+	if errors.Is(err, ErrIncompleteRun) {
+		err = nil
+	}
+	if err != nil {
+		// Reuse the shell-side diagnostics for unknown and failed runs
+		_, err := resolveRunDir(cmd, id)
+		return err
+	}
+
+	prefix := func() string {
+		return time.Now().Format(opts.Format)
+	}
+	w := NewAnnotatedWriter(cmd.OutOrStdout(), prefix, !opts.Verbose)
+
+	if err := TailRun(cmd.Context(), dir, TailPollInterval, writeTailLine(w, opts.Format)); err != nil {
+		return err
+	}
+
+	meta, err := ReadMeta(dir)
+	if err != nil {
+		// The run finished without meta.json, so it failed to start
+		_, err := resolveRunDir(cmd, id)
+		return err
+	}
+
+	if err := w.WriteLine(IndicatorInfo, formatMetaFinish(meta, opts.Verbose)); err != nil {
+		return err
+	}
+
+	if meta.ExitCode != 0 {
+		return &ExitError{Code: meta.ExitCode}
+	}
+	return nil
+}
+
+// writeTailLine returns a TailRun callback that writes each line to w,
+// prefixed with the time it was read in format.
+func writeTailLine(w *AnnotatedWriter, format string) func(TailLine) error {
+	return func(l TailLine) error {
+		p := l.Time.Format(format)
+		if l.Partial {
+			return w.WritePartialLineWithPrefix(p, l.Stream, l.Text)
+		}
+		return w.WriteLineWithPrefix(p, l.Stream, l.Text)
+	}
+}
+
+// formatMetaFinish builds the end-of-run summary line of the finished run
+// described by meta, as the live runner would have written it. An attempt of
+// a repeat is marked with its number.
+func formatMetaFinish(meta *Meta, verbose bool) string {
+	signaled := meta.Signal != nil
+	var sig int
+	if signaled {
+		sig = *meta.Signal
+	}
+	d := time.Duration(meta.DurationMs) * time.Millisecond
+	finish := formatFinish(meta.ExitCode, signaled, sig, d, meta.StdoutLines, meta.StderrLines, meta.ID)
+	if meta.Attempt > 0 {
+		finish += fmt.Sprintf(" attempt=%d", meta.Attempt)
+	}
+	if meta.TimedOut && meta.Deadline != nil {
+		finish += " timeout=" + formatDuration(meta.Deadline.Sub(meta.StartedAt))
+	}
+	if verbose && meta.Resources != nil {
+		finish += " " + formatResources(meta.Resources)
+	}
+	return finish
+}
@@ -0,0 +1,47 @@
+package cg
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFollowInFlight(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	dir := seedRunDir(t, "AAAAAA", nil)
+	appendFile(t, dir, "stdout", "started\n")
+
+	type result struct {
+		stdout string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		stdout, _, err := runCgSplit("follow", "AAAAAA")
+		done <- result{stdout: stdout, err: err}
+	}()
+
+	// Finish the run only after follow has had a chance to start waiting
+	time.Sleep(50 * time.Millisecond)
+	appendFile(t, dir, "stderr", "failing\n")
+	signal := 15
+	if err := WriteMeta(dir, &Meta{ID: "AAAAAA", DurationMs: 1500, ExitCode: 143, Signal: &signal, StdoutLines: 1, StderrLines: 1}); err != nil {
+		t.Fatalf("WriteMeta: %v", err)
+	}
+
+	var res result
+	select {
+	case res = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("follow did not return after the run finished")
+	}
+
+	var exitErr *ExitError
+	if !errors.As(res.err, &exitErr) || exitErr.Code != 143 {
+		t.Fatalf("follow error = %v, want exit code 143", res.err)
+	}
+	want := "O: started\nE: failing\nI: Finished signal=15 in 1.5s (out=1 err=1) id=AAAAAA\n"
+	if res.stdout != want {
+		t.Errorf("stdout = %q, want %q", res.stdout, want)
+	}
+}
@@ -0,0 +1,136 @@
+package cg
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ParseLabels parses labels written as key=value. The key must be non-empty;
+// the value may be empty. A key given twice takes its last value.
+func ParseLabels(specs []string) (map[string]string, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		k, v, ok := strings.Cut(spec, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid label %q: want key=value", spec)
+		}
+		labels[k] = v
+	}
+	return labels, nil
+}
+
+// ValidateLabels checks that every key of labels is non-empty and free of
+// "=", so that each label can be written back as key=value.
+func ValidateLabels(labels map[string]string) error {
+	for k := range labels {
+		if k == "" || strings.Contains(k, "=") {
+			return fmt.Errorf("invalid label key %q: must be non-empty and must not contain \"=\"", k)
+		}
+	}
+	return nil
+}
+
+// ParseSince parses a point in time given either as a duration before now,
+// such as 2h, or as an RFC 3339 timestamp.
+func ParseSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		if d < 0 {
+			return time.Time{}, fmt.Errorf("invalid time %q: duration must not be negative", s)
+		}
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: want a duration such as 2h, or an RFC 3339 timestamp", s)
+	}
+	return t, nil
+}
+
+// RunFilter selects capture runs by what their records say about them. The
+// zero RunFilter matches every run.
+type RunFilter struct {
+	// Labels must all be set on the run, with the same values.
+	Labels map[string]string
+	// Command, when non-nil, must match the run's command, its arguments
+	// joined by spaces. It is usually a glob compiled by CompileGlob.
+	Command *regexp.Regexp
+	// ExitCode, when non-nil, must be the exit code of a finished run.
+	ExitCode *int
+	// Since, when non-zero, is the earliest start time to match.
+	Since time.Time
+	// Failed matches only runs that failed to start, or that finished with
+	// a non-zero exit code, a signal or a timeout.
+	Failed bool
+}
+
+// Match reports whether f selects a run, given whichever of its meta.json,
+// debug.json and start.json were read, in that order of preference, and the
+// modification time of its directory. The directory's time stands in for
+// the start time of a run that does not record one.
+func (f *RunFilter) Match(meta *Meta, debug *StartDebug, start *StartInfo, mtime time.Time) bool {
+	var (
+		command []string
+		labels  map[string]string
+		started = mtime
+		failed  bool
+	)
+	switch {
+	case meta != nil:
+		command, labels, started = meta.Command, meta.Labels, meta.StartedAt
+		failed = meta.ExitCode != 0 || meta.Signal != nil || meta.TimedOut
+	case debug != nil:
+		command, labels = debug.Command, debug.Labels
+		failed = true
+	case start != nil:
+		command, labels, started = start.Command, start.Labels, start.StartedAt
+	}
+
+	if f.Failed && !failed {
+		return false
+	}
+	if f.ExitCode != nil && (meta == nil || meta.ExitCode != *f.ExitCode) {
+		return false
+	}
+	if !f.Since.IsZero() && started.Before(f.Since) {
+		return false
+	}
+	for k, v := range f.Labels {
+		if got, ok := labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	if f.Command != nil && !f.Command.MatchString(strings.Join(command, " ")) {
+		return false
+	}
+	return true
+}
+
+// CompileGlob compiles a glob into an anchored regular expression for
+// RunFilter.Command. A * matches any run of characters, including spaces and
+// slashes, a ? matches any one character, and every other character matches
+// itself.
+func CompileGlob(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString(`(?s)^`)
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(`.*`)
+		case '?':
+			b.WriteString(`.`)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString(`$`)
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %w", glob, err)
+	}
+	return re, nil
+}
@@ -0,0 +1,154 @@
+package cg
+
+import (
+	"maps"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLabels(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in      []string
+		want    map[string]string
+		wantErr string
+	}{
+		{in: nil, want: nil},
+		{in: []string{"branch=main", "os=linux"}, want: map[string]string{"branch": "main", "os": "linux"}},
+		{in: []string{"empty="}, want: map[string]string{"empty": ""}},
+		{in: []string{"expr=a=b"}, want: map[string]string{"expr": "a=b"}},
+		{in: []string{"k=1", "k=2"}, want: map[string]string{"k": "2"}},
+		{in: []string{"branch"}, wantErr: "want key=value"},
+		{in: []string{"=main"}, wantErr: "want key=value"},
+	}
+	for _, tt := range tests {
+		got, err := ParseLabels(tt.in)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseLabels(%q) err = %v, want to contain %q", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !maps.Equal(got, tt.want) {
+			t.Errorf("ParseLabels(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 6, 6, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr string
+	}{
+		{in: "2h", want: now.Add(-2 * time.Hour)},
+		{in: "2026-06-01T00:00:00Z", want: time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{in: "-1h", wantErr: "must not be negative"},
+		{in: "yesterday", wantErr: "want a duration"},
+	}
+	for _, tt := range tests {
+		got, err := ParseSince(tt.in, now)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseSince(%q) err = %v, want to contain %q", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("ParseSince(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestRunFilterMatch(t *testing.T) {
+	t.Parallel()
+
+	started := time.Date(2026, 6, 6, 12, 0, 0, 0, time.UTC)
+	sig := 15
+	exit2 := 2
+	finished := &Meta{Command: []string{"make", "test"}, StartedAt: started, ExitCode: 2, Labels: map[string]string{"branch": "x"}}
+	passed := &Meta{Command: []string{"./scripts/check.sh", "--all"}, StartedAt: started}
+	signaled := &Meta{Command: []string{"sleep", "9"}, StartedAt: started, ExitCode: -1, Signal: &sig}
+	failedStart := &StartDebug{Command: []string{"nope"}, Labels: map[string]string{"branch": "x"}}
+	running := &StartInfo{Command: []string{"make", "test"}, StartedAt: started, Labels: map[string]string{"branch": "y"}}
+	glob := func(s string) *regexp.Regexp {
+		re, err := CompileGlob(s)
+		if err != nil {
+			t.Fatalf("CompileGlob(%q): %v", s, err)
+		}
+		return re
+	}
+
+	tests := []struct {
+		name   string
+		filter RunFilter
+		meta   *Meta
+		debug  *StartDebug
+		start  *StartInfo
+		want   bool
+	}{
+		{name: "zero filter", meta: passed, want: true},
+		{name: "label matches", filter: RunFilter{Labels: map[string]string{"branch": "x"}}, meta: finished, want: true},
+		{name: "label differs", filter: RunFilter{Labels: map[string]string{"branch": "y"}}, meta: finished, want: false},
+		{name: "label missing", filter: RunFilter{Labels: map[string]string{"branch": "x"}}, meta: passed, want: false},
+		{name: "label on failed start", filter: RunFilter{Labels: map[string]string{"branch": "x"}}, debug: failedStart, want: true},
+		{name: "label on running", filter: RunFilter{Labels: map[string]string{"branch": "y"}}, start: running, want: true},
+		{name: "glob matches", filter: RunFilter{Command: glob("make t*")}, meta: finished, want: true},
+		{name: "glob spans slashes", filter: RunFilter{Command: glob("*/check.sh *")}, meta: passed, want: true},
+		{name: "glob is anchored", filter: RunFilter{Command: glob("make")}, meta: finished, want: false},
+		{name: "glob ? and literal dot", filter: RunFilter{Command: glob("./scripts/check?sh --all")}, meta: passed, want: true},
+		{name: "exit matches", filter: RunFilter{ExitCode: &exit2}, meta: finished, want: true},
+		{name: "exit differs", filter: RunFilter{ExitCode: &exit2}, meta: passed, want: false},
+		{name: "exit needs a finished run", filter: RunFilter{ExitCode: &exit2}, start: running, want: false},
+		{name: "since includes", filter: RunFilter{Since: started}, meta: finished, want: true},
+		{name: "since excludes", filter: RunFilter{Since: started.Add(time.Second)}, meta: finished, want: false},
+		{name: "failed exit", filter: RunFilter{Failed: true}, meta: finished, want: true},
+		{name: "failed signal", filter: RunFilter{Failed: true}, meta: signaled, want: true},
+		{name: "failed start", filter: RunFilter{Failed: true}, debug: failedStart, want: true},
+		{name: "failed excludes pass", filter: RunFilter{Failed: true}, meta: passed, want: false},
+		{name: "failed excludes running", filter: RunFilter{Failed: true}, start: running, want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Match(tt.meta, tt.debug, tt.start, started); got != tt.want {
+			t.Errorf("%s: Match = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRunCaptureLabels(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	labels := map[string]string{"branch": "main"}
+	run, err := RunCapture([]string{"true"}, nil, "", nil, CaptureOptions{Labels: labels, Note: "nightly"})
+	if err != nil {
+		t.Fatalf("RunCapture: %v", err)
+	}
+	waitDone(t, run, 3*time.Second)
+
+	meta, err := ReadMeta(run.Dir)
+	if err != nil {
+		t.Fatalf("ReadMeta: %v", err)
+	}
+	if !maps.Equal(meta.Labels, labels) || meta.Note != "nightly" {
+		t.Errorf("Labels, Note = %v, %q; want %v, %q", meta.Labels, meta.Note, labels, "nightly")
+	}
+
+	_, err = RunCapture([]string{"cg-nonexistent-command-xyz"}, nil, "", nil, CaptureOptions{Labels: labels, Note: "nightly"})
+	sf, ok := err.(*StartFailure)
+	if !ok {
+		t.Fatalf("RunCapture err = %v, want a start failure", err)
+	}
+	dbg, err := ReadStartDebug(sf.Dir)
+	if err != nil {
+		t.Fatalf("ReadStartDebug: %v", err)
+	}
+	if !maps.Equal(dbg.Labels, labels) || dbg.Note != "nightly" {
+		t.Errorf("debug Labels, Note = %v, %q; want %v, %q", dbg.Labels, dbg.Note, labels, "nightly")
+	}
+}
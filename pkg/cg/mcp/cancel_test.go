@@ -18,7 +18,7 @@ import (
 // not outlive the test.
 func startCancelRun(t *testing.T, reg *runRegistry, args ...string) *cg.CaptureRun {
 	t.Helper()
-	run, err := cg.RunCapture(args, nil, "", nil)
+	run, err := cg.RunCapture(args, nil, "", nil, cg.CaptureOptions{})
 	if err != nil {
 		t.Fatalf("RunCapture: %v", err)
 	}
@@ -254,3 +254,58 @@ func TestHandleCancelNoPidFile(t *testing.T) {
 		t.Errorf("error = %q, want no pid recorded message", err.Error())
 	}
 }
+
+func TestHandleCancelRepeat(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	reg := newRunRegistry()
+	cwd := t.TempDir()
+	wait := false
+	// Each attempt logs its start, then sleeps well past the test's timeouts.
+	_, started, err := handleRepeat(context.Background(), reg, nil, nil, repeatInput{
+		runInput: runInput{Command: []string{"sh", "-c", "echo start >> starts; sleep 30"}, Cwd: cwd, Wait: &wait},
+		Attempts: 5,
+	})
+	if err != nil {
+		t.Fatalf("handleRepeat: %v", err)
+	}
+
+	starts := filepath.Join(cwd, "starts")
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(starts); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("first attempt of %s never started", started.ID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_, out, err := handleCancel(context.Background(), reg, cancelInput{ID: started.ID, EscalateAfterMs: 5000})
+	if err != nil {
+		t.Fatalf("handleCancel: %v", err)
+	}
+	if !out.Signaled || !out.Finished || out.Escalated {
+		t.Errorf("out = %+v, want signaled and finished without escalation", out)
+	}
+
+	dir, err := cg.LookupRunDir(started.ID)
+	if err != nil {
+		t.Fatalf("LookupRunDir: %v", err)
+	}
+	meta, err := cg.ReadMeta(dir)
+	if err != nil {
+		t.Fatalf("ReadMeta: %v", err)
+	}
+	if meta.Repeat == nil || len(meta.Repeat.Attempts) != 1 {
+		t.Errorf("Repeat = %+v, want a single attempt", meta.Repeat)
+	}
+	data, err := os.ReadFile(starts)
+	if err != nil {
+		t.Fatalf("reading starts: %v", err)
+	}
+	if n := strings.Count(string(data), "start"); n != 1 {
+		t.Errorf("%d attempts started, want 1", n)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"unicode/utf8"
 
 	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
@@ -38,6 +39,8 @@ type grepInput struct {
 	CaseInsensitive bool   `json:"case_insensitive,omitempty" jsonschema:"fold case when matching"`
 	InvertMatch     bool   `json:"invert_match,omitempty" jsonschema:"return lines that do NOT match"`
 	MaxMatches      int    `json:"max_matches,omitempty" jsonschema:"cap on returned matches; default 1000, max 10000"`
+	Combined        bool   `json:"combined,omitempty" jsonschema:"return matches from both streams interleaved in capture order, rather than stdout's before stderr's"`
+	StripANSI       bool   `json:"strip_ansi,omitempty" jsonschema:"match and return each line with terminal escape sequences and control characters removed, as for a pty run"`
 }
 
 // grepMatch is one matching line. ContentEncoding is omitted (meaning utf8) for
@@ -61,7 +64,7 @@ type grepOutput struct {
 func registerGrep(s *mcpsdk.Server) {
 	mcpsdk.AddTool(s, &mcpsdk.Tool{
 		Name:        "cg_grep",
-		Description: "Search a run's captured output line by line and return matching lines with stream and 1-based line number. Supply exactly one of text (fixed string) or pattern (RE2 regex). Searches both streams by default; streams selects stdout or stderr. Supports case_insensitive and invert_match. Works for in-flight runs. Lines with invalid UTF-8 are base64-encoded and tagged content_encoding: \"base64\".",
+		Description: "Search a run's captured output line by line and return matching lines with stream and 1-based line number. Supply exactly one of text (fixed string) or pattern (RE2 regex). Searches both streams by default; streams selects stdout or stderr. Supports case_insensitive and invert_match. combined=true orders matches across streams as the lines were captured. strip_ansi=true matches against and returns plain-text lines with terminal escape sequences removed, for runs started with pty. Works for in-flight runs. Lines with invalid UTF-8 are base64-encoded and tagged content_encoding: \"base64\".",
 	}, handleGrep)
 }
 
@@ -95,6 +98,10 @@ func handleGrep(_ context.Context, _ *mcpsdk.CallToolRequest, in grepInput) (*mc
 	if err != nil {
 		return nil, grepOutput{}, err
 	}
+	render := func(b []byte) []byte { return b }
+	if in.StripANSI {
+		render = cg.StripANSI
+	}
 
 	dir, err := cg.LookupRunDir(in.ID)
 	if err != nil && !errors.Is(err, cg.ErrIncompleteRun) && !errors.Is(err, cg.ErrFailedRun) {
@@ -102,8 +109,20 @@ func handleGrep(_ context.Context, _ *mcpsdk.CallToolRequest, in grepInput) (*mc
 	}
 
 	out := grepOutput{Matches: []grepMatch{}}
+	if in.Combined {
+		more, err := grepCombined(dir, targetStreams(streams), render, matcher, maxMatches, &out.Matches)
+		if errors.Is(err, cg.ErrNoCombined) {
+			return nil, grepOutput{}, fmt.Errorf("run %s has no combined log", in.ID)
+		}
+		if err != nil {
+			return nil, grepOutput{}, err
+		}
+		out.Truncated = more
+		out.MatchCount = len(out.Matches)
+		return nil, out, nil
+	}
 	for _, name := range targetStreams(streams) {
-		more, err := grepStream(filepath.Join(dir, name), name, matcher, maxMatches, &out.Matches)
+		more, err := grepStream(filepath.Join(dir, name), name, render, matcher, maxMatches, &out.Matches)
 		if err != nil {
 			return nil, grepOutput{}, err
 		}
@@ -161,10 +180,11 @@ func buildMatcher(in grepInput) (func([]byte) bool, error) {
 }
 
 // grepStream scans path line by line, appending matches to *acc until the
-// max_matches cap is reached. It returns more=true when matches remain beyond
+// max_matches cap is reached. Each line is passed through render before it is
+// matched. It returns more=true when matches remain beyond
 // the cap. A missing file yields no matches and no error, since the run dir was
 // already validated by the caller.
-func grepStream(path, stream string, matcher func([]byte) bool, maxMatches int, acc *[]grepMatch) (bool, error) {
+func grepStream(path, stream string, render func([]byte) []byte, matcher func([]byte) bool, maxMatches int, acc *[]grepMatch) (bool, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -183,6 +203,7 @@ func grepStream(path, stream string, matcher func([]byte) bool, maxMatches int,
 		}
 		if len(line) > 0 || err == nil {
 			lineNo++
+			line = render(line)
 			if matcher(line) {
 				if len(*acc) >= maxMatches {
 					return true, nil
@@ -196,6 +217,41 @@ func grepStream(path, stream string, matcher func([]byte) bool, maxMatches int,
 	}
 }
 
+// errGrepCapped stops a combined replay once the max_matches cap is reached.
+var errGrepCapped = errors.New("max_matches reached")
+
+// grepCombined is grepStream over the run's combined log, appending matches
+// from the named streams in the order their lines were captured.
+func grepCombined(dir string, streams []string, render func([]byte) []byte, matcher func([]byte) bool, maxMatches int, acc *[]grepMatch) (bool, error) {
+	err := cg.ReplayCombined(dir, func(l cg.CombinedLine) error {
+		stream := grepStreamsStdout
+		if l.Stream == string(rune(cg.IndicatorErr)) {
+			stream = grepStreamsStderr
+		}
+		if !slices.Contains(streams, stream) {
+			return nil
+		}
+
+		line := l.Text
+		if len(line) > maxGrepLineBytes {
+			line = line[:maxGrepLineBytes]
+		}
+		line = render(line)
+		if !matcher(line) {
+			return nil
+		}
+		if len(*acc) >= maxMatches {
+			return errGrepCapped
+		}
+		*acc = append(*acc, newGrepMatch(stream, l.Number, line))
+		return nil
+	})
+	if errors.Is(err, errGrepCapped) {
+		return true, nil
+	}
+	return false, err
+}
+
 // readGrepLine reads a single newline-terminated line from r, dropping the
 // trailing newline. Lines longer than maxGrepLineBytes are capped and the
 // remainder is discarded so a pathological line cannot exhaust memory. A final
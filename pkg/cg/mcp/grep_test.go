@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ripta/rt/pkg/cg"
 )
@@ -25,6 +26,37 @@ func writeStreams(t *testing.T, id, stdout, stderr string) {
 	}
 }
 
+// writeCombined seeds $TMPDIR/cg/<id>/ with a finished-looking run whose lines
+// are recorded in combined.jsonl in the given order. Each line is prefixed
+// with its stream's indicator, as "O:text" or "E:text".
+func writeCombined(t *testing.T, id string, lines ...string) {
+	t.Helper()
+	seedRunDir(t, id, &cg.Meta{ID: id, Command: []string{"echo", "hi"}})
+	dir := filepath.Join(cg.CaptureRoot(), id)
+
+	files := map[string]*os.File{}
+	for _, name := range []string{"stdout", "stderr", cg.CombinedFilename} {
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("creating %s: %v", name, err)
+		}
+		defer f.Close()
+		files[name] = f
+	}
+
+	log := cg.NewCombinedLog(files[cg.CombinedFilename], time.Now())
+	writers := map[string]*cg.CombinedWriter{
+		"O": log.Writer(cg.IndicatorOut, files["stdout"]),
+		"E": log.Writer(cg.IndicatorErr, files["stderr"]),
+	}
+	for _, l := range lines {
+		stream, text, _ := strings.Cut(l, ":")
+		if _, err := writers[stream].Write([]byte(text + "\n")); err != nil {
+			t.Fatalf("writing %s: %v", l, err)
+		}
+	}
+}
+
 func grep(t *testing.T, in grepInput) grepOutput {
 	t.Helper()
 	_, out, err := handleGrep(context.Background(), nil, in)
@@ -289,3 +321,60 @@ func TestHandleGrepNoMatchesEmptySlice(t *testing.T) {
 		t.Errorf("Matches = nil, want empty slice")
 	}
 }
+
+func TestHandleGrepCombined(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	writeCombined(t, "AAAAAA", "O:ok pkg/a", "E:error: boom", "O:building", "O:ok pkg/b", "E:done")
+
+	out := grep(t, grepInput{ID: "AAAAAA", Text: "o", Combined: true})
+	want := []grepMatch{
+		{Stream: "stdout", LineNumber: 1, Line: "ok pkg/a"},
+		{Stream: "stderr", LineNumber: 1, Line: "error: boom"},
+		{Stream: "stdout", LineNumber: 3, Line: "ok pkg/b"},
+		{Stream: "stderr", LineNumber: 2, Line: "done"},
+	}
+	if out.MatchCount != len(want) {
+		t.Fatalf("match_count = %d, want %d: %+v", out.MatchCount, len(want), out.Matches)
+	}
+	for i, w := range want {
+		if got := out.Matches[i]; got != w {
+			t.Errorf("match[%d] = %+v, want %+v", i, got, w)
+		}
+	}
+
+	out = grep(t, grepInput{ID: "AAAAAA", Text: "o", Combined: true, Streams: "stderr", MaxMatches: 1})
+	if out.MatchCount != 1 || !out.Truncated || out.Matches[0].Line != "error: boom" {
+		t.Errorf("stderr-only capped grep = %+v, want the first stderr match, truncated", out)
+	}
+}
+
+func TestHandleGrepCombinedMissing(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	writeStreams(t, "AAAAAA", "match\n", "")
+
+	_, _, err := handleGrep(context.Background(), nil, grepInput{ID: "AAAAAA", Text: "match", Combined: true})
+	if err == nil || !strings.Contains(err.Error(), "no combined log") {
+		t.Fatalf("error = %v, want no combined log", err)
+	}
+}
+
+func TestHandleGrepStripANSI(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	writeStreams(t, "AAAAAA", "\x1b[31mFAIL\x1b[0m: \x1b[1mTestX\x1b[0m\nok\n", "")
+
+	// Escape sequences split the raw text, so it only matches once stripped
+	out := grep(t, grepInput{ID: "AAAAAA", Text: "FAIL: TestX"})
+	if out.MatchCount != 0 {
+		t.Errorf("raw MatchCount = %d, want 0", out.MatchCount)
+	}
+	out = grep(t, grepInput{ID: "AAAAAA", Text: "FAIL: TestX", StripANSI: true})
+	if out.MatchCount != 1 || out.Matches[0].Line != "FAIL: TestX" || out.Matches[0].LineNumber != 1 {
+		t.Errorf("stripped matches = %+v, want line 1 FAIL: TestX", out.Matches)
+	}
+
+	writeCombined(t, "BBBBBB", "O:\x1b[32mpass\x1b[0m", "E:\x1b[31mfail\x1b[0m")
+	out = grep(t, grepInput{ID: "BBBBBB", Pattern: "^(pass|fail)$", Combined: true, StripANSI: true})
+	if out.MatchCount != 2 || out.Matches[0].Line != "pass" || out.Matches[1].Line != "fail" {
+		t.Errorf("combined stripped matches = %+v, want pass then fail", out.Matches)
+	}
+}
@@ -26,8 +26,13 @@ const (
 
 // listInput is the argument shape for `cg_list`.
 type listInput struct {
-	Limit int    `json:"limit,omitempty" jsonschema:"maximum number of runs to return; default 20, max 1000"`
-	State string `json:"state,omitempty" jsonschema:"which runs to surface: all|finished|running|failed; default finished"`
+	Limit       int               `json:"limit,omitempty" jsonschema:"maximum number of runs to return; default 20, max 1000"`
+	State       string            `json:"state,omitempty" jsonschema:"which runs to surface: all|finished|running|failed; default finished"`
+	Labels      map[string]string `json:"labels,omitempty" jsonschema:"only runs carrying every one of these labels with the same value"`
+	CommandGlob string            `json:"command_glob,omitempty" jsonschema:"only runs whose command, arguments joined by spaces, matches this glob; * matches any characters and ? any one"`
+	ExitCode    *int              `json:"exit_code,omitempty" jsonschema:"only finished runs that exited with this code"`
+	Since       string            `json:"since,omitempty" jsonschema:"only runs started at or after this time: a duration before now such as 2h, or an RFC 3339 timestamp"`
+	Failed      bool              `json:"failed,omitempty" jsonschema:"only runs that failed to start, or finished with a non-zero exit code, a signal or a timeout"`
 }
 
 // listOutput is the result shape for `cg_list`.
@@ -41,23 +46,27 @@ type listOutput struct {
 // `started_at` synthesized from the run dir's mtime when start.json is absent.
 // Failed rows carry `start_error` and `command`.
 type listRun struct {
-	ID          string     `json:"id"`
-	State       string     `json:"state"`
-	Command     []string   `json:"command,omitempty"`
-	StartedAt   *time.Time `json:"started_at,omitempty"`
-	FinishedAt  *time.Time `json:"finished_at,omitempty"`
-	DurationMs  *int64     `json:"duration_ms,omitempty"`
-	ExitCode    *int       `json:"exit_code,omitempty"`
-	Signal      *int       `json:"signal,omitempty"`
-	StdoutLines *int64     `json:"stdout_lines,omitempty"`
-	StderrLines *int64     `json:"stderr_lines,omitempty"`
-	StartError  string     `json:"start_error,omitempty"`
+	ID          string            `json:"id"`
+	State       string            `json:"state"`
+	Command     []string          `json:"command,omitempty"`
+	StartedAt   *time.Time        `json:"started_at,omitempty"`
+	FinishedAt  *time.Time        `json:"finished_at,omitempty"`
+	DurationMs  *int64            `json:"duration_ms,omitempty"`
+	ExitCode    *int              `json:"exit_code,omitempty"`
+	Signal      *int              `json:"signal,omitempty"`
+	StdoutLines *int64            `json:"stdout_lines,omitempty"`
+	StderrLines *int64            `json:"stderr_lines,omitempty"`
+	StartError  string            `json:"start_error,omitempty"`
+	Parent      string            `json:"parent,omitempty"`
+	Attempt     int               `json:"attempt,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Note        string            `json:"note,omitempty"`
 }
 
 func registerList(s *mcpsdk.Server) {
 	mcpsdk.AddTool(s, &mcpsdk.Tool{
 		Name:        "cg_list",
-		Description: "List recent capture runs, most-recent-first by directory mtime. The `state` input filters to finished (default), running, failed, or all runs. Failed rows include state: \"failed\" and start_error. Running rows carry id, state, command, and started_at from start.json, falling back to the run dir's mtime when start.json is absent.",
+		Description: "List recent capture runs, most-recent-first by directory mtime. The `state` input filters to finished (default), running, failed, or all runs. Failed rows include state: \"failed\" and start_error. Attempts made by cg_repeat carry the parent id of the repeat and their attempt number. Rows carry any labels and note recorded on the run. labels, command_glob, exit_code, since and failed narrow the list further; a run must match all of them. Running rows carry id, state, command, and started_at from start.json, falling back to the run dir's mtime when start.json is absent.",
 	}, handleList)
 }
 
@@ -80,6 +89,26 @@ func handleList(_ context.Context, _ *mcpsdk.CallToolRequest, in listInput) (*mc
 		return nil, listOutput{}, fmt.Errorf("invalid state %q: want all|finished|running|failed", in.State)
 	}
 
+	filter := cg.RunFilter{
+		Labels:   in.Labels,
+		ExitCode: in.ExitCode,
+		Failed:   in.Failed,
+	}
+	if in.CommandGlob != "" {
+		re, err := cg.CompileGlob(in.CommandGlob)
+		if err != nil {
+			return nil, listOutput{}, fmt.Errorf("command_glob: %w", err)
+		}
+		filter.Command = re
+	}
+	if in.Since != "" {
+		since, err := cg.ParseSince(in.Since, time.Now())
+		if err != nil {
+			return nil, listOutput{}, err
+		}
+		filter.Since = since
+	}
+
 	root := cg.CaptureRoot()
 	entries, err := os.ReadDir(root)
 	if errors.Is(err, fs.ErrNotExist) {
@@ -111,7 +140,7 @@ func handleList(_ context.Context, _ *mcpsdk.CallToolRequest, in listInput) (*mc
 			// No meta.json: distinguish a failed run (has debug.json) from one
 			// still in flight (neither file present yet).
 			if dbg, dbgErr := cg.ReadStartDebug(dir); dbgErr == nil {
-				if state == stateRunning || state == stateFinished {
+				if state == stateRunning || state == stateFinished || !filter.Match(nil, dbg, nil, mtime) {
 					continue
 				}
 				started := mtime
@@ -123,6 +152,8 @@ func handleList(_ context.Context, _ *mcpsdk.CallToolRequest, in listInput) (*mc
 						Command:    dbg.Command,
 						StartedAt:  &started,
 						StartError: dbg.StartError,
+						Labels:     dbg.Labels,
+						Note:       dbg.Note,
 					},
 				})
 				continue
@@ -133,10 +164,19 @@ func handleList(_ context.Context, _ *mcpsdk.CallToolRequest, in listInput) (*mc
 			// A running capture writes start.json with its command and precise
 			// start time; fall back to the run dir's mtime when it is absent.
 			running := listRun{ID: name, State: stateRunning}
-			if si, siErr := cg.ReadStartInfo(dir); siErr == nil {
+			si, siErr := cg.ReadStartInfo(dir)
+			if siErr != nil {
+				si = nil
+			}
+			if !filter.Match(nil, nil, si, mtime) {
+				continue
+			}
+			if si != nil {
 				started := si.StartedAt
 				running.StartedAt = &started
 				running.Command = si.Command
+				running.Labels = si.Labels
+				running.Note = si.Note
 			} else {
 				started := mtime
 				running.StartedAt = &started
@@ -145,7 +185,7 @@ func handleList(_ context.Context, _ *mcpsdk.CallToolRequest, in listInput) (*mc
 			continue
 		}
 
-		if state == stateRunning || state == stateFailed {
+		if state == stateRunning || state == stateFailed || !filter.Match(meta, nil, nil, mtime) {
 			continue
 		}
 
@@ -165,6 +205,10 @@ func handleList(_ context.Context, _ *mcpsdk.CallToolRequest, in listInput) (*mc
 			ExitCode:    &exit,
 			StdoutLines: &stdoutLines,
 			StderrLines: &stderrLines,
+			Parent:      meta.Parent,
+			Attempt:     meta.Attempt,
+			Labels:      meta.Labels,
+			Note:        meta.Note,
 		}
 		if meta.Signal != nil {
 			sig := *meta.Signal
@@ -4,6 +4,8 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -283,3 +285,73 @@ func TestHandleListLimitClampedToMax(t *testing.T) {
 		t.Errorf("expected 0 runs (empty root), got %d", len(out.Runs))
 	}
 }
+
+func TestHandleListFilters(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	if err := os.MkdirAll(cg.CaptureRoot(), 0o755); err != nil {
+		t.Fatalf("mkdir root: %v", err)
+	}
+
+	now := time.Now().UTC()
+	seedRunDir(t, "AAAAAA", &cg.Meta{
+		ID:        "AAAAAA",
+		Command:   []string{"make", "test"},
+		StartedAt: now.Add(-3 * time.Hour),
+		ExitCode:  2,
+		Labels:    map[string]string{"branch": "main"},
+		Note:      "flaky again",
+	})
+	seedRunDir(t, "BBBBBB", &cg.Meta{
+		ID:        "BBBBBB",
+		Command:   []string{"make", "lint"},
+		StartedAt: now.Add(-time.Minute),
+		Labels:    map[string]string{"branch": "feature"},
+	})
+	dir := seedRunDir(t, "CCCCCC", nil)
+	if err := cg.WriteStartInfo(dir, &cg.StartInfo{Command: []string{"make", "test"}, StartedAt: now, Labels: map[string]string{"branch": "main"}}); err != nil {
+		t.Fatalf("WriteStartInfo: %v", err)
+	}
+
+	exit2 := 2
+	tests := []struct {
+		name string
+		in   listInput
+		want []string
+	}{
+		{name: "label", in: listInput{State: "all", Labels: map[string]string{"branch": "main"}}, want: []string{"AAAAAA", "CCCCCC"}},
+		{name: "label and state", in: listInput{Labels: map[string]string{"branch": "main"}}, want: []string{"AAAAAA"}},
+		{name: "command glob", in: listInput{State: "all", CommandGlob: "make l*"}, want: []string{"BBBBBB"}},
+		{name: "exit code", in: listInput{State: "all", ExitCode: &exit2}, want: []string{"AAAAAA"}},
+		{name: "since", in: listInput{State: "all", Since: "1h"}, want: []string{"BBBBBB", "CCCCCC"}},
+		{name: "failed", in: listInput{State: "all", Failed: true}, want: []string{"AAAAAA"}},
+		{name: "no match", in: listInput{State: "all", Labels: map[string]string{"branch": "x"}}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, out, err := handleList(context.Background(), nil, tt.in)
+			if err != nil {
+				t.Fatalf("handleList: %v", err)
+			}
+			got := make([]string, len(out.Runs))
+			for i, r := range out.Runs {
+				got[i] = r.ID
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ids = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	_, out, err := handleList(context.Background(), nil, listInput{CommandGlob: "make t*"})
+	if err != nil {
+		t.Fatalf("handleList: %v", err)
+	}
+	if len(out.Runs) != 1 || out.Runs[0].Labels["branch"] != "main" || out.Runs[0].Note != "flaky again" {
+		t.Errorf("Runs = %+v, want AAAAAA with its labels and note", out.Runs)
+	}
+
+	if _, _, err := handleList(context.Background(), nil, listInput{Since: "yesterday"}); err == nil || !strings.Contains(err.Error(), "invalid time") {
+		t.Errorf("err = %v, want an invalid time error", err)
+	}
+}
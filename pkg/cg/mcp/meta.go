@@ -21,14 +21,24 @@ type metaInput struct {
 // out of the JSON response when the run is still in flight and the caller
 // has no meta to report.
 type metaFields struct {
-	Command     []string   `json:"command,omitempty"`
-	StartedAt   *time.Time `json:"started_at,omitempty"`
-	FinishedAt  *time.Time `json:"finished_at,omitempty"`
-	DurationMs  *int64     `json:"duration_ms,omitempty"`
-	ExitCode    *int       `json:"exit_code,omitempty"`
-	Signal      *int       `json:"signal,omitempty"`
-	StdoutLines *int64     `json:"stdout_lines,omitempty"`
-	StderrLines *int64     `json:"stderr_lines,omitempty"`
+	Command     []string          `json:"command,omitempty"`
+	StartedAt   *time.Time        `json:"started_at,omitempty"`
+	FinishedAt  *time.Time        `json:"finished_at,omitempty"`
+	DurationMs  *int64            `json:"duration_ms,omitempty"`
+	ExitCode    *int              `json:"exit_code,omitempty"`
+	Signal      *int              `json:"signal,omitempty"`
+	StdoutLines *int64            `json:"stdout_lines,omitempty"`
+	StderrLines *int64            `json:"stderr_lines,omitempty"`
+	Resources   *cg.Resources     `json:"resources,omitempty"`
+	Stdin       *cg.StdinInfo     `json:"stdin,omitempty"`
+	Pty         *cg.PtyInfo       `json:"pty,omitempty"`
+	Deadline    *time.Time        `json:"deadline,omitempty"`
+	TimedOut    bool              `json:"timed_out,omitempty"`
+	Parent      string            `json:"parent,omitempty"`
+	Attempt     int               `json:"attempt,omitempty"`
+	Repeat      *cg.RepeatSummary `json:"repeat,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Note        string            `json:"note,omitempty"`
 }
 
 // metaOutput is the result shape for `cg_meta`. State is always populated;
@@ -108,6 +118,16 @@ func metaFieldsFrom(m *cg.Meta) metaFields {
 		ExitCode:    &exit,
 		StdoutLines: &stdoutLines,
 		StderrLines: &stderrLines,
+		Resources:   m.Resources,
+		Stdin:       m.Stdin,
+		Pty:         m.Pty,
+		Deadline:    m.Deadline,
+		TimedOut:    m.TimedOut,
+		Parent:      m.Parent,
+		Attempt:     m.Attempt,
+		Repeat:      m.Repeat,
+		Labels:      m.Labels,
+		Note:        m.Note,
 	}
 	if m.Signal != nil {
 		sig := *m.Signal
@@ -19,6 +19,7 @@ func TestHandleMetaSuccess(t *testing.T) {
 		Signal:      &sig,
 		DurationMs:  12,
 		StdoutLines: 1,
+		Resources:   &cg.Resources{MaxRSSBytes: 4096, StdoutBytes: 3},
 	})
 
 	_, out, err := handleMeta(context.Background(), nil, metaInput{ID: "AAAAAA"})
@@ -40,6 +41,9 @@ func TestHandleMetaSuccess(t *testing.T) {
 	if out.StdoutLines == nil || *out.StdoutLines != 1 {
 		t.Errorf("StdoutLines = %v, want 1", out.StdoutLines)
 	}
+	if out.Resources == nil || out.Resources.MaxRSSBytes != 4096 || out.Resources.StdoutBytes != 3 {
+		t.Errorf("Resources = %+v, want rss 4096 and 3 stdout bytes", out.Resources)
+	}
 }
 
 func TestHandleMetaUnknownID(t *testing.T) {
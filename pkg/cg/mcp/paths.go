@@ -19,16 +19,17 @@ type pathsInput struct {
 // even when meta.json does not yet exist; callers waiting on an in-flight run
 // can poll the same path. Debug is populated for failed runs.
 type pathsOutput struct {
-	Stdout string `json:"stdout"`
-	Stderr string `json:"stderr"`
-	Meta   string `json:"meta"`
-	Debug  string `json:"debug,omitempty"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	Combined string `json:"combined"`
+	Meta     string `json:"meta"`
+	Debug    string `json:"debug,omitempty"`
 }
 
 func registerPaths(s *mcpsdk.Server) {
 	mcpsdk.AddTool(s, &mcpsdk.Tool{
 		Name:        "cg_paths",
-		Description: "Return absolute paths for a capture run's stdout, stderr, and meta.json files. Works for in-flight and failed runs. Failed runs also include a debug path for debug.json.",
+		Description: "Return absolute paths for a capture run's stdout, stderr, combined.jsonl, and meta.json files. Works for in-flight and failed runs. Failed runs also include a debug path for debug.json.",
 	}, handlePaths)
 }
 
@@ -38,9 +39,10 @@ func handlePaths(_ context.Context, _ *mcpsdk.CallToolRequest, in pathsInput) (*
 		return nil, pathsOutput{}, mapLookupError(in.ID, err)
 	}
 	out := pathsOutput{
-		Stdout: filepath.Join(dir, "stdout"),
-		Stderr: filepath.Join(dir, "stderr"),
-		Meta:   filepath.Join(dir, cg.MetaFilename),
+		Stdout:   filepath.Join(dir, "stdout"),
+		Stderr:   filepath.Join(dir, "stderr"),
+		Combined: filepath.Join(dir, cg.CombinedFilename),
+		Meta:     filepath.Join(dir, cg.MetaFilename),
 	}
 	if errors.Is(err, cg.ErrFailedRun) {
 		out.Debug = filepath.Join(dir, cg.DebugFilename)
@@ -23,6 +23,9 @@ func TestHandlePathsSuccess(t *testing.T) {
 	if out.Stderr != filepath.Join(dir, "stderr") {
 		t.Errorf("Stderr = %q, want %q", out.Stderr, filepath.Join(dir, "stderr"))
 	}
+	if out.Combined != filepath.Join(dir, "combined.jsonl") {
+		t.Errorf("Combined = %q, want %q", out.Combined, filepath.Join(dir, "combined.jsonl"))
+	}
 	if out.Meta != filepath.Join(dir, "meta.json") {
 		t.Errorf("Meta = %q, want %q", out.Meta, filepath.Join(dir, "meta.json"))
 	}
@@ -0,0 +1,151 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/ripta/rt/pkg/cg"
+)
+
+const maxRepeatAttempts = 100
+
+// repeatInput is the argument shape for `cg_repeat`. It takes every cg_run
+// input, which applies to each attempt, plus the shape of the series.
+type repeatInput struct {
+	runInput
+	Attempts     int   `json:"attempts" jsonschema:"how many times to run the command, at most 100"`
+	UntilSuccess bool  `json:"until_success,omitempty" jsonschema:"stop at the first attempt that exits 0, retrying failures; by default every attempt is made"`
+	RetryOnExit  []int `json:"retry_on_exit,omitempty" jsonschema:"only retry attempts that exit with one of these codes; requires until_success"`
+	BackoffMs    int   `json:"backoff_ms,omitempty" jsonschema:"wait this long after a failed attempt before the next, doubling with each further failure in a row"`
+	MaxBackoffMs int   `json:"max_backoff_ms,omitempty" jsonschema:"longest wait between attempts; requires backoff_ms"`
+}
+
+// repeatOutput is the result shape for `cg_repeat`. The summary fields are
+// populated only once the series has finished.
+type repeatOutput struct {
+	ID         string            `json:"id"`
+	Started    bool              `json:"started,omitempty"`
+	TimedOut   bool              `json:"timed_out,omitempty"`
+	ExitCode   *int              `json:"exit_code,omitempty"`
+	DurationMs *int64            `json:"duration_ms,omitempty"`
+	Repeat     *cg.RepeatSummary `json:"repeat,omitempty"`
+	// Outcome is the cg_run result of the attempt that decided the series.
+	Outcome *runOutput `json:"outcome,omitempty"`
+}
+
+func registerRepeat(s *mcpsdk.Server, reg *runRegistry, g *gate) {
+	mcpsdk.AddTool(s, &mcpsdk.Tool{
+		Name:        "cg_repeat",
+		Description: "Run a command several times to tell whether it is flaky, or retry it until it succeeds with until_success. Takes every cg_run input, applied to each attempt. Each attempt is captured as its own run, whose meta names the repeat's id as its parent. Returns the repeat's id and, once finished, a summary: every attempt's id, exit code and duration, pass and fail counts, flaky, the first failed attempt, and duration percentiles. outcome holds the cg_run result, with excerpts, of the attempt that decided the series: the last attempt of a retry, or the first failed attempt of a repeat. wait and wait_timeout_ms apply to the whole series; a series still running can be awaited with cg_wait on the repeat's id.",
+	}, func(ctx context.Context, req *mcpsdk.CallToolRequest, in repeatInput) (*mcpsdk.CallToolResult, repeatOutput, error) {
+		var el elicitor
+		if elicitationAvailable(req) {
+			el = req.Session
+		}
+		return handleRepeat(ctx, reg, g, el, in)
+	})
+}
+
+func handleRepeat(ctx context.Context, reg *runRegistry, g *gate, el elicitor, in repeatInput) (*mcpsdk.CallToolResult, repeatOutput, error) {
+	rep, err := repeatFrom(in)
+	if err != nil {
+		return nil, repeatOutput{}, err
+	}
+
+	setup, err := setupRun(ctx, g, el, in.runInput)
+	if err != nil {
+		return nil, repeatOutput{}, err
+	}
+
+	rr, err := cg.RunRepeat(in.Command, setup.resolved, in.Cwd, in.Env, setup.opts, rep, func(_ int, run *cg.CaptureRun, err error) {
+		if err == nil && reg != nil {
+			reg.Add(run.ID, run.Done)
+		}
+	})
+	var done <-chan struct{}
+	if err == nil {
+		done = rr.Done
+	}
+	closeStdin(setup.opts.Stdin, done)
+	if err != nil {
+		return nil, repeatOutput{}, fmt.Errorf("starting repeat: %w", err)
+	}
+	if reg != nil {
+		reg.AddRepeat(rr)
+	}
+
+	if in.Wait != nil && !*in.Wait {
+		return nil, repeatOutput{ID: rr.ID, Started: true}, nil
+	}
+
+	timeoutMs := in.WaitTimeoutMs
+	if timeoutMs <= 0 {
+		timeoutMs = defaultWaitTimeoutMs
+	}
+
+	timer := time.NewTimer(time.Duration(timeoutMs) * time.Millisecond)
+	defer timer.Stop()
+
+	select {
+	case <-rr.Done:
+		out, err := finishedRepeatOutput(rr, setup.excerpt, in.ExcerptFrom)
+		return nil, out, err
+	case <-timer.C:
+		return nil, repeatOutput{ID: rr.ID, TimedOut: true}, nil
+	case <-ctx.Done():
+		return nil, repeatOutput{}, ctx.Err()
+	}
+}
+
+// repeatFrom returns the series of attempts described by in.
+func repeatFrom(in repeatInput) (cg.Repeat, error) {
+	if in.Attempts <= 0 || in.Attempts > maxRepeatAttempts {
+		return cg.Repeat{}, fmt.Errorf("attempts must be between 1 and %d", maxRepeatAttempts)
+	}
+	if len(in.RetryOnExit) > 0 && !in.UntilSuccess {
+		return cg.Repeat{}, fmt.Errorf("retry_on_exit requires until_success")
+	}
+	if in.BackoffMs < 0 || in.MaxBackoffMs < 0 {
+		return cg.Repeat{}, fmt.Errorf("backoff_ms and max_backoff_ms must be non-negative")
+	}
+	if in.MaxBackoffMs > 0 && in.BackoffMs == 0 {
+		return cg.Repeat{}, fmt.Errorf("max_backoff_ms requires backoff_ms")
+	}
+	return cg.Repeat{
+		Attempts:     in.Attempts,
+		UntilSuccess: in.UntilSuccess,
+		RetryOn:      in.RetryOnExit,
+		Backoff:      time.Duration(in.BackoffMs) * time.Millisecond,
+		MaxBackoff:   time.Duration(in.MaxBackoffMs) * time.Millisecond,
+	}, nil
+}
+
+// finishedRepeatOutput builds the result for a finished series from the
+// repeat's meta.json, and the outcome from the deciding attempt's.
+func finishedRepeatOutput(rr *cg.RepeatRun, excerpt int, excerptFrom string) (repeatOutput, error) {
+	m, err := cg.ReadMeta(rr.Dir)
+	if err != nil {
+		return repeatOutput{}, fmt.Errorf("reading meta.json for %s: %w", rr.ID, err)
+	}
+
+	out := repeatOutput{ID: rr.ID, Repeat: m.Repeat}
+	ec := m.ExitCode
+	dur := m.DurationMs
+	out.ExitCode = &ec
+	out.DurationMs = &dur
+
+	o := m.Repeat.Outcome()
+	switch {
+	case o == nil:
+	case o.StartError != "":
+		out.Outcome = &runOutput{ID: o.ID, StartError: o.StartError}
+	default:
+		dir, _ := cg.LookupRunDir(o.ID)
+		res := finishedOutput(&cg.CaptureRun{ID: o.ID, Dir: dir}, excerpt, excerptFrom)
+		out.Outcome = &res
+	}
+	return out, nil
+}
@@ -0,0 +1,166 @@
+package mcp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ripta/rt/pkg/cg"
+)
+
+func TestHandleRepeat(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	// Odd-numbered runs pass; even-numbered ones fail with a message
+	script := `n=$(cat count 2>/dev/null || echo 0); n=$((n+1)); echo $n > count; [ $((n % 2)) -eq 1 ] || { echo "boom $n" >&2; exit 3; }`
+	_, out, err := handleRepeat(context.Background(), nil, nil, nil, repeatInput{
+		runInput: runInput{Command: []string{"sh", "-c", script}, Cwd: t.TempDir()},
+		Attempts: 4,
+	})
+	if err != nil {
+		t.Fatalf("handleRepeat: %v", err)
+	}
+	if out.ID == "" || out.TimedOut {
+		t.Fatalf("out = %+v, want a finished repeat", out)
+	}
+	if out.ExitCode == nil || *out.ExitCode != 3 {
+		t.Errorf("ExitCode = %v, want 3", out.ExitCode)
+	}
+
+	s := out.Repeat
+	if s == nil {
+		t.Fatalf("Repeat = nil, want a summary")
+	}
+	if len(s.Attempts) != 4 || s.Passed != 2 || s.Failed != 2 || !s.Flaky || s.FirstFailure != 2 {
+		t.Errorf("summary = %+v, want 4 attempts, 2 passed, flaky, first failure 2", s)
+	}
+	if s.Durations == nil {
+		t.Errorf("Durations = nil, want percentiles")
+	}
+
+	if out.Outcome == nil || out.Outcome.ID != s.Attempts[1].ID {
+		t.Fatalf("Outcome = %+v, want the first failed attempt %s", out.Outcome, s.Attempts[1].ID)
+	}
+	if out.Outcome.StderrExcerpt != "boom 2\n" {
+		t.Errorf("Outcome.StderrExcerpt = %q, want %q", out.Outcome.StderrExcerpt, "boom 2\n")
+	}
+
+	_, meta, err := handleMeta(context.Background(), nil, metaInput{ID: s.Attempts[1].ID})
+	if err != nil {
+		t.Fatalf("handleMeta: %v", err)
+	}
+	if meta.Parent != out.ID || meta.Attempt != 2 {
+		t.Errorf("attempt meta parent %q attempt %d, want %q 2", meta.Parent, meta.Attempt, out.ID)
+	}
+}
+
+func TestHandleRepeatUntilSuccess(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	script := `n=$(cat count 2>/dev/null || echo 0); n=$((n+1)); echo $n > count; echo "try $n"; [ $n -ge 2 ]`
+	_, out, err := handleRepeat(context.Background(), nil, nil, nil, repeatInput{
+		runInput:     runInput{Command: []string{"sh", "-c", script}, Cwd: t.TempDir()},
+		Attempts:     5,
+		UntilSuccess: true,
+		BackoffMs:    1,
+	})
+	if err != nil {
+		t.Fatalf("handleRepeat: %v", err)
+	}
+	if out.Repeat == nil || len(out.Repeat.Attempts) != 2 || out.Repeat.Mode != cg.RepeatModeRetry {
+		t.Fatalf("Repeat = %+v, want a retry that stopped after 2 attempts", out.Repeat)
+	}
+	if out.ExitCode == nil || *out.ExitCode != 0 {
+		t.Errorf("ExitCode = %v, want 0", out.ExitCode)
+	}
+	if out.Outcome == nil || out.Outcome.StdoutExcerpt != "try 2\n" {
+		t.Errorf("Outcome = %+v, want the passing attempt", out.Outcome)
+	}
+}
+
+func TestHandleRepeatAsync(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	wait := false
+	reg := newRunRegistry()
+	_, out, err := handleRepeat(context.Background(), reg, nil, nil, repeatInput{
+		runInput: runInput{Command: []string{"true"}, Wait: &wait},
+		Attempts: 2,
+	})
+	if err != nil {
+		t.Fatalf("handleRepeat: %v", err)
+	}
+	if !out.Started || out.Repeat != nil {
+		t.Fatalf("out = %+v, want only started", out)
+	}
+
+	_, w, err := handleWait(context.Background(), reg, waitInput{ID: out.ID, TimeoutMs: 5000})
+	if err != nil {
+		t.Fatalf("handleWait: %v", err)
+	}
+	if !w.Finished || w.Repeat == nil || w.Repeat.Passed != 2 {
+		t.Errorf("wait = %+v, want a finished repeat with 2 passes", w)
+	}
+}
+
+func TestHandleRepeatStartError(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	_, out, err := handleRepeat(context.Background(), nil, nil, nil, repeatInput{
+		runInput: runInput{Command: []string{"cg-nonexistent-command-xyz"}},
+		Attempts: 3,
+	})
+	if err != nil {
+		t.Fatalf("handleRepeat: %v", err)
+	}
+	if out.Repeat == nil || len(out.Repeat.Attempts) != 1 {
+		t.Fatalf("Repeat = %+v, want a single attempt", out.Repeat)
+	}
+	if out.Outcome == nil || out.Outcome.StartError == "" {
+		t.Errorf("Outcome = %+v, want a start error", out.Outcome)
+	}
+}
+
+func TestHandleRepeatErrors(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	tests := []struct {
+		name string
+		in   repeatInput
+		want string
+	}{
+		{
+			name: "no attempts",
+			in:   repeatInput{runInput: runInput{Command: []string{"true"}}},
+			want: "attempts must be between 1 and 100",
+		},
+		{
+			name: "too many attempts",
+			in:   repeatInput{runInput: runInput{Command: []string{"true"}}, Attempts: 101},
+			want: "attempts must be between 1 and 100",
+		},
+		{
+			name: "retry_on_exit without until_success",
+			in:   repeatInput{runInput: runInput{Command: []string{"true"}}, Attempts: 2, RetryOnExit: []int{1}},
+			want: "retry_on_exit requires until_success",
+		},
+		{
+			name: "max_backoff_ms without backoff_ms",
+			in:   repeatInput{runInput: runInput{Command: []string{"true"}}, Attempts: 2, MaxBackoffMs: 10},
+			want: "max_backoff_ms requires backoff_ms",
+		},
+		{
+			name: "empty command",
+			in:   repeatInput{Attempts: 2},
+			want: "command must contain at least one element",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := handleRepeat(context.Background(), nil, nil, nil, tt.in)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want to contain %q", err, tt.want)
+			}
+		})
+	}
+}
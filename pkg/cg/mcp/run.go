@@ -1,12 +1,17 @@
 package mcp
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
 	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
@@ -33,29 +38,43 @@ type runInput struct {
 	WaitTimeoutMs int               `json:"wait_timeout_ms,omitempty" jsonschema:"how long to wait before returning timed_out=true (default 60000)"`
 	ExcerptBytes  int               `json:"excerpt_bytes,omitempty" jsonschema:"per-stream excerpt cap in bytes (default 4096, max 16384)"`
 	ExcerptFrom   string            `json:"excerpt_from,omitempty" jsonschema:"excerpt window: \"auto\" (default) picks head on success and tail on non-zero exit / signal / timeout; \"head\" or \"tail\" forces the window"`
+	Stdin         string            `json:"stdin,omitempty" jsonschema:"input to feed the child on stdin; mutually exclusive with stdin_file"`
+	StdinEncoding string            `json:"stdin_encoding,omitempty" jsonschema:"encoding of stdin: utf8 (default) or base64 for binary input"`
+	StdinFile     string            `json:"stdin_file,omitempty" jsonschema:"path of a file to feed the child on stdin, relative to cwd; mutually exclusive with stdin"`
+	Pty           bool              `json:"pty,omitempty" jsonschema:"run the child under a pseudo-terminal, capturing its combined terminal stream as stdout; cannot be combined with stdin or stdin_file"`
+	PtyCols       int               `json:"pty_cols,omitempty" jsonschema:"pseudo-terminal width in columns (default 80); requires pty"`
+	PtyRows       int               `json:"pty_rows,omitempty" jsonschema:"pseudo-terminal height in rows (default 24); requires pty"`
+	TimeoutMs     int               `json:"timeout_ms,omitempty" jsonschema:"signal the child's process group once it has run this long; unlike wait_timeout_ms, this ends the run"`
+	KillAfterMs   int               `json:"kill_after_ms,omitempty" jsonschema:"send SIGKILL if the child is still running this long after the timeout signal; requires timeout_ms"`
+	TimeoutSignal string            `json:"timeout_signal,omitempty" jsonschema:"signal to send at timeout_ms: SIGTERM (default), SIGINT, SIGKILL, or a numeric value; requires timeout_ms"`
+	Labels        map[string]string `json:"labels,omitempty" jsonschema:"labels to record on the run in meta.json, for filtering with cg_list"`
+	Note          string            `json:"note,omitempty" jsonschema:"free-form note to record on the run in meta.json"`
 }
 
 // runOutput is the result shape for `cg_run`.
 type runOutput struct {
-	ID            string `json:"id"`
-	Started       bool   `json:"started,omitempty"`
-	TimedOut      bool   `json:"timed_out,omitempty"`
-	ExitCode      *int   `json:"exit_code,omitempty"`
-	Signal        *int   `json:"signal,omitempty"`
-	DurationMs    *int64 `json:"duration_ms,omitempty"`
-	StdoutLines   *int64 `json:"stdout_lines,omitempty"`
-	StderrLines   *int64 `json:"stderr_lines,omitempty"`
-	StdoutExcerpt string `json:"stdout_excerpt"`
-	StderrExcerpt string `json:"stderr_excerpt"`
-	ExcerptFrom   string `json:"excerpt_from,omitempty"`
-	Truncated     bool   `json:"truncated"`
-	StartError    string `json:"start_error,omitempty"`
+	ID               string        `json:"id"`
+	Started          bool          `json:"started,omitempty"`
+	TimedOut         bool          `json:"timed_out,omitempty"`
+	Deadline         *time.Time    `json:"deadline,omitempty"`
+	DeadlineExceeded bool          `json:"deadline_exceeded,omitempty"`
+	ExitCode         *int          `json:"exit_code,omitempty"`
+	Signal           *int          `json:"signal,omitempty"`
+	DurationMs       *int64        `json:"duration_ms,omitempty"`
+	StdoutLines      *int64        `json:"stdout_lines,omitempty"`
+	StderrLines      *int64        `json:"stderr_lines,omitempty"`
+	Resources        *cg.Resources `json:"resources,omitempty"`
+	StdoutExcerpt    string        `json:"stdout_excerpt"`
+	StderrExcerpt    string        `json:"stderr_excerpt"`
+	ExcerptFrom      string        `json:"excerpt_from,omitempty"`
+	Truncated        bool          `json:"truncated"`
+	StartError       string        `json:"start_error,omitempty"`
 }
 
 func registerRun(s *mcpsdk.Server, reg *runRegistry, g *gate) {
 	mcpsdk.AddTool(s, &mcpsdk.Tool{
 		Name:        "cg_run",
-		Description: "Run a command with capture. Returns metadata, exit code, and short head-excerpts of stdout and stderr. The run is recorded on disk under $TMPDIR/cg/<id>/ and can be inspected with the other cg tools.",
+		Description: "Run a command with capture. Returns metadata, exit code, and short head-excerpts of stdout and stderr. timeout_ms bounds the run itself: the child's process group is sent timeout_signal (default SIGTERM) once it elapses, then SIGKILL after kill_after_ms, and the result reports deadline_exceeded. Input can be fed on stdin as text, as base64 with stdin_encoding: \"base64\", or from stdin_file; its size and SHA-256 are recorded in meta.json. labels and a note recorded on the run are returned by cg_meta and can be filtered on with cg_list. The run is recorded on disk under $TMPDIR/cg/<id>/ and can be inspected with the other cg tools.",
 	}, func(ctx context.Context, req *mcpsdk.CallToolRequest, in runInput) (*mcpsdk.CallToolResult, runOutput, error) {
 		var el elicitor
 		if elicitationAvailable(req) {
@@ -66,36 +85,23 @@ func registerRun(s *mcpsdk.Server, reg *runRegistry, g *gate) {
 }
 
 func handleRun(ctx context.Context, reg *runRegistry, g *gate, el elicitor, in runInput) (*mcpsdk.CallToolResult, runOutput, error) {
-	if len(in.Command) == 0 {
-		return nil, runOutput{}, fmt.Errorf("command must contain at least one element")
-	}
-
-	resolved, _ := cg.ResolveCommand(in.Command, in.Cwd)
-
-	if err := g.check(ctx, in, el); err != nil {
+	setup, err := setupRun(ctx, g, el, in)
+	if err != nil {
 		return nil, runOutput{}, err
 	}
-
-	excerpt := in.ExcerptBytes
-	if excerpt <= 0 {
-		excerpt = defaultExcerptBytes
-	}
-	if excerpt > maxExcerptBytes {
-		excerpt = maxExcerptBytes
-	}
-
-	switch in.ExcerptFrom {
-	case "", excerptFromAuto, excerptFromHead, excerptFromTail:
-	default:
-		return nil, runOutput{}, fmt.Errorf("invalid excerpt_from: %q (want %q, %q, or %q)", in.ExcerptFrom, excerptFromHead, excerptFromTail, excerptFromAuto)
-	}
+	excerpt := setup.excerpt
 
 	wait := true
 	if in.Wait != nil {
 		wait = *in.Wait
 	}
 
-	run, err := cg.RunCapture(in.Command, resolved, in.Cwd, in.Env)
+	run, err := cg.RunCapture(in.Command, setup.resolved, in.Cwd, in.Env, setup.opts)
+	var done <-chan struct{}
+	if err == nil {
+		done = run.Done
+	}
+	closeStdin(setup.opts.Stdin, done)
 	if err != nil {
 		var sf *cg.StartFailure
 		if errors.As(err, &sf) {
@@ -129,6 +135,188 @@ func handleRun(ctx context.Context, reg *runRegistry, g *gate, el elicitor, in r
 	}
 }
 
+// runSetup is what a cg_run input asks for, checked and ready to start.
+type runSetup struct {
+	resolved *cg.Resolution
+	excerpt  int
+	opts     cg.CaptureOptions
+}
+
+// setupRun validates in, consults the approval gate, and opens the child's
+// stdin. A stdin file in the returned options is the caller's to close with
+// closeStdin.
+func setupRun(ctx context.Context, g *gate, el elicitor, in runInput) (*runSetup, error) {
+	if len(in.Command) == 0 {
+		return nil, fmt.Errorf("command must contain at least one element")
+	}
+
+	resolved, _ := cg.ResolveCommand(in.Command, in.Cwd)
+
+	if err := g.check(ctx, in, el); err != nil {
+		return nil, err
+	}
+
+	excerpt := in.ExcerptBytes
+	if excerpt <= 0 {
+		excerpt = defaultExcerptBytes
+	}
+	if excerpt > maxExcerptBytes {
+		excerpt = maxExcerptBytes
+	}
+
+	switch in.ExcerptFrom {
+	case "", excerptFromAuto, excerptFromHead, excerptFromTail:
+	default:
+		return nil, fmt.Errorf("invalid excerpt_from: %q (want %q, %q, or %q)", in.ExcerptFrom, excerptFromHead, excerptFromTail, excerptFromAuto)
+	}
+
+	pty, err := ptyFrom(in)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout, err := timeoutFrom(in)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cg.ValidateLabels(in.Labels); err != nil {
+		return nil, err
+	}
+
+	stdin, err := openStdin(in)
+	if err != nil {
+		return nil, err
+	}
+
+	return &runSetup{
+		resolved: resolved,
+		excerpt:  excerpt,
+		opts:     cg.CaptureOptions{Stdin: stdin, Pty: pty, Timeout: timeout, Labels: in.Labels, Note: in.Note},
+	}, nil
+}
+
+// closeStdin closes a stdin file opened by setupRun once done closes, or at
+// once when done is nil because nothing was started.
+func closeStdin(stdin io.Reader, done <-chan struct{}) {
+	f, ok := stdin.(*os.File)
+	if !ok {
+		return
+	}
+	if done == nil {
+		f.Close()
+		return
+	}
+	go func() {
+		<-done
+		f.Close()
+	}()
+}
+
+// ptyFrom returns the pseudo-terminal described by in, or nil when in does not
+// ask for one.
+func ptyFrom(in runInput) (*cg.PtyInfo, error) {
+	if !in.Pty {
+		if in.PtyCols != 0 || in.PtyRows != 0 {
+			return nil, fmt.Errorf("pty_cols and pty_rows require pty")
+		}
+		return nil, nil
+	}
+	if in.Stdin != "" || in.StdinFile != "" {
+		return nil, fmt.Errorf("pty cannot be combined with stdin or stdin_file")
+	}
+
+	if in.PtyCols < 0 || in.PtyCols > math.MaxUint16 {
+		return nil, fmt.Errorf("pty_cols must be between 1 and %d", math.MaxUint16)
+	}
+	if in.PtyRows < 0 || in.PtyRows > math.MaxUint16 {
+		return nil, fmt.Errorf("pty_rows must be between 1 and %d", math.MaxUint16)
+	}
+
+	size, _ := cg.ParsePtySize(cg.DefaultPtySize)
+	if in.PtyCols > 0 {
+		size.Cols = uint16(in.PtyCols)
+	}
+	if in.PtyRows > 0 {
+		size.Rows = uint16(in.PtyRows)
+	}
+	return size, nil
+}
+
+// timeoutFrom returns the run timeout described by in, or nil when in does
+// not set one.
+func timeoutFrom(in runInput) (*cg.Timeout, error) {
+	if in.TimeoutMs < 0 || in.KillAfterMs < 0 {
+		return nil, fmt.Errorf("timeout_ms and kill_after_ms must be non-negative")
+	}
+	if in.TimeoutMs == 0 {
+		if in.KillAfterMs != 0 || in.TimeoutSignal != "" {
+			return nil, fmt.Errorf("kill_after_ms and timeout_signal require timeout_ms")
+		}
+		return nil, nil
+	}
+
+	sig, err := cg.ParseSignal(in.TimeoutSignal, syscall.SIGTERM)
+	if err != nil {
+		return nil, fmt.Errorf("timeout_signal: %w", err)
+	}
+	return &cg.Timeout{
+		After:     time.Duration(in.TimeoutMs) * time.Millisecond,
+		Signal:    sig,
+		KillAfter: time.Duration(in.KillAfterMs) * time.Millisecond,
+	}, nil
+}
+
+// openStdin returns the child's stdin described by in, or nil when in supplies
+// none. A stdin_file is opened relative to in.Cwd, and is the caller's to
+// close.
+func openStdin(in runInput) (io.Reader, error) {
+	if in.Stdin != "" && in.StdinFile != "" {
+		return nil, fmt.Errorf("stdin and stdin_file are mutually exclusive")
+	}
+	if in.StdinEncoding != "" && in.Stdin == "" {
+		return nil, fmt.Errorf("stdin_encoding requires stdin")
+	}
+
+	if in.StdinFile != "" {
+		path := in.StdinFile
+		if !filepath.IsAbs(path) && in.Cwd != "" {
+			path = filepath.Join(in.Cwd, path)
+		}
+		// Devices, pipes and the like are refused: /dev/stdin, for one, is
+		// the server's own JSON-RPC stream. Checked before opening, since
+		// opening a FIFO blocks until it has a writer.
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("opening stdin_file: %w", err)
+		}
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("stdin_file %s is not a regular file", in.StdinFile)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("opening stdin_file: %w", err)
+		}
+		return f, nil
+	}
+	if in.Stdin == "" {
+		return nil, nil
+	}
+
+	switch in.StdinEncoding {
+	case "", contentEncodingUTF8:
+		return strings.NewReader(in.Stdin), nil
+	case contentEncodingBase64:
+		data, err := base64.StdEncoding.DecodeString(in.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("decoding stdin: %w", err)
+		}
+		return bytes.NewReader(data), nil
+	default:
+		return nil, fmt.Errorf("invalid stdin_encoding: %q (want %q or %q)", in.StdinEncoding, contentEncodingUTF8, contentEncodingBase64)
+	}
+}
+
 // finishedOutput builds the result for a fully completed run, reading
 // meta.json to fill exit/signal/duration/line-count fields.
 func finishedOutput(run *cg.CaptureRun, excerpt int, excerptFrom string) runOutput {
@@ -144,6 +332,9 @@ func finishedOutput(run *cg.CaptureRun, excerpt int, excerptFrom string) runOutp
 		out.DurationMs = &dur
 		out.StdoutLines = &outLines
 		out.StderrLines = &errLines
+		out.Resources = meta.Resources
+		out.Deadline = meta.Deadline
+		out.DeadlineExceeded = meta.TimedOut
 		if meta.Signal != nil {
 			sig := *meta.Signal
 			out.Signal = &sig
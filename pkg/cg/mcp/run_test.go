@@ -44,6 +44,9 @@ func TestHandleRunSyncSuccess(t *testing.T) {
 	if out.ExcerptFrom != excerptFromHead {
 		t.Errorf("ExcerptFrom = %q, want %q", out.ExcerptFrom, excerptFromHead)
 	}
+	if out.Resources == nil || out.Resources.StdoutBytes != 3 {
+		t.Errorf("Resources = %+v, want 3 stdout bytes", out.Resources)
+	}
 }
 
 func TestHandleRunNonZeroExit(t *testing.T) {
@@ -276,3 +279,205 @@ func TestHandleRunInvalidExcerptFrom(t *testing.T) {
 		t.Fatalf("expected error for invalid excerpt_from, got nil")
 	}
 }
+
+func TestHandleRunStdin(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "in.txt"), []byte("from file\n"), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		in   runInput
+		want string
+	}{
+		{"text", runInput{Stdin: "hello\n"}, "hello\n"},
+		{"utf8", runInput{Stdin: "hello\n", StdinEncoding: "utf8"}, "hello\n"},
+		{"base64", runInput{Stdin: "AAFoaQo=", StdinEncoding: "base64"}, "\x00\x01hi\n"},
+		{"file relative to cwd", runInput{StdinFile: "in.txt", Cwd: dir}, "from file\n"},
+		{"file absolute", runInput{StdinFile: filepath.Join(dir, "in.txt")}, "from file\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := tt.in
+			in.Command = []string{"cat"}
+			_, out, err := handleRun(context.Background(), nil, nil, nil, in)
+			if err != nil {
+				t.Fatalf("handleRun: %v", err)
+			}
+			if out.StdoutExcerpt != tt.want {
+				t.Errorf("StdoutExcerpt = %q, want %q", out.StdoutExcerpt, tt.want)
+			}
+
+			m, err := cg.ReadMeta(filepath.Join(cg.CaptureRoot(), out.ID))
+			if err != nil {
+				t.Fatalf("ReadMeta: %v", err)
+			}
+			if m.Stdin == nil || m.Stdin.Bytes != int64(len(tt.want)) {
+				t.Errorf("meta Stdin = %+v, want %d bytes", m.Stdin, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestHandleRunStdinErrors(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	tests := []struct {
+		name string
+		in   runInput
+		want string
+	}{
+		{"both", runInput{Stdin: "x", StdinFile: "in.txt"}, "mutually exclusive"},
+		{"encoding without stdin", runInput{StdinEncoding: "base64"}, "stdin_encoding requires stdin"},
+		{"bad encoding", runInput{Stdin: "x", StdinEncoding: "hex"}, "invalid stdin_encoding"},
+		{"bad base64", runInput{Stdin: "!!", StdinEncoding: "base64"}, "decoding stdin"},
+		{"missing file", runInput{StdinFile: filepath.Join(t.TempDir(), "nosuch")}, "opening stdin_file"},
+		{"directory", runInput{StdinFile: t.TempDir()}, "not a regular file"},
+		{"server stdin", runInput{StdinFile: "/dev/stdin"}, "not a regular file"},
+		{"device", runInput{StdinFile: "/dev/null"}, "not a regular file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := tt.in
+			in.Command = []string{"cat"}
+			_, _, err := handleRun(context.Background(), nil, nil, nil, in)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleRunPty(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	_, out, err := handleRun(context.Background(), nil, nil, nil, runInput{
+		Command: []string{"sh", "-c", "test -t 1 && echo tty; stty size"},
+		Pty:     true,
+		PtyCols: 120,
+	})
+	if err != nil {
+		t.Fatalf("handleRun: %v", err)
+	}
+	if want := "tty\n24 120\n"; out.StdoutExcerpt != want {
+		t.Errorf("StdoutExcerpt = %q, want %q", out.StdoutExcerpt, want)
+	}
+
+	_, meta, err := handleMeta(context.Background(), nil, metaInput{ID: out.ID})
+	if err != nil {
+		t.Fatalf("handleMeta: %v", err)
+	}
+	if meta.Pty == nil || *meta.Pty != (cg.PtyInfo{Cols: 120, Rows: 24}) {
+		t.Errorf("Pty = %+v, want 120x24", meta.Pty)
+	}
+}
+
+func TestHandleRunPtyErrors(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	tests := []struct {
+		name string
+		in   runInput
+		want string
+	}{
+		{"size without pty", runInput{PtyRows: 40}, "require pty"},
+		{"with stdin", runInput{Pty: true, Stdin: "x"}, "cannot be combined"},
+		{"with stdin_file", runInput{Pty: true, StdinFile: "in.txt"}, "cannot be combined"},
+		{"negative cols", runInput{Pty: true, PtyCols: -1}, "pty_cols must be between"},
+		{"rows too large", runInput{Pty: true, PtyRows: 70000}, "pty_rows must be between"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := tt.in
+			in.Command = []string{"true"}
+			_, _, err := handleRun(context.Background(), nil, nil, nil, in)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleRunTimeoutMs(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	_, out, err := handleRun(context.Background(), nil, nil, nil, runInput{
+		Command:   []string{"sh", "-c", "echo started; sleep 5"},
+		TimeoutMs: 100,
+	})
+	if err != nil {
+		t.Fatalf("handleRun: %v", err)
+	}
+	if out.TimedOut {
+		t.Errorf("TimedOut = true, want false: the wait outlasted the run")
+	}
+	if !out.DeadlineExceeded {
+		t.Errorf("DeadlineExceeded = false, want true")
+	}
+	if out.Deadline == nil {
+		t.Errorf("Deadline = nil, want it set")
+	}
+	if out.Signal == nil || *out.Signal != 15 {
+		t.Errorf("Signal = %v, want 15", out.Signal)
+	}
+	if out.StdoutExcerpt != "started\n" {
+		t.Errorf("StdoutExcerpt = %q, want %q", out.StdoutExcerpt, "started\n")
+	}
+}
+
+func TestHandleRunTimeoutMsErrors(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	tests := []struct {
+		name string
+		in   runInput
+		want string
+	}{
+		{"negative", runInput{TimeoutMs: -1}, "must be non-negative"},
+		{"kill_after without timeout", runInput{KillAfterMs: 100}, "require timeout_ms"},
+		{"signal without timeout", runInput{TimeoutSignal: "SIGINT"}, "require timeout_ms"},
+		{"bad signal", runInput{TimeoutMs: 100, TimeoutSignal: "SIGFOO"}, "timeout_signal: unsupported signal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := tt.in
+			in.Command = []string{"true"}
+			_, _, err := handleRun(context.Background(), nil, nil, nil, in)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleRunLabels(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	_, out, err := handleRun(context.Background(), nil, nil, nil, runInput{
+		Command: []string{"true"},
+		Labels:  map[string]string{"branch": "main"},
+		Note:    "nightly",
+	})
+	if err != nil {
+		t.Fatalf("handleRun: %v", err)
+	}
+
+	_, meta, err := handleMeta(context.Background(), nil, metaInput{ID: out.ID})
+	if err != nil {
+		t.Fatalf("handleMeta: %v", err)
+	}
+	if meta.Labels["branch"] != "main" || meta.Note != "nightly" {
+		t.Errorf("Labels, Note = %v, %q; want branch=main, %q", meta.Labels, meta.Note, "nightly")
+	}
+
+	_, _, err = handleRun(context.Background(), nil, nil, nil, runInput{
+		Command: []string{"true"},
+		Labels:  map[string]string{"a=b": "c"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "invalid label key") {
+		t.Errorf("err = %v, want an invalid label key error", err)
+	}
+}
@@ -1,6 +1,10 @@
 package mcp
 
-import "sync"
+import (
+	"sync"
+
+	"github.com/ripta/rt/pkg/cg"
+)
 
 // Run state strings shared by the cg_meta, cg_list, and cg_wait outputs.
 const (
@@ -16,14 +20,19 @@ const (
 //
 // Entries are added by handleRun once the child is started and removed by a
 // janitor goroutine when the Done channel closes, so the map size tracks the
-// in-flight set.
+// in-flight set. Repeats are also kept by ID so that cg_cancel can stop the
+// series: a repeat's own run directory has no pid file to signal.
 type runRegistry struct {
-	mu   sync.Mutex
-	done map[string]<-chan struct{}
+	mu      sync.Mutex
+	done    map[string]<-chan struct{}
+	repeats map[string]*cg.RepeatRun
 }
 
 func newRunRegistry() *runRegistry {
-	return &runRegistry{done: make(map[string]<-chan struct{})}
+	return &runRegistry{
+		done:    make(map[string]<-chan struct{}),
+		repeats: make(map[string]*cg.RepeatRun),
+	}
 }
 
 // Add registers done under id and spawns a goroutine that removes the entry
@@ -40,6 +49,7 @@ func (r *runRegistry) Add(id string, done <-chan struct{}) {
 		r.mu.Lock()
 		if cur, ok := r.done[id]; ok && cur == done {
 			delete(r.done, id)
+			delete(r.repeats, id)
 		}
 		r.mu.Unlock()
 	}()
@@ -52,3 +62,21 @@ func (r *runRegistry) Done(id string) (<-chan struct{}, bool) {
 	done, ok := r.done[id]
 	return done, ok
 }
+
+// AddRepeat registers rr as Add does, and keeps rr itself until its Done
+// channel closes.
+func (r *runRegistry) AddRepeat(rr *cg.RepeatRun) {
+	r.mu.Lock()
+	r.repeats[rr.ID] = rr
+	r.mu.Unlock()
+	r.Add(rr.ID, rr.Done)
+}
+
+// Repeat returns the in-flight repeat registered under id, or (nil, false) if
+// id is not a tracked repeat.
+func (r *runRegistry) Repeat(id string) (*cg.RepeatRun, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rr, ok := r.repeats[id]
+	return rr, ok
+}
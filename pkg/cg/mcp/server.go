@@ -63,6 +63,7 @@ func newServer(v string, g *gate) *mcpsdk.Server {
 	s := mcpsdk.NewServer(&mcpsdk.Implementation{Name: "cg", Version: v}, nil)
 	reg := newRunRegistry()
 	registerRun(s, reg, g)
+	registerRepeat(s, reg, g)
 	registerList(s)
 	registerMeta(s)
 	registerWait(s, reg)
@@ -33,6 +33,8 @@ type streamInput struct {
 	From            string `json:"from,omitempty" jsonschema:"\"head\" (default) reads from offset; \"tail\" reads the last max_bytes"`
 	Offset          int64  `json:"offset,omitempty" jsonschema:"byte offset for head reads; ignored when from=tail"`
 	ContentEncoding string `json:"content_encoding,omitempty" jsonschema:"\"utf8\" (default) validates UTF-8 and falls back to base64 on invalid bytes; \"base64\" always base64-encodes"`
+	Combined        bool   `json:"combined,omitempty" jsonschema:"read both streams interleaved in capture order, each line prefixed O: or E:, instead of this stream alone"`
+	StripANSI       bool   `json:"strip_ansi,omitempty" jsonschema:"read the plain-text rendition with terminal escape sequences and control characters removed, as for a pty run; offsets and byte counts then refer to that rendition"`
 }
 
 // streamOutput is the result shape for `cg_stdout` and `cg_stderr`.
@@ -48,11 +50,11 @@ type streamOutput struct {
 func registerStreams(s *mcpsdk.Server) {
 	mcpsdk.AddTool(s, &mcpsdk.Tool{
 		Name:        "cg_stdout",
-		Description: "Fetch captured stdout for a run. Defaults to the first 16 KiB; max_bytes caps the response (max 1 MiB), from=\"tail\" reads the final window, offset pages through head reads. Works for in-flight runs. Output content_encoding is \"utf8\" when bytes validate as UTF-8 and \"base64\" otherwise (or when forced via input).",
+		Description: "Fetch captured stdout for a run. Defaults to the first 16 KiB; max_bytes caps the response (max 1 MiB), from=\"tail\" reads the final window, offset pages through head reads. Works for in-flight runs. combined=true reads stdout and stderr interleaved in capture order instead, each line prefixed O: or E:. strip_ansi=true reads a plain-text rendition with terminal escape sequences removed, for runs started with pty. Output content_encoding is \"utf8\" when bytes validate as UTF-8 and \"base64\" otherwise (or when forced via input).",
 	}, makeStreamHandler("stdout"))
 	mcpsdk.AddTool(s, &mcpsdk.Tool{
 		Name:        "cg_stderr",
-		Description: "Fetch captured stderr for a run. Defaults to the first 16 KiB; max_bytes caps the response (max 1 MiB), from=\"tail\" reads the final window, offset pages through head reads. Works for in-flight runs. Output content_encoding is \"utf8\" when bytes validate as UTF-8 and \"base64\" otherwise (or when forced via input).",
+		Description: "Fetch captured stderr for a run. Defaults to the first 16 KiB; max_bytes caps the response (max 1 MiB), from=\"tail\" reads the final window, offset pages through head reads. Works for in-flight runs. combined=true reads stdout and stderr interleaved in capture order instead, each line prefixed O: or E:. strip_ansi=true reads a plain-text rendition with terminal escape sequences removed. Output content_encoding is \"utf8\" when bytes validate as UTF-8 and \"base64\" otherwise (or when forced via input).",
 	}, makeStreamHandler("stderr"))
 }
 
@@ -99,21 +101,62 @@ func handleStream(fileName string, in streamInput) (*mcpsdk.CallToolResult, stre
 		return nil, streamOutput{}, mapLookupError(in.ID, err)
 	}
 
-	path := filepath.Join(dir, fileName)
-	f, err := os.Open(path)
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return nil, streamOutput{}, fmt.Errorf("unknown run id: %s", in.ID)
+	// A rendition, combined or stripped, is windowed as it is produced, so
+	// that only the window is held in memory.
+	win := newWindowWriter(from, in.Offset, maxBytes)
+	var (
+		w      io.Writer = win
+		closer io.Closer
+	)
+	if in.StripANSI {
+		sw := cg.NewANSIStripper(win)
+		w, closer = sw, sw
+	}
+
+	var (
+		f     io.ReadSeeker
+		total int64
+	)
+	if in.Combined {
+		if err := cg.RenderCombined(dir, w); err != nil {
+			if errors.Is(err, cg.ErrNoCombined) {
+				return nil, streamOutput{}, fmt.Errorf("run %s has no combined log", in.ID)
+			}
+			return nil, streamOutput{}, fmt.Errorf("rendering combined output for %s: %w", in.ID, err)
+		}
+	} else {
+		file, err := os.Open(filepath.Join(dir, fileName))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, streamOutput{}, fmt.Errorf("unknown run id: %s", in.ID)
+			}
+			return nil, streamOutput{}, fmt.Errorf("opening %s for %s: %w", fileName, in.ID, err)
+		}
+		defer file.Close()
+
+		info, err := file.Stat()
+		if err != nil {
+			return nil, streamOutput{}, fmt.Errorf("stat %s for %s: %w", fileName, in.ID, err)
+		}
+		f, total = file, info.Size()
+
+		if in.StripANSI {
+			if _, err := io.Copy(w, io.LimitReader(file, total)); err != nil {
+				return nil, streamOutput{}, fmt.Errorf("reading %s for %s: %w", fileName, in.ID, err)
+			}
+		}
+	}
+	if closer != nil {
+		if err := closer.Close(); err != nil {
+			return nil, streamOutput{}, err
 		}
-		return nil, streamOutput{}, fmt.Errorf("opening %s for %s: %w", fileName, in.ID, err)
 	}
-	defer f.Close()
 
-	info, err := f.Stat()
-	if err != nil {
-		return nil, streamOutput{}, fmt.Errorf("stat %s for %s: %w", fileName, in.ID, err)
+	if in.Combined || in.StripANSI {
+		raw, out := win.result(clamped)
+		out.Content, out.ContentEncoding = encodeContent(raw, in.ContentEncoding)
+		return nil, out, nil
 	}
-	total := info.Size()
 
 	var (
 		raw []byte
@@ -133,7 +176,7 @@ func handleStream(fileName string, in streamInput) (*mcpsdk.CallToolResult, stre
 	return nil, out, nil
 }
 
-func readHead(f *os.File, total int64, offset int64, maxBytes int, clamped bool) ([]byte, streamOutput, error) {
+func readHead(f io.ReadSeeker, total int64, offset int64, maxBytes int, clamped bool) ([]byte, streamOutput, error) {
 	if offset >= total {
 		return nil, streamOutput{TotalBytes: total, Clamped: clamped}, nil
 	}
@@ -158,7 +201,7 @@ func readHead(f *os.File, total int64, offset int64, maxBytes int, clamped bool)
 	}, nil
 }
 
-func readTail(f *os.File, total int64, maxBytes int, clamped bool) ([]byte, streamOutput, error) {
+func readTail(f io.ReadSeeker, total int64, maxBytes int, clamped bool) ([]byte, streamOutput, error) {
 	n := int64(maxBytes)
 	if n > total {
 		n = total
@@ -180,6 +223,60 @@ func readTail(f *os.File, total int64, maxBytes int, clamped bool) ([]byte, stre
 	}, nil
 }
 
+// windowWriter keeps the part of what is written to it that a head or tail
+// read would return, counting every byte so that the total is known.
+type windowWriter struct {
+	tail   bool
+	offset int64
+	max    int
+	total  int64
+	buf    []byte
+}
+
+// newWindowWriter returns a writer that keeps up to maxBytes from offset for
+// a head read, or the last maxBytes for a tail read.
+func newWindowWriter(from string, offset int64, maxBytes int) *windowWriter {
+	if from == streamFromTail {
+		offset = 0
+	}
+	return &windowWriter{tail: from == streamFromTail, offset: offset, max: maxBytes}
+}
+
+func (w *windowWriter) Write(p []byte) (int, error) {
+	start := w.total
+	w.total += int64(len(p))
+	if w.tail {
+		w.buf = append(w.buf, p...)
+		// Compact only once the slack reaches the window, so that many
+		// small writes cost amortised linear time.
+		if len(w.buf) >= 2*w.max {
+			w.buf = append(w.buf[:0], w.buf[len(w.buf)-w.max:]...)
+		}
+		return len(p), nil
+	}
+
+	lo := max(w.offset-start, 0)
+	hi := min(w.offset+int64(w.max)-start, int64(len(p)))
+	if lo < hi {
+		w.buf = append(w.buf, p[lo:hi]...)
+	}
+	return len(p), nil
+}
+
+// result returns the window and describes it as readHead or readTail would.
+func (w *windowWriter) result(clamped bool) ([]byte, streamOutput) {
+	raw := w.buf
+	if w.tail && len(raw) > w.max {
+		raw = raw[len(raw)-w.max:]
+	}
+	return raw, streamOutput{
+		TotalBytes:    w.total,
+		ReturnedBytes: len(raw),
+		Truncated:     w.offset+int64(len(raw)) < w.total,
+		Clamped:       clamped,
+	}
+}
+
 // encodeContent renders raw bytes into the wire content + content_encoding
 // pair. requested is the caller's content_encoding input: "" or "utf8" means
 // auto-validate with base64 fallback; "base64" forces base64 regardless of
@@ -355,3 +355,105 @@ func TestHandleStreamEmptyContentDefaultsToUTF8(t *testing.T) {
 		t.Errorf("ContentEncoding = %q, want %q", out.ContentEncoding, "utf8")
 	}
 }
+
+func TestHandleStreamCombined(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	writeCombined(t, "AAAAAA", "O:one", "E:two", "O:three")
+
+	for _, fileName := range []string{"stdout", "stderr"} {
+		_, out, err := handleStream(fileName, streamInput{ID: "AAAAAA", Combined: true})
+		if err != nil {
+			t.Fatalf("handleStream(%s): %v", fileName, err)
+		}
+		if want := "O: one\nE: two\nO: three\n"; out.Content != want {
+			t.Errorf("%s content = %q, want %q", fileName, out.Content, want)
+		}
+	}
+
+	_, out, err := handleStream("stdout", streamInput{ID: "AAAAAA", Combined: true, From: streamFromTail, MaxBytes: 9})
+	if err != nil {
+		t.Fatalf("handleStream: %v", err)
+	}
+	if out.Content != "O: three\n" || !out.Truncated || out.TotalBytes != 23 {
+		t.Errorf("tail = %+v, want the last line of 23 bytes, truncated", out)
+	}
+}
+
+func TestHandleStreamCombinedOffset(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	writeCombined(t, "AAAAAA", "O:one", "E:two", "O:three")
+
+	_, out, err := handleStream("stdout", streamInput{ID: "AAAAAA", Combined: true, Offset: 7, MaxBytes: 7})
+	if err != nil {
+		t.Fatalf("handleStream: %v", err)
+	}
+	if out.Content != "E: two\n" || !out.Truncated || out.TotalBytes != 23 || out.ReturnedBytes != 7 {
+		t.Errorf("head = %+v, want the second line of 23 bytes, truncated", out)
+	}
+}
+
+func TestWindowWriter(t *testing.T) {
+	t.Parallel()
+
+	data := "abcdefghijklmnopqrstuvwxyz"
+	tests := []struct {
+		from          string
+		offset        int64
+		max           int
+		want          string
+		wantTruncated bool
+	}{
+		{from: streamFromHead, max: 100, want: data},
+		{from: streamFromHead, max: 5, want: "abcde", wantTruncated: true},
+		{from: streamFromHead, offset: 3, max: 4, want: "defg", wantTruncated: true},
+		{from: streamFromHead, offset: 24, max: 5, want: "yz"},
+		{from: streamFromHead, offset: 30, max: 5, want: ""},
+		{from: streamFromTail, max: 5, want: "vwxyz", wantTruncated: true},
+		{from: streamFromTail, max: 100, want: data},
+	}
+	for _, tt := range tests {
+		w := newWindowWriter(tt.from, tt.offset, tt.max)
+		// Written a few bytes at a time, so windows span writes
+		for i := 0; i < len(data); i += 3 {
+			if _, err := w.Write([]byte(data[i:min(i+3, len(data))])); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+		}
+		raw, out := w.result(false)
+		if string(raw) != tt.want || out.Truncated != tt.wantTruncated || out.TotalBytes != int64(len(data)) || out.ReturnedBytes != len(tt.want) {
+			t.Errorf("%s offset %d max %d = %q, %+v; want %q, truncated %t", tt.from, tt.offset, tt.max, raw, out, tt.want, tt.wantTruncated)
+		}
+	}
+}
+
+func TestHandleStreamStripANSI(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	writeStream(t, "AAAAAA", "stdout", "\x1b[1;32mok\x1b[0m\n50%\r100%\n")
+
+	_, out, err := handleStream("stdout", streamInput{ID: "AAAAAA", StripANSI: true})
+	if err != nil {
+		t.Fatalf("handleStream: %v", err)
+	}
+	if want := "ok\n100%\n"; out.Content != want {
+		t.Errorf("Content = %q, want %q", out.Content, want)
+	}
+	if out.TotalBytes != 8 {
+		t.Errorf("TotalBytes = %d, want 8 (the stripped rendition)", out.TotalBytes)
+	}
+
+	_, out, err = handleStream("stdout", streamInput{ID: "AAAAAA", StripANSI: true, From: streamFromTail, MaxBytes: 5})
+	if err != nil {
+		t.Fatalf("handleStream: %v", err)
+	}
+	if out.Content != "100%\n" || !out.Truncated {
+		t.Errorf("tail = %+v, want the last stripped line, truncated", out)
+	}
+
+	_, out, err = handleStream("stdout", streamInput{ID: "AAAAAA", StripANSI: true, Offset: 3, MaxBytes: 2})
+	if err != nil {
+		t.Fatalf("handleStream: %v", err)
+	}
+	if out.Content != "10" || !out.Truncated || out.TotalBytes != 8 {
+		t.Errorf("head = %+v, want 2 bytes at offset 3 of the stripped rendition", out)
+	}
+}
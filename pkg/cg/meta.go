@@ -23,6 +23,26 @@ type Meta struct {
 	Signal      *int      `json:"signal"`
 	StdoutLines int64     `json:"stdout_lines"`
 	StderrLines int64     `json:"stderr_lines"`
+	// Resources is absent for runs captured before resource accounting.
+	Resources *Resources `json:"resources,omitempty"`
+	// Stdin is absent when the child was given no input.
+	Stdin *StdinInfo `json:"stdin,omitempty"`
+	// Pty is set when the child ran under a pseudo-terminal, whose stream
+	// was captured as stdout.
+	Pty *PtyInfo `json:"pty,omitempty"`
+	// Deadline is when a run with a timeout was due to be signalled, and
+	// TimedOut whether it was.
+	Deadline *time.Time `json:"deadline,omitempty"`
+	TimedOut bool       `json:"timed_out,omitempty"`
+	// Parent is the ID of the repeat that made this run one of its attempts,
+	// and Attempt the run's 1-based place in that series.
+	Parent  string `json:"parent,omitempty"`
+	Attempt int    `json:"attempt,omitempty"`
+	// Repeat is set on a repeat's own run, which summarises its attempts.
+	Repeat *RepeatSummary `json:"repeat,omitempty"`
+	// Labels and Note are given by the user to find the run again later.
+	Labels map[string]string `json:"labels,omitempty"`
+	Note   string            `json:"note,omitempty"`
 }
 
 // WriteMeta serialises m and writes it atomically to dir/meta.json via a
@@ -0,0 +1,115 @@
+package cg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/containerd/console"
+)
+
+// ctrlD is the terminal's default end-of-file character.
+const ctrlD = 0x04
+
+// DefaultPtySize is the window size a pseudo-terminal child gets unless told
+// otherwise, as COLSxROWS.
+const DefaultPtySize = "80x24"
+
+// PtyInfo records that a child ran under a pseudo-terminal, and the window
+// size it was given.
+type PtyInfo struct {
+	Cols uint16 `json:"cols"`
+	Rows uint16 `json:"rows"`
+}
+
+// ParsePtySize parses a window size written as COLSxROWS, such as 120x40.
+func ParsePtySize(s string) (*PtyInfo, error) {
+	c, r, ok := strings.Cut(strings.ToLower(s), "x")
+	if !ok {
+		return nil, fmt.Errorf("invalid window size %q: want COLSxROWS", s)
+	}
+	cols, err := parsePtyDim(c)
+	if err != nil {
+		return nil, fmt.Errorf("invalid window size %q: columns: %w", s, err)
+	}
+	rows, err := parsePtyDim(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid window size %q: rows: %w", s, err)
+	}
+	return &PtyInfo{Cols: cols, Rows: rows}, nil
+}
+
+func parsePtyDim(s string) (uint16, error) {
+	n, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return 0, errors.Unwrap(err)
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return uint16(n), nil
+}
+
+// attachPty allocates a pseudo-terminal of the given size and makes it the
+// child's stdin, stdout, stderr and controlling terminal. The child becomes
+// the leader of a new session, and so of its own process group. The caller
+// starts the child, then calls the returned release to drop the parent's copy
+// of the terminal, and reads the combined terminal stream from the returned
+// reader until EOF. The terminal does not translate "\n" into "\r\n", so the
+// stream keeps the line endings the child wrote.
+//
+// Nothing is typed into the terminal. So that a child reading it does not wait
+// forever, it is sent a single end-of-file, which its first read sees as the
+// null device would.
+func attachPty(child *exec.Cmd, size *PtyInfo) (io.ReadCloser, func(), error) {
+	master, slavePath, err := console.NewPty()
+	if err != nil {
+		return nil, nil, fmt.Errorf("allocating pseudo-terminal: %w", err)
+	}
+	if err := master.Resize(console.WinSize{Width: size.Cols, Height: size.Rows}); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("sizing pseudo-terminal: %w", err)
+	}
+	if err := console.ClearONLCR(master.Fd()); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("configuring pseudo-terminal: %w", err)
+	}
+
+	// An end-of-file character is queued for the first read of the terminal
+	if _, err := master.Write([]byte{ctrlD}); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("configuring pseudo-terminal: %w", err)
+	}
+
+	slave, err := os.OpenFile(slavePath, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("opening pseudo-terminal: %w", err)
+	}
+
+	child.Stdin = slave
+	child.Stdout = slave
+	child.Stderr = slave
+	child.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+	return &ptyReader{master}, func() { slave.Close() }, nil
+}
+
+// ptyReader reads the master side of a pseudo-terminal. Linux fails reads
+// with EIO once every process has closed the other side; ptyReader reports
+// that as EOF.
+type ptyReader struct {
+	console.Console
+}
+
+func (p *ptyReader) Read(b []byte) (int, error) {
+	n, err := p.Console.Read(b)
+	if errors.Is(err, syscall.EIO) {
+		return n, io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,85 @@
+package cg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePtySize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in      string
+		want    PtyInfo
+		wantErr string
+	}{
+		{in: "80x24", want: PtyInfo{Cols: 80, Rows: 24}},
+		{in: "200X50", want: PtyInfo{Cols: 200, Rows: 50}},
+		{in: "80", wantErr: "want COLSxROWS"},
+		{in: "x24", wantErr: "columns"},
+		{in: "80x0", wantErr: "rows: must be positive"},
+		{in: "80x70000", wantErr: "rows: value out of range"},
+		{in: "axb", wantErr: "columns: invalid syntax"},
+	}
+	for _, tt := range tests {
+		got, err := ParsePtySize(tt.in)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParsePtySize(%q) err = %v, want to contain %q", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePtySize(%q): %v", tt.in, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("ParsePtySize(%q) = %+v, want %+v", tt.in, *got, tt.want)
+		}
+	}
+}
+
+func TestRunCapturePty(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	size := &PtyInfo{Cols: 100, Rows: 30}
+	script := "test -t 0 && test -t 1 && echo tty; stty size; echo oops >&2; read x || echo eof"
+	run, err := RunCapture([]string{"sh", "-c", script}, nil, "", nil, CaptureOptions{Pty: size})
+	if err != nil {
+		t.Fatalf("RunCapture: %v", err)
+	}
+	waitDone(t, run, 5*time.Second)
+
+	// Both streams arrive on the terminal, and a read of it sees end-of-file
+	out, err := os.ReadFile(filepath.Join(run.Dir, "stdout"))
+	if err != nil {
+		t.Fatalf("read stdout: %v", err)
+	}
+	want := "tty\n30 100\noops\neof\n"
+	if string(out) != want {
+		t.Errorf("stdout = %q, want %q", out, want)
+	}
+
+	meta, err := ReadMeta(run.Dir)
+	if err != nil {
+		t.Fatalf("ReadMeta: %v", err)
+	}
+	if meta.Pty == nil || *meta.Pty != *size {
+		t.Errorf("Pty = %+v, want %+v", meta.Pty, size)
+	}
+	if meta.StdoutLines != 4 || meta.StderrLines != 0 {
+		t.Errorf("lines = out %d err %d, want out 4 err 0", meta.StdoutLines, meta.StderrLines)
+	}
+}
+
+func TestRunCapturePtyWithStdin(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	_, err := RunCapture([]string{"cat"}, nil, "", nil, CaptureOptions{Stdin: strings.NewReader("x"), Pty: &PtyInfo{Cols: 80, Rows: 24}})
+	if err == nil {
+		t.Fatal("expected error combining stdin and pty")
+	}
+}
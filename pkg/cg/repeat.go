@@ -0,0 +1,379 @@
+package cg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Repeat modes, as recorded in a RepeatSummary.
+const (
+	// RepeatModeRepeat makes every attempt, however each one ends.
+	RepeatModeRepeat = "repeat"
+	// RepeatModeRetry stops at the first attempt that passes.
+	RepeatModeRetry = "retry"
+)
+
+// Repeat describes a series of attempts at one command.
+type Repeat struct {
+	// Attempts is the most attempts to make.
+	Attempts int
+	// UntilSuccess stops the series at the first attempt that passes.
+	UntilSuccess bool
+	// RetryOn, when non-empty, also stops the series at a failed attempt
+	// whose exit code is not listed. It only applies with UntilSuccess.
+	RetryOn []int
+	// Backoff is how long to wait after a failed attempt before starting the
+	// next. The wait doubles with each further failure in a row, up to
+	// MaxBackoff when that is positive.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+func (r Repeat) mode() string {
+	if r.UntilSuccess {
+		return RepeatModeRetry
+	}
+	return RepeatModeRepeat
+}
+
+// again reports whether an attempt that ended as a did should be followed by
+// another, attempts permitting. An attempt that could not start ends the
+// series in either mode, as every later attempt would fail the same way.
+func (r Repeat) again(a AttemptResult) bool {
+	if a.StartError != "" {
+		return false
+	}
+	if !r.UntilSuccess {
+		return true
+	}
+	if a.Passed {
+		return false
+	}
+	return len(r.RetryOn) == 0 || slices.Contains(r.RetryOn, a.ExitCode)
+}
+
+// backoff returns the wait before the attempt that follows the given number
+// of failures in a row.
+func (r Repeat) backoff(failures int) time.Duration {
+	d := r.Backoff
+	for i := 1; i < failures && d < math.MaxInt64/2; i++ {
+		if r.MaxBackoff > 0 && d >= r.MaxBackoff {
+			break
+		}
+		d *= 2
+	}
+	if r.MaxBackoff > 0 {
+		d = min(d, r.MaxBackoff)
+	}
+	return d
+}
+
+// AttemptResult records how one attempt of a repeat ended.
+type AttemptResult struct {
+	ID string `json:"id"`
+	// Passed is set when the attempt exited 0 of its own accord.
+	Passed     bool  `json:"passed"`
+	ExitCode   int   `json:"exit_code"`
+	Signal     *int  `json:"signal,omitempty"`
+	DurationMs int64 `json:"duration_ms"`
+	TimedOut   bool  `json:"timed_out,omitempty"`
+	// StartError is set when the attempt could not be started.
+	StartError string `json:"start_error,omitempty"`
+}
+
+// attemptFromMeta summarises the finished attempt described by m.
+func attemptFromMeta(m *Meta) AttemptResult {
+	return AttemptResult{
+		ID:         m.ID,
+		Passed:     m.ExitCode == 0 && m.Signal == nil && !m.TimedOut,
+		ExitCode:   m.ExitCode,
+		Signal:     m.Signal,
+		DurationMs: m.DurationMs,
+		TimedOut:   m.TimedOut,
+	}
+}
+
+// RepeatSummary describes a finished series of attempts.
+type RepeatSummary struct {
+	Mode     string          `json:"mode"`
+	Attempts []AttemptResult `json:"attempts"`
+	Passed   int             `json:"passed"`
+	Failed   int             `json:"failed"`
+	// Flaky is set when the command both passed and failed.
+	Flaky bool `json:"flaky"`
+	// FirstFailure is the 1-based number of the first attempt that failed,
+	// or zero when none did.
+	FirstFailure int `json:"first_failure,omitempty"`
+	// Durations is absent when no attempt started.
+	Durations *DurationStats `json:"durations,omitempty"`
+}
+
+// DurationStats summarises how long the attempts of a repeat took. The
+// percentiles are nearest-rank, so each is the duration of some attempt.
+type DurationStats struct {
+	MinMs int64 `json:"min_ms"`
+	P50Ms int64 `json:"p50_ms"`
+	P90Ms int64 `json:"p90_ms"`
+	MaxMs int64 `json:"max_ms"`
+}
+
+// summarizeAttempts builds the summary of a series made in mode.
+func summarizeAttempts(mode string, attempts []AttemptResult) *RepeatSummary {
+	s := &RepeatSummary{Mode: mode, Attempts: attempts}
+	var durations []int64
+	for i, a := range attempts {
+		if a.Passed {
+			s.Passed++
+		} else {
+			s.Failed++
+			if s.FirstFailure == 0 {
+				s.FirstFailure = i + 1
+			}
+		}
+		if a.StartError == "" {
+			durations = append(durations, a.DurationMs)
+		}
+	}
+	s.Flaky = s.Passed > 0 && s.Failed > 0
+
+	if len(durations) > 0 {
+		slices.Sort(durations)
+		s.Durations = &DurationStats{
+			MinMs: durations[0],
+			P50Ms: percentile(durations, 0.5),
+			P90Ms: percentile(durations, 0.9),
+			MaxMs: durations[len(durations)-1],
+		}
+	}
+	return s
+}
+
+// percentile returns the nearest-rank p-quantile, for p in (0, 1], of the
+// non-empty sorted.
+func percentile(sorted []int64, p float64) int64 {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
+
+// Outcome returns the attempt that decides how the series as a whole ended:
+// the last attempt of a retry, and the first failed attempt of a repeat, or
+// its last attempt when every one passed. It returns nil when no attempt was
+// made.
+func (s *RepeatSummary) Outcome() *AttemptResult {
+	if len(s.Attempts) == 0 {
+		return nil
+	}
+	if s.Mode == RepeatModeRepeat && s.FirstFailure > 0 {
+		return &s.Attempts[s.FirstFailure-1]
+	}
+	return &s.Attempts[len(s.Attempts)-1]
+}
+
+// RepeatRun is an in-flight or completed repeat. Each attempt is a capture
+// run of its own, whose meta.json names the repeat as its parent. The
+// repeat's own run directory holds start.json while attempts are being made,
+// and then a meta.json that summarises them, taking its exit code and signal
+// from the deciding attempt. Done closes once that meta.json is written.
+type RepeatRun struct {
+	CaptureRun
+
+	mu      sync.Mutex
+	current string
+	stopped bool
+	sig     syscall.Signal
+	stop    chan struct{}
+}
+
+// Stop ends the series early: no further attempt starts, and the attempt in
+// flight, if any, has its process group sent sig.
+func (r *RepeatRun) Stop(sig syscall.Signal) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.stopped {
+		r.stopped = true
+		close(r.stop)
+	}
+	r.sig = sig
+	r.signalCurrent()
+}
+
+// track records dir as the run directory of the attempt in flight, or that
+// none is when dir is empty. An attempt that starts after Stop is sent the
+// stop signal straight away.
+func (r *RepeatRun) track(dir string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current = dir
+	if r.stopped {
+		r.signalCurrent()
+	}
+}
+
+// signalCurrent sends the stop signal to the attempt in flight. The caller
+// must hold r.mu.
+func (r *RepeatRun) signalCurrent() {
+	if r.current == "" {
+		return
+	}
+	if pid, err := ReadPidFile(r.current); err == nil {
+		_ = syscall.Kill(-pid, r.sig)
+	}
+}
+
+// RunRepeat makes up to rep.Attempts attempts at args, one after another,
+// each started as by RunCapture with opts. Every attempt is fed the same
+// stdin, which must therefore be seekable. RunRepeat returns once the
+// repeat's own run directory exists; a background goroutine makes the
+// attempts, writes the repeat's meta.json, and closes Done.
+//
+// onAttempt, when non-nil, is called from that goroutine as each attempt
+// starts, or with the error when it could not be started. The attempt after
+// it does not start until onAttempt returns.
+func RunRepeat(args []string, resolved *Resolution, cwd string, env map[string]string, opts CaptureOptions, rep Repeat, onAttempt func(n int, run *CaptureRun, err error)) (*RepeatRun, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("command is empty")
+	}
+	if rep.Attempts <= 0 {
+		return nil, fmt.Errorf("attempts must be positive")
+	}
+
+	var rewind func() error
+	if opts.Stdin != nil {
+		rs, ok := opts.Stdin.(io.Seeker)
+		if !ok {
+			return nil, fmt.Errorf("stdin must be seekable to feed it to every attempt")
+		}
+		off, err := rs.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, fmt.Errorf("stdin must be seekable to feed it to every attempt: %w", err)
+		}
+		rewind = func() error {
+			_, err := rs.Seek(off, io.SeekStart)
+			return err
+		}
+	}
+
+	if resolved == nil {
+		resolved, _ = ResolveCommand(args, cwd)
+	}
+
+	// The repeat's own run captures no output, but keeps the usual files so
+	// that every tool can read it like any other run
+	cap, err := NewCapture()
+	if err != nil {
+		return nil, err
+	}
+	_ = cap.Close()
+
+	start := time.Now()
+	_ = WriteStartInfo(cap.Dir, &StartInfo{Command: args, StartedAt: start.UTC(), Labels: opts.Labels, Note: opts.Note})
+
+	done := make(chan struct{})
+	r := &RepeatRun{
+		CaptureRun: CaptureRun{ID: cap.ID, Dir: cap.Dir, Done: done},
+		stop:       make(chan struct{}),
+	}
+	go func() {
+		defer close(done)
+		attempts := r.attempts(args, resolved, cwd, env, opts, rep, rewind, onAttempt)
+		elapsed := time.Since(start)
+
+		meta := &Meta{
+			ID:         cap.ID,
+			Command:    args,
+			StartedAt:  start.UTC(),
+			FinishedAt: start.Add(elapsed).UTC(),
+			DurationMs: elapsed.Milliseconds(),
+			Repeat:     summarizeAttempts(rep.mode(), attempts),
+			Labels:     opts.Labels,
+			Note:       opts.Note,
+		}
+		if o := meta.Repeat.Outcome(); o != nil {
+			meta.ExitCode = o.ExitCode
+			meta.Signal = o.Signal
+		}
+		_ = WriteMeta(cap.Dir, meta)
+		RemoveStartInfo(cap.Dir)
+	}()
+
+	return r, nil
+}
+
+// attempts makes the attempts of r in turn, returning how each one ended.
+func (r *RepeatRun) attempts(args []string, resolved *Resolution, cwd string, env map[string]string, opts CaptureOptions, rep Repeat, rewind func() error, onAttempt func(int, *CaptureRun, error)) []AttemptResult {
+	var (
+		results  []AttemptResult
+		failures int
+	)
+	opts.Parent = r.ID
+	for n := 1; n <= rep.Attempts; n++ {
+		select {
+		case <-r.stop:
+			return results
+		default:
+		}
+		if n > 1 && rewind != nil {
+			// An attempt fed the wrong input would not be a fair attempt, so
+			// it is recorded as one that could not start, ending the series.
+			if err := rewind(); err != nil {
+				err = fmt.Errorf("rewinding stdin: %w", err)
+				if onAttempt != nil {
+					onAttempt(n, nil, err)
+				}
+				return append(results, AttemptResult{ExitCode: ExitCodeFromError(err), StartError: err.Error()})
+			}
+		}
+
+		opts.Attempt = n
+		run, err := RunCapture(args, resolved, cwd, env, opts)
+		if err != nil {
+			if onAttempt != nil {
+				onAttempt(n, nil, err)
+			}
+			res := AttemptResult{ExitCode: ExitCodeFromError(err), StartError: err.Error()}
+			var sf *StartFailure
+			if errors.As(err, &sf) {
+				res.ID = sf.RunID
+			}
+			return append(results, res)
+		}
+
+		r.track(run.Dir)
+		if onAttempt != nil {
+			onAttempt(n, run, nil)
+		}
+		<-run.Done
+		r.track("")
+
+		res := AttemptResult{ID: run.ID, ExitCode: 1}
+		if m, err := ReadMeta(run.Dir); err == nil {
+			res = attemptFromMeta(m)
+		}
+		results = append(results, res)
+		if n == rep.Attempts || !rep.again(res) {
+			break
+		}
+
+		var wait time.Duration
+		if res.Passed {
+			failures = 0
+		} else {
+			failures++
+			wait = rep.backoff(failures)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-r.stop:
+			timer.Stop()
+			return results
+		case <-timer.C:
+		}
+	}
+	return results
+}
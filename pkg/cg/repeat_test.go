@@ -0,0 +1,302 @@
+package cg
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyScript passes on odd-numbered runs and exits 3 on even-numbered ones,
+// counting runs in a file in its working directory.
+const flakyScript = `n=$(cat count 2>/dev/null || echo 0); n=$((n+1)); echo $n > count; echo "run $n"; [ $((n % 2)) -eq 1 ] || exit 3`
+
+func TestSummarizeAttempts(t *testing.T) {
+	t.Parallel()
+
+	pass := func(ms int64) AttemptResult { return AttemptResult{Passed: true, DurationMs: ms} }
+	fail := func(ms int64) AttemptResult { return AttemptResult{ExitCode: 1, DurationMs: ms} }
+
+	tests := []struct {
+		name         string
+		attempts     []AttemptResult
+		passed       int
+		failed       int
+		flaky        bool
+		firstFailure int
+		durations    *DurationStats
+	}{
+		{
+			name:      "all pass",
+			attempts:  []AttemptResult{pass(10), pass(30), pass(20)},
+			passed:    3,
+			durations: &DurationStats{MinMs: 10, P50Ms: 20, P90Ms: 30, MaxMs: 30},
+		},
+		{
+			name:         "flaky",
+			attempts:     []AttemptResult{pass(5), fail(40), pass(10), fail(20)},
+			passed:       2,
+			failed:       2,
+			flaky:        true,
+			firstFailure: 2,
+			durations:    &DurationStats{MinMs: 5, P50Ms: 10, P90Ms: 40, MaxMs: 40},
+		},
+		{
+			name:         "start failure has no duration",
+			attempts:     []AttemptResult{{ExitCode: 127, StartError: "not found"}},
+			failed:       1,
+			firstFailure: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := summarizeAttempts(RepeatModeRepeat, tt.attempts)
+			if s.Passed != tt.passed || s.Failed != tt.failed || s.Flaky != tt.flaky || s.FirstFailure != tt.firstFailure {
+				t.Errorf("summary = passed %d failed %d flaky %t first %d; want %d %d %t %d",
+					s.Passed, s.Failed, s.Flaky, s.FirstFailure, tt.passed, tt.failed, tt.flaky, tt.firstFailure)
+			}
+			switch {
+			case tt.durations == nil && s.Durations != nil:
+				t.Errorf("Durations = %+v, want nil", s.Durations)
+			case tt.durations != nil && (s.Durations == nil || *s.Durations != *tt.durations):
+				t.Errorf("Durations = %+v, want %+v", s.Durations, tt.durations)
+			}
+		})
+	}
+}
+
+func TestRepeatSummaryOutcome(t *testing.T) {
+	t.Parallel()
+
+	attempts := []AttemptResult{{ID: "A", Passed: true}, {ID: "B", ExitCode: 1}, {ID: "C", Passed: true}}
+	if got := summarizeAttempts(RepeatModeRepeat, attempts).Outcome(); got.ID != "B" {
+		t.Errorf("repeat Outcome = %s, want the first failure B", got.ID)
+	}
+	if got := summarizeAttempts(RepeatModeRetry, attempts).Outcome(); got.ID != "C" {
+		t.Errorf("retry Outcome = %s, want the last attempt C", got.ID)
+	}
+	if got := summarizeAttempts(RepeatModeRepeat, attempts[:1]).Outcome(); got.ID != "A" {
+		t.Errorf("passing repeat Outcome = %s, want the last attempt A", got.ID)
+	}
+	if got := summarizeAttempts(RepeatModeRepeat, nil).Outcome(); got != nil {
+		t.Errorf("empty Outcome = %+v, want nil", got)
+	}
+}
+
+func TestRepeatAgain(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		rep  Repeat
+		a    AttemptResult
+		want bool
+	}{
+		{name: "repeat after pass", rep: Repeat{}, a: AttemptResult{Passed: true}, want: true},
+		{name: "repeat after failure", rep: Repeat{}, a: AttemptResult{ExitCode: 1}, want: true},
+		{name: "start failure", rep: Repeat{}, a: AttemptResult{ExitCode: 127, StartError: "x"}, want: false},
+		{name: "retry after pass", rep: Repeat{UntilSuccess: true}, a: AttemptResult{Passed: true}, want: false},
+		{name: "retry after failure", rep: Repeat{UntilSuccess: true}, a: AttemptResult{ExitCode: 1}, want: true},
+		{name: "retry on listed code", rep: Repeat{UntilSuccess: true, RetryOn: []int{1, 2}}, a: AttemptResult{ExitCode: 2}, want: true},
+		{name: "retry on unlisted code", rep: Repeat{UntilSuccess: true, RetryOn: []int{1, 2}}, a: AttemptResult{ExitCode: 3}, want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.rep.again(tt.a); got != tt.want {
+			t.Errorf("%s: again = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRepeatBackoff(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		rep      Repeat
+		failures int
+		want     time.Duration
+	}{
+		{rep: Repeat{}, failures: 3, want: 0},
+		{rep: Repeat{Backoff: time.Second}, failures: 1, want: time.Second},
+		{rep: Repeat{Backoff: time.Second}, failures: 3, want: 4 * time.Second},
+		{rep: Repeat{Backoff: time.Second, MaxBackoff: 3 * time.Second}, failures: 3, want: 3 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := tt.rep.backoff(tt.failures); got != tt.want {
+			t.Errorf("backoff(%+v, %d) = %v, want %v", tt.rep, tt.failures, got, tt.want)
+		}
+	}
+
+	if got := (Repeat{Backoff: time.Second}).backoff(100); got <= 0 {
+		t.Errorf("backoff after 100 failures = %v, want it not to overflow", got)
+	}
+}
+
+func TestRunRepeat(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	cwd := t.TempDir()
+
+	var started []int
+	rr, err := RunRepeat([]string{"sh", "-c", flakyScript}, nil, cwd, nil, CaptureOptions{}, Repeat{Attempts: 4}, func(n int, run *CaptureRun, err error) {
+		if err != nil {
+			t.Errorf("attempt %d: %v", n, err)
+			return
+		}
+		started = append(started, n)
+	})
+	if err != nil {
+		t.Fatalf("RunRepeat: %v", err)
+	}
+	waitDone(t, &rr.CaptureRun, 5*time.Second)
+
+	if len(started) != 4 {
+		t.Errorf("onAttempt called for %v, want 4 attempts", started)
+	}
+
+	meta, err := ReadMeta(rr.Dir)
+	if err != nil {
+		t.Fatalf("ReadMeta: %v", err)
+	}
+	s := meta.Repeat
+	if s == nil {
+		t.Fatalf("Repeat = nil, want a summary")
+	}
+	if s.Mode != RepeatModeRepeat || len(s.Attempts) != 4 || s.Passed != 2 || s.Failed != 2 || !s.Flaky || s.FirstFailure != 2 {
+		t.Errorf("summary = %+v, want 4 attempts, 2 passed, flaky, first failure 2", s)
+	}
+	if meta.ExitCode != 3 {
+		t.Errorf("ExitCode = %d, want 3 from the first failure", meta.ExitCode)
+	}
+	if _, err := os.Stat(filepath.Join(rr.Dir, StartFilename)); err == nil {
+		t.Errorf("start.json left behind in the finished repeat")
+	}
+
+	for i, a := range s.Attempts {
+		am, err := ReadMeta(filepath.Join(CaptureRoot(), a.ID))
+		if err != nil {
+			t.Fatalf("attempt %d: ReadMeta: %v", i+1, err)
+		}
+		if am.Parent != rr.ID || am.Attempt != i+1 {
+			t.Errorf("attempt %d: parent %q attempt %d, want %q %d", i+1, am.Parent, am.Attempt, rr.ID, i+1)
+		}
+	}
+}
+
+func TestRunRepeatUntilSuccess(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	tests := []struct {
+		name     string
+		script   string
+		rep      Repeat
+		attempts int
+		exitCode int
+	}{
+		{
+			name:     "stops at the first pass",
+			script:   `n=$(cat count 2>/dev/null || echo 0); n=$((n+1)); echo $n > count; [ $n -ge 3 ]`,
+			rep:      Repeat{Attempts: 5, UntilSuccess: true},
+			attempts: 3,
+		},
+		{
+			name:     "gives up after every attempt",
+			script:   "exit 2",
+			rep:      Repeat{Attempts: 3, UntilSuccess: true, Backoff: time.Millisecond},
+			attempts: 3,
+			exitCode: 2,
+		},
+		{
+			name:     "stops at an exit code not retried",
+			script:   "exit 4",
+			rep:      Repeat{Attempts: 3, UntilSuccess: true, RetryOn: []int{1, 2}},
+			attempts: 1,
+			exitCode: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr, err := RunRepeat([]string{"sh", "-c", tt.script}, nil, t.TempDir(), nil, CaptureOptions{}, tt.rep, nil)
+			if err != nil {
+				t.Fatalf("RunRepeat: %v", err)
+			}
+			waitDone(t, &rr.CaptureRun, 5*time.Second)
+
+			meta, err := ReadMeta(rr.Dir)
+			if err != nil {
+				t.Fatalf("ReadMeta: %v", err)
+			}
+			if got := len(meta.Repeat.Attempts); got != tt.attempts {
+				t.Errorf("attempts = %d, want %d", got, tt.attempts)
+			}
+			if meta.ExitCode != tt.exitCode {
+				t.Errorf("ExitCode = %d, want %d", meta.ExitCode, tt.exitCode)
+			}
+		})
+	}
+}
+
+func TestRunRepeatStdin(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	rr, err := RunRepeat([]string{"cat"}, nil, "", nil, CaptureOptions{Stdin: strings.NewReader("hi\n")}, Repeat{Attempts: 2}, nil)
+	if err != nil {
+		t.Fatalf("RunRepeat: %v", err)
+	}
+	waitDone(t, &rr.CaptureRun, 5*time.Second)
+
+	meta, err := ReadMeta(rr.Dir)
+	if err != nil {
+		t.Fatalf("ReadMeta: %v", err)
+	}
+	for i, a := range meta.Repeat.Attempts {
+		got, err := os.ReadFile(filepath.Join(CaptureRoot(), a.ID, "stdout"))
+		if err != nil {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+		if string(got) != "hi\n" {
+			t.Errorf("attempt %d: stdout = %q, want every attempt fed the same input", i+1, got)
+		}
+	}
+
+	// A failed rewind ends the series with an attempt that could not start
+	rr, err = RunRepeat([]string{"cat"}, nil, "", nil, CaptureOptions{Stdin: &rewindFailer{Reader: strings.NewReader("hi\n")}}, Repeat{Attempts: 3}, nil)
+	if err != nil {
+		t.Fatalf("RunRepeat: %v", err)
+	}
+	waitDone(t, &rr.CaptureRun, 5*time.Second)
+	meta, err = ReadMeta(rr.Dir)
+	if err != nil {
+		t.Fatalf("ReadMeta: %v", err)
+	}
+	if s := meta.Repeat; len(s.Attempts) != 2 || !strings.Contains(s.Attempts[1].StartError, "rewinding stdin: seek refused") || s.Failed != 1 {
+		t.Errorf("summary = %+v, want the second attempt to record the rewind failure", s)
+	}
+	if meta.ExitCode != 1 {
+		t.Errorf("ExitCode = %d, want 1 from the failed rewind", meta.ExitCode)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if _, err := RunRepeat([]string{"cat"}, nil, "", nil, CaptureOptions{Stdin: r}, Repeat{Attempts: 2}, nil); err == nil || !strings.Contains(err.Error(), "seekable") {
+		t.Errorf("RunRepeat with a pipe: err = %v, want a seekable error", err)
+	}
+}
+
+// rewindFailer is a reader whose only successful seek is the query of its
+// current offset.
+type rewindFailer struct {
+	*strings.Reader
+}
+
+func (r *rewindFailer) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekCurrent {
+		return r.Reader.Seek(offset, whence)
+	}
+	return 0, errors.New("seek refused")
+}
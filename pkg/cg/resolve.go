@@ -4,12 +4,16 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 	"time"
+	"unicode"
 
 	"github.com/spf13/cobra"
 )
@@ -99,9 +103,11 @@ func resolveRunDir(cmd *cobra.Command, id string) (string, error) {
 }
 
 // NewOutCommand returns the `cg out <ID>` subcommand. It prints the absolute
-// path of the captured stdout file.
+// path of the captured stdout file, or with --combined, both streams
+// interleaved in the order they were captured.
 func NewOutCommand() *cobra.Command {
-	return &cobra.Command{
+	var combined bool
+	c := &cobra.Command{
 		Use:           "out <ID>",
 		Short:         "Print the absolute path of a captured run's stdout file",
 		Args:          cobra.ExactArgs(1),
@@ -112,10 +118,21 @@ func NewOutCommand() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			fmt.Fprintln(cmd.OutOrStdout(), filepath.Join(dir, "stdout"))
-			return nil
+			if !combined {
+				fmt.Fprintln(cmd.OutOrStdout(), filepath.Join(dir, "stdout"))
+				return nil
+			}
+
+			err = RenderCombined(dir, cmd.OutOrStdout())
+			if errors.Is(err, ErrNoCombined) {
+				fmt.Fprintf(cmd.ErrOrStderr(), "no combined log: %s (missing %s)\n", args[0], CombinedFilename)
+				return &ExitError{Code: 1}
+			}
+			return err
 		},
 	}
+	c.Flags().BoolVar(&combined, "combined", false, "print stdout and stderr interleaved in capture order, annotated O: and E:, instead of the path")
+	return c
 }
 
 // NewErrCommand returns the `cg err <ID>` subcommand. It prints the absolute
@@ -164,10 +181,19 @@ func NewPathsCommand() *cobra.Command {
 // lsOptions holds flags for the `cg ls` subcommand.
 type lsOptions struct {
 	N int
+
+	Labels      []string
+	CommandGlob string
+	Exit        int
+	Since       string
+	Failed      bool
+
+	Verbose bool
 }
 
 // NewLsCommand returns the `cg ls` subcommand. It lists recent capture runs in
-// most-recent-first order by directory mtime.
+// most-recent-first order by directory mtime, optionally filtered by label,
+// command, exit code, start time or failure.
 func NewLsCommand() *cobra.Command {
 	opts := &lsOptions{}
 	c := &cobra.Command{
@@ -179,9 +205,38 @@ func NewLsCommand() *cobra.Command {
 		RunE:          opts.run,
 	}
 	c.Flags().IntVarP(&opts.N, "limit", "n", 20, "maximum number of runs to list")
+	c.Flags().StringArrayVar(&opts.Labels, "label", nil, "only list runs labelled key=value; repeatable, and every label must match")
+	c.Flags().StringVar(&opts.CommandGlob, "command-glob", "", "only list runs whose command, joined by spaces, matches this glob (* matches anything, ? one character)")
+	c.Flags().IntVar(&opts.Exit, "exit", 0, "only list finished runs that exited with this code")
+	c.Flags().StringVar(&opts.Since, "since", "", "only list runs started since a duration ago (such as 2h) or an RFC 3339 time")
+	c.Flags().BoolVar(&opts.Failed, "failed", false, "only list runs that failed to start, exited non-zero, were signalled or timed out")
+	c.Flags().BoolVarP(&opts.Verbose, "verbose", "v", false, "also show each run's labels and note")
 	return c
 }
 
+// filter builds the RunFilter the flags describe.
+func (opts *lsOptions) filter(cmd *cobra.Command, now time.Time) (*RunFilter, error) {
+	labels, err := ParseLabels(opts.Labels)
+	if err != nil {
+		return nil, fmt.Errorf("--label: %w", err)
+	}
+	f := &RunFilter{Labels: labels, Failed: opts.Failed}
+	if opts.CommandGlob != "" {
+		if f.Command, err = CompileGlob(opts.CommandGlob); err != nil {
+			return nil, fmt.Errorf("--command-glob: %w", err)
+		}
+	}
+	if cmd.Flags().Changed("exit") {
+		f.ExitCode = &opts.Exit
+	}
+	if opts.Since != "" {
+		if f.Since, err = ParseSince(opts.Since, now); err != nil {
+			return nil, fmt.Errorf("--since: %w", err)
+		}
+	}
+	return f, nil
+}
+
 type lsRow struct {
 	id    string
 	mtime time.Time
@@ -191,17 +246,44 @@ type lsRow struct {
 }
 
 func (opts *lsOptions) run(cmd *cobra.Command, args []string) error {
+	now := time.Now()
+	filter, err := opts.filter(cmd, now)
+	if err != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), err)
+		return &ExitError{Code: 2}
+	}
 	if opts.N <= 0 {
 		return nil
 	}
 
+	rows, err := scanRuns()
+	if err != nil {
+		return err
+	}
+	rows = slices.DeleteFunc(rows, func(r lsRow) bool {
+		return !filter.Match(r.meta, r.debug, r.start, r.mtime)
+	})
+	if len(rows) > opts.N {
+		rows = rows[:opts.N]
+	}
+
+	tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	for _, r := range rows {
+		fmt.Fprintln(tw, formatLsRow(r, now, opts.Verbose))
+	}
+	return tw.Flush()
+}
+
+// scanRuns reads every run directory under CaptureRoot, most-recent-first by
+// directory mtime. A missing capture root yields no runs.
+func scanRuns() ([]lsRow, error) {
 	root := CaptureRoot()
 	entries, err := os.ReadDir(root)
 	if errors.Is(err, fs.ErrNotExist) {
-		return nil
+		return nil, nil
 	}
 	if err != nil {
-		return fmt.Errorf("reading capture root: %w", err)
+		return nil, fmt.Errorf("reading capture root: %w", err)
 	}
 
 	rows := make([]lsRow, 0, len(entries))
@@ -214,54 +296,91 @@ func (opts *lsOptions) run(cmd *cobra.Command, args []string) error {
 		if err != nil {
 			continue
 		}
-		row := lsRow{id: name, mtime: info.ModTime()}
-		dir := filepath.Join(root, name)
-		if m, err := ReadMeta(dir); err == nil {
-			row.meta = m
-		} else if d, err := ReadStartDebug(dir); err == nil {
-			row.debug = d
-		} else if s, err := ReadStartInfo(dir); err == nil {
-			row.start = s
-		}
-		rows = append(rows, row)
+		rows = append(rows, readLsRow(name, filepath.Join(root, name), info.ModTime()))
 	}
 
 	sort.Slice(rows, func(i, j int) bool {
 		return rows[i].mtime.After(rows[j].mtime)
 	})
+	return rows, nil
+}
 
-	if len(rows) > opts.N {
-		rows = rows[:opts.N]
+// readLsRow reads whichever of meta.json, debug.json and start.json
+// describes the run in dir, in that order of preference.
+func readLsRow(id, dir string, mtime time.Time) lsRow {
+	row := lsRow{id: id, mtime: mtime}
+	if m, err := ReadMeta(dir); err == nil {
+		row.meta = m
+	} else if d, err := ReadStartDebug(dir); err == nil {
+		row.debug = d
+	} else if s, err := ReadStartInfo(dir); err == nil {
+		row.start = s
 	}
-
-	tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
-	now := time.Now()
-	for _, r := range rows {
-		fmt.Fprintln(tw, formatLsRow(r, now))
-	}
-	return tw.Flush()
+	return row
 }
 
-// formatLsRow renders one tab-separated ls row: id, status, duration, command.
-// Finished runs read their status and duration from meta.json; failed runs read
-// the command from debug.json; in-flight runs read the command from start.json
-// and show elapsed time measured against now. The caller aligns the columns
-// with a tabwriter.
-func formatLsRow(r lsRow, now time.Time) string {
-	if r.debug != nil {
-		return fmt.Sprintf("%s\tstart_failed\t?\t%s", r.id, EscapeArgs(r.debug.Command))
-	}
-	if r.meta != nil {
-		head := fmt.Sprintf("exit=%d", r.meta.ExitCode)
+// formatLsRow renders one tab-separated ls row: id, status, duration,
+// resources, command. Finished runs read their status, duration and resource
+// usage from meta.json; failed runs read the command from debug.json; in-flight
+// runs read the command from start.json and show elapsed time measured against
+// now. Resources are shown as ? when unknown. When verbose, the run's labels
+// and note are shown before the command, as - when it has none. The caller
+// aligns the columns with a tabwriter.
+func formatLsRow(r lsRow, now time.Time, verbose bool) string {
+	status, dur, res, command := "running", "?", "?", "?"
+	var (
+		labels map[string]string
+		note   string
+	)
+	switch {
+	case r.debug != nil:
+		status, command = "start_failed", EscapeArgs(r.debug.Command)
+		labels, note = r.debug.Labels, r.debug.Note
+	case r.meta != nil:
+		status = fmt.Sprintf("exit=%d", r.meta.ExitCode)
 		if r.meta.Signal != nil {
-			head = fmt.Sprintf("signal=%d", *r.meta.Signal)
+			status = fmt.Sprintf("signal=%d", *r.meta.Signal)
+		}
+		dur = formatDuration(time.Duration(r.meta.DurationMs) * time.Millisecond)
+		if r.meta.Resources != nil {
+			res = formatResources(r.meta.Resources)
 		}
-		dur := formatDuration(time.Duration(r.meta.DurationMs) * time.Millisecond)
-		return fmt.Sprintf("%s\t%s\t%s\t%s", r.id, head, dur, EscapeArgs(r.meta.Command))
+		command = EscapeArgs(r.meta.Command)
+		labels, note = r.meta.Labels, r.meta.Note
+	case r.start != nil:
+		dur = formatDuration(now.Sub(r.start.StartedAt))
+		command = EscapeArgs(r.start.Command)
+		labels, note = r.start.Labels, r.start.Note
 	}
-	if r.start != nil {
-		elapsed := formatDuration(now.Sub(r.start.StartedAt))
-		return fmt.Sprintf("%s\trunning\t%s\t%s", r.id, elapsed, EscapeArgs(r.start.Command))
+
+	if !verbose {
+		return fmt.Sprintf("%s\t%s\t%s\t%s\t%s", r.id, status, dur, res, command)
+	}
+	return fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s", r.id, status, dur, res, formatLabels(labels), formatNote(note), command)
+}
+
+// formatLabels renders labels as key=value pairs sorted by key and joined by
+// commas, or - when there are none. The whole is quoted when a key or value
+// would otherwise break the row.
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "-"
+	}
+	pairs := make([]string, 0, len(labels))
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		pairs = append(pairs, k+"="+labels[k])
+	}
+	s := strings.Join(pairs, ",")
+	if strings.ContainsFunc(s, func(r rune) bool { return unicode.IsSpace(r) || !unicode.IsPrint(r) || r == '"' }) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// formatNote renders a note quoted, or - when it is empty.
+func formatNote(note string) string {
+	if note == "" {
+		return "-"
 	}
-	return fmt.Sprintf("%s\trunning\t?\t?", r.id)
+	return strconv.Quote(note)
 }
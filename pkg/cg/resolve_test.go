@@ -229,13 +229,13 @@ func TestLsCommand(t *testing.T) {
 	}
 	// Columns are space-aligned by a tabwriter; status width is set by the widest
 	// cell ("running"), so the finished rows pad out to match.
-	if lines[0] != "AAAAAA  exit=0   12ms   echo new" {
+	if lines[0] != "AAAAAA  exit=0   12ms   ?  echo new" {
 		t.Errorf("line 0 = %q", lines[0])
 	}
-	if lines[1] != "CCCCCC  running  ?      ?" {
+	if lines[1] != "CCCCCC  running  ?      ?  ?" {
 		t.Errorf("line 1 = %q", lines[1])
 	}
-	if lines[2] != "BBBBBB  exit=2   1.23s  sh -c 'exit 2'" {
+	if lines[2] != "BBBBBB  exit=2   1.23s  ?  sh -c 'exit 2'" {
 		t.Errorf("line 2 = %q", lines[2])
 	}
 }
@@ -248,8 +248,8 @@ func TestFormatLsRowRunning(t *testing.T) {
 		id:    "DDDDDD",
 		start: &StartInfo{Command: []string{"sleep", "30"}, StartedAt: now.Add(-90 * time.Second)},
 	}
-	got := formatLsRow(row, now)
-	want := "DDDDDD\trunning\t1m30s\tsleep 30"
+	got := formatLsRow(row, now, false)
+	want := "DDDDDD\trunning\t1m30s\t?\tsleep 30"
 	if got != want {
 		t.Errorf("formatLsRow running = %q, want %q", got, want)
 	}
@@ -258,13 +258,45 @@ func TestFormatLsRowRunning(t *testing.T) {
 func TestFormatLsRowRunningNoStartInfo(t *testing.T) {
 	t.Parallel()
 
-	got := formatLsRow(lsRow{id: "EEEEEE"}, time.Now())
-	want := "EEEEEE\trunning\t?\t?"
+	got := formatLsRow(lsRow{id: "EEEEEE"}, time.Now(), false)
+	want := "EEEEEE\trunning\t?\t?\t?"
 	if got != want {
 		t.Errorf("formatLsRow running fallback = %q, want %q", got, want)
 	}
 }
 
+func TestFormatLsRowVerbose(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	tests := []struct {
+		row  lsRow
+		want string
+	}{
+		{
+			row:  lsRow{id: "AAAAAA", meta: &Meta{Command: []string{"make", "test"}, ExitCode: 2, Labels: map[string]string{"os": "linux", "branch": "x"}, Note: "after the refactor"}},
+			want: "AAAAAA\texit=2\t0s\t?\tbranch=x,os=linux\t\"after the refactor\"\tmake test",
+		},
+		{
+			row:  lsRow{id: "BBBBBB", debug: &StartDebug{Command: []string{"nope"}, Labels: map[string]string{"why": "a b"}}},
+			want: "BBBBBB\tstart_failed\t?\t?\t\"why=a b\"\t-\tnope",
+		},
+		{
+			row:  lsRow{id: "CCCCCC", start: &StartInfo{Command: []string{"sleep", "30"}, StartedAt: now, Note: "two\nlines"}},
+			want: "CCCCCC\trunning\t0s\t?\t-\t\"two\\nlines\"\tsleep 30",
+		},
+		{
+			row:  lsRow{id: "DDDDDD"},
+			want: "DDDDDD\trunning\t?\t?\t-\t-\t?",
+		},
+	}
+	for _, tt := range tests {
+		if got := formatLsRow(tt.row, now, true); got != tt.want {
+			t.Errorf("formatLsRow(%s) = %q, want %q", tt.row.id, got, tt.want)
+		}
+	}
+}
+
 func TestLsCommandLimit(t *testing.T) {
 	t.Setenv("TMPDIR", t.TempDir())
 	root := CaptureRoot()
@@ -339,7 +371,7 @@ func TestLsCommandSignaledMeta(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	want := "AAAAAA  signal=15  5ms  sleep 10\n"
+	want := "AAAAAA  signal=15  5ms  ?  sleep 10\n"
 	if stdout != want {
 		t.Errorf("stdout = %q, want %q", stdout, want)
 	}
@@ -0,0 +1,69 @@
+package cg
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// Resources is the resource usage of a finished child, as reported by the
+// kernel when it was reaped, along with the bytes it wrote to each stream.
+type Resources struct {
+	MaxRSSBytes            int64 `json:"max_rss_bytes"`
+	UserCPUMs              int64 `json:"user_cpu_ms"`
+	SystemCPUMs            int64 `json:"system_cpu_ms"`
+	VoluntaryCtxSwitches   int64 `json:"voluntary_ctx_switches"`
+	InvoluntaryCtxSwitches int64 `json:"involuntary_ctx_switches"`
+	StdoutBytes            int64 `json:"stdout_bytes"`
+	StderrBytes            int64 `json:"stderr_bytes"`
+}
+
+// resourcesFrom builds the Resources of a child from its process state and
+// stream byte counts. It returns nil if the child never ran.
+func resourcesFrom(ps *os.ProcessState, stdoutBytes, stderrBytes int64) *Resources {
+	if ps == nil {
+		return nil
+	}
+
+	r := &Resources{
+		UserCPUMs:   ps.UserTime().Milliseconds(),
+		SystemCPUMs: ps.SystemTime().Milliseconds(),
+		StdoutBytes: stdoutBytes,
+		StderrBytes: stderrBytes,
+	}
+	if ru, ok := ps.SysUsage().(*syscall.Rusage); ok && ru != nil {
+		// Linux reports the peak resident set in KiB; macOS in bytes
+		r.MaxRSSBytes = int64(ru.Maxrss)
+		if runtime.GOOS != "darwin" {
+			r.MaxRSSBytes *= 1024
+		}
+		r.VoluntaryCtxSwitches = int64(ru.Nvcsw)
+		r.InvoluntaryCtxSwitches = int64(ru.Nivcsw)
+	}
+	return r
+}
+
+// formatResources renders r as space-separated key=value pairs for the
+// finish summary and `cg ls`.
+func formatResources(r *Resources) string {
+	cpu := func(ms int64) string {
+		return formatDuration(time.Duration(ms) * time.Millisecond)
+	}
+	return fmt.Sprintf("rss=%s user=%s sys=%s", formatBytes(r.MaxRSSBytes), cpu(r.UserCPUMs), cpu(r.SystemCPUMs))
+}
+
+// formatBytes renders n in binary units, to one decimal place above KiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTP"[exp])
+}
@@ -0,0 +1,78 @@
+package cg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatBytes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1024, "1.0KiB"},
+		{1536, "1.5KiB"},
+		{9 * 1024 * 1024, "9.0MiB"},
+		{3 << 30, "3.0GiB"},
+		{5 << 50, "5.0PiB"},
+		{2048 << 50, "2048.0PiB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestFormatResources(t *testing.T) {
+	t.Parallel()
+
+	r := &Resources{MaxRSSBytes: 2 << 20, UserCPUMs: 1500, SystemCPUMs: 20}
+	want := "rss=2.0MiB user=1.5s sys=20ms"
+	if got := formatResources(r); got != want {
+		t.Errorf("formatResources = %q, want %q", got, want)
+	}
+}
+
+func TestResourcesFromNil(t *testing.T) {
+	t.Parallel()
+
+	if r := resourcesFrom(nil, 1, 2); r != nil {
+		t.Errorf("resourcesFrom(nil) = %+v, want nil", r)
+	}
+}
+
+func TestRunCaptureResources(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	run, err := RunCapture([]string{"sh", "-c", "echo hello; printf oops >&2"}, nil, "", nil, CaptureOptions{})
+	if err != nil {
+		t.Fatalf("RunCapture: %v", err)
+	}
+	waitDone(t, run, 5*time.Second)
+
+	meta, err := ReadMeta(run.Dir)
+	if err != nil {
+		t.Fatalf("ReadMeta: %v", err)
+	}
+	r := meta.Resources
+	if r == nil {
+		t.Fatal("Resources = nil, want populated")
+	}
+	if r.StdoutBytes != 6 {
+		t.Errorf("StdoutBytes = %d, want 6", r.StdoutBytes)
+	}
+	if r.StderrBytes != 4 {
+		t.Errorf("StderrBytes = %d, want 4", r.StderrBytes)
+	}
+	if r.MaxRSSBytes <= 0 {
+		t.Errorf("MaxRSSBytes = %d, want > 0", r.MaxRSSBytes)
+	}
+	if r.UserCPUMs < 0 || r.SystemCPUMs < 0 {
+		t.Errorf("CPU = user %dms sys %dms, want >= 0", r.UserCPUMs, r.SystemCPUMs)
+	}
+}
@@ -12,7 +12,7 @@ import (
 )
 
 // CaptureRun is an in-flight or completed capture. The on-disk layout matches
-// the shell --capture path: $TMPDIR/cg/<ID>/{stdout,stderr,meta.json}. Done
+// the shell --capture path: $TMPDIR/cg/<ID>/{stdout,stderr,combined.jsonl,meta.json}. Done
 // closes when the child exits and meta.json has been written.
 type CaptureRun struct {
 	ID   string
@@ -32,6 +32,27 @@ type StartFailure struct {
 func (e *StartFailure) Error() string { return e.Err.Error() }
 func (e *StartFailure) Unwrap() error { return e.Err }
 
+// CaptureOptions holds the optional settings of a RunCapture child.
+type CaptureOptions struct {
+	// Stdin, when non-nil, is fed to the child and its size and SHA-256
+	// recorded in meta.json; when nil the child reads from the null device. A
+	// caller-opened stdin file stays the caller's to close once Done closes.
+	Stdin io.Reader
+	// Pty, when non-nil, runs the child under a pseudo-terminal of that size,
+	// capturing the terminal stream as stdout. It cannot be combined with
+	// Stdin.
+	Pty *PtyInfo
+	// Timeout, when non-nil, bounds how long the child may run.
+	Timeout *Timeout
+	// Parent and Attempt, when set, record the run as an attempt of a repeat.
+	Parent  string
+	Attempt int
+	// Labels and Note are recorded in meta.json, or in debug.json if the
+	// child cannot be started.
+	Labels map[string]string
+	Note   string
+}
+
 // RunCapture starts args[0] with args[1:] under capture. stdout and stderr are
 // written to $TMPDIR/cg/<ID>/{stdout,stderr}. cwd is passed through; empty
 // inherits the caller's working directory. env entries are appended to
@@ -47,10 +68,13 @@ func (e *StartFailure) Unwrap() error { return e.Err }
 // The child runs in its own process group, so cancelling a caller's context
 // does not kill it. A background goroutine waits for the child, writes
 // meta.json, and closes Done.
-func RunCapture(args []string, resolved *Resolution, cwd string, env map[string]string) (*CaptureRun, error) {
+func RunCapture(args []string, resolved *Resolution, cwd string, env map[string]string, opts CaptureOptions) (*CaptureRun, error) {
 	if len(args) == 0 {
 		return nil, fmt.Errorf("command is empty")
 	}
+	if opts.Stdin != nil && opts.Pty != nil {
+		return nil, fmt.Errorf("stdin cannot be combined with a pseudo-terminal")
+	}
 
 	if resolved == nil {
 		resolved, _ = ResolveCommand(args, cwd)
@@ -61,33 +85,78 @@ func RunCapture(args []string, resolved *Resolution, cwd string, env map[string]
 		return nil, err
 	}
 
-	outCounter := &lineCountingWriter{w: cap.Stdout}
-	errCounter := &lineCountingWriter{w: cap.Stderr}
+	start := time.Now()
+	outW, errW := cap.Writers(start)
+	outCounter := &lineCountingWriter{w: outW}
+	errCounter := &lineCountingWriter{w: errW}
 
 	child := exec.Command(resolved.ExecPath(), args[1:]...)
 	child.Args[0] = args[0]
 	child.Dir = cwd
 	child.Stdout = outCounter
 	child.Stderr = errCounter
+	var stdinInfo func() *StdinInfo
+	if opts.Stdin != nil {
+		child.Stdin, stdinInfo = prepareStdin(opts.Stdin)
+	}
 	child.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 	if len(env) > 0 {
 		child.Env = mergeEnv(os.Environ(), env)
 	}
 
-	start := time.Now()
+	var (
+		term    io.ReadCloser
+		release func()
+	)
+	if opts.Pty != nil {
+		term, release, err = attachPty(child, opts.Pty)
+		if err != nil {
+			_ = cap.Close()
+			_ = WriteStartDebug(cap.Dir, buildStartDebug(args, cwd, env, resolved, opts, err))
+			return nil, &StartFailure{RunID: cap.ID, Dir: cap.Dir, Err: err}
+		}
+	}
+
 	if err := child.Start(); err != nil {
+		if term != nil {
+			release()
+			term.Close()
+		}
 		_ = cap.Close()
-		_ = WriteStartDebug(cap.Dir, buildStartDebug(args, cwd, env, resolved, err))
+		_ = WriteStartDebug(cap.Dir, buildStartDebug(args, cwd, env, resolved, opts, err))
 		return nil, &StartFailure{RunID: cap.ID, Dir: cap.Dir, Err: fmt.Errorf("starting child: %w", err)}
 	}
 
 	_ = WritePidFile(cap.Dir, child.Process.Pid)
 
+	stopTimeout := func() bool { return false }
+	if opts.Timeout != nil {
+		stopTimeout = opts.Timeout.watch(child.Process.Pid, start)
+	}
+
+	// The terminal stream is copied by hand, as exec.Cmd only copies the
+	// streams it was given as plain writers
+	copied := make(chan struct{})
+	if term != nil {
+		release()
+		go func() {
+			defer close(copied)
+			defer term.Close()
+			_, _ = io.Copy(outCounter, term)
+		}()
+	} else {
+		close(copied)
+	}
+
 	done := make(chan struct{})
 	go func() {
 		defer close(done)
 		waitErr := child.Wait()
+		timedOut := stopTimeout()
+		<-copied
 		elapsed := time.Since(start)
+		outW.Flush()
+		errW.Flush()
 		_ = cap.Close()
 
 		meta := &Meta{
@@ -99,7 +168,21 @@ func RunCapture(args []string, resolved *Resolution, cwd string, env map[string]
 			ExitCode:    ExitCodeFromError(waitErr),
 			StdoutLines: outCounter.n.Load(),
 			StderrLines: errCounter.n.Load(),
+			Resources:   resourcesFrom(child.ProcessState, outCounter.bytes.Load(), errCounter.bytes.Load()),
+		}
+		if stdinInfo != nil {
+			meta.Stdin = stdinInfo()
+		}
+		meta.Pty = opts.Pty
+		if opts.Timeout != nil {
+			deadline := opts.Timeout.deadline(start).UTC()
+			meta.Deadline = &deadline
+			meta.TimedOut = timedOut
 		}
+		meta.Parent = opts.Parent
+		meta.Attempt = opts.Attempt
+		meta.Labels = opts.Labels
+		meta.Note = opts.Note
 		if ws := exitStatus(child); ws != nil && ws.Signaled() {
 			sig := int(ws.Signal())
 			meta.Signal = &sig
@@ -111,15 +194,17 @@ func RunCapture(args []string, resolved *Resolution, cwd string, env map[string]
 	return &CaptureRun{ID: cap.ID, Dir: cap.Dir, Done: done}, nil
 }
 
-// lineCountingWriter wraps an io.Writer and counts '\n' bytes as they pass
-// through.
+// lineCountingWriter wraps an io.Writer and counts '\n' bytes, and all bytes,
+// as they pass through.
 type lineCountingWriter struct {
-	w io.Writer
-	n atomic.Int64
+	w     io.Writer
+	n     atomic.Int64
+	bytes atomic.Int64
 }
 
 func (lc *lineCountingWriter) Write(p []byte) (int, error) {
 	n, err := lc.w.Write(p)
+	lc.bytes.Add(int64(n))
 	for _, b := range p[:n] {
 		if b == '\n' {
 			lc.n.Add(1)
@@ -131,11 +216,14 @@ func (lc *lineCountingWriter) Write(p []byte) (int, error) {
 // buildStartDebug assembles the diagnostic payload written to debug.json when
 // child.Start fails. resolved carries the absolute resolved path and the
 // symlink-canonical path when they could be determined, so a post-mortem shows
-// both the original command and the file cg tried to exec.
-func buildStartDebug(args []string, cwd string, env map[string]string, resolved *Resolution, startErr error) *StartDebug {
+// both the original command and the file cg tried to exec. The labels and note
+// in opts are carried over, so the failed run can be found like any other.
+func buildStartDebug(args []string, cwd string, env map[string]string, resolved *Resolution, opts CaptureOptions, startErr error) *StartDebug {
 	d := &StartDebug{
 		Command:    args,
 		StartError: startErr.Error(),
+		Labels:     opts.Labels,
+		Note:       opts.Note,
 	}
 	if resolved != nil {
 		d.ResolvedPath = resolved.Resolved
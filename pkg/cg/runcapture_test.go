@@ -21,7 +21,7 @@ func waitDone(t *testing.T, run *CaptureRun, d time.Duration) {
 func TestRunCaptureEcho(t *testing.T) {
 	t.Setenv("TMPDIR", t.TempDir())
 
-	run, err := RunCapture([]string{"echo", "hello"}, nil, "", nil)
+	run, err := RunCapture([]string{"echo", "hello"}, nil, "", nil, CaptureOptions{})
 	if err != nil {
 		t.Fatalf("RunCapture: %v", err)
 	}
@@ -62,7 +62,7 @@ func TestRunCaptureEcho(t *testing.T) {
 func TestRunCaptureNonZeroExit(t *testing.T) {
 	t.Setenv("TMPDIR", t.TempDir())
 
-	run, err := RunCapture([]string{"sh", "-c", "exit 3"}, nil, "", nil)
+	run, err := RunCapture([]string{"sh", "-c", "exit 3"}, nil, "", nil, CaptureOptions{})
 	if err != nil {
 		t.Fatalf("RunCapture: %v", err)
 	}
@@ -80,7 +80,7 @@ func TestRunCaptureNonZeroExit(t *testing.T) {
 func TestRunCaptureStartError(t *testing.T) {
 	t.Setenv("TMPDIR", t.TempDir())
 
-	_, err := RunCapture([]string{"this-binary-does-not-exist-zzzz"}, nil, "", nil)
+	_, err := RunCapture([]string{"this-binary-does-not-exist-zzzz"}, nil, "", nil, CaptureOptions{})
 	if err == nil {
 		t.Fatalf("RunCapture: expected error, got nil")
 	}
@@ -101,7 +101,7 @@ func TestRunCaptureStartError(t *testing.T) {
 }
 
 func TestRunCaptureEmptyCommand(t *testing.T) {
-	if _, err := RunCapture(nil, nil, "", nil); err == nil {
+	if _, err := RunCapture(nil, nil, "", nil, CaptureOptions{}); err == nil {
 		t.Fatalf("expected error for empty command")
 	}
 }
@@ -109,7 +109,7 @@ func TestRunCaptureEmptyCommand(t *testing.T) {
 func TestRunCaptureEnv(t *testing.T) {
 	t.Setenv("TMPDIR", t.TempDir())
 
-	run, err := RunCapture([]string{"sh", "-c", "echo $CG_TEST_KEY"}, nil, "", map[string]string{"CG_TEST_KEY": "from-mcp"})
+	run, err := RunCapture([]string{"sh", "-c", "echo $CG_TEST_KEY"}, nil, "", map[string]string{"CG_TEST_KEY": "from-mcp"}, CaptureOptions{})
 	if err != nil {
 		t.Fatalf("RunCapture: %v", err)
 	}
@@ -128,7 +128,7 @@ func TestRunCaptureEnvOverride(t *testing.T) {
 	t.Setenv("TMPDIR", t.TempDir())
 	t.Setenv("CG_OVERRIDE_ME", "parent-value")
 
-	run, err := RunCapture([]string{"sh", "-c", "echo $CG_OVERRIDE_ME"}, nil, "", map[string]string{"CG_OVERRIDE_ME": "child-value"})
+	run, err := RunCapture([]string{"sh", "-c", "echo $CG_OVERRIDE_ME"}, nil, "", map[string]string{"CG_OVERRIDE_ME": "child-value"}, CaptureOptions{})
 	if err != nil {
 		t.Fatalf("RunCapture: %v", err)
 	}
@@ -147,7 +147,7 @@ func TestRunCaptureCwd(t *testing.T) {
 	t.Setenv("TMPDIR", t.TempDir())
 
 	dir := t.TempDir()
-	run, err := RunCapture([]string{"pwd"}, nil, dir, nil)
+	run, err := RunCapture([]string{"pwd"}, nil, dir, nil, CaptureOptions{})
 	if err != nil {
 		t.Fatalf("RunCapture: %v", err)
 	}
@@ -174,7 +174,7 @@ func TestRunCaptureCwd(t *testing.T) {
 func TestRunCaptureStderr(t *testing.T) {
 	t.Setenv("TMPDIR", t.TempDir())
 
-	run, err := RunCapture([]string{"sh", "-c", "echo only-err >&2"}, nil, "", nil)
+	run, err := RunCapture([]string{"sh", "-c", "echo only-err >&2"}, nil, "", nil, CaptureOptions{})
 	if err != nil {
 		t.Fatalf("RunCapture: %v", err)
 	}
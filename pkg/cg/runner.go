@@ -1,11 +1,13 @@
 package cg
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"os/signal"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -16,17 +18,19 @@ import (
 	"github.com/ripta/rt/pkg/version"
 )
 
-// lineCountingReader wraps an io.Reader and counts '\n' bytes as they pass
-// through. The counter is intended to be read after the reader has been fully
-// drained, but uses atomic operations so callers can sample it earlier if
-// needed.
+// lineCountingReader wraps an io.Reader and counts '\n' bytes, and all bytes,
+// as they pass through. The counters are intended to be read after the reader
+// has been fully drained, but use atomic operations so callers can sample them
+// earlier if needed.
 type lineCountingReader struct {
-	r io.Reader
-	n atomic.Int64
+	r     io.Reader
+	n     atomic.Int64
+	bytes atomic.Int64
 }
 
 func (lc *lineCountingReader) Read(p []byte) (int, error) {
 	n, err := lc.r.Read(p)
+	lc.bytes.Add(int64(n))
 	for _, b := range p[:n] {
 		if b == '\n' {
 			lc.n.Add(1)
@@ -63,6 +67,23 @@ func formatFinish(code int, signaled bool, sig int, d time.Duration, outLines, e
 	return line
 }
 
+// formatRepeatSummary builds the line that ends a series of attempts: how
+// many passed and failed, whether the command is flaky, which attempt failed
+// first, and the spread of attempt durations. id is the series' own run.
+func formatRepeatSummary(s *RepeatSummary, id string) string {
+	line := fmt.Sprintf("Summary attempts=%d passed=%d failed=%d flaky=%t", len(s.Attempts), s.Passed, s.Failed, s.Flaky)
+	if s.FirstFailure > 0 {
+		line += fmt.Sprintf(" first_failure=%d", s.FirstFailure)
+	}
+	if d := s.Durations; d != nil {
+		ms := func(n int64) string {
+			return formatDuration(time.Duration(n) * time.Millisecond)
+		}
+		line += fmt.Sprintf(" min=%s p50=%s p90=%s max=%s", ms(d.MinMs), ms(d.P50Ms), ms(d.P90Ms), ms(d.MaxMs))
+	}
+	return line + " id=" + id
+}
+
 func (opts *Options) run(cmd *cobra.Command, args []string) error {
 	if len(args) == 0 {
 		_ = cmd.Usage()
@@ -138,26 +159,77 @@ func (opts *Options) run(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	if opts.repeating() {
+		return opts.runRepeat(cmd, args, w)
+	}
+
 	child := exec.CommandContext(cmd.Context(), args[0], args[1:]...)
 	child.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
-	stdout, err := child.StdoutPipe()
-	if err != nil {
-		return fmt.Errorf("creating stdout pipe: %w", err)
+	var stdinInfo func() *StdinInfo
+	if opts.StdinFile != "" {
+		f := os.Stdin
+		if opts.StdinFile != "-" {
+			var err error
+			f, err = os.Open(opts.StdinFile)
+			if err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "opening --stdin-file: %s\n", err)
+				return &ExitError{Code: 2}
+			}
+			defer f.Close()
+		}
+		child.Stdin = f
+		if opts.Capture {
+			child.Stdin, stdinInfo = prepareStdin(f)
+		}
 	}
 
-	stderr, err := child.StderrPipe()
-	if err != nil {
-		return fmt.Errorf("creating stderr pipe: %w", err)
+	var (
+		stdout, stderr io.Reader
+		ptyInfo        *PtyInfo
+		release        func()
+	)
+	if opts.Pty {
+		// Validated by validateFlags
+		ptyInfo, _ = ParsePtySize(opts.PtySize)
+		term, rel, err := attachPty(child, ptyInfo)
+		if err != nil {
+			return err
+		}
+		defer term.Close()
+		// Everything the child writes arrives on the terminal, as stdout
+		stdout, stderr, release = term, strings.NewReader(""), rel
+	} else {
+		out, err := child.StdoutPipe()
+		if err != nil {
+			return fmt.Errorf("creating stdout pipe: %w", err)
+		}
+
+		errp, err := child.StderrPipe()
+		if err != nil {
+			return fmt.Errorf("creating stderr pipe: %w", err)
+		}
+		stdout, stderr, release = out, errp, func() {}
 	}
 
 	start := time.Now()
-	if err := child.Start(); err != nil {
+	err := child.Start()
+	release()
+	if err != nil {
 		code := ExitCodeFromError(err)
 		_ = writeInfo(formatFinish(code, false, 0, time.Since(start), 0, 0, ""))
 		return &ExitError{Code: code}
 	}
 
+	timeout := opts.timeout()
+	stopTimeout := func() bool { return false }
+	if timeout != nil {
+		stopTimeout = timeout.watch(child.Process.Pid, start)
+	}
+
+	// Validated by validateFlags
+	labels, _ := ParseLabels(opts.Labels)
+
 	var cap *Capture
 	if opts.Capture {
 		cap, err = NewCapture()
@@ -169,7 +241,7 @@ func (opts *Options) run(cmd *cobra.Command, args []string) error {
 		defer cap.Close()
 
 		_ = WritePidFile(cap.Dir, child.Process.Pid)
-		_ = WriteStartInfo(cap.Dir, &StartInfo{Command: args, StartedAt: start.UTC()})
+		_ = WriteStartInfo(cap.Dir, &StartInfo{Command: args, StartedAt: start.UTC(), Labels: labels, Note: opts.Note})
 
 		if opts.Verbose {
 			if err := writeInfo(fmt.Sprintf("capture.stdout=%s", cap.Stdout.Name())); err != nil {
@@ -198,6 +270,11 @@ func (opts *Options) run(cmd *cobra.Command, args []string) error {
 	outCounter := &lineCountingReader{r: stdout}
 	errCounter := &lineCountingReader{r: stderr}
 
+	var outW, errW *CombinedWriter
+	if cap != nil {
+		outW, errW = cap.Writers(start)
+	}
+
 	var wg sync.WaitGroup
 	wg.Add(2)
 
@@ -205,20 +282,20 @@ func (opts *Options) run(cmd *cobra.Command, args []string) error {
 	case cap != nil && buf != nil:
 		go func() {
 			defer wg.Done()
-			_ = buf.WriteLines(io.TeeReader(outCounter, cap.Stdout), IndicatorOut)
+			_ = buf.WriteLines(io.TeeReader(outCounter, outW), IndicatorOut)
 		}()
 		go func() {
 			defer wg.Done()
-			_ = buf.WriteLines(io.TeeReader(errCounter, cap.Stderr), IndicatorErr)
+			_ = buf.WriteLines(io.TeeReader(errCounter, errW), IndicatorErr)
 		}()
 	case cap != nil:
 		go func() {
 			defer wg.Done()
-			_, _ = io.Copy(cap.Stdout, outCounter)
+			_, _ = io.Copy(outW, outCounter)
 		}()
 		go func() {
 			defer wg.Done()
-			_, _ = io.Copy(cap.Stderr, errCounter)
+			_, _ = io.Copy(errW, errCounter)
 		}()
 	case buf != nil:
 		go func() {
@@ -241,10 +318,15 @@ func (opts *Options) run(cmd *cobra.Command, args []string) error {
 	}
 
 	wg.Wait()
+	if cap != nil {
+		outW.Flush()
+		errW.Flush()
+	}
 
 	waitErr := child.Wait()
 	elapsed := time.Since(start)
 	code := ExitCodeFromError(waitErr)
+	timedOut := stopTimeout()
 
 	if buf != nil {
 		if err := buf.Flush(w); err != nil {
@@ -266,7 +348,15 @@ func (opts *Options) run(cmd *cobra.Command, args []string) error {
 	if signaled {
 		sig = int(ws.Signal())
 	}
-	_ = writeInfo(formatFinish(code, signaled, sig, elapsed, outLines, errLines, id))
+	res := resourcesFrom(child.ProcessState, outCounter.bytes.Load(), errCounter.bytes.Load())
+	finish := formatFinish(code, signaled, sig, elapsed, outLines, errLines, id)
+	if timedOut {
+		finish += " timeout=" + formatDuration(timeout.After)
+	}
+	if opts.Verbose && res != nil {
+		finish += " " + formatResources(res)
+	}
+	_ = writeInfo(finish)
 
 	if cap != nil {
 		meta := &Meta{
@@ -278,6 +368,18 @@ func (opts *Options) run(cmd *cobra.Command, args []string) error {
 			ExitCode:    code,
 			StdoutLines: outLines,
 			StderrLines: errLines,
+			Resources:   res,
+		}
+		if stdinInfo != nil {
+			meta.Stdin = stdinInfo()
+		}
+		meta.Pty = ptyInfo
+		meta.Labels = labels
+		meta.Note = opts.Note
+		if timeout != nil {
+			deadline := timeout.deadline(start).UTC()
+			meta.Deadline = &deadline
+			meta.TimedOut = timedOut
 		}
 		if signaled {
 			meta.Signal = &sig
@@ -289,9 +391,91 @@ func (opts *Options) run(cmd *cobra.Command, args []string) error {
 		RemoveStartInfo(cap.Dir)
 	}
 
+	if timedOut {
+		return &ExitError{Code: TimeoutExitCode}
+	}
 	if code != 0 {
 		return &ExitError{Code: code}
 	}
 
 	return nil
 }
+
+// runRepeat runs args as the series of attempts the flags describe, each
+// captured as its own run. It prints each attempt's output and Finished line
+// as the attempt runs, then a Summary of the series, and exits as the
+// deciding attempt did.
+func (opts *Options) runRepeat(cmd *cobra.Command, args []string, w *AnnotatedWriter) error {
+	writeInfo := func(msg string) error {
+		return w.WriteLine(IndicatorInfo, msg)
+	}
+
+	// Validated by validateFlags
+	labels, _ := ParseLabels(opts.Labels)
+	copts := CaptureOptions{Timeout: opts.timeout(), Labels: labels, Note: opts.Note}
+	if opts.StdinFile != "" {
+		f, err := os.Open(opts.StdinFile)
+		if err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "opening --stdin-file: %s\n", err)
+			return &ExitError{Code: 2}
+		}
+		defer f.Close()
+		copts.Stdin = f
+	}
+	if opts.Pty {
+		// Validated by validateFlags
+		copts.Pty, _ = ParsePtySize(opts.PtySize)
+	}
+
+	rr, err := RunRepeat(args, nil, "", nil, copts, opts.repeat(), func(n int, run *CaptureRun, err error) {
+		if err != nil {
+			var id string
+			var sf *StartFailure
+			if errors.As(err, &sf) {
+				id = sf.RunID
+			}
+			_ = writeInfo(formatFinish(ExitCodeFromError(err), false, 0, 0, 0, 0, id) + fmt.Sprintf(" attempt=%d", n))
+			return
+		}
+		_ = TailRun(cmd.Context(), run.Dir, TailPollInterval, writeTailLine(w, opts.Format))
+		<-run.Done
+		if meta, err := ReadMeta(run.Dir); err == nil {
+			_ = writeInfo(formatMetaFinish(meta, opts.Verbose))
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer func() {
+		signal.Stop(sigCh)
+		close(sigCh)
+	}()
+
+	go func() {
+		for sig := range sigCh {
+			// Forward the signal to the attempt in flight, and start no more
+			rr.Stop(sig.(syscall.Signal))
+		}
+	}()
+
+	<-rr.Done
+	meta, err := ReadMeta(rr.Dir)
+	if err != nil {
+		return fmt.Errorf("reading repeat summary: %w", err)
+	}
+	_ = writeInfo(formatRepeatSummary(meta.Repeat, rr.ID))
+
+	o := meta.Repeat.Outcome()
+	switch {
+	case o == nil:
+		return nil
+	case o.TimedOut:
+		return &ExitError{Code: TimeoutExitCode}
+	case o.ExitCode != 0:
+		return &ExitError{Code: o.ExitCode}
+	}
+	return nil
+}
@@ -341,6 +341,26 @@ func TestCommandExitCodePropagation(t *testing.T) {
 	}
 }
 
+func TestCommandTimeoutExitCode(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	// A child that exits cleanly on the timeout signal still reports 124
+	out, err := runCgCommand("--timeout", "100ms", "--", "sh", "-c", "trap 'exit 0' TERM; sleep 5 & wait")
+
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expected *ExitError, got %T: %v", err, err)
+	}
+	if exitErr.Code != TimeoutExitCode {
+		t.Errorf("exit code = %d, want %d", exitErr.Code, TimeoutExitCode)
+	}
+	if !strings.Contains(out, "Finished exitcode=0 in ") || !strings.Contains(out, " timeout=100ms") {
+		t.Errorf("output missing timeout finish message, got: %q", out)
+	}
+}
+
 func TestCommandPartialLine(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration test")
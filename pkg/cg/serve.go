@@ -0,0 +1,301 @@
+package cg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// DefaultServeAddr is the address `cg serve` listens on by default.
+const DefaultServeAddr = "127.0.0.1:7480"
+
+// defaultServeLimit is the number of runs GET /runs returns when no limit is
+// given.
+const defaultServeLimit = 20
+
+// Run states reported by `cg serve`, matching those of cg_list.
+const (
+	serveStateRunning  = "running"
+	serveStateFinished = "finished"
+	serveStateFailed   = "failed"
+)
+
+// serveOptions holds flags for the `cg serve` subcommand.
+type serveOptions struct {
+	Addr string
+}
+
+// NewServeCommand returns the `cg serve` subcommand. It serves the capture
+// runs under CaptureRoot over HTTP on a loopback address:
+//
+//	GET /runs               recent runs, most-recent-first; ?limit=N
+//	GET /runs/{id}          a single run's state and metadata
+//	GET /runs/{id}/events   a Server-Sent Events stream of the run's lines
+func NewServeCommand() *cobra.Command {
+	opts := &serveOptions{}
+	c := &cobra.Command{
+		Use:           "serve",
+		Short:         "Serve capture runs over loopback HTTP, with a live event stream per run",
+		Args:          cobra.NoArgs,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE:          opts.run,
+	}
+	c.Flags().StringVar(&opts.Addr, "addr", DefaultServeAddr, "loopback address to listen on")
+	return c
+}
+
+func (opts *serveOptions) run(cmd *cobra.Command, args []string) error {
+	if err := checkLoopback(opts.Addr); err != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), err)
+		return &ExitError{Code: 2}
+	}
+
+	ln, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		return fmt.Errorf("listening: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Event streams last as long as their runs, so they are tied to ctx
+	// rather than left for Shutdown to wait on
+	srv := &http.Server{
+		Handler:           NewServeHandler(TailPollInterval),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "serving %s on http://%s\n", CaptureRoot(), ln.Addr())
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// checkLoopback returns an error unless addr is a host:port whose host is
+// localhost or a loopback IP. Captured output can hold anything the child
+// printed, so it is never served beyond the local machine.
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid --addr %q: %w", addr, err)
+	}
+	if isLoopbackHost(host) {
+		return nil
+	}
+	return fmt.Errorf("invalid --addr %q: must be a loopback address", addr)
+}
+
+// isLoopbackHost reports whether host, without a port, is localhost or a
+// loopback IP.
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// requireLoopbackHost rejects requests whose Host header does not name a
+// loopback host. Listening on loopback alone does not keep a web page from
+// reading the runs: a name that it controls can be rebound to 127.0.0.1, and
+// its requests then carry that name as their Host.
+func requireLoopbackHost(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		if !isLoopbackHost(host) {
+			http.Error(w, fmt.Sprintf("invalid Host %q: must be a loopback host", r.Host), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serveRun is a run as reported by `cg serve`. Only ID and State are always
+// present; Meta is set for finished runs, StartError for failed ones.
+type serveRun struct {
+	ID         string     `json:"id"`
+	State      string     `json:"state"`
+	Command    []string   `json:"command,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	Meta       *Meta      `json:"meta,omitempty"`
+	StartError string     `json:"start_error,omitempty"`
+}
+
+func newServeRun(r lsRow) serveRun {
+	switch {
+	case r.meta != nil:
+		started := r.meta.StartedAt
+		return serveRun{ID: r.id, State: serveStateFinished, Command: r.meta.Command, StartedAt: &started, Meta: r.meta}
+	case r.debug != nil:
+		started := r.mtime
+		return serveRun{ID: r.id, State: serveStateFailed, Command: r.debug.Command, StartedAt: &started, StartError: r.debug.StartError}
+	case r.start != nil:
+		started := r.start.StartedAt
+		return serveRun{ID: r.id, State: serveStateRunning, Command: r.start.Command, StartedAt: &started}
+	}
+	started := r.mtime
+	return serveRun{ID: r.id, State: serveStateRunning, StartedAt: &started}
+}
+
+// serveLine is the data of a `line` event.
+type serveLine struct {
+	Stream  string    `json:"stream"`
+	Time    time.Time `json:"time"`
+	Line    int64     `json:"line"`
+	Text    string    `json:"text"`
+	Partial bool      `json:"partial,omitempty"`
+}
+
+// serveHandler serves the capture runs under CaptureRoot.
+type serveHandler struct {
+	interval time.Duration
+}
+
+// NewServeHandler returns the HTTP handler behind `cg serve`. Event streams
+// poll in-flight runs for new output every interval.
+func NewServeHandler(interval time.Duration) http.Handler {
+	h := &serveHandler{interval: interval}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /runs", h.handleRuns)
+	mux.HandleFunc("GET /runs/{id}", h.handleRun)
+	mux.HandleFunc("GET /runs/{id}/events", h.handleEvents)
+	return requireLoopbackHost(mux)
+}
+
+func (h *serveHandler) handleRuns(w http.ResponseWriter, r *http.Request) {
+	limit := defaultServeLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, fmt.Sprintf("invalid limit %q", s), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	rows, err := scanRuns()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(rows) > limit {
+		rows = rows[:limit]
+	}
+
+	runs := make([]serveRun, len(rows))
+	for i, row := range rows {
+		runs[i] = newServeRun(row)
+	}
+	writeJSON(w, runs)
+}
+
+func (h *serveHandler) handleRun(w http.ResponseWriter, r *http.Request) {
+	row, ok := lookupServeRun(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	writeJSON(w, newServeRun(row))
+}
+
+// handleEvents streams the run's lines as `line` events, following an
+// in-flight run as it writes, and ends with a `finished` event carrying the
+// run's final state.
+func (h *serveHandler) handleEvents(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, ok := lookupServeRun(w, id); !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	dir, _ := LookupRunDir(id)
+	err := TailRun(r.Context(), dir, h.interval, func(l TailLine) error {
+		ev := serveLine{Stream: string(rune(l.Stream)), Time: l.Time.UTC(), Line: l.Number, Text: l.Text, Partial: l.Partial}
+		if err := writeEvent(w, "line", ev); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return
+	}
+	_ = writeEvent(w, "finished", newServeRun(readLsRow(id, dir, info.ModTime())))
+	flusher.Flush()
+}
+
+// lookupServeRun reads the run with the given id, writing a 404 and
+// returning false if there is no such run.
+func lookupServeRun(w http.ResponseWriter, id string) (lsRow, bool) {
+	dir, err := LookupRunDir(id)
+	if err != nil && !errors.Is(err, ErrIncompleteRun) && !errors.Is(err, ErrFailedRun) {
+		if errors.Is(err, ErrUnknownRunID) {
+			http.Error(w, fmt.Sprintf("unknown run id: %s", id), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return lsRow{}, false
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return lsRow{}, false
+	}
+	return readLsRow(id, dir, info.ModTime()), true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+// writeEvent writes one Server-Sent Event whose data is v as a single line of
+// JSON.
+func writeEvent(w http.ResponseWriter, event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
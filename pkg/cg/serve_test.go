@@ -0,0 +1,221 @@
+package cg
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckLoopback(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		addr    string
+		wantErr bool
+	}{
+		{addr: "127.0.0.1:7480"},
+		{addr: "[::1]:0"},
+		{addr: "localhost:8080"},
+		{addr: "127.1.2.3:80"},
+		{addr: ":7480", wantErr: true},
+		{addr: "0.0.0.0:7480", wantErr: true},
+		{addr: "192.168.1.10:7480", wantErr: true},
+		{addr: "example.com:80", wantErr: true},
+		{addr: "127.0.0.1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			err := checkLoopback(tt.addr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkLoopback(%q) = %v, wantErr %v", tt.addr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// sseEvent is one parsed Server-Sent Event.
+type sseEvent struct {
+	name string
+	data string
+}
+
+// readEvents parses Server-Sent Events from r until it is closed.
+func readEvents(t *testing.T, r io.Reader) []sseEvent {
+	t.Helper()
+
+	var events []sseEvent
+	var ev sseEvent
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			events = append(events, ev)
+			ev = sseEvent{}
+		case strings.HasPrefix(line, "event: "):
+			ev.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			ev.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatalf("reading events: %v", err)
+	}
+	return events
+}
+
+func getJSON(t *testing.T, url string, v any) int {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("decoding %s: %v", url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestServeRejectsForeignHost(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	h := NewServeHandler(time.Millisecond)
+	tests := []struct {
+		host string
+		want int
+	}{
+		{host: "127.0.0.1:7480", want: http.StatusOK},
+		{host: "localhost:7480", want: http.StatusOK},
+		{host: "[::1]:7480", want: http.StatusOK},
+		{host: "localhost", want: http.StatusOK},
+		{host: "rebound.example:7480", want: http.StatusForbidden},
+		{host: "rebound.example", want: http.StatusForbidden},
+		{host: "192.168.1.10:7480", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/runs", nil)
+		req.Host = tt.host
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("GET /runs with Host %q = %d, want %d", tt.host, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestServeRuns(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	seedRunDir(t, "AAAAAA", &Meta{ID: "AAAAAA", Command: []string{"echo", "a"}, ExitCode: 3})
+	running := seedRunDir(t, "BBBBBB", nil)
+	if err := WriteStartInfo(running, &StartInfo{Command: []string{"sleep", "9"}, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("WriteStartInfo: %v", err)
+	}
+	chtimes(t, running, time.Now().Add(time.Hour))
+
+	srv := httptest.NewServer(NewServeHandler(time.Millisecond))
+	defer srv.Close()
+
+	var runs []serveRun
+	if code := getJSON(t, srv.URL+"/runs", &runs); code != http.StatusOK {
+		t.Fatalf("GET /runs = %d", code)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("got %d runs, want 2: %+v", len(runs), runs)
+	}
+	if runs[0].ID != "BBBBBB" || runs[0].State != serveStateRunning || runs[0].Command[0] != "sleep" {
+		t.Errorf("runs[0] = %+v, want running BBBBBB", runs[0])
+	}
+	if runs[1].ID != "AAAAAA" || runs[1].State != serveStateFinished || runs[1].Meta == nil || runs[1].Meta.ExitCode != 3 {
+		t.Errorf("runs[1] = %+v, want finished AAAAAA with exit code 3", runs[1])
+	}
+
+	if code := getJSON(t, srv.URL+"/runs?limit=1", &runs); code != http.StatusOK || len(runs) != 1 {
+		t.Errorf("GET /runs?limit=1 = %d with %d runs, want 1 run", code, len(runs))
+	}
+	if code := getJSON(t, srv.URL+"/runs?limit=x", &runs); code != http.StatusBadRequest {
+		t.Errorf("GET /runs?limit=x = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	var run serveRun
+	if code := getJSON(t, srv.URL+"/runs/AAAAAA", &run); code != http.StatusOK || run.ID != "AAAAAA" {
+		t.Errorf("GET /runs/AAAAAA = %d %+v", code, run)
+	}
+	if code := getJSON(t, srv.URL+"/runs/ZZZZZZ", &run); code != http.StatusNotFound {
+		t.Errorf("GET /runs/ZZZZZZ = %d, want %d", code, http.StatusNotFound)
+	}
+	if code := getJSON(t, srv.URL+"/runs/ZZZZZZ/events", &run); code != http.StatusNotFound {
+		t.Errorf("GET /runs/ZZZZZZ/events = %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestServeEvents(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	dir := seedRunDir(t, "AAAAAA", nil)
+	appendFile(t, dir, "stdout", "building\n")
+
+	srv := httptest.NewServer(NewServeHandler(time.Millisecond))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/runs/AAAAAA/events")
+	if err != nil {
+		t.Fatalf("GET events: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	// The stream follows the run until it finishes
+	appendFile(t, dir, "stderr", "warning\n")
+	appendFile(t, dir, "stdout", "done")
+	if err := WriteMeta(dir, &Meta{ID: "AAAAAA", ExitCode: 1}); err != nil {
+		t.Fatalf("WriteMeta: %v", err)
+	}
+
+	events := readEvents(t, resp.Body)
+	if len(events) != 4 {
+		t.Fatalf("got %d events, want 4: %+v", len(events), events)
+	}
+
+	want := []serveLine{
+		{Stream: "O", Line: 1, Text: "building"},
+		{Stream: "E", Line: 1, Text: "warning"},
+		{Stream: "O", Line: 2, Text: "done", Partial: true},
+	}
+	for i, w := range want {
+		if events[i].name != "line" {
+			t.Fatalf("event %d is %q, want line", i, events[i].name)
+		}
+		var got serveLine
+		if err := json.Unmarshal([]byte(events[i].data), &got); err != nil {
+			t.Fatalf("decoding event %d: %v", i, err)
+		}
+		if got.Time.IsZero() {
+			t.Errorf("event %d has no time", i)
+		}
+		got.Time = time.Time{}
+		if got != w {
+			t.Errorf("event %d = %+v, want %+v", i, got, w)
+		}
+	}
+
+	var fin serveRun
+	if events[3].name != "finished" {
+		t.Fatalf("last event is %q, want finished", events[3].name)
+	}
+	if err := json.Unmarshal([]byte(events[3].data), &fin); err != nil {
+		t.Fatalf("decoding finished event: %v", err)
+	}
+	if fin.State != serveStateFinished || fin.Meta == nil || fin.Meta.ExitCode != 1 {
+		t.Errorf("finished = %+v, want finished with exit code 1", fin)
+	}
+}
@@ -18,8 +18,10 @@ const StartFilename = "start.json"
 // child has finished. It lets `cg ls` and cg_list surface the command and a
 // precise elapsed time for a run that is still going.
 type StartInfo struct {
-	Command   []string  `json:"command"`
-	StartedAt time.Time `json:"started_at"`
+	Command   []string          `json:"command"`
+	StartedAt time.Time         `json:"started_at"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Note      string            `json:"note,omitempty"`
 }
 
 // WriteStartInfo serialises s and writes it to dir/start.json.
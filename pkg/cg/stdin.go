@@ -0,0 +1,75 @@
+package cg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+)
+
+// StdinInfo identifies the input fed to a child, so that a run can be
+// reproduced with the same bytes.
+type StdinInfo struct {
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+	// File is the path the input was read from, if it came from a file.
+	File string `json:"file,omitempty"`
+}
+
+// prepareStdin returns the reader to hand the child as stdin, and a function
+// that reports what was fed to it once the child has exited. A seekable
+// input, such as a regular file or an in-memory buffer, is hashed in full up
+// front and rewound, so the record covers the whole input even if the child
+// stops reading early. Any other input is hashed as the child consumes it.
+func prepareStdin(r io.Reader) (io.Reader, func() *StdinInfo) {
+	var file string
+	if f, ok := r.(*os.File); ok {
+		file = f.Name()
+	}
+
+	if rs, ok := r.(io.ReadSeeker); ok {
+		if info, err := digestSeeker(rs); err == nil {
+			info.File = file
+			return r, func() *StdinInfo { return info }
+		}
+	}
+
+	hr := &hashingReader{r: r, h: sha256.New()}
+	return hr, func() *StdinInfo {
+		return &StdinInfo{Bytes: hr.n, SHA256: hex.EncodeToString(hr.h.Sum(nil)), File: file}
+	}
+}
+
+// digestSeeker hashes rs from its current offset to EOF, then seeks back.
+func digestSeeker(rs io.ReadSeeker) (*StdinInfo, error) {
+	off, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(h, rs)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := rs.Seek(off, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return &StdinInfo{Bytes: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// hashingReader hashes and counts the bytes read through it. It is only read
+// by the goroutine exec.Cmd starts to copy stdin, and only inspected after the
+// child has been waited for.
+type hashingReader struct {
+	r io.Reader
+	h hash.Hash
+	n int64
+}
+
+func (hr *hashingReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	hr.h.Write(p[:n])
+	hr.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,132 @@
+package cg
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sha256 of "hello\n"
+const helloSHA256 = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+
+func TestPrepareStdinSeekable(t *testing.T) {
+	t.Parallel()
+
+	r := strings.NewReader("hello\n")
+	got, info := prepareStdin(r)
+	if got != io.Reader(r) {
+		t.Errorf("prepareStdin wrapped a seekable reader")
+	}
+
+	// The digest covers the whole input before the child reads any of it
+	want := StdinInfo{Bytes: 6, SHA256: helloSHA256}
+	if i := info(); *i != want {
+		t.Errorf("info = %+v, want %+v", *i, want)
+	}
+	data, err := io.ReadAll(got)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(data) != "hello\n" {
+		t.Errorf("rewound input = %q, want %q", data, "hello\n")
+	}
+}
+
+func TestPrepareStdinStream(t *testing.T) {
+	t.Parallel()
+
+	got, info := prepareStdin(io.MultiReader(bytes.NewBufferString("hel"), strings.NewReader("lo\n")))
+	if _, err := io.Copy(io.Discard, got); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	want := StdinInfo{Bytes: 6, SHA256: helloSHA256}
+	if i := info(); *i != want {
+		t.Errorf("info = %+v, want %+v", *i, want)
+	}
+}
+
+func TestRunCaptureStdin(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	run, err := RunCapture([]string{"cat"}, nil, "", nil, CaptureOptions{Stdin: strings.NewReader("hello\n")})
+	if err != nil {
+		t.Fatalf("RunCapture: %v", err)
+	}
+	waitDone(t, run, 5*time.Second)
+
+	out, err := os.ReadFile(filepath.Join(run.Dir, "stdout"))
+	if err != nil {
+		t.Fatalf("read stdout: %v", err)
+	}
+	if string(out) != "hello\n" {
+		t.Errorf("stdout = %q, want %q", out, "hello\n")
+	}
+
+	meta, err := ReadMeta(run.Dir)
+	if err != nil {
+		t.Fatalf("ReadMeta: %v", err)
+	}
+	want := StdinInfo{Bytes: 6, SHA256: helloSHA256}
+	if meta.Stdin == nil || *meta.Stdin != want {
+		t.Errorf("Stdin = %+v, want %+v", meta.Stdin, want)
+	}
+}
+
+func TestRunCaptureStdinFile(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	path := filepath.Join(t.TempDir(), "in.txt")
+	if err := os.WriteFile(path, []byte("hello\n"), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open input: %v", err)
+	}
+	defer f.Close()
+
+	run, err := RunCapture([]string{"wc", "-c"}, nil, "", nil, CaptureOptions{Stdin: f})
+	if err != nil {
+		t.Fatalf("RunCapture: %v", err)
+	}
+	waitDone(t, run, 5*time.Second)
+
+	out, err := os.ReadFile(filepath.Join(run.Dir, "stdout"))
+	if err != nil {
+		t.Fatalf("read stdout: %v", err)
+	}
+	if strings.TrimSpace(string(out)) != "6" {
+		t.Errorf("stdout = %q, want 6", out)
+	}
+
+	meta, err := ReadMeta(run.Dir)
+	if err != nil {
+		t.Fatalf("ReadMeta: %v", err)
+	}
+	want := StdinInfo{Bytes: 6, SHA256: helloSHA256, File: path}
+	if meta.Stdin == nil || *meta.Stdin != want {
+		t.Errorf("Stdin = %+v, want %+v", meta.Stdin, want)
+	}
+}
+
+func TestRunCaptureNoStdin(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	run, err := RunCapture([]string{"cat"}, nil, "", nil, CaptureOptions{})
+	if err != nil {
+		t.Fatalf("RunCapture: %v", err)
+	}
+	waitDone(t, run, 5*time.Second)
+
+	meta, err := ReadMeta(run.Dir)
+	if err != nil {
+		t.Fatalf("ReadMeta: %v", err)
+	}
+	if meta.Stdin != nil {
+		t.Errorf("Stdin = %+v, want nil", meta.Stdin)
+	}
+}
@@ -0,0 +1,165 @@
+package cg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TailPollInterval is how often TailRun checks a run's captured files for new
+// output and for the run having finished.
+const TailPollInterval = 100 * time.Millisecond
+
+// tailReadSize is the size of each read from a captured file.
+const tailReadSize = 32 * 1024
+
+// TailLine is one line of a run's captured output.
+type TailLine struct {
+	Stream Indicator
+	// Time is when the line was read. For a line written while the run is
+	// being tailed, this is within a poll interval of when the child wrote
+	// it; for output already on disk, it is when tailing began.
+	Time time.Time
+	// Number is the line's 1-based position within its stream.
+	Number int64
+	// Text is the line without its trailing newline.
+	Text string
+	// Partial is set on a stream's final line when it has no trailing
+	// newline.
+	Partial bool
+}
+
+// TailRun reads the captured stdout and stderr of the run in dir, calling fn
+// for each complete line in the order it is read. It works on in-flight runs:
+// it polls every interval for new output until meta.json or debug.json
+// appears, then reads what remains, reports any unterminated final lines as
+// partial, and returns nil. Lines are interleaved between the streams only as
+// finely as the polling allows.
+//
+// TailRun returns ctx.Err() if ctx is done first, or the first error returned
+// by fn.
+func TailRun(ctx context.Context, dir string, interval time.Duration, fn func(TailLine) error) error {
+	streams := []*tailStream{
+		{ind: IndicatorOut, path: filepath.Join(dir, "stdout")},
+		{ind: IndicatorErr, path: filepath.Join(dir, "stderr")},
+	}
+	defer func() {
+		for _, s := range streams {
+			s.close()
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Check for the end of the run before reading, so that the read
+		// which follows is guaranteed to see all of the output
+		done := runFinished(dir)
+		for _, s := range streams {
+			if err := s.poll(time.Now(), fn); err != nil {
+				return err
+			}
+		}
+		if done {
+			for _, s := range streams {
+				if err := s.flush(time.Now(), fn); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// runFinished reports whether the run in dir has finished or failed to
+// start.
+func runFinished(dir string) bool {
+	for _, name := range []string{MetaFilename, DebugFilename} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// tailStream follows one captured file, holding back an incomplete final
+// line until the rest of it is written.
+type tailStream struct {
+	ind     Indicator
+	path    string
+	f       *os.File
+	partial []byte
+	n       int64
+}
+
+// poll reads whatever has been appended to the file since the last poll and
+// calls fn for each line it completes. A file that does not exist yet is
+// treated as empty.
+func (s *tailStream) poll(now time.Time, fn func(TailLine) error) error {
+	if s.f == nil {
+		f, err := os.Open(s.path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.f = f
+	}
+
+	buf := make([]byte, tailReadSize)
+	for {
+		n, err := s.f.Read(buf)
+		s.partial = append(s.partial, buf[:n]...)
+		for {
+			i := bytes.IndexByte(s.partial, '\n')
+			if i < 0 {
+				break
+			}
+			s.n++
+			if ferr := fn(TailLine{Stream: s.ind, Time: now, Number: s.n, Text: string(s.partial[:i])}); ferr != nil {
+				return ferr
+			}
+			s.partial = s.partial[i+1:]
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+	}
+}
+
+// flush reports the unterminated final line, if any.
+func (s *tailStream) flush(now time.Time, fn func(TailLine) error) error {
+	if len(s.partial) == 0 {
+		return nil
+	}
+	s.n++
+	line := TailLine{Stream: s.ind, Time: now, Number: s.n, Text: string(s.partial), Partial: true}
+	s.partial = nil
+	return fn(line)
+}
+
+func (s *tailStream) close() {
+	if s.f != nil {
+		_ = s.f.Close()
+	}
+}
@@ -0,0 +1,123 @@
+package cg
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// appendFile appends data to dir/name, creating it if needed.
+func appendFile(t *testing.T, dir, name, data string) {
+	t.Helper()
+	f, err := os.OpenFile(filepath.Join(dir, name), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("opening %s: %v", name, err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatalf("writing %s: %v", name, err)
+	}
+}
+
+func TestTailRunFinished(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	dir := seedRunDir(t, "AAAAAA", &Meta{ID: "AAAAAA"})
+	appendFile(t, dir, "stdout", "one\ntwo\nthree")
+	appendFile(t, dir, "stderr", "oops\n")
+
+	var got []TailLine
+	err := TailRun(context.Background(), dir, time.Millisecond, func(l TailLine) error {
+		got = append(got, l)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("TailRun: %v", err)
+	}
+
+	want := []TailLine{
+		{Stream: IndicatorOut, Number: 1, Text: "one"},
+		{Stream: IndicatorOut, Number: 2, Text: "two"},
+		{Stream: IndicatorErr, Number: 1, Text: "oops"},
+		{Stream: IndicatorOut, Number: 3, Text: "three", Partial: true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		got[i].Time = time.Time{}
+		if got[i] != want[i] {
+			t.Errorf("line %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestTailRunInFlight(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	dir := seedRunDir(t, "AAAAAA", nil)
+	appendFile(t, dir, "stdout", "first\nsec")
+
+	lines := make(chan TailLine, 10)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- TailRun(context.Background(), dir, time.Millisecond, func(l TailLine) error {
+			lines <- l
+			return nil
+		})
+	}()
+
+	if l := <-lines; l.Text != "first" {
+		t.Fatalf("first line = %q, want %q", l.Text, "first")
+	}
+
+	// The rest of a line written in two parts arrives as one line
+	appendFile(t, dir, "stdout", "ond\n")
+	if l := <-lines; l.Text != "second" || l.Number != 2 || l.Partial {
+		t.Fatalf("second line = %+v, want complete line 2 %q", l, "second")
+	}
+
+	appendFile(t, dir, "stderr", "last\n")
+	if err := WriteMeta(dir, &Meta{ID: "AAAAAA"}); err != nil {
+		t.Fatalf("WriteMeta: %v", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("TailRun: %v", err)
+	}
+	if l := <-lines; l.Stream != IndicatorErr || l.Text != "last" {
+		t.Fatalf("final line = %+v, want stderr %q", l, "last")
+	}
+}
+
+func TestTailRunCancelled(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	dir := seedRunDir(t, "AAAAAA", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := TailRun(ctx, dir, time.Millisecond, func(TailLine) error { return nil })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("TailRun = %v, want context.Canceled", err)
+	}
+}
+
+func TestTailRunReadError(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	dir := seedRunDir(t, "AAAAAA", nil)
+
+	// A directory opens, but reading it fails
+	stdout := filepath.Join(dir, "stdout")
+	if err := os.Remove(stdout); err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(stdout, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	err := TailRun(ctx, dir, time.Millisecond, func(TailLine) error { return nil })
+	if err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("TailRun = %v, want the read error", err)
+	}
+}
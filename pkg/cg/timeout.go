@@ -0,0 +1,103 @@
+package cg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// TimeoutExitCode is what the shell runner exits with when its child ran out
+// of time, as timeout(1) does.
+const TimeoutExitCode = 124
+
+// maxSignalNumber bounds numeric signal inputs. Real signal numbers fit well
+// under this; the cap rejects obvious garbage without enumerating every
+// platform's signal table.
+const maxSignalNumber = 64
+
+// ParseSignal maps a signal name or numeric string onto a syscall.Signal. An
+// empty input returns def. Accepted names are SIGTERM, SIGINT, and SIGKILL;
+// numeric values in (0, maxSignalNumber] are accepted directly, which covers
+// signals like SIGQUIT without enumerating every name.
+func ParseSignal(name string, def syscall.Signal) (syscall.Signal, error) {
+	s := strings.TrimSpace(name)
+	if s == "" {
+		return def, nil
+	}
+	switch strings.ToUpper(s) {
+	case "SIGTERM":
+		return syscall.SIGTERM, nil
+	case "SIGINT":
+		return syscall.SIGINT, nil
+	case "SIGKILL":
+		return syscall.SIGKILL, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		if n <= 0 || n > maxSignalNumber {
+			return 0, fmt.Errorf("numeric signal out of range: %d", n)
+		}
+		return syscall.Signal(n), nil
+	}
+	return 0, fmt.Errorf("unsupported signal: %q (want SIGTERM, SIGINT, SIGKILL, or a number)", name)
+}
+
+// Timeout bounds how long a child may run.
+type Timeout struct {
+	// After is how long the child may run before it is sent Signal.
+	After time.Duration
+	// Signal is sent to the child's process group once After has elapsed.
+	Signal syscall.Signal
+	// KillAfter, when positive, is how long to wait after Signal before
+	// sending SIGKILL to a process group that is still running.
+	KillAfter time.Duration
+}
+
+// deadline returns when a child started at start runs out of time.
+func (t *Timeout) deadline(start time.Time) time.Time {
+	return start.Add(t.After)
+}
+
+// watch enforces t on the process group led by pid, which started at start.
+// The caller calls the returned stop once the child has been waited for; stop
+// ends the watch and reports whether the child ran out of time.
+func (t *Timeout) watch(pid int, start time.Time) (stop func() bool) {
+	var (
+		fired   bool
+		stopped = make(chan struct{})
+		done    = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		timer := time.NewTimer(time.Until(t.deadline(start)))
+		defer timer.Stop()
+		select {
+		case <-stopped:
+			return
+		case <-timer.C:
+		}
+
+		// A group that is already gone exited on its own, just in time
+		if err := syscall.Kill(-pid, t.Signal); err != nil {
+			return
+		}
+		fired = true
+		if t.KillAfter <= 0 {
+			return
+		}
+
+		timer.Reset(t.KillAfter)
+		select {
+		case <-stopped:
+		case <-timer.C:
+			_ = syscall.Kill(-pid, syscall.SIGKILL)
+		}
+	}()
+
+	return func() bool {
+		close(stopped)
+		<-done
+		return fired
+	}
+}
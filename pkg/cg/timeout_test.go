@@ -0,0 +1,110 @@
+package cg
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseSignal(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in      string
+		want    syscall.Signal
+		wantErr string
+	}{
+		{in: "", want: syscall.SIGHUP},
+		{in: "SIGTERM", want: syscall.SIGTERM},
+		{in: "sigint", want: syscall.SIGINT},
+		{in: " SIGKILL ", want: syscall.SIGKILL},
+		{in: "3", want: syscall.SIGQUIT},
+		{in: "0", wantErr: "out of range"},
+		{in: "65", wantErr: "out of range"},
+		{in: "TERM", wantErr: "unsupported signal"},
+	}
+	for _, tt := range tests {
+		got, err := ParseSignal(tt.in, syscall.SIGHUP)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseSignal(%q) err = %v, want to contain %q", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseSignal(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestRunCaptureTimeout(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	timeout := &Timeout{After: 100 * time.Millisecond, Signal: syscall.SIGTERM}
+	run, err := RunCapture([]string{"sleep", "5"}, nil, "", nil, CaptureOptions{Timeout: timeout})
+	if err != nil {
+		t.Fatalf("RunCapture: %v", err)
+	}
+	waitDone(t, run, 3*time.Second)
+
+	meta, err := ReadMeta(run.Dir)
+	if err != nil {
+		t.Fatalf("ReadMeta: %v", err)
+	}
+	if !meta.TimedOut {
+		t.Errorf("TimedOut = false, want true")
+	}
+	if meta.Signal == nil || *meta.Signal != int(syscall.SIGTERM) {
+		t.Errorf("Signal = %v, want SIGTERM", meta.Signal)
+	}
+	if meta.Deadline == nil || !meta.Deadline.Equal(meta.StartedAt.Add(100*time.Millisecond)) {
+		t.Errorf("Deadline = %v, want 100ms after %v", meta.Deadline, meta.StartedAt)
+	}
+}
+
+func TestRunCaptureTimeoutKillAfter(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	// The child ignores the timeout signal, so only SIGKILL ends it
+	timeout := &Timeout{After: 100 * time.Millisecond, Signal: syscall.SIGTERM, KillAfter: 100 * time.Millisecond}
+	script := `trap "" TERM; echo ready; while :; do sleep 0.05; done`
+	run, err := RunCapture([]string{"sh", "-c", script}, nil, "", nil, CaptureOptions{Timeout: timeout})
+	if err != nil {
+		t.Fatalf("RunCapture: %v", err)
+	}
+	waitDone(t, run, 3*time.Second)
+
+	meta, err := ReadMeta(run.Dir)
+	if err != nil {
+		t.Fatalf("ReadMeta: %v", err)
+	}
+	if !meta.TimedOut {
+		t.Errorf("TimedOut = false, want true")
+	}
+	if meta.Signal == nil || *meta.Signal != int(syscall.SIGKILL) {
+		t.Errorf("Signal = %v, want SIGKILL", meta.Signal)
+	}
+}
+
+func TestRunCaptureWithinTimeout(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	timeout := &Timeout{After: 5 * time.Second, Signal: syscall.SIGTERM}
+	run, err := RunCapture([]string{"true"}, nil, "", nil, CaptureOptions{Timeout: timeout})
+	if err != nil {
+		t.Fatalf("RunCapture: %v", err)
+	}
+	waitDone(t, run, 3*time.Second)
+
+	meta, err := ReadMeta(run.Dir)
+	if err != nil {
+		t.Fatalf("ReadMeta: %v", err)
+	}
+	if meta.TimedOut || meta.ExitCode != 0 {
+		t.Errorf("TimedOut = %v, ExitCode = %d; want false, 0", meta.TimedOut, meta.ExitCode)
+	}
+	if meta.Deadline == nil {
+		t.Errorf("Deadline = nil, want it recorded")
+	}
+}